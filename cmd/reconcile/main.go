@@ -0,0 +1,48 @@
+// Command reconcile recomputes users' token balances from the tokens ledger.
+// By default it only reports drift; pass -fix to overwrite drifted balances.
+// It exits with status 1 if drift was found and not fixed.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/ledger"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "overwrite drifted balances with the ledger sums")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("FATAL: Error loading .env file: %v", err)
+	}
+
+	ctx := context.Background()
+	database, err := db.NewDB(ctx)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	drifts, err := ledger.Reconcile(ctx, database.Queries, *fix)
+	if err != nil {
+		log.Fatalf("Failed to reconcile token balances: %v", err)
+	}
+
+	switch {
+	case len(drifts) == 0:
+		log.Println("INFO: All token balances match the ledger")
+	case *fix:
+		log.Printf("INFO: Reconciled %d token balances", len(drifts))
+	default:
+		log.Printf("WARN: %d token balances differ from the ledger, run with -fix to reconcile them", len(drifts))
+		database.Close()
+		os.Exit(1)
+	}
+}
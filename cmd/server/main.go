@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -105,12 +106,13 @@ func main() {
 	}
 	defer database.Close()
 
-	// Initialize Gemini client
-	geminiClient, err := gemini.NewClient()
+	// Initialize the quiz generator (provider and model come from LLM_PROVIDER / LLM_MODEL)
+	generator, err := gemini.NewGenerator(gemini.ConfigFromEnv())
 	if err != nil {
-		log.Fatalf("Failed to initialize Gemini client: %v", err)
+		log.Fatalf("Failed to initialize quiz generator: %v", err)
 	}
-	defer geminiClient.Close()
+	defer generator.Close()
+	log.Printf("INFO: Using quiz generator %s", generator.Name())
 
 	// Set up Gin router
 	router := gin.Default()
@@ -162,9 +164,12 @@ func main() {
 	router.Use(sessions.Sessions(storeName, store))
 
 	// Set up API handlers
-	handler := handlers.NewHandler(GoogleOauthConfig, storeName, database, geminiClient) // Use NewHandler from handlers package
+	handler := handlers.NewHandler(GoogleOauthConfig, storeName, database, generator) // Use NewHandler from handlers package
 	api.SetupRoutes(router, handler)
 
+	// Start the background quiz generation workers
+	handler.StartGenerationWorkers(ctx, envInt("GENERATION_WORKERS", 2), envInt("GENERATION_QUEUE_SIZE", 100))
+
 	// Get port from environment variable or use default
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -176,6 +181,8 @@ func main() {
 		Addr:    ":" + port,
 		Handler: router,
 	}
+	// Progress streams stay open until their job ends, so they are closed when shutdown begins
+	server.RegisterOnShutdown(handler.CloseStreams)
 
 	// Start server in a goroutine
 	go func() {
@@ -185,6 +192,21 @@ func main() {
 		}
 	}()
 
+	// Metrics get their own listener, e.g. METRICS_ADDR=127.0.0.1:9090, reachable only from inside
+	var metricsServer *http.Server
+	if metricsAddr := os.Getenv("METRICS_ADDR"); metricsAddr != "" {
+		metricsServer = &http.Server{
+			Addr:    metricsAddr,
+			Handler: api.MetricsHandler(),
+		}
+		go func() {
+			log.Printf("Metrics listening on %s", metricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("ERROR: Failed to start metrics server: %v", err)
+			}
+		}()
+	}
+
 	// Set up graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -195,9 +217,35 @@ func main() {
 	ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	// The generation workers are stopped below even if requests were still open,
+	// so running jobs release their token reservations
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("ERROR: Server forced to shutdown: %v", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Printf("ERROR: Metrics server forced to shutdown: %v", err)
+		}
 	}
 
+	// Give running generation jobs a little longer; jobs still running afterwards are cancelled
+	jobsCtx, jobsCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer jobsCancel()
+	handler.StopGenerationWorkers(jobsCtx)
+
 	log.Println("Server exited properly")
 }
+
+// envInt reads a positive integer from the environment, falling back to def when unset or invalid
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("WARNING: Invalid value %q for %s, using default %d", value, key, def)
+		return def
+	}
+	return n
+}
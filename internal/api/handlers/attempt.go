@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"database/sql" // Added for sql.ErrNoRows
-	"errors"       // Import the standard errors package
-	"fmt"          // Added for error formatting
-	"log"          // Added for logging errors
+	"encoding/json"
+	"errors" // Import the standard errors package
+	"fmt"    // Added for error formatting
+	"io"     // Added for io.EOF of empty bodies
+	"log"    // Added for logging errors
 	"net/http"
 	"time" // Added for time.Now()
 
@@ -17,7 +19,12 @@ import (
 
 // --- Quiz Attempt Handlers ---
 
-// HandleCreateQuizAttempt starts a new attempt for a given quiz.
+// CreateQuizAttemptRequest is the optional JSON body for starting an attempt
+type CreateQuizAttemptRequest struct {
+	Mode db.AttemptMode `json:"mode"` // "exam" (default) or "practice"
+}
+
+// HandleCreateQuizAttempt starts a new attempt for a given quiz, which the user must be allowed to see.
 func (h *Handler) HandleCreateQuizAttempt(c *gin.Context) {
 	ctx := c.Request.Context()
 	quizIDStr := c.Param("quizId")
@@ -38,33 +45,6 @@ func (h *Handler) HandleCreateQuizAttempt(c *gin.Context) {
 		return
 	}
 
-	// Get user details for notifications
-	userName := "Unknown User"                              // Default value
-	userEmail := ""                                         // Default value
-	userProfileValue, profileExists := c.Get("userProfile") // Use the key set by middleware
-
-	if profileExists {
-		profile, profileOk := userProfileValue.(UserProfile) // Check type assertion
-		if profileOk {
-			// Successfully retrieved and asserted profile
-			userName = profile.Name
-			userEmail = profile.Email
-			// Ensure name isn't empty, fallback if needed
-			if userName == "" {
-				userName = "User" // Use a slightly better default if name is empty but profile exists
-			}
-			log.Printf("INFO: Retrieved user profile from context for attempt start notification: Name=%s, Email=%s", userName, userEmail)
-		} else {
-			// Profile key exists, but type assertion failed
-			log.Printf("ERROR: Value found for key '%s' in context is not of type UserProfile during attempt start. Type: %T. UserID: %s", "userProfile", userProfileValue, userID)
-			// userName and userEmail will keep their default values ("Unknown User", "")
-		}
-	} else {
-		// Profile key does not exist in context
-		log.Printf("ERROR: User profile key '%s' not found in context for attempt start notification. UserID: %s", "userProfile", userID)
-		// userName and userEmail will keep their default values ("Unknown User", "")
-	}
-
 	// 2. Parse Quiz ID
 	quizID, err := uuid.Parse(quizIDStr)
 	if err != nil {
@@ -86,11 +66,20 @@ func (h *Handler) HandleCreateQuizAttempt(c *gin.Context) {
 		}
 		return
 	}
+	if !canViewQuiz(dbQuiz.CreatorID, dbQuiz.Visibility, userID, false) {
+		h.handleErrorAndNotify(c, userID, http.StatusForbidden, fmt.Sprintf("User %s attempted to start an attempt for private quiz %s", userID, quizID), errors.New("this quiz is private"))
+		return
+	}
+	mode, ok := h.attemptMode(c, userID, quizID)
+	if !ok {
+		return
+	}
 
 	// 4. Create Quiz Attempt record
 	attemptParams := db.CreateQuizAttemptParams{
 		QuizID: quizID,
 		UserID: userID,
+		Mode:   mode,
 	}
 	newAttempt, err := h.DB.Queries.CreateQuizAttempt(ctx, attemptParams)
 	if err != nil {
@@ -100,36 +89,87 @@ func (h *Handler) HandleCreateQuizAttempt(c *gin.Context) {
 	}
 
 	log.Printf("INFO: Created quiz attempt %s for quiz %s, user %s", newAttempt.ID, quizID, userID)
+	h.recordAttemptStart(c, userID, dbQuiz.Title, newAttempt)
+
+	// 5. Return the new attempt ID
+	c.JSON(http.StatusCreated, gin.H{"attemptId": newAttempt.ID.String(), "mode": newAttempt.Mode})
+}
+
+// attemptMode reads the mode of a new attempt from the optional JSON body, exam without one.
+// If it returns false, the error response was already sent.
+func (h *Handler) attemptMode(c *gin.Context, userID, quizID uuid.UUID) (db.AttemptMode, bool) {
+	var req CreateQuizAttemptRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for creating attempt for quiz %s", quizID), err)
+		return "", false
+	}
+	switch req.Mode {
+	case "":
+		return db.AttemptModeExam, true
+	case db.AttemptModeExam, db.AttemptModePractice:
+		return req.Mode, true
+	default:
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid attempt mode for quiz %s", quizID), fmt.Errorf("mode must be exam or practice, not %q", req.Mode))
+		return "", false
+	}
+}
+
+// recordAttemptStart logs the activity of a started attempt and announces it on Discord
+func (h *Handler) recordAttemptStart(c *gin.Context, userID uuid.UUID, quizTitle string, newAttempt db.QuizAttempt) {
+	// Get user details for notifications
+	userName := "Unknown User"                              // Default value
+	userEmail := ""                                         // Default value
+	userProfileValue, profileExists := c.Get("userProfile") // Use the key set by middleware
+
+	if profileExists {
+		profile, profileOk := userProfileValue.(UserProfile) // Check type assertion
+		if profileOk {
+			// Successfully retrieved and asserted profile
+			userName = profile.Name
+			userEmail = profile.Email
+			// Ensure name isn't empty, fallback if needed
+			if userName == "" {
+				userName = "User" // Use a slightly better default if name is empty but profile exists
+			}
+			log.Printf("INFO: Retrieved user profile from context for attempt start notification: Name=%s, Email=%s", userName, userEmail)
+		} else {
+			// Profile key exists, but type assertion failed
+			log.Printf("ERROR: Value found for key '%s' in context is not of type UserProfile during attempt start. Type: %T. UserID: %s", "userProfile", userProfileValue, userID)
+			// userName and userEmail will keep their default values ("Unknown User", "")
+		}
+	} else {
+		// Profile key does not exist in context
+		log.Printf("ERROR: User profile key '%s' not found in context for attempt start notification. UserID: %s", "userProfile", userID)
+		// userName and userEmail will keep their default values ("Unknown User", "")
+	}
 
 	// Log attempt start activity
-	h.logActivity(ctx, userID, db.ActivityActionQuizAttemptStart,
+	h.logActivity(c.Request.Context(), userID, db.ActivityActionQuizAttemptStart,
 		db.NullActivityTargetType{ActivityTargetType: db.ActivityTargetTypeQuizAttempt, Valid: true},
 		pgtype.UUID{Bytes: newAttempt.ID, Valid: true},
-		map[string]interface{}{"quiz_id": quizID.String()})
+		map[string]interface{}{"quiz_id": newAttempt.QuizID.String(), "mode": newAttempt.Mode})
 
 	// Send Discord notification for attempt start using Embed
 	startEmbed := DiscordEmbed{
 		Title: "🚀 Quiz Attempt Started",
 		Color: 0x2196F3, // Blue color
 		Fields: []DiscordEmbedField{
-			{Name: "Quiz Title", Value: dbQuiz.Title, Inline: true},
-			{Name: "Quiz ID", Value: fmt.Sprintf("`%s`", quizID.String()), Inline: true},
+			{Name: "Quiz Title", Value: quizTitle, Inline: true},
+			{Name: "Quiz ID", Value: fmt.Sprintf("`%s`", newAttempt.QuizID.String()), Inline: true},
 			{Name: "Attempt ID", Value: fmt.Sprintf("`%s`", newAttempt.ID.String()), Inline: false},
 			{Name: "Started By", Value: fmt.Sprintf("%s (%s)", userName, userEmail), Inline: false},
 		},
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
 	h.sendDiscordNotification(startEmbed)
-
-	// 5. Return the new attempt ID
-	c.JSON(http.StatusCreated, gin.H{"attemptId": newAttempt.ID.String()})
 }
 
 // ResponseAttemptAnswer matches the structure needed by the frontend
 type ResponseAttemptAnswer struct {
-	QuestionID       uuid.UUID `json:"question_id"`
-	SelectedAnswerID uuid.UUID `json:"selected_answer_id"`
-	IsCorrect        bool      `json:"is_correct"`
+	QuestionID       uuid.UUID       `json:"question_id"`
+	SelectedAnswerID uuid.UUID       `json:"selected_answer_id"`
+	IsCorrect        *bool           `json:"is_correct,omitempty"` // Omitted until the answer key of the question is revealed
+	Response         json.RawMessage `json:"response,omitempty"`   // The answer to questions that aren't single choice
 }
 
 // ResponseQuizAttempt includes the basic attempt info and saved answers
@@ -140,7 +180,11 @@ type ResponseQuizAttempt struct {
 	Score     pgtype.Int4             `json:"score"` // Use pgtype for nullable int
 	StartTime time.Time               `json:"start_time"`
 	EndTime   pgtype.Timestamptz      `json:"end_time"` // Use pgtype for nullable timestamp
+	Mode      db.AttemptMode          `json:"mode"`
 	Answers   []ResponseAttemptAnswer `json:"answers"`
+	// Questions in the taker view, with the answer key of the revealed ones: all once the attempt
+	// is finished, in practice mode also those already answered
+	Questions []ResponseQuestion `json:"questions"`
 }
 
 // HandleGetQuizAttempt retrieves details and saved answers for a specific attempt.
@@ -204,13 +248,30 @@ func (h *Handler) HandleGetQuizAttempt(c *gin.Context) {
 		dbAnswers = []db.AttemptAnswer{} // Ensure empty slice, not null
 	}
 
-	// 5. Structure the response
+	// 5. Fetch the questions of the quiz
+	questions, err := h.quizQuestions(ctx, dbAttempt.QuizID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get questions for attempt %s", attemptID), err)
+		return
+	}
+
+	// 6. Structure the response, revealing what the taker may see by now
+	revealed := make(map[uuid.UUID]bool, len(dbAnswers)) // Question IDs
 	responseAnswers := make([]ResponseAttemptAnswer, len(dbAnswers))
 	for i, dbA := range dbAnswers {
 		responseAnswers[i] = ResponseAttemptAnswer{
 			QuestionID:       dbA.QuestionID,
 			SelectedAnswerID: dbA.SelectedAnswerID.Bytes, // Extract UUID bytes from pgtype.UUID
-			IsCorrect:        dbA.IsCorrect.Bool,         // Extract bool from pgtype.Bool
+			Response:         dbA.Response,               // nil for single choice answers
+		}
+		if dbAttempt.EndTime.Valid || dbAttempt.Mode == db.AttemptModePractice {
+			revealed[dbA.QuestionID] = true
+			responseAnswers[i].IsCorrect = &dbA.IsCorrect.Bool
+		}
+	}
+	for i, q := range questions {
+		if !dbAttempt.EndTime.Valid && !revealed[q.ID] {
+			questions[i] = q.withoutAnswerKey()
 		}
 	}
 
@@ -221,18 +282,26 @@ func (h *Handler) HandleGetQuizAttempt(c *gin.Context) {
 		Score:     dbAttempt.Score,
 		StartTime: dbAttempt.StartTime,
 		EndTime:   dbAttempt.EndTime,
+		Mode:      dbAttempt.Mode,
 		Answers:   responseAnswers,
+		Questions: questions,
 	}
 
 	log.Printf("INFO: Successfully prepared response for quiz attempt %s", attemptID)
-	// 6. Return JSON response
+	// 7. Return JSON response
 	c.JSON(http.StatusOK, response)
 }
 
-// SaveAttemptAnswerRequest defines the expected JSON body for saving an answer
+// SaveAttemptAnswerRequest defines the expected JSON body for saving an answer.
+// Only the field for the type of the question has to be set.
 type SaveAttemptAnswerRequest struct {
-	QuestionID       uuid.UUID `json:"questionId" binding:"required"`
-	SelectedAnswerID uuid.UUID `json:"selectedAnswerId" binding:"required"`
+	QuestionID        uuid.UUID            `json:"questionId" binding:"required"`
+	SelectedAnswerID  uuid.UUID            `json:"selectedAnswerId"`  // Multiple choice and true/false
+	SelectedAnswerIDs []uuid.UUID          `json:"selectedAnswerIds"` // Multi-select
+	TextAnswer        *string              `json:"textAnswer"`        // Short answer
+	NumericAnswer     *float64             `json:"numericAnswer"`     // Numeric
+	Order             []uuid.UUID          `json:"order"`             // Ordering: the item IDs in the chosen order
+	Matches           map[uuid.UUID]string `json:"matches"`           // Matching: item ID to the chosen match text
 }
 
 // HandleSaveAttemptAnswer saves or updates a user's answer for a specific question in an attempt.
@@ -271,7 +340,7 @@ func (h *Handler) HandleSaveAttemptAnswer(c *gin.Context) {
 		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for saving answer to attempt %s", attemptID), err)
 		return
 	}
-	log.Printf("INFO: Handling request to save answer (Q: %s, A: %s) for attempt ID: %s by user ID: %s", req.QuestionID, req.SelectedAnswerID, attemptID, userID)
+	log.Printf("INFO: Handling request to save answer (Q: %s) for attempt ID: %s by user ID: %s", req.QuestionID, attemptID, userID)
 
 	// 4. Verify Attempt Ownership and Status (Attempt must exist and belong to user)
 	dbAttempt, err := h.DB.Queries.GetQuizAttempt(ctx, attemptID)
@@ -297,27 +366,55 @@ func (h *Handler) HandleSaveAttemptAnswer(c *gin.Context) {
 		return
 	}
 
-	// 5. Check if the selected answer is correct
-	isCorrect, err := h.DB.Queries.GetAnswerCorrectness(ctx, req.SelectedAnswerID)
+	// 5. Load the question, which must belong to the attempted quiz, and its answer key
+	dbQuestion, err := h.DB.Queries.GetQuestionByID(ctx, req.QuestionID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Selected answer ID %s not found when saving answer for attempt %s", req.SelectedAnswerID, attemptID), err)
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Question %s not found when saving answer for attempt %s", req.QuestionID, attemptID), err)
 		} else {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to check answer correctness for answer %s, attempt %s", req.SelectedAnswerID, attemptID), err)
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get question %s when saving answer for attempt %s", req.QuestionID, attemptID), err)
+		}
+		return
+	}
+	if dbQuestion.QuizID != dbAttempt.QuizID {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Question %s is not part of the quiz of attempt %s", req.QuestionID, attemptID), errors.New("question does not belong to this quiz"))
+		return
+	}
+	dbAnswers, err := h.DB.Queries.ListAnswersByQuestionID(ctx, req.QuestionID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get answers of question %s, attempt %s", req.QuestionID, attemptID), err)
+		return
+	}
+	// Grade the answer according to the question type
+	graded, err := gradeAttemptAnswer(dbQuestion.QuestionType, dbAnswers, req)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errInvalidAttemptAnswer) {
+			status = http.StatusBadRequest
 		}
+		h.handleErrorAndNotify(c, userID, status, fmt.Sprintf("Failed to grade answer to %s question %s for attempt %s", dbQuestion.QuestionType, req.QuestionID, attemptID), err)
 		return
 	}
 
-	// 6. Upsert the Attempt Answer
+	// 6. Upsert the Attempt Answer. In practice mode the answer key is revealed once answered, so
+	// the first answer is kept; the insert does nothing when there already is one, even from a
+	// concurrent request.
 	upsertParams := db.UpsertAttemptAnswerParams{
 		QuizAttemptID:    attemptID,
 		QuestionID:       req.QuestionID,
-		SelectedAnswerID: pgtype.UUID{Bytes: req.SelectedAnswerID, Valid: true},
-		IsCorrect:        pgtype.Bool{Bool: isCorrect, Valid: true},
+		SelectedAnswerID: graded.SelectedAnswerID,
+		IsCorrect:        pgtype.Bool{Bool: graded.IsCorrect, Valid: true},
+		Response:         graded.Response,
+	}
+	if dbAttempt.Mode == db.AttemptModePractice {
+		_, err = h.DB.Queries.InsertAttemptAnswer(ctx, db.InsertAttemptAnswerParams(upsertParams))
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusConflict, fmt.Sprintf("User %s attempted to change the practice answer to question %s in attempt %s", userID, req.QuestionID, attemptID), errors.New("this question has already been answered"))
+			return
+		}
+	} else {
+		_, err = h.DB.Queries.UpsertAttemptAnswer(ctx, upsertParams)
 	}
-	_, err = h.DB.Queries.UpsertAttemptAnswer(ctx, upsertParams)
 	if err != nil {
 		// Use handleErrorAndNotify
 		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to upsert attempt answer for attempt %s, question %s", attemptID, req.QuestionID), err)
@@ -325,8 +422,15 @@ func (h *Handler) HandleSaveAttemptAnswer(c *gin.Context) {
 	}
 
 	log.Printf("INFO: Successfully saved/updated answer for attempt %s, question %s", attemptID, req.QuestionID)
-	// 7. Return Success Response
-	c.Status(http.StatusOK) // Or return the saved answer data if needed
+	// 7. Return Success Response; in practice mode with the result and the answer key of the question
+	if dbAttempt.Mode != db.AttemptModePractice {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"is_correct": graded.IsCorrect,
+		"question":   newResponseQuestion(dbQuestion, topicTitle(ctx, h.DB.Queries, dbQuestion.TopicID), dbAnswers),
+	})
 }
 
 // HandleFinishQuizAttempt marks an attempt as finished and calculates the score.
@@ -109,7 +109,7 @@ func (h *Handler) HandleGoogleCallback(c *gin.Context) {
 				GoogleID: pgtype.Text{String: userinfo.Id, Valid: userinfo.Id != ""},
 				Picture:  pgtype.Text{String: userinfo.Picture, Valid: userinfo.Picture != ""}, // Added Picture field
 			}
-			dbUser, err = h.DB.Queries.CreateUser(ctx, createUserParams) // Corrected: Use h.DB.Queries
+			dbUser, err = h.createUserWithSignupGift(ctx, createUserParams)
 			if err != nil {
 				// Use handleErrorAndNotify (userID is Nil as user creation failed)
 				h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, "Failed to create user profile", err)
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/gemini"
+	"quizbuilderai/internal/models"
+)
+
+// cachedGeneration is stored in generation_cache.response: the model output and, for each question,
+// the input it was generated from. Inputs are identified by their content hash, as the job paths
+// differ between jobs.
+type cachedGeneration struct {
+	Quiz    models.GeminiQuizResponse `json:"quiz"`
+	Merged  int                       `json:"merged"`  // Duplicate questions merged away
+	Sources []cachedQuestionSource    `json:"sources"` // One per question
+}
+
+// cachedQuestionSource is where a cached question came from
+type cachedQuestionSource struct {
+	Input     string `json:"input,omitempty"` // Content hash of the input
+	FirstPage int    `json:"first_page,omitempty"`
+	LastPage  int    `json:"last_page,omitempty"`
+}
+
+// contentHash returns the hex encoded SHA-256 of data
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// inputHashes returns the content hash of each input by its path in the job directory,
+// and false if an input has none, as inputs of jobs queued before hashes existed don't
+func (in generationJobInput) inputHashes() (map[string]string, bool) {
+	hashes := make(map[string]string)
+	for _, file := range in.Files {
+		hashes[file.Path] = file.Hash
+	}
+	for _, video := range in.Videos {
+		hashes[video.Path] = video.Hash
+	}
+	for _, page := range in.Pages {
+		hashes[page.Path] = page.Hash
+	}
+	for _, hash := range hashes {
+		if hash == "" {
+			return nil, false
+		}
+	}
+	return hashes, len(hashes) > 0
+}
+
+// generationCacheKey returns the key of the job's generation in the cache: the hash over the content
+// hashes of all inputs, in any order, the prompt version, the hash of the options and the generator.
+// It returns false if the job can't be cached.
+func (h *Handler) generationCacheKey(input generationJobInput) (db.GetGenerationCacheParams, bool) {
+	hashes, ok := input.inputHashes()
+	if !ok {
+		return db.GetGenerationCacheParams{}, false
+	}
+	sorted := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		sorted = append(sorted, hash)
+	}
+	sort.Strings(sorted)
+
+	// The options are normalised when parsed, so equal options encode equally
+	options, err := json.Marshal(input.Options)
+	if err != nil {
+		log.Printf("WARN: Failed to encode generation options for the cache key: %v", err)
+		return db.GetGenerationCacheParams{}, false
+	}
+	return db.GetGenerationCacheParams{
+		ContentHash:   contentHash([]byte(strings.Join(sorted, "\n"))),
+		PromptVersion: gemini.PromptVersion,
+		OptionsHash:   contentHash(options),
+		Generator:     h.Generator.Name(),
+	}, true
+}
+
+// lookupGenerationCache returns the cached generation for the job's inputs and options, nil if there is none
+func (h *Handler) lookupGenerationCache(ctx context.Context, input generationJobInput) (*db.GenerationCache, error) {
+	key, ok := h.generationCacheKey(input)
+	if !ok {
+		return nil, nil
+	}
+	entry, err := h.DB.Queries.GetGenerationCache(ctx, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up cached generation: %w", err)
+	}
+	return &entry, nil
+}
+
+// storeGenerationCache keeps the model output of a finished job for identical requests.
+// The quiz is already saved, so failures are only logged.
+func (h *Handler) storeGenerationCache(ctx context.Context, input generationJobInput, quiz *models.GeminiQuizResponse) {
+	key, ok := h.generationCacheKey(input)
+	if !ok {
+		return
+	}
+	hashes, _ := input.inputHashes()
+	cached := cachedGeneration{
+		Quiz:    *quiz,
+		Merged:  quiz.Merged,
+		Sources: make([]cachedQuestionSource, len(quiz.Questions)),
+	}
+	for i, q := range quiz.Questions {
+		cached.Sources[i] = cachedQuestionSource{Input: hashes[q.SourceFile], FirstPage: q.FirstPage, LastPage: q.LastPage}
+	}
+	response, err := json.Marshal(cached)
+	if err != nil {
+		log.Printf("WARN: Failed to encode generation for the cache: %v", err)
+		return
+	}
+	if err := h.DB.Queries.UpsertGenerationCache(ctx, db.UpsertGenerationCacheParams{
+		ContentHash:   key.ContentHash,
+		PromptVersion: key.PromptVersion,
+		OptionsHash:   key.OptionsHash,
+		Generator:     key.Generator,
+		Response:      response,
+	}); err != nil {
+		log.Printf("WARN: Failed to cache generation %s: %v", key.ContentHash, err)
+		return
+	}
+	log.Printf("INFO: Cached generation %s with %d questions", key.ContentHash, len(quiz.Questions))
+}
+
+// cachedQuiz rebuilds the quiz of a job from its cached generation, attributing each question
+// to the job's input with the content it was generated from
+func (h *Handler) cachedQuiz(ctx context.Context, input generationJobInput) (*models.GeminiQuizResponse, error) {
+	entry, err := h.DB.Queries.GetGenerationCacheByID(ctx, *input.CacheID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cached generation %s: %w", *input.CacheID, err)
+	}
+	var cached cachedGeneration
+	if err := json.Unmarshal(entry.Response, &cached); err != nil {
+		return nil, fmt.Errorf("failed to decode cached generation %s: %w", entry.ID, err)
+	}
+	if len(cached.Quiz.Questions) == 0 {
+		return nil, fmt.Errorf("cached generation %s has no questions", entry.ID)
+	}
+
+	paths := make(map[string]string) // Input path by content hash
+	hashes, _ := input.inputHashes()
+	for path, hash := range hashes {
+		paths[hash] = path
+	}
+	quiz := cached.Quiz
+	quiz.Merged = cached.Merged
+	for i := range quiz.Questions {
+		if i >= len(cached.Sources) {
+			break
+		}
+		source := cached.Sources[i]
+		quiz.Questions[i].SourceFile = paths[source.Input]
+		quiz.Questions[i].FirstPage = source.FirstPage
+		quiz.Questions[i].LastPage = source.LastPage
+	}
+
+	if err := h.DB.Queries.RecordGenerationCacheHit(ctx, entry.ID); err != nil {
+		log.Printf("WARN: Failed to record hit of cached generation %s: %v", entry.ID, err)
+	}
+	log.Printf("INFO: Built quiz from cached generation %s (%d questions)", entry.ID, len(quiz.Questions))
+	return &quiz, nil
+}
@@ -0,0 +1,708 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/gemini"
+	"quizbuilderai/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// --- Quiz Editing ---
+// Only the creator of a quiz may edit it. Edits of questions and answers run in one transaction that
+// first touches the quiz: the row lock makes concurrent edits of the same quiz wait for each other,
+// so the invariants checked below (e.g. exactly one correct option) can't be broken by a race.
+
+// UpdateQuizRequest changes the settings of a quiz; omitted fields are kept
+type UpdateQuizRequest struct {
+	Title       *string            `json:"title"`
+	Description *string            `json:"description"` // Empty to remove the description
+	Visibility  *db.QuizVisibility `json:"visibility"`
+}
+
+// ResponseQuizSettings is a quiz after its settings were changed
+type ResponseQuizSettings struct {
+	ID          uuid.UUID         `json:"id"`
+	Title       string            `json:"title"`
+	Description *string           `json:"description,omitempty"`
+	Visibility  db.QuizVisibility `json:"visibility"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// UpdateQuestionRequest changes the text or topic of a question; omitted fields are kept
+type UpdateQuestionRequest struct {
+	Text  *string `json:"text"`
+	Topic *string `json:"topic"` // Title of the topic, created if the user has none with this title
+}
+
+// UpdateAnswerRequest changes an answer of a question; omitted fields are kept
+type UpdateAnswerRequest struct {
+	Text        *string `json:"text"`        // The value, for numeric questions
+	IsCorrect   *bool   `json:"is_correct"`  // Marking an option of a single choice question correct unmarks the others
+	Explanation *string `json:"explanation"` // Empty to remove the explanation
+}
+
+// ReorderQuestionsRequest puts the questions of a quiz in a new order
+type ReorderQuestionsRequest struct {
+	QuestionIDs []uuid.UUID `json:"question_ids" binding:"required"` // Every question of the quiz exactly once, in the new order
+}
+
+// ownQuiz returns the user and the quiz of the request, which the user must have created.
+// If it returns false, the error response was already sent.
+func (h *Handler) ownQuiz(c *gin.Context) (uuid.UUID, db.GetQuizByIDRow, bool) {
+	quizIDStr := c.Param("quizId")
+
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, fmt.Sprintf("User ID not found in context for editing quiz %s", quizIDStr), errors.New("user not authenticated"))
+		return uuid.Nil, db.GetQuizByIDRow{}, false
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, fmt.Sprintf("User ID in context is not UUID for editing quiz %s", quizIDStr), errors.New("invalid user ID type in context"))
+		return uuid.Nil, db.GetQuizByIDRow{}, false
+	}
+
+	quizID, err := uuid.Parse(quizIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid Quiz ID format '%s'", quizIDStr), err)
+		return userID, db.GetQuizByIDRow{}, false
+	}
+	dbQuiz, err := h.DB.Queries.GetQuizByID(c.Request.Context(), quizID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Quiz not found: %s", quizID), err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get quiz %s", quizID), err)
+		}
+		return userID, db.GetQuizByIDRow{}, false
+	}
+	if !dbQuiz.CreatorID.Valid || dbQuiz.CreatorID.Bytes != userID {
+		h.handleErrorAndNotify(c, userID, http.StatusForbidden, fmt.Sprintf("User %s attempted to edit quiz %s owned by %s", userID, quizID, dbQuiz.CreatorID.Bytes), errors.New("you do not have permission to edit this quiz"))
+		return userID, db.GetQuizByIDRow{}, false
+	}
+	return userID, dbQuiz, true
+}
+
+// quizQuestion returns the question of the request, which must be part of the quiz.
+// If it returns false, the error response was already sent.
+func (h *Handler) quizQuestion(c *gin.Context, userID, quizID uuid.UUID) (db.Question, bool) {
+	questionIDStr := c.Param("questionId")
+	questionID, err := uuid.Parse(questionIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid Question ID format '%s'", questionIDStr), err)
+		return db.Question{}, false
+	}
+	question, err := h.DB.Queries.GetQuestionByID(c.Request.Context(), questionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Question not found: %s", questionID), err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get question %s", questionID), err)
+		}
+		return db.Question{}, false
+	}
+	if question.QuizID != quizID {
+		h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Question not found: %s", questionID), fmt.Errorf("question belongs to quiz %s", question.QuizID))
+		return db.Question{}, false
+	}
+	return question, true
+}
+
+// newResponseQuestion maps an edited question and its answers to the response form, without its source
+func newResponseQuestion(question db.Question, topicTitle string, answers []db.Answer) ResponseQuestion {
+	options := make([]ResponseOption, 0, len(answers))
+	for _, a := range answers {
+		options = append(options, newResponseOption(a))
+	}
+	response := ResponseQuestion{
+		ID:       question.ID,
+		Text:     question.Question,
+		Type:     question.QuestionType,
+		Options:  options,
+		Position: question.Position,
+	}
+	if topicTitle != "" {
+		response.TopicTitle = &topicTitle
+	}
+	return response
+}
+
+// topicTitle returns the title of a topic for responses, empty if it can't be found
+func topicTitle(ctx context.Context, qtx *db.Queries, topicID uuid.UUID) string {
+	topic, err := qtx.GetTopicByID(ctx, topicID)
+	if err != nil {
+		log.Printf("WARN: Failed to get topic %s: %v", topicID, err)
+		return ""
+	}
+	return topic.Title
+}
+
+// logQuizUpdate records an edit of the quiz, with details on what changed
+func (h *Handler) logQuizUpdate(ctx context.Context, userID, quizID uuid.UUID, details map[string]interface{}) {
+	h.logActivity(ctx, userID, db.ActivityActionQuizUpdate,
+		db.NullActivityTargetType{ActivityTargetType: db.ActivityTargetTypeQuiz, Valid: true},
+		pgtype.UUID{Bytes: quizID, Valid: true},
+		details)
+}
+
+// HandleUpdateQuiz changes the title, description or visibility of a quiz
+func (h *Handler) HandleUpdateQuiz(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get the quiz, which the user must own
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+
+	// 2. Parse and validate the request
+	var req UpdateQuizRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for updating quiz %s", dbQuiz.ID), err)
+		return
+	}
+	params := db.UpdateQuizParams{
+		ID:          dbQuiz.ID,
+		CreatorID:   dbQuiz.CreatorID,
+		Title:       dbQuiz.Title,
+		Description: dbQuiz.Description,
+		Visibility:  dbQuiz.Visibility,
+	}
+	var changed []string
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid title for quiz %s", dbQuiz.ID), errors.New("title must not be empty"))
+			return
+		}
+		params.Title = title
+		changed = append(changed, "title")
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		params.Description = pgtype.Text{String: description, Valid: description != ""}
+		changed = append(changed, "description")
+	}
+	if req.Visibility != nil {
+		switch *req.Visibility {
+		case db.QuizVisibilityPublic, db.QuizVisibilityPrivate, db.QuizVisibilityUnlisted:
+			params.Visibility = *req.Visibility
+		default:
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid visibility for quiz %s", dbQuiz.ID), fmt.Errorf("visibility must be public, private or unlisted, not %q", *req.Visibility))
+			return
+		}
+		changed = append(changed, "visibility")
+	}
+	if len(changed) == 0 {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Nothing to update for quiz %s", dbQuiz.ID), errors.New("set title, description or visibility"))
+		return
+	}
+
+	// 3. Update the quiz
+	updated, err := h.DB.Queries.UpdateQuiz(ctx, params)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update quiz %s", dbQuiz.ID), err)
+		return
+	}
+	log.Printf("INFO: User %s updated %s of quiz %s", userID, strings.Join(changed, ", "), updated.ID)
+	h.logQuizUpdate(ctx, userID, updated.ID, map[string]interface{}{
+		"title":  updated.Title,
+		"fields": changed,
+	})
+
+	// 4. Return the updated settings
+	response := ResponseQuizSettings{
+		ID:         updated.ID,
+		Title:      updated.Title,
+		Visibility: updated.Visibility,
+		UpdatedAt:  updated.UpdatedAt,
+	}
+	if updated.Description.Valid {
+		response.Description = &updated.Description.String
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleCreateQuestion adds a question to a quiz. The body has the shape of a generated question,
+// its answer key must satisfy the same rules.
+func (h *Handler) HandleCreateQuestion(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get the quiz, which the user must own
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+
+	// 2. Parse and validate the question
+	var req models.GeminiQuestion
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for adding a question to quiz %s", dbQuiz.ID), err)
+		return
+	}
+	req.Text = strings.TrimSpace(req.Text)
+	req.Topic = strings.TrimSpace(req.Topic)
+	if req.Topic == "" {
+		req.Topic = "General" // Same default as for generated questions
+	}
+	if err := gemini.ValidateQuestion(req); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid question for quiz %s", dbQuiz.ID), err)
+		return
+	}
+
+	// 3. Create the question and its answers in one transaction
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to begin transaction", err)
+		return
+	}
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+	qtx := h.DB.Queries.WithTx(tx)
+
+	if err := qtx.TouchQuiz(ctx, dbQuiz.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update quiz %s", dbQuiz.ID), err)
+		return
+	}
+	topicID, err := getOrCreateTopic(ctx, qtx, userID, req.Topic)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get or create topic '%s'", req.Topic), err)
+		return
+	}
+	position, err := qtx.NextQuestionPosition(ctx, dbQuiz.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get next question position of quiz %s", dbQuiz.ID), err)
+		return
+	}
+	question, err := qtx.CreateQuestion(ctx, db.CreateQuestionParams{
+		QuizID:       dbQuiz.ID,
+		TopicID:      topicID,
+		Question:     req.Text,
+		QuestionType: db.QuestionType(req.QuestionType()),
+		Position:     position, // Added questions come last
+	})
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create question for quiz %s", dbQuiz.ID), err)
+		return
+	}
+	if err := createQuestionAnswers(ctx, qtx, question.ID, req); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create answers for question %s", question.ID), err)
+		return
+	}
+	answers, err := qtx.ListAnswersByQuestionID(ctx, question.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get answers of question %s", question.ID), err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to commit new question for quiz %s", dbQuiz.ID), err)
+		return
+	}
+
+	log.Printf("INFO: User %s added %s question %s to quiz %s", userID, question.QuestionType, question.ID, dbQuiz.ID)
+	h.logQuizUpdate(ctx, userID, dbQuiz.ID, map[string]interface{}{
+		"title":       dbQuiz.Title,
+		"change":      "question_create",
+		"question_id": question.ID.String(),
+	})
+
+	// 4. Return the new question
+	c.JSON(http.StatusCreated, newResponseQuestion(question, req.Topic, answers))
+}
+
+// HandleUpdateQuestion changes the text or topic of a question
+func (h *Handler) HandleUpdateQuestion(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get the quiz, which the user must own, and the question
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+	question, ok := h.quizQuestion(c, userID, dbQuiz.ID)
+	if !ok {
+		return
+	}
+
+	// 2. Parse and validate the request
+	var req UpdateQuestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for updating question %s", question.ID), err)
+		return
+	}
+	if req.Text == nil && req.Topic == nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Nothing to update for question %s", question.ID), errors.New("set text or topic"))
+		return
+	}
+	text := question.Question
+	if req.Text != nil {
+		text = strings.TrimSpace(*req.Text)
+		if text == "" {
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid text for question %s", question.ID), errors.New("text must not be empty"))
+			return
+		}
+	}
+	var topic string
+	if req.Topic != nil {
+		topic = strings.TrimSpace(*req.Topic)
+		if topic == "" {
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid topic for question %s", question.ID), errors.New("topic must not be empty"))
+			return
+		}
+	}
+
+	// 3. Update the question in one transaction
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to begin transaction", err)
+		return
+	}
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+	qtx := h.DB.Queries.WithTx(tx)
+
+	if err := qtx.TouchQuiz(ctx, dbQuiz.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update quiz %s", dbQuiz.ID), err)
+		return
+	}
+	topicID := question.TopicID
+	if topic != "" {
+		if topicID, err = getOrCreateTopic(ctx, qtx, userID, topic); err != nil {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get or create topic '%s'", topic), err)
+			return
+		}
+	} else {
+		topic = topicTitle(ctx, qtx, topicID)
+	}
+	updated, err := qtx.UpdateQuestion(ctx, db.UpdateQuestionParams{
+		ID:       question.ID,
+		QuizID:   question.QuizID,
+		TopicID:  topicID,
+		Question: text,
+	})
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update question %s", question.ID), err)
+		return
+	}
+	answers, err := qtx.ListAnswersByQuestionID(ctx, question.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get answers of question %s", question.ID), err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to commit update of question %s", question.ID), err)
+		return
+	}
+
+	log.Printf("INFO: User %s updated question %s of quiz %s", userID, question.ID, dbQuiz.ID)
+	h.logQuizUpdate(ctx, userID, dbQuiz.ID, map[string]interface{}{
+		"title":       dbQuiz.Title,
+		"change":      "question_update",
+		"question_id": question.ID.String(),
+	})
+
+	// 4. Return the updated question
+	c.JSON(http.StatusOK, newResponseQuestion(updated, topic, answers))
+}
+
+// HandleDeleteQuestion removes a question and its answers from a quiz. The last question of a quiz
+// can't be deleted, delete the quiz instead.
+func (h *Handler) HandleDeleteQuestion(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get the quiz, which the user must own, and the question
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+	question, ok := h.quizQuestion(c, userID, dbQuiz.ID)
+	if !ok {
+		return
+	}
+
+	// 2. Delete the question in one transaction, keeping at least one
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to begin transaction", err)
+		return
+	}
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+	qtx := h.DB.Queries.WithTx(tx)
+
+	if err := qtx.TouchQuiz(ctx, dbQuiz.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update quiz %s", dbQuiz.ID), err)
+		return
+	}
+	count, err := qtx.CountQuestionsByQuizID(ctx, dbQuiz.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to count questions of quiz %s", dbQuiz.ID), err)
+		return
+	}
+	if count <= 1 {
+		h.handleErrorAndNotify(c, userID, http.StatusConflict, fmt.Sprintf("Cannot delete question %s", question.ID), errors.New("a quiz must keep at least one question, delete the quiz instead"))
+		return
+	}
+	// Answers, sources and attempt answers of the question are deleted with it
+	if err := qtx.DeleteQuestion(ctx, question.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to delete question %s", question.ID), err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to commit deletion of question %s", question.ID), err)
+		return
+	}
+
+	log.Printf("INFO: User %s deleted question %s of quiz %s", userID, question.ID, dbQuiz.ID)
+	h.logQuizUpdate(ctx, userID, dbQuiz.ID, map[string]interface{}{
+		"title":       dbQuiz.Title,
+		"change":      "question_delete",
+		"question_id": question.ID.String(),
+	})
+
+	// 3. Return Success Response
+	c.Status(http.StatusNoContent)
+}
+
+// HandleUpdateAnswer changes the text, correctness or explanation of an answer. The question must
+// still be valid afterwards, e.g. a multiple choice question keeps exactly one correct option.
+func (h *Handler) HandleUpdateAnswer(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get the quiz, which the user must own, and the question
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+	question, ok := h.quizQuestion(c, userID, dbQuiz.ID)
+	if !ok {
+		return
+	}
+	answerIDStr := c.Param("answerId")
+	answerID, err := uuid.Parse(answerIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid Answer ID format '%s'", answerIDStr), err)
+		return
+	}
+
+	// 2. Parse the request
+	var req UpdateAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for updating answer %s", answerID), err)
+		return
+	}
+	if req.Text == nil && req.IsCorrect == nil && req.Explanation == nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Nothing to update for answer %s", answerID), errors.New("set text, is_correct or explanation"))
+		return
+	}
+
+	// 3. Apply the change to the answers of the question in one transaction
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to begin transaction", err)
+		return
+	}
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+	qtx := h.DB.Queries.WithTx(tx)
+
+	if err := qtx.TouchQuiz(ctx, dbQuiz.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update quiz %s", dbQuiz.ID), err)
+		return
+	}
+	answers, err := qtx.ListAnswersByQuestionID(ctx, question.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get answers of question %s", question.ID), err)
+		return
+	}
+	index := slices.IndexFunc(answers, func(a db.Answer) bool { return a.ID == answerID })
+	if index < 0 {
+		h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Answer not found: %s", answerID), fmt.Errorf("answer is not part of question %s", question.ID))
+		return
+	}
+
+	edited, err := editAnswer(question, answers, index, req)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid change of answer %s", answerID), err)
+		return
+	}
+
+	// Store every answer that changed, marking one option correct may have unmarked another
+	var changedIDs []string
+	for i := range edited {
+		if edited[i] == answers[i] {
+			continue
+		}
+		updated, err := qtx.UpdateAnswerContent(ctx, db.UpdateAnswerContentParams{
+			ID:           edited[i].ID,
+			Answer:       edited[i].Answer,
+			IsCorrect:    edited[i].IsCorrect,
+			Explanation:  edited[i].Explanation,
+			NumericValue: edited[i].NumericValue,
+		})
+		if err != nil {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update answer %s", edited[i].ID), err)
+			return
+		}
+		edited[i] = updated
+		changedIDs = append(changedIDs, updated.ID.String())
+	}
+	topic := topicTitle(ctx, qtx, question.TopicID)
+	if err := tx.Commit(ctx); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to commit update of answer %s", answerID), err)
+		return
+	}
+
+	log.Printf("INFO: User %s updated answer %s of question %s (%d answers changed)", userID, answerID, question.ID, len(changedIDs))
+	h.logQuizUpdate(ctx, userID, dbQuiz.ID, map[string]interface{}{
+		"title":       dbQuiz.Title,
+		"change":      "answer_update",
+		"question_id": question.ID.String(),
+		"answer_ids":  changedIDs,
+	})
+
+	// 4. Return the question with its updated answers
+	c.JSON(http.StatusOK, newResponseQuestion(question, topic, edited))
+}
+
+// editAnswer returns the answers of the question with req applied to the answer at index, leaving
+// answers itself unchanged. It fails if the question would no longer be valid.
+func editAnswer(question db.Question, answers []db.Answer, index int, req UpdateAnswerRequest) ([]db.Answer, error) {
+	edited := slices.Clone(answers)
+	answer := &edited[index]
+	if req.Text != nil {
+		text := strings.TrimSpace(*req.Text)
+		if text == "" {
+			return nil, errors.New("text must not be empty")
+		}
+		if question.QuestionType == db.QuestionTypeNumeric {
+			// The value is what answers are graded against, the text only displays it
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("the answer of a numeric question must be a number: %w", err)
+			}
+			text = strconv.FormatFloat(value, 'g', -1, 64)
+			answer.NumericValue = pgtype.Float8{Float64: value, Valid: true}
+		}
+		answer.Answer = text
+	}
+	if req.IsCorrect != nil && *req.IsCorrect != answer.IsCorrect {
+		switch question.QuestionType {
+		case db.QuestionTypeMultipleChoice, db.QuestionTypeTrueFalse:
+			// Moving the single correct option; unmarking it alone is rejected by the validation below
+			if *req.IsCorrect {
+				for i := range edited {
+					edited[i].IsCorrect = false
+				}
+			}
+			answer.IsCorrect = *req.IsCorrect
+		case db.QuestionTypeMultiSelect:
+			answer.IsCorrect = *req.IsCorrect
+		default:
+			// Every answer row of the other types is part of the answer key
+			return nil, fmt.Errorf("cannot change correctness, all answers of %s questions are correct", question.QuestionType)
+		}
+	}
+	if req.Explanation != nil {
+		explanation := strings.TrimSpace(*req.Explanation)
+		answer.Explanation = pgtype.Text{String: explanation, Valid: explanation != ""}
+	}
+	if err := gemini.ValidateQuestion(questionFromAnswers(question.QuestionType, question.Question, edited)); err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+// HandleReorderQuestions puts the questions of a quiz in the order of the request. All positions are
+// rewritten in one statement, so readers see either the old or the new order.
+func (h *Handler) HandleReorderQuestions(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get the quiz, which the user must own
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+
+	// 2. Parse the request
+	var req ReorderQuestionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for reordering questions of quiz %s", dbQuiz.ID), err)
+		return
+	}
+
+	// 3. Rewrite the positions in one transaction
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to begin transaction", err)
+		return
+	}
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+	qtx := h.DB.Queries.WithTx(tx)
+
+	if err := qtx.TouchQuiz(ctx, dbQuiz.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to update quiz %s", dbQuiz.ID), err)
+		return
+	}
+	questions, err := qtx.ListQuestionsByQuizID(ctx, dbQuiz.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get questions of quiz %s", dbQuiz.ID), err)
+		return
+	}
+	questionIDs := make([]uuid.UUID, len(questions))
+	for i, q := range questions {
+		questionIDs[i] = q.ID
+	}
+	if err := validateQuestionOrder(questionIDs, req.QuestionIDs); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid order for questions of quiz %s", dbQuiz.ID), err)
+		return
+	}
+	if _, err := qtx.SetQuestionPositions(ctx, db.SetQuestionPositionsParams{
+		QuestionIds: req.QuestionIDs,
+		QuizID:      dbQuiz.ID,
+	}); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to reorder questions of quiz %s", dbQuiz.ID), err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to commit new order of quiz %s", dbQuiz.ID), err)
+		return
+	}
+
+	log.Printf("INFO: User %s reordered the %d questions of quiz %s", userID, len(req.QuestionIDs), dbQuiz.ID)
+	h.logQuizUpdate(ctx, userID, dbQuiz.ID, map[string]interface{}{
+		"title":  dbQuiz.Title,
+		"change": "question_reorder",
+	})
+
+	// 4. Return the new order
+	c.JSON(http.StatusOK, gin.H{"question_ids": req.QuestionIDs})
+}
+
+// validateQuestionOrder checks that order is a permutation of the quiz's questionIDs: each of them exactly once
+func validateQuestionOrder(questionIDs []uuid.UUID, order []uuid.UUID) error {
+	remaining := make(map[uuid.UUID]bool, len(questionIDs))
+	for _, id := range questionIDs {
+		remaining[id] = true
+	}
+	for _, id := range order {
+		if !remaining[id] {
+			return fmt.Errorf("question %s is not part of the quiz or listed twice", id)
+		}
+		delete(remaining, id)
+	}
+	if len(remaining) > 0 {
+		return fmt.Errorf("%d questions of the quiz are missing from the order", len(remaining))
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"quizbuilderai/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// testAnswers returns answers with the texts, those at the correct indexes marked correct
+func testAnswers(texts []string, correct ...int) []db.Answer {
+	answers := make([]db.Answer, len(texts))
+	for i, text := range texts {
+		answers[i] = db.Answer{ID: uuid.New(), Answer: text, Position: int32(i + 1)}
+	}
+	for _, i := range correct {
+		answers[i].IsCorrect = true
+	}
+	return answers
+}
+
+func TestEditAnswer(t *testing.T) {
+	yes, no := true, false
+	text := func(s string) *string { return &s }
+	question := func(typ db.QuestionType) db.Question {
+		return db.Question{ID: uuid.New(), Question: "Question", QuestionType: typ}
+	}
+
+	multipleChoice := testAnswers([]string{"Chlorophyll", "Keratin", "Melanin", "Hemoglobin"}, 0)
+	trueFalse := testAnswers([]string{"True", "False"}, 1)
+	multiSelect := testAnswers([]string{"Oxygen", "Glucose", "Nitrogen"}, 0)
+	shortAnswer := testAnswers([]string{"photosynthesis", "photo-synthesis"}, 0, 1)
+	numeric := testAnswers([]string{"9.81"}, 0)
+	numeric[0].NumericValue = pgtype.Float8{Float64: 9.81, Valid: true}
+	numeric[0].Tolerance = pgtype.Float8{Float64: 0.01, Valid: true}
+	ordering := testAnswers([]string{"Light reactions", "Calvin cycle", "Glucose export"}, 0, 1, 2)
+	for i := range ordering {
+		ordering[i].CorrectPosition = pgtype.Int4{Int32: int32(i + 1), Valid: true}
+	}
+	matching := testAnswers([]string{"Gas exchange", "Water transport"}, 0, 1)
+	matching[0].MatchText = pgtype.Text{String: "Stomata", Valid: true}
+	matching[1].MatchText = pgtype.Text{String: "Xylem", Valid: true}
+
+	tests := []struct {
+		name        string
+		question    db.Question
+		answers     []db.Answer
+		index       int
+		req         UpdateAnswerRequest
+		wantErr     bool
+		wantCorrect []bool // Correctness of every answer afterwards, nil to skip
+		check       func(t *testing.T, edited []db.Answer)
+	}{
+		{
+			name:        "multiple choice moves the correct option",
+			question:    question(db.QuestionTypeMultipleChoice),
+			answers:     multipleChoice,
+			index:       2,
+			req:         UpdateAnswerRequest{IsCorrect: &yes},
+			wantCorrect: []bool{false, false, true, false},
+		},
+		{
+			name:     "multiple choice can't unmark its only correct option",
+			question: question(db.QuestionTypeMultipleChoice),
+			answers:  multipleChoice,
+			index:    0,
+			req:      UpdateAnswerRequest{IsCorrect: &no},
+			wantErr:  true,
+		},
+		{
+			name:        "multiple choice marking the correct option again changes nothing",
+			question:    question(db.QuestionTypeMultipleChoice),
+			answers:     multipleChoice,
+			index:       0,
+			req:         UpdateAnswerRequest{IsCorrect: &yes},
+			wantCorrect: []bool{true, false, false, false},
+		},
+		{
+			name:     "multiple choice rejects a duplicate option",
+			question: question(db.QuestionTypeMultipleChoice),
+			answers:  multipleChoice,
+			index:    1,
+			req:      UpdateAnswerRequest{Text: text(" Chlorophyll ")},
+			wantErr:  true,
+		},
+		{
+			name:     "empty text",
+			question: question(db.QuestionTypeMultipleChoice),
+			answers:  multipleChoice,
+			index:    1,
+			req:      UpdateAnswerRequest{Text: text("  ")},
+			wantErr:  true,
+		},
+		{
+			name:        "true/false moves the correct option",
+			question:    question(db.QuestionTypeTrueFalse),
+			answers:     trueFalse,
+			index:       0,
+			req:         UpdateAnswerRequest{IsCorrect: &yes},
+			wantCorrect: []bool{true, false},
+		},
+		{
+			name:        "multi select marks another option correct",
+			question:    question(db.QuestionTypeMultiSelect),
+			answers:     multiSelect,
+			index:       1,
+			req:         UpdateAnswerRequest{IsCorrect: &yes},
+			wantCorrect: []bool{true, true, false},
+		},
+		{
+			name:     "multi select keeps a correct option",
+			question: question(db.QuestionTypeMultiSelect),
+			answers:  multiSelect,
+			index:    0,
+			req:      UpdateAnswerRequest{IsCorrect: &no},
+			wantErr:  true,
+		},
+		{
+			name:     "short answer correctness can't change",
+			question: question(db.QuestionTypeShortAnswer),
+			answers:  shortAnswer,
+			index:    1,
+			req:      UpdateAnswerRequest{IsCorrect: &no},
+			wantErr:  true,
+		},
+		{
+			name:     "numeric correctness can't change",
+			question: question(db.QuestionTypeNumeric),
+			answers:  numeric,
+			index:    0,
+			req:      UpdateAnswerRequest{IsCorrect: &no},
+			wantErr:  true,
+		},
+		{
+			name:     "ordering correctness can't change",
+			question: question(db.QuestionTypeOrdering),
+			answers:  ordering,
+			index:    1,
+			req:      UpdateAnswerRequest{IsCorrect: &no},
+			wantErr:  true,
+		},
+		{
+			name:     "matching correctness can't change",
+			question: question(db.QuestionTypeMatching),
+			answers:  matching,
+			index:    0,
+			req:      UpdateAnswerRequest{IsCorrect: &no},
+			wantErr:  true,
+		},
+		{
+			name:     "numeric text sets the value",
+			question: question(db.QuestionTypeNumeric),
+			answers:  numeric,
+			index:    0,
+			req:      UpdateAnswerRequest{Text: text(" 9.810 ")},
+			check: func(t *testing.T, edited []db.Answer) {
+				if edited[0].Answer != "9.81" || edited[0].NumericValue != (pgtype.Float8{Float64: 9.81, Valid: true}) {
+					t.Errorf("answer = %q %v, want \"9.81\" with the value 9.81", edited[0].Answer, edited[0].NumericValue)
+				}
+			},
+		},
+		{
+			name:     "numeric text must be a number",
+			question: question(db.QuestionTypeNumeric),
+			answers:  numeric,
+			index:    0,
+			req:      UpdateAnswerRequest{Text: text("about ten")},
+			wantErr:  true,
+		},
+		{
+			name:     "matching rejects a duplicate item",
+			question: question(db.QuestionTypeMatching),
+			answers:  matching,
+			index:    1,
+			req:      UpdateAnswerRequest{Text: text("Gas exchange")},
+			wantErr:  true,
+		},
+		{
+			name:     "blank explanation removes it",
+			question: question(db.QuestionTypeMultipleChoice),
+			answers:  multipleChoice,
+			index:    0,
+			req:      UpdateAnswerRequest{Explanation: text("  ")},
+			check: func(t *testing.T, edited []db.Answer) {
+				if edited[0].Explanation.Valid {
+					t.Errorf("explanation = %q, want none", edited[0].Explanation.String)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := make([]db.Answer, len(tt.answers))
+			copy(original, tt.answers)
+
+			edited, err := editAnswer(tt.question, tt.answers, tt.index, tt.req)
+			if !reflect.DeepEqual(tt.answers, original) {
+				t.Error("editAnswer changed the answers it was given")
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("editAnswer accepted an invalid change")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("editAnswer: %v", err)
+			}
+			if tt.wantCorrect != nil {
+				correct := make([]bool, len(edited))
+				for i, a := range edited {
+					correct[i] = a.IsCorrect
+				}
+				if !reflect.DeepEqual(correct, tt.wantCorrect) {
+					t.Errorf("correct = %v, want %v", correct, tt.wantCorrect)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, edited)
+			}
+		})
+	}
+}
+
+func TestValidateQuestionOrder(t *testing.T) {
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	tests := []struct {
+		name    string
+		order   []uuid.UUID
+		wantErr bool
+	}{
+		{"same order", []uuid.UUID{ids[0], ids[1], ids[2]}, false},
+		{"new order", []uuid.UUID{ids[2], ids[0], ids[1]}, false},
+		{"missing question", []uuid.UUID{ids[2], ids[0]}, true},
+		{"duplicate question", []uuid.UUID{ids[2], ids[0], ids[0]}, true},
+		{"duplicate instead of a question", []uuid.UUID{ids[2], ids[0], ids[2]}, true},
+		{"question of another quiz", []uuid.UUID{ids[2], ids[0], ids[1], uuid.New()}, true},
+		{"empty", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateQuestionOrder(ids, tt.order)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateQuestionOrder = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
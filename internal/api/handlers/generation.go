@@ -0,0 +1,1016 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/gemini"
+	"quizbuilderai/internal/jobs"
+	"quizbuilderai/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// jobsDirName is the directory under os.TempDir() holding the inputs of queued jobs
+const jobsDirName = "quizbuilderai-jobs"
+
+const (
+	// generationJobHeartbeat is how often a worker shows it is still running its job
+	generationJobHeartbeat = 30 * time.Second
+	// generationJobLease is how long a running job may go without a heartbeat before any
+	// instance considers its worker gone and fails it
+	generationJobLease = 2 * time.Minute
+)
+
+// errGenerationJobLost is returned when saving the result of a job that stopped running meanwhile,
+// because another instance considered its worker gone and failed it
+var errGenerationJobLost = errors.New("generation job is no longer running")
+
+// generationJobFile is an uploaded file saved to the job directory
+type generationJobFile struct {
+	Name       string     `json:"name"`
+	Path       string     `json:"path"`
+	Size       int64      `json:"size"`
+	Hash       string     `json:"hash,omitempty"`        // Hex encoded SHA-256 of the content
+	MaterialID *uuid.UUID `json:"material_id,omitempty"` // Set for stored files of earlier quizzes, which are reused rather than created
+}
+
+// generationJobVideo is a video whose transcript was saved to the job directory
+type generationJobVideo struct {
+	URL             string `json:"url"`
+	Path            string `json:"path"`
+	Size            int64  `json:"size"`
+	VideoID         string `json:"video_id,omitempty"`
+	Title           string `json:"title,omitempty"`
+	Channel         string `json:"channel,omitempty"`
+	DurationSeconds int    `json:"duration_seconds,omitempty"`
+	Language        string `json:"language,omitempty"` // Caption language of the transcript
+	Hash            string `json:"hash,omitempty"`     // Hex encoded SHA-256 of the saved transcript
+	// Set for videos of earlier quizzes, which are reused rather than created
+	MaterialID *uuid.UUID `json:"material_id,omitempty"`
+}
+
+// generationJobPage is a web page whose content was saved to the job directory
+type generationJobPage struct {
+	URL      string `json:"url"` // URL the page was fetched from, after redirects
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Title    string `json:"title,omitempty"`
+	SiteName string `json:"site_name,omitempty"`
+	Hash     string `json:"hash,omitempty"` // Hex encoded SHA-256 of the saved content
+	// Set for pages of earlier quizzes, which are reused rather than created
+	MaterialID *uuid.UUID `json:"material_id,omitempty"`
+}
+
+// materialMetadata is stored in materials.metadata for YouTube videos and web pages
+type materialMetadata struct {
+	Source          string `json:"source"` // "youtube" or "web"
+	VideoID         string `json:"video_id,omitempty"`
+	Title           string `json:"title,omitempty"`
+	Channel         string `json:"channel,omitempty"`
+	DurationSeconds int    `json:"duration_seconds,omitempty"`
+	Language        string `json:"language,omitempty"`
+	SiteName        string `json:"site_name,omitempty"`
+}
+
+// maxTitleFileNameLength bounds the part of a job file name taken from a title, in bytes
+const maxTitleFileNameLength = 100
+
+// titledFileName names the text file of a video or web page after its title, e.g. "Intro to Go.txt",
+// so the generator sees a meaningful document name. Untitled files are named fallback.
+func titledFileName(title, fallback string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(title))
+	if len(name) > maxTitleFileNameLength {
+		cut := maxTitleFileNameLength
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = strings.TrimSpace(name[:cut])
+	}
+	if name == "" || name == "." || name == ".." {
+		name = fallback
+	}
+	return name + ".txt"
+}
+
+// jobDocumentName is the name the generator sees for a saved video or page: the job file name without its index prefix
+func jobDocumentName(path string) string {
+	name := filepath.Base(path)
+	if _, title, found := strings.Cut(name, "_"); found {
+		return title
+	}
+	return name
+}
+
+// generationJobInput is stored in generation_jobs.input and holds everything a worker needs
+type generationJobInput struct {
+	Dir       string                   `json:"dir"` // Job directory, removed once the job finishes
+	Files     []generationJobFile      `json:"files"`
+	Videos    []generationJobVideo     `json:"videos"`
+	Pages     []generationJobPage      `json:"pages"`
+	Options   gemini.GenerationOptions `json:"options"`
+	CacheID   *uuid.UUID               `json:"cache_id,omitempty"` // Set to build the quiz from a cached generation instead of generating
+	UserName  string                   `json:"user_name"`          // For notifications
+	UserEmail string                   `json:"user_email"`         // For notifications
+}
+
+// documentFiles returns the inputs in the form the generator expects. PDFs with extractable text
+// are split into chunks of pages, DOCX, PPTX and EPUB files into chunks of sections, slides or chapters.
+func (in generationJobInput) documentFiles() ([]gemini.DocumentFile, error) {
+	var documents []gemini.DocumentFile
+	for _, file := range in.Files {
+		documents = append(documents, gemini.DocumentFile{Name: file.Name, Path: file.Path, Size: file.Size})
+	}
+	for _, video := range in.Videos {
+		documents = append(documents, gemini.DocumentFile{Name: jobDocumentName(video.Path), Path: video.Path, Size: video.Size})
+	}
+	for _, page := range in.Pages {
+		documents = append(documents, gemini.DocumentFile{Name: jobDocumentName(page.Path), Path: page.Path, Size: page.Size})
+	}
+	return gemini.SplitDocuments(documents, gemini.MaxChunkTokens)
+}
+
+// parseGenerationOptions reads the generation options from the generate form.
+// questionCount, difficulty and language are plain values, focusTopics and questionTypes may be repeated,
+// and bloomMix is a JSON object of Bloom level to percentage, e.g. {"apply":60,"analyze":40}.
+func parseGenerationOptions(form *multipart.Form) (gemini.GenerationOptions, error) {
+	var opts gemini.GenerationOptions
+	value := func(key string) string {
+		if values := form.Value[key]; len(values) > 0 {
+			return strings.TrimSpace(values[0])
+		}
+		return ""
+	}
+
+	if v := value("questionCount"); v != "" {
+		count, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("question count must be a number")
+		}
+		if count < 1 {
+			return opts, fmt.Errorf("question count must be between 1 and %d", gemini.MaxQuestionCount)
+		}
+		opts.QuestionCount = count
+	}
+	opts.Difficulty = value("difficulty")
+	if v := value("bloomMix"); v != "" {
+		if err := json.Unmarshal([]byte(v), &opts.BloomMix); err != nil {
+			return opts, fmt.Errorf("bloom mix must be a JSON object of level to percentage")
+		}
+	}
+	opts.FocusTopics = form.Value["focusTopics"]
+	opts.Language = value("language")
+	opts.QuestionTypes = form.Value["questionTypes"]
+
+	opts = opts.Normalize()
+	return opts, opts.Validate()
+}
+
+// ResponseGenerationJob is the job status returned to the frontend
+type ResponseGenerationJob struct {
+	ID         uuid.UUID              `json:"id"`
+	Status     db.GenerationJobStatus `json:"status"`
+	QuizID     *uuid.UUID             `json:"quiz_id,omitempty"` // Set once the job succeeded
+	Error      *string                `json:"error,omitempty"`   // Set if the job failed
+	CreatedAt  time.Time              `json:"created_at"`
+	StartedAt  *time.Time             `json:"started_at,omitempty"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+	// Duplicate questions merged away while generating, e.g. from slides and notes of the same lecture
+	MergedQuestions int32 `json:"merged_questions"`
+}
+
+// nodeIDFromEnv identifies this instance on the jobs it creates: NODE_ID if set, the hostname otherwise.
+// It has to stay the same across restarts, like the job directories, for queued jobs to be run after one.
+func nodeIDFromEnv() string {
+	if nodeID := strings.TrimSpace(os.Getenv("NODE_ID")); nodeID != "" {
+		return nodeID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Printf("WARN: Failed to get hostname for the node ID, queued generation jobs won't survive a restart: %v", err)
+		return uuid.NewString()
+	}
+	return hostname
+}
+
+// newJobDir creates the directory holding the inputs of a job
+func newJobDir(jobID uuid.UUID) (string, error) {
+	dir := filepath.Join(os.TempDir(), jobsDirName, jobID.String())
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create job directory: %w", err)
+	}
+	return dir, nil
+}
+
+// saveJobFile writes data into the job directory. The index keeps names unique
+// when the same filename is uploaded twice.
+func saveJobFile(dir string, index int, filename string, data []byte) (string, error) {
+	path := jobFilePath(dir, index, filename)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", fmt.Errorf("failed to save job file: %w", err)
+	}
+	return path, nil
+}
+
+// jobFilePath is the path of an input in the job directory, e.g. "<dir>/2_notes.pdf"
+func jobFilePath(dir string, index int, filename string) string {
+	return filepath.Join(dir, fmt.Sprintf("%d_%s", index, filepath.Base(filename)))
+}
+
+// StartGenerationWorkers starts the background workers that generate quizzes.
+// Jobs this node left queued in a previous run are re-queued, jobs of other nodes are left to them
+// as their inputs are on their disks. Running jobs whose worker stopped sending
+// heartbeats, on this or any other instance, are failed now and periodically until ctx is done.
+func (h *Handler) StartGenerationWorkers(ctx context.Context, workers int, queueSize int) {
+	h.Jobs = jobs.NewQueue(workers, queueSize, h.processGenerationJob)
+	h.Jobs.Start(ctx)
+
+	h.failStaleGenerationJobs(ctx)
+	go func() {
+		ticker := time.NewTicker(generationJobLease / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				h.failStaleGenerationJobs(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	queued, err := h.DB.Queries.ListQueuedGenerationJobsByNode(ctx, pgtype.Text{String: h.NodeID, Valid: true})
+	if err != nil {
+		log.Printf("ERROR: Failed to list queued generation jobs: %v", err)
+		return
+	}
+	for _, job := range queued {
+		if err := h.Jobs.Enqueue(job.ID); err != nil {
+			// The job stays queued in the database and is picked up on the next start
+			log.Printf("WARN: Failed to re-queue generation job %s: %v", job.ID, err)
+			continue
+		}
+		log.Printf("INFO: Re-queued generation job %s", job.ID)
+	}
+}
+
+// failStaleGenerationJobs fails running jobs whose lease expired, giving back their reserved tokens.
+// Jobs of live workers, including those of other instances, keep their heartbeat fresh and are left alone.
+func (h *Handler) failStaleGenerationJobs(ctx context.Context) {
+	stale, err := h.DB.Queries.ClaimStaleGenerationJobs(ctx, int32(generationJobLease/time.Second))
+	if err != nil {
+		log.Printf("ERROR: Failed to claim stale generation jobs: %v", err)
+		return
+	}
+	for _, job := range stale {
+		log.Printf("WARN: Generation job %s has had no heartbeat for %s, marking it failed", job.ID, generationJobLease)
+		h.failGenerationJob(ctx, job, gemini.TokenUsage{}, "Generation interrupted", errors.New("the server stopped while the quiz was being generated, please try again"))
+	}
+}
+
+// keepGenerationJobAlive renews the job's heartbeat until stop is called. The returned context is
+// cancelled if the job stops running meanwhile, e.g. because another instance considered it lost.
+func (h *Handler) keepGenerationJobAlive(ctx context.Context, jobID uuid.UUID) (jobCtx context.Context, stop func()) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(generationJobHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-jobCtx.Done():
+				return
+			}
+			n, err := h.DB.Queries.HeartbeatGenerationJob(jobCtx, jobID)
+			if err != nil {
+				// The lease outlasts a few missed heartbeats
+				log.Printf("WARN: Failed to renew heartbeat of generation job %s: %v", jobID, err)
+				continue
+			}
+			if n == 0 {
+				log.Printf("WARN: Generation job %s is no longer running, cancelling it", jobID)
+				cancel()
+				return
+			}
+		}
+	}()
+	return jobCtx, cancel
+}
+
+// StopGenerationWorkers waits for running jobs to finish, cancelling them if ctx expires first
+func (h *Handler) StopGenerationWorkers(ctx context.Context) {
+	if h.Jobs != nil {
+		h.Jobs.Stop(ctx)
+	}
+}
+
+// processGenerationJob runs a single generation job. It is called by the job workers.
+func (h *Handler) processGenerationJob(ctx context.Context, jobID uuid.UUID) {
+	if ctx.Err() != nil {
+		// Shutting down, leave the job queued for the next start
+		return
+	}
+
+	// Claim the job; this fails if another worker already took it
+	job, err := h.DB.Queries.StartGenerationJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("WARN: Generation job %s is no longer queued, skipping", jobID)
+			return
+		}
+		log.Printf("ERROR: Failed to start generation job %s: %v", jobID, err)
+		return
+	}
+	startTime := time.Now()
+	userID := job.UserID
+	log.Printf("INFO: Started generation job %s for user %s", job.ID, userID)
+
+	ctx, stopHeartbeat := h.keepGenerationJobAlive(ctx, job.ID)
+	defer stopHeartbeat()
+
+	// Subscribers are told the job is over once this returns
+	progress := h.Progress.Func(job.ID)
+	defer h.Progress.Close(job.ID)
+
+	var input generationJobInput
+	if err := json.Unmarshal(job.Input, &input); err != nil {
+		h.failGenerationJob(ctx, job, gemini.TokenUsage{}, "Failed to decode generation job input", err)
+		return
+	}
+	// The inputs are only needed while the job runs
+	defer func() {
+		if input.Dir == "" {
+			return
+		}
+		if err := os.RemoveAll(input.Dir); err != nil {
+			log.Printf("WARN: Failed to remove job directory %s: %v", input.Dir, err)
+		}
+	}()
+
+	var geminiResponse *models.GeminiQuizResponse
+	var usage gemini.TokenUsage
+	if input.CacheID != nil {
+		// Built from the output of an identical earlier generation, which uses no tokens
+		geminiResponse, err = h.cachedQuiz(ctx, input)
+		if err != nil {
+			h.failGenerationJob(ctx, job, usage, "Failed to load the cached quiz", err)
+			return
+		}
+		progress.Emit(gemini.ProgressEvent{
+			Stage:   gemini.StageCacheHit,
+			Message: fmt.Sprintf("Reused %d questions generated earlier from the same material", len(geminiResponse.Questions)),
+		})
+	} else {
+		documentFiles, err := input.documentFiles()
+		if err != nil {
+			h.failGenerationJob(ctx, job, gemini.TokenUsage{}, "Failed to read the uploaded documents", err)
+			return
+		}
+		if len(documentFiles) == 0 {
+			h.failGenerationJob(ctx, job, gemini.TokenUsage{}, "No valid files or video URLs were processed", errors.New("no valid content provided or processed. Please check files and URLs"))
+			return
+		}
+
+		// Call the configured generator to generate the quiz
+		log.Printf("INFO: Calling %s to process %d documents for user %s (job %s)", h.Generator.Name(), len(documentFiles), userID, job.ID)
+		geminiResponse, usage, err = h.Generator.ProcessDocuments(ctx, documentFiles, input.Options, progress)
+		if err != nil {
+			h.failGenerationJob(ctx, job, usage, "Gemini processing failed", err)
+			return
+		}
+	}
+
+	// Log received token counts
+	log.Printf("INFO: Gemini Token Usage Reported: User=%s, Prompt=%d, Candidates=%d, Total=%d", userID, usage.PromptTokens, usage.CandidateTokens, usage.TotalTokens)
+
+	if geminiResponse == nil || len(geminiResponse.Questions) == 0 {
+		h.failGenerationJob(ctx, job, usage, "Gemini returned no questions", errors.New("quiz generation resulted in no questions"))
+		return
+	}
+
+	log.Printf("INFO: Gemini generated quiz titled '%s' with %d questions (%d duplicates merged) for user %s", geminiResponse.Title, len(geminiResponse.Questions), geminiResponse.Merged, userID)
+
+	createdQuiz, materialCount, errorContext, err := h.saveGeneratedQuiz(ctx, job, input, geminiResponse, usage)
+	if errors.Is(err, errGenerationJobLost) {
+		// The instance that failed the job gave the tokens back and reports the failure
+		log.Printf("WARN: Generation job %s was failed elsewhere before its quiz was saved, dropping the result", job.ID)
+		return
+	}
+	if err != nil {
+		h.failGenerationJob(ctx, job, usage, errorContext, err)
+		return
+	}
+	progress.Emit(gemini.ProgressEvent{
+		Stage:   gemini.StageDBCommit,
+		Message: fmt.Sprintf("Saved quiz with %d questions (%d duplicates merged)", len(geminiResponse.Questions), geminiResponse.Merged),
+		Usage:   &usage,
+		QuizID:  createdQuiz.ID.String(),
+	})
+	if input.CacheID == nil {
+		h.storeGenerationCache(ctx, input, geminiResponse)
+	}
+
+	log.Printf("INFO: Successfully created quiz %s with %d questions for user %s", createdQuiz.ID, len(geminiResponse.Questions), userID)
+	progress.Emit(gemini.ProgressEvent{
+		Stage:   gemini.StageCompleted,
+		Message: "Quiz generated successfully!",
+		QuizID:  createdQuiz.ID.String(),
+	})
+
+	// Calculate duration (time spent waiting in the queue is not included)
+	duration := time.Since(startTime)
+	log.Printf("INFO: Quiz %s generation took %s", createdQuiz.ID, duration)
+
+	// Log quiz creation activity
+	h.logActivity(ctx, userID, db.ActivityActionQuizCreate,
+		db.NullActivityTargetType{ActivityTargetType: db.ActivityTargetTypeQuiz, Valid: true},
+		pgtype.UUID{Bytes: createdQuiz.ID, Valid: true},
+		map[string]interface{}{
+			"title":            createdQuiz.Title,
+			"question_count":   len(geminiResponse.Questions),
+			"material_count":   materialCount,
+			"merged_questions": geminiResponse.Merged,
+			"prompt_tokens":    usage.PromptTokens,
+			"candidate_tokens": usage.CandidateTokens,
+			"total_tokens":     usage.TotalTokens,
+			"duration_ms":      duration.Milliseconds(),
+			"job_id":           job.ID.String(),
+		})
+
+	// Send Discord notification for quiz creation using Embed
+	quizEmbed := DiscordEmbed{
+		Title: "📝 Quiz Created",
+		Color: 0x4CAF50, // Green color
+		Fields: []DiscordEmbedField{
+			{Name: "Title", Value: createdQuiz.Title, Inline: true},
+			{Name: "Questions", Value: fmt.Sprintf("%d", len(geminiResponse.Questions)), Inline: true},
+			{Name: "Materials", Value: fmt.Sprintf("%d", materialCount), Inline: true},
+			{Name: "Tokens Used", Value: fmt.Sprintf("%d", usage.TotalTokens), Inline: true},
+			{Name: "Time Taken", Value: fmt.Sprintf("%.2fs", duration.Seconds()), Inline: true},
+			{Name: "Created By", Value: fmt.Sprintf("%s (%s)", input.UserName, input.UserEmail), Inline: false},
+			{Name: "Quiz ID", Value: fmt.Sprintf("`%s`", createdQuiz.ID.String()), Inline: false},
+		},
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	h.sendDiscordNotification(quizEmbed)
+}
+
+// failGenerationJob marks a job as failed and reports the error like a failed request would.
+// The job's reserved tokens are given back, tokens it consumed before failing are refunded,
+// and progress subscribers receive a final failed event.
+func (h *Handler) failGenerationJob(ctx context.Context, job db.GenerationJob, consumed gemini.TokenUsage, errorContext string, err error) {
+	// Record the failure even if the job was cancelled by a shutdown
+	ctx = context.WithoutCancel(ctx)
+
+	h.Progress.Publish(job.ID, gemini.ProgressEvent{
+		Stage:   gemini.StageFailed,
+		Message: errorContext,
+		Error:   err.Error(),
+	})
+	defer h.Progress.Close(job.ID)
+
+	h.notifyError(ctx, job.UserID, http.StatusInternalServerError, errorContext, fmt.Sprintf("/api/jobs/%s", job.ID), err)
+
+	if releaseErr := h.releaseTokenReservation(ctx, job, consumed); releaseErr != nil {
+		log.Printf("ERROR: Failed to release token reservation of generation job %s: %v", job.ID, releaseErr)
+	}
+
+	_, dbErr := h.DB.Queries.FailGenerationJob(ctx, db.FailGenerationJobParams{
+		ID:    job.ID,
+		Error: pgtype.Text{String: fmt.Sprintf("%s: %v", errorContext, err), Valid: true},
+	})
+	if errors.Is(dbErr, sql.ErrNoRows) {
+		log.Printf("WARN: Generation job %s had already finished, not marking it failed", job.ID)
+	} else if dbErr != nil {
+		log.Printf("ERROR: Failed to mark generation job %s as failed: %v", job.ID, dbErr)
+	}
+}
+
+// saveGeneratedQuiz stores the generated quiz, its materials, topics, questions and answers,
+// settles the job's token reservation and marks the job succeeded, all in one transaction.
+// Returns errGenerationJobLost, saving nothing, if the job stopped running meanwhile.
+// On error it also returns a short description of the step that failed.
+func (h *Handler) saveGeneratedQuiz(ctx context.Context, job db.GenerationJob, input generationJobInput, geminiResponse *models.GeminiQuizResponse, usage gemini.TokenUsage) (db.Quize, int, string, error) {
+	var createdQuiz db.Quize // Variable to hold the created quiz
+	userID := job.UserID
+
+	// Start transaction using the connection pool from the DB struct
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		return createdQuiz, 0, "Failed to begin database transaction", err
+	}
+	// Ensure rollback on error
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+
+	qtx := h.DB.Queries.WithTx(tx)
+
+	// --- Token Settlement (Inside Transaction) ---
+	// The tokens reserved when the job was created are replaced by the actual usage
+	if err := settleTokenReservation(ctx, qtx, job, usage); err != nil {
+		return createdQuiz, 0, "Failed to settle token usage", err
+	}
+	// --- End Token Settlement ---
+
+	// The options are kept with the quiz so it can be regenerated the same way
+	optionsJSON, err := json.Marshal(input.Options)
+	if err != nil {
+		return createdQuiz, 0, "Failed to encode generation options", err
+	}
+
+	// Create the main Quiz record
+	quizParams := db.CreateQuizParams{
+		CreatorID:         pgtype.UUID{Bytes: userID, Valid: true},
+		Title:             geminiResponse.Title,
+		Description:       pgtype.Text{String: geminiResponse.Description, Valid: geminiResponse.Description != ""},
+		Visibility:        db.QuizVisibilityPublic, // Default visibility set to public
+		GenerationOptions: optionsJSON,
+	}
+	createdQuiz, err = qtx.CreateQuiz(ctx, quizParams)
+	if err != nil {
+		return createdQuiz, 0, "Failed to create quiz record", err
+	}
+	log.Printf("INFO: Created quiz with ID %s for user %s", createdQuiz.ID, userID)
+
+	// Create and Link Materials to the Quiz (Inside Transaction)
+	processedMaterialCount := 0
+	materialIDs := make(map[string]uuid.UUID) // Material of each input path, to link questions to their source
+
+	// Process uploaded files (DB record creation and linking)
+	linked := make(map[uuid.UUID]bool)                // Materials already linked, as several files can share one
+	unstored := make(map[uuid.UUID]generationJobFile) // Materials whose original is stored once the quiz is committed
+	for _, file := range input.Files {
+		materialID := file.MaterialID // Materials reused from earlier quizzes are only linked
+		if materialID == nil && file.Hash != "" {
+			// A file the user uploaded before is linked to its earlier material rather than duplicated
+			existing, err := qtx.GetMaterialByUserIDAndContentHash(ctx, db.GetMaterialByUserIDAndContentHashParams{
+				UserID:      userID,
+				ContentHash: pgtype.Text{String: file.Hash, Valid: true},
+			})
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return createdQuiz, 0, fmt.Sprintf("Failed to look up earlier uploads of file %s", file.Name), err
+			}
+			if err == nil {
+				log.Printf("INFO: File %s is the same as material %s uploaded before", file.Name, existing.ID)
+				materialID = &existing.ID
+				if !existing.StorageKey.Valid {
+					unstored[existing.ID] = file
+				}
+			}
+		}
+
+		if materialID == nil {
+			// Create Material Record (the original is stored once the quiz is committed)
+			material, err := qtx.CreateMaterial(ctx, db.CreateMaterialParams{
+				UserID:      userID,
+				Title:       file.Name,
+				Metadata:    []byte("{}"),
+				ContentHash: pgtype.Text{String: file.Hash, Valid: file.Hash != ""},
+				// Url is NULL/empty, uploads are downloaded by their storage key
+			})
+			if err != nil {
+				return createdQuiz, 0, fmt.Sprintf("Failed to create material record for file %s", file.Name), err
+			}
+			log.Printf("INFO: Created material record %s for file %s", material.ID, file.Name)
+			materialID = &material.ID
+			unstored[material.ID] = file
+		}
+		materialIDs[file.Path] = *materialID
+		if linked[*materialID] {
+			continue
+		}
+
+		// Link Material to Quiz
+		_, linkErr := qtx.LinkQuizMaterial(ctx, db.LinkQuizMaterialParams{
+			QuizID:     createdQuiz.ID,
+			MaterialID: *materialID,
+		})
+		if linkErr != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to link material %s to quiz %s", *materialID, createdQuiz.ID), linkErr
+		}
+		linked[*materialID] = true
+		processedMaterialCount++
+	} // End loop for uploaded files
+
+	// Process video URLs (Create material with YouTube URL, link to quiz)
+	for _, video := range input.Videos {
+		if video.MaterialID != nil {
+			// Materials reused from earlier quizzes are only linked
+			if _, err := qtx.LinkQuizMaterial(ctx, db.LinkQuizMaterialParams{
+				QuizID:     createdQuiz.ID,
+				MaterialID: *video.MaterialID,
+			}); err != nil {
+				return createdQuiz, 0, fmt.Sprintf("Failed to link reused video material %s to quiz %s", *video.MaterialID, createdQuiz.ID), err
+			}
+			materialIDs[video.Path] = *video.MaterialID
+			processedMaterialCount++
+			continue
+		}
+		// Named after the video, the URL only for jobs queued before video details were fetched
+		videoTitle := video.Title
+		if videoTitle == "" {
+			videoTitle = fmt.Sprintf("YouTube Transcript Source: %s", video.URL)
+		}
+		if len(videoTitle) > 255 {
+			videoTitle = videoTitle[:252] + "..."
+		}
+		metadata, err := json.Marshal(materialMetadata{
+			Source:          "youtube",
+			VideoID:         video.VideoID,
+			Title:           video.Title,
+			Channel:         video.Channel,
+			DurationSeconds: video.DurationSeconds,
+			Language:        video.Language,
+		})
+		if err != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to encode metadata of video %s", video.URL), err
+		}
+
+		// Create material record with the original YouTube URL and the video details
+		material, err := qtx.CreateMaterial(ctx, db.CreateMaterialParams{
+			UserID:   userID,
+			Title:    videoTitle,
+			Url:      pgtype.Text{String: video.URL, Valid: true}, // Store the YouTube URL
+			Metadata: metadata,
+		})
+		if err != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to create material record for video %s", video.URL), err
+		}
+		materialIDs[video.Path] = material.ID
+
+		// Link material to quiz
+		_, linkErr := qtx.LinkQuizMaterial(ctx, db.LinkQuizMaterialParams{
+			QuizID:     createdQuiz.ID,
+			MaterialID: material.ID,
+		})
+		if linkErr != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to link video material %s to quiz %s", material.ID, createdQuiz.ID), linkErr
+		}
+		processedMaterialCount++
+	} // End loop for video URLs
+
+	// Process web pages (Create material with the page URL, link to quiz)
+	for _, page := range input.Pages {
+		if page.MaterialID != nil {
+			// Materials reused from earlier quizzes are only linked
+			if _, err := qtx.LinkQuizMaterial(ctx, db.LinkQuizMaterialParams{
+				QuizID:     createdQuiz.ID,
+				MaterialID: *page.MaterialID,
+			}); err != nil {
+				return createdQuiz, 0, fmt.Sprintf("Failed to link reused page material %s to quiz %s", *page.MaterialID, createdQuiz.ID), err
+			}
+			materialIDs[page.Path] = *page.MaterialID
+			processedMaterialCount++
+			continue
+		}
+		pageTitle := page.Title
+		if pageTitle == "" {
+			pageTitle = page.URL
+		}
+		if len(pageTitle) > 255 {
+			pageTitle = pageTitle[:252] + "..."
+		}
+		metadata, err := json.Marshal(materialMetadata{
+			Source:   "web",
+			Title:    page.Title,
+			SiteName: page.SiteName,
+		})
+		if err != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to encode metadata of page %s", page.URL), err
+		}
+
+		material, err := qtx.CreateMaterial(ctx, db.CreateMaterialParams{
+			UserID:   userID,
+			Title:    pageTitle,
+			Url:      pgtype.Text{String: page.URL, Valid: true},
+			Metadata: metadata,
+		})
+		if err != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to create material record for page %s", page.URL), err
+		}
+		materialIDs[page.Path] = material.ID
+
+		_, linkErr := qtx.LinkQuizMaterial(ctx, db.LinkQuizMaterialParams{
+			QuizID:     createdQuiz.ID,
+			MaterialID: material.ID,
+		})
+		if linkErr != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to link page material %s to quiz %s", material.ID, createdQuiz.ID), linkErr
+		}
+		processedMaterialCount++
+	}
+
+	log.Printf("INFO: Created and linked %d total materials (files, videos and pages) to quiz %s", processedMaterialCount, createdQuiz.ID)
+	// Process Questions and Answers
+	topicCache := make(map[string]uuid.UUID) // Cache found/created topic IDs
+	var position int32                       // Position of the last saved question
+
+	for _, geminiQuestion := range geminiResponse.Questions {
+		if err := gemini.ValidateQuestion(geminiQuestion); err != nil {
+			log.Printf("WARN: Skipping invalid question from Gemini (%v): %+v", err, geminiQuestion)
+			continue
+		}
+
+		// Get or Create Topic
+		topicTitle := geminiQuestion.Topic
+		if topicTitle == "" {
+			topicTitle = "General" // Default topic if Gemini didn't provide one
+			log.Printf("WARN: Gemini question missing topic, using default: '%s'", topicTitle)
+		}
+
+		topicID, found := topicCache[topicTitle]
+		if !found {
+			var err error
+			topicID, err = getOrCreateTopic(ctx, qtx, userID, topicTitle)
+			if err != nil {
+				return createdQuiz, 0, fmt.Sprintf("Failed to get or create topic '%s'", topicTitle), err
+			}
+			topicCache[topicTitle] = topicID
+		}
+
+		// Create Question, in the order the model returned them
+		position++
+		dbQuestion, err := qtx.CreateQuestion(ctx, db.CreateQuestionParams{
+			QuizID:       createdQuiz.ID,
+			TopicID:      topicID,
+			Question:     geminiQuestion.Text,
+			QuestionType: db.QuestionType(geminiQuestion.QuestionType()),
+			Position:     position,
+		})
+		if err != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to create question for quiz %s", createdQuiz.ID), err
+		}
+
+		// Record the material and passage the question was generated from
+		if _, err := qtx.CreateQuestionSource(ctx, questionSourceParams(dbQuestion.ID, geminiQuestion, materialIDs)); err != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to create source for question %s", dbQuestion.ID), err
+		}
+
+		// Create Answers in the shape of the question type
+		if err := createQuestionAnswers(ctx, qtx, dbQuestion.ID, geminiQuestion); err != nil {
+			return createdQuiz, 0, fmt.Sprintf("Failed to create answers for question %s", dbQuestion.ID), err
+		}
+	}
+
+	// Mark the job succeeded, unless it was failed meanwhile, which rolls back the quiz and the charge
+	if _, err := qtx.CompleteGenerationJob(ctx, db.CompleteGenerationJobParams{
+		ID:              job.ID,
+		QuizID:          pgtype.UUID{Bytes: createdQuiz.ID, Valid: true},
+		MergedQuestions: int32(geminiResponse.Merged),
+	}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return createdQuiz, 0, "Generation job is no longer running", errGenerationJobLost
+		}
+		return createdQuiz, 0, fmt.Sprintf("Failed to mark generation job %s as succeeded", job.ID), err
+	}
+
+	// Commit the transaction
+	if err := tx.Commit(ctx); err != nil {
+		return createdQuiz, 0, fmt.Sprintf("Failed to commit transaction for quiz %s", createdQuiz.ID), err
+	}
+
+	// Keep the originals of the uploaded files, the job directory is removed after the job
+	for materialID, file := range unstored {
+		h.storeMaterialFile(ctx, userID, materialID, file)
+	}
+	return createdQuiz, processedMaterialCount, "", nil
+}
+
+// getOrCreateTopic returns the ID of the user's topic with the title, creating the topic if it doesn't exist
+func getOrCreateTopic(ctx context.Context, qtx *db.Queries, userID uuid.UUID, topicTitle string) (uuid.UUID, error) {
+	topic, err := qtx.GetTopicByTitleAndUser(ctx, db.GetTopicByTitleAndUserParams{
+		Title:     topicTitle,
+		CreatorID: pgtype.UUID{Bytes: userID, Valid: true},
+	})
+	if err == nil {
+		// Topic found
+		log.Printf("INFO: Found existing topic '%s' with ID %s for user %s", topicTitle, topic.ID, userID)
+		return topic.ID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		// Other database error
+		return uuid.Nil, fmt.Errorf("database error checking topic '%s': %w", topicTitle, err)
+	}
+
+	// Topic doesn't exist, create it
+	log.Printf("INFO: Topic '%s' not found for user %s, creating new topic.", topicTitle, userID)
+	newTopic, err := qtx.CreateTopic(ctx, db.CreateTopicParams{
+		CreatorID: pgtype.UUID{Bytes: userID, Valid: true},
+		Title:     topicTitle,
+	})
+	if err != nil {
+		return uuid.Nil, err
+	}
+	log.Printf("INFO: Created topic '%s' with ID %s for user %s", topicTitle, newTopic.ID, userID)
+	return newTopic.ID, nil
+}
+
+// maxSourceQuoteLength is the longest quote of a question source that is stored, in bytes
+const maxSourceQuoteLength = 500
+
+// questionSourceParams returns the source of a generated question: the material of the document it
+// was generated from and the pages, video offset and quote the model gave
+func questionSourceParams(questionID uuid.UUID, q models.GeminiQuestion, materialIDs map[string]uuid.UUID) db.CreateQuestionSourceParams {
+	params := db.CreateQuestionSourceParams{QuestionID: questionID}
+	if materialID, ok := materialIDs[q.SourceFile]; ok {
+		params.MaterialID = pgtype.UUID{Bytes: materialID, Valid: true}
+	}
+	if q.FirstPage > 0 {
+		params.PageStart = pgtype.Int4{Int32: int32(q.FirstPage), Valid: true}
+		params.PageEnd = pgtype.Int4{Int32: int32(q.LastPage), Valid: true}
+	}
+	if q.Source.Timestamp > 0 {
+		params.TimestampSeconds = pgtype.Int4{Int32: int32(q.Source.Timestamp), Valid: true}
+	}
+	if quote := strings.TrimSpace(q.Source.Quote); quote != "" {
+		if len(quote) > maxSourceQuoteLength {
+			// Cut at a rune boundary so the quote stays valid UTF-8
+			cut := maxSourceQuoteLength
+			for cut > 0 && !utf8.RuneStart(quote[cut]) {
+				cut--
+			}
+			quote = quote[:cut] + "..."
+		}
+		params.Quote = pgtype.Text{String: quote, Valid: true}
+	}
+	return params
+}
+
+// HandleGetGenerationJob returns the status of a quiz generation job.
+// Once the job succeeded the response contains the ID of the new quiz.
+func (h *Handler) HandleGetGenerationJob(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get User ID from context
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, "User ID not found in context for getting generation job", errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, "User ID in context is not UUID for getting generation job", errors.New("invalid user ID type in context"))
+		return
+	}
+
+	// 2. Get Job ID from URL parameter
+	jobIDStr := c.Param("jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid job ID format: %s", jobIDStr), err)
+		return
+	}
+
+	// 3. Fetch the job, only the user who started it may see it
+	job, err := h.DB.Queries.GetGenerationJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Generation job %s not found", jobID), err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve generation job %s", jobID), err)
+		}
+		return
+	}
+	if job.UserID != userID {
+		h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Generation job %s not found", jobID), errors.New("job belongs to another user"))
+		return
+	}
+
+	// 4. Build the response
+	response := ResponseGenerationJob{
+		ID:              job.ID,
+		Status:          job.Status,
+		CreatedAt:       job.CreatedAt,
+		MergedQuestions: job.MergedQuestions,
+	}
+	if job.QuizID.Valid {
+		quizID := uuid.UUID(job.QuizID.Bytes)
+		response.QuizID = &quizID
+	}
+	if job.Error.Valid {
+		response.Error = &job.Error.String
+	}
+	if job.StartedAt.Valid {
+		response.StartedAt = &job.StartedAt.Time
+	}
+	if job.FinishedAt.Valid {
+		response.FinishedAt = &job.FinishedAt.Time
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleGenerationJobEvents streams the progress of a generation job as Server-Sent Events.
+// Events that happened before the client connected are replayed first; the stream ends
+// after the final completed or failed event.
+func (h *Handler) HandleGenerationJobEvents(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get User ID from context
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, "User ID not found in context for streaming generation job events", errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, "User ID in context is not UUID for streaming generation job events", errors.New("invalid user ID type in context"))
+		return
+	}
+
+	// 2. Get Job ID from URL parameter
+	jobIDStr := c.Param("jobId")
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid job ID format: %s", jobIDStr), err)
+		return
+	}
+
+	// 3. Fetch the job, only the user who started it may follow it
+	job, err := h.DB.Queries.GetGenerationJob(ctx, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Generation job %s not found", jobID), err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to retrieve generation job %s", jobID), err)
+		}
+		return
+	}
+	if job.UserID != userID {
+		h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Generation job %s not found", jobID), errors.New("job belongs to another user"))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Stop reverse proxies from buffering the stream
+
+	// 4. A job that finished a while ago has no events left in memory, send its final state instead
+	finished := job.Status == db.GenerationJobStatusSucceeded || job.Status == db.GenerationJobStatusFailed
+	if finished && !h.Progress.Has(job.ID) {
+		event := gemini.ProgressEvent{Stage: gemini.StageCompleted, Message: "Quiz generated successfully!", Time: job.UpdatedAt}
+		if job.QuizID.Valid {
+			event.QuizID = uuid.UUID(job.QuizID.Bytes).String()
+		}
+		if job.Status == db.GenerationJobStatusFailed {
+			event = gemini.ProgressEvent{Stage: gemini.StageFailed, Message: "Quiz generation failed", Error: job.Error.String, Time: job.UpdatedAt}
+		}
+		c.SSEvent(string(event.Stage), event)
+		c.Writer.Flush()
+		return
+	}
+
+	// 5. Replay what already happened, then follow the job until it ends or the client leaves
+	history, events, unsubscribe := h.Progress.Subscribe(job.ID)
+	defer unsubscribe()
+
+	for _, event := range history {
+		c.SSEvent(string(event.Stage), event)
+	}
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false // Job finished
+			}
+			c.SSEvent(string(event.Stage), event)
+			return true
+		case <-keepAlive.C:
+			// SSE comment line, keeps idle connections from being closed by proxies
+			fmt.Fprint(w, ": keep-alive\n\n")
+			return true
+		case <-ctx.Done():
+			return false
+		case <-h.streamsClosed:
+			return false // Server is shutting down
+		}
+	})
+	log.Printf("INFO: Closed progress stream for generation job %s (user %s)", job.ID, userID)
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/gemini"
+	"quizbuilderai/internal/jobs"
+	"quizbuilderai/internal/upload"
+	"quizbuilderai/internal/youtube"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationsDir holds the goose migrations, relative to this package
+const migrationsDir = "../../../sql/migrations"
+
+// newTestDB connects to the Postgres database at TEST_DATABASE_URL and migrates a schema of its
+// own, which is dropped when the test ends. The test is skipped when the variable isn't set.
+func newTestDB(t *testing.T) *db.DB {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+
+	admin, err := pgx.Connect(ctx, dbURL)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		admin.Close(ctx)
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Logf("failed to drop schema %s: %v", schema, err)
+		}
+		admin.Close(context.Background())
+	})
+
+	config, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		t.Fatalf("failed to parse TEST_DATABASE_URL: %v", err)
+	}
+	// Extensions already installed in public stay usable
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ",public"
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrate(t, pool)
+	return &db.DB{Pool: pool, Queries: db.New(pool)}
+}
+
+// migrate applies the Up section of every migration in order. Each file is sent as one
+// statement batch, so each is committed before the next, like goose does.
+func migrate(t *testing.T, pool *pgxpool.Pool) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found in %s: %v", migrationsDir, err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read migration: %v", err)
+		}
+		_, up, found := strings.Cut(string(data), "-- +goose Up")
+		if !found {
+			t.Fatalf("migration %s has no Up section", file)
+		}
+		up, _, _ = strings.Cut(up, "-- +goose Down")
+		// Without arguments the batch is sent with the simple protocol, which allows several statements
+		if _, err := pool.Exec(context.Background(), up); err != nil {
+			t.Fatalf("failed to apply migration %s: %v", filepath.Base(file), err)
+		}
+	}
+}
+
+// roundTripFunc lets a function serve as an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestHandler returns a Handler on database with the fake generator. Discord notifications
+// fail right away instead of leaving the test.
+func newTestHandler(database *db.DB) *Handler {
+	h := &Handler{
+		DB:        database,
+		Generator: gemini.NewFakeGenerator(),
+		Youtube:   youtube.New(youtube.Config{Cache: youtube.NewDBCache(database.Queries)}),
+		Uploads:   upload.LimitsFromEnv(),
+		DiscordClient: &http.Client{Transport: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("notifications are disabled in tests")
+		})},
+		Progress:      jobs.NewProgressBroker(time.Minute),
+		streamsClosed: make(chan struct{}),
+	}
+	// The test runs the jobs itself, so the queue's workers are never started
+	h.Jobs = jobs.NewQueue(1, 10, h.processGenerationJob)
+	return h
+}
+
+// generateRequest builds a generate form uploading one text file
+func generateRequest(t *testing.T, filename, content string, values map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("files", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	for key, value := range values {
+		form.WriteField(key, value)
+	}
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/quizzes/generate", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func TestGenerateQuizWithFakeGenerator(t *testing.T) {
+	database := newTestDB(t)
+	h := newTestHandler(database)
+	ctx := context.Background()
+
+	user, err := h.createUserWithSignupGift(ctx, db.CreateUserParams{
+		Email: "learner@example.com",
+		Name:  pgtype.Text{String: "Learner", Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	// 1. The request queues a job and reserves its estimated tokens
+	const questionCount = 4
+	content := strings.Repeat("Plants turn light, water and carbon dioxide into glucose and oxygen. ", 20)
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = generateRequest(t, "photosynthesis.txt", content, map[string]string{"questionCount": fmt.Sprint(questionCount)})
+	c.Set("userID", user.ID)
+	c.Set("userProfile", UserProfile{DatabaseID: user.ID, Email: user.Email, Name: user.Name.String})
+	h.HandleGenerateQuiz(c)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body.String())
+	}
+	var response struct {
+		JobID string `json:"jobId"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	jobID, err := uuid.Parse(response.JobID)
+	if err != nil {
+		t.Fatalf("invalid job ID %q: %v", response.JobID, err)
+	}
+
+	job, err := database.Queries.GetGenerationJob(ctx, jobID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if job.Status != db.GenerationJobStatusQueued {
+		t.Errorf("job status = %s, want %s", job.Status, db.GenerationJobStatusQueued)
+	}
+	// The fake estimates exactly what it uses, 100 output tokens per question
+	if job.ReservedOutputTokens != questionCount*100 || job.ReservedInputTokens <= 0 {
+		t.Errorf("reserved Input=%d, Output=%d, want a positive input and %d output tokens", job.ReservedInputTokens, job.ReservedOutputTokens, questionCount*100)
+	}
+	reserved, err := database.Queries.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if reserved.InputTokensBalance != user.InputTokensBalance-job.ReservedInputTokens ||
+		reserved.OutputTokensBalance != user.OutputTokensBalance-job.ReservedOutputTokens {
+		t.Errorf("balances after reserving = %d/%d, want %d/%d", reserved.InputTokensBalance, reserved.OutputTokensBalance,
+			user.InputTokensBalance-job.ReservedInputTokens, user.OutputTokensBalance-job.ReservedOutputTokens)
+	}
+
+	// 2. A worker runs the job
+	h.processGenerationJob(ctx, jobID)
+
+	job, err = database.Queries.GetGenerationJob(ctx, jobID)
+	if err != nil {
+		t.Fatalf("failed to get job: %v", err)
+	}
+	if job.Status != db.GenerationJobStatusSucceeded || !job.QuizID.Valid {
+		t.Fatalf("job status = %s, error %q, want succeeded with a quiz", job.Status, job.Error.String)
+	}
+	quizID := uuid.UUID(job.QuizID.Bytes)
+
+	// The quiz, its questions and their answers
+	quiz, err := database.Queries.GetQuizByID(ctx, quizID)
+	if err != nil {
+		t.Fatalf("failed to get quiz: %v", err)
+	}
+	if quiz.Title != "Practice Quiz: photosynthesis" || uuid.UUID(quiz.CreatorID.Bytes) != user.ID {
+		t.Errorf("quiz = %q by %v, want %q by %s", quiz.Title, quiz.CreatorID, "Practice Quiz: photosynthesis", user.ID)
+	}
+	questions, err := database.Queries.ListQuestionsByQuizID(ctx, quizID)
+	if err != nil {
+		t.Fatalf("failed to list questions: %v", err)
+	}
+	if len(questions) != questionCount {
+		t.Fatalf("got %d questions, want %d", len(questions), questionCount)
+	}
+	for i, question := range questions {
+		if question.QuestionType != db.QuestionTypeMultipleChoice || !strings.Contains(question.Question, fmt.Sprintf("(#%d)", i+1)) {
+			t.Errorf("question %d = %s %q", i+1, question.QuestionType, question.Question)
+		}
+		answers, err := database.Queries.ListAnswersByQuestionID(ctx, question.ID)
+		if err != nil {
+			t.Fatalf("failed to list answers: %v", err)
+		}
+		correct := 0
+		for _, answer := range answers {
+			if answer.IsCorrect {
+				correct++
+			}
+		}
+		if len(answers) != 4 || correct != 1 {
+			t.Errorf("question %d has %d answers, %d of them correct, want 4 with 1 correct", i+1, len(answers), correct)
+		}
+	}
+	materials, err := database.Queries.ListMaterialsByQuizID(ctx, quizID)
+	if err != nil {
+		t.Fatalf("failed to list materials: %v", err)
+	}
+	if len(materials) != 1 {
+		t.Errorf("got %d materials, want 1", len(materials))
+	}
+
+	// The ledger has the signup gift and the reservation, settled as the job's usage
+	ledger, err := database.Queries.ListTokensByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to list tokens: %v", err)
+	}
+	var gift, usage *db.Token
+	for i := range ledger {
+		switch ledger[i].Type {
+		case db.TokenTypeGift:
+			gift = &ledger[i]
+		case db.TokenTypeUsage:
+			usage = &ledger[i]
+		default:
+			t.Errorf("unexpected %s ledger entry of %d tokens", ledger[i].Type, ledger[i].Amount)
+		}
+	}
+	if len(ledger) != 2 || gift == nil || usage == nil {
+		t.Fatalf("got %d ledger entries, want the gift and the usage", len(ledger))
+	}
+	if gift.InputAmount != user.InputTokensBalance || gift.OutputAmount != user.OutputTokensBalance {
+		t.Errorf("gift = %d/%d, want the starting balances %d/%d", gift.InputAmount, gift.OutputAmount, user.InputTokensBalance, user.OutputTokensBalance)
+	}
+	if usage.Status != db.TokenStatusSettled || uuid.UUID(usage.GenerationJobID.Bytes) != jobID ||
+		usage.InputAmount != -job.ReservedInputTokens || usage.OutputAmount != -job.ReservedOutputTokens ||
+		usage.Amount != usage.InputAmount+usage.OutputAmount {
+		t.Errorf("usage = %s %d (Input=%d, Output=%d) of job %v, want settled -%d/-%d of job %s", usage.Status, usage.Amount,
+			usage.InputAmount, usage.OutputAmount, usage.GenerationJobID, job.ReservedInputTokens, job.ReservedOutputTokens, jobID)
+	}
+
+	// The balances are the gift less the usage, as the ledger says
+	settled, err := database.Queries.GetUserByID(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if settled.InputTokensBalance != gift.InputAmount+usage.InputAmount || settled.OutputTokensBalance != gift.OutputAmount+usage.OutputAmount {
+		t.Errorf("balances = %d/%d, want %d/%d", settled.InputTokensBalance, settled.OutputTokensBalance,
+			gift.InputAmount+usage.InputAmount, gift.OutputAmount+usage.OutputAmount)
+	}
+	drift, err := database.Queries.ListTokenBalanceDrift(ctx)
+	if err != nil {
+		t.Fatalf("failed to check balance drift: %v", err)
+	}
+	if len(drift) != 0 {
+		t.Errorf("balances differ from the ledger: %+v", drift)
+	}
+}
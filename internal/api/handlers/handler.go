@@ -11,10 +11,17 @@ import (
 	// "io" // Duplicate import, already imported above
 	"log"      // Added for logging errors
 	"net/http" // Added for Discord notification &amp; status codes
+	"strconv"  // Added for pagination parameters
+	"strings"  // Added for joining upload rejections
+	"sync"     // Added for closing progress streams once
 	"time"     // Added for response struct timestamps &amp; Discord timeout
 
 	"quizbuilderai/internal/db"
 	"quizbuilderai/internal/gemini"
+	"quizbuilderai/internal/jobs"
+	"quizbuilderai/internal/storage"
+	"quizbuilderai/internal/upload"
+	"quizbuilderai/internal/webpage"
 	"quizbuilderai/internal/youtube"
 
 	"github.com/gin-gonic/gin"       // Added for gin.Context, gin.H
@@ -96,28 +103,63 @@ type Handler struct {
 	OauthConfig   *oauth2.Config
 	StoreName     string
 	DB            *db.DB
-	Gemini        *gemini.Client
+	Generator     gemini.QuizGenerator // Quiz generation provider (Gemini, OpenAI-compatible or fake)
 	Youtube       *youtube.YoutubeTranscript
-	DiscordClient *http.Client // Added HTTP client for Discord
+	Webpages      *webpage.Fetcher     // Fetches web pages given as quiz material
+	Uploads       upload.Limits        // Size and count limits of uploaded files
+	Storage       storage.Storage      // Keeps the originals of uploaded files, nil when no storage is configured
+	DiscordClient *http.Client         // Added HTTP client for Discord
+	Jobs          *jobs.Queue          // Background quiz generation workers, set by StartGenerationWorkers
+	NodeID        string               // Recorded on the generation jobs this instance creates, whose inputs are on its disk
+	Progress      *jobs.ProgressBroker // Progress events of generation jobs, streamed over SSE
+
+	streamsClosed    chan struct{} // Closed by CloseStreams
+	closeStreamsOnce sync.Once
 }
 
 // NewHandler creates a new Handler
-func NewHandler(oauth *oauth2.Config, store string, db *db.DB, gemini *gemini.Client) *Handler {
+func NewHandler(oauth *oauth2.Config, store string, db *db.DB, generator gemini.QuizGenerator) *Handler {
 	// Create a dedicated HTTP client for Discord with a timeout
 	discordClient := &http.Client{
 		Timeout: 5 * time.Second, // Set a 5-second timeout for Discord requests
 	}
 
+	// Transcripts are cached in the database
+	youtubeConfig := youtube.ConfigFromEnv()
+	youtubeConfig.Cache = youtube.NewDBCache(db.Queries)
+
+	// Without storage quizzes are still generated, the uploads just can't be downloaded again
+	fileStorage, err := storage.FromEnv()
+	if err != nil {
+		log.Printf("ERROR: Failed to configure file storage, uploaded files will not be kept: %v", err)
+	}
+
 	return &Handler{
 		OauthConfig:   oauth,
 		StoreName:     store,
 		DB:            db,
-		Gemini:        gemini,
-		Youtube:       youtube.New(),
+		Generator:     generator,
+		Youtube:       youtube.New(youtubeConfig),
+		Webpages:      webpage.New(webpage.Config{}),
+		Uploads:       upload.LimitsFromEnv(),
+		Storage:       fileStorage,
 		DiscordClient: discordClient, // Initialize Discord client
+		NodeID:        nodeIDFromEnv(),
+		Progress:      jobs.NewProgressBroker(10 * time.Minute),
+		streamsClosed: make(chan struct{}),
 	}
 }
 
+// CloseStreams ends all open progress streams and makes new ones end right away,
+// so they don't hold up a graceful shutdown. Clients reconnect to get the rest of the job.
+func (h *Handler) CloseStreams() {
+	h.closeStreamsOnce.Do(func() {
+		if h.streamsClosed != nil {
+			close(h.streamsClosed)
+		}
+	})
+}
+
 // sendDiscordNotification sends an embed message to the configured Discord webhook.
 // It runs asynchronously to avoid blocking the main request flow.
 func (h *Handler) sendDiscordNotification(embed DiscordEmbed) {
@@ -171,12 +213,37 @@ func (h *Handler) sendDiscordNotification(embed DiscordEmbed) {
 
 // handleErrorAndNotify logs an error, sends a Discord notification, logs to activity table, and aborts the request.
 func (h *Handler) handleErrorAndNotify(c *gin.Context, userID uuid.UUID, statusCode int, errorContext string, err error) {
+	h.notifyError(c.Request.Context(), userID, statusCode, errorContext, c.Request.URL.Path, err)
+
+	// 4. Abort request with JSON response
+	c.AbortWithStatusJSON(statusCode, gin.H{"error": fmt.Sprintf("%s: %v", errorContext, err)})
+}
+
+// rejectUploads responds to an upload with files that failed validation, listing each file and
+// why it was rejected. The status is the one of the first rejection.
+func (h *Handler) rejectUploads(c *gin.Context, userID uuid.UUID, rejections []upload.Rejection) {
+	reasons := make([]string, len(rejections))
+	for i, rejection := range rejections {
+		reasons[i] = rejection.Error()
+	}
+	err := errors.New(strings.Join(reasons, "; "))
+	status := rejections[0].Status
+	h.notifyError(c.Request.Context(), userID, status, "Uploaded files were rejected", c.Request.URL.Path, err)
+	c.AbortWithStatusJSON(status, gin.H{
+		"error":          fmt.Sprintf("Uploaded files were rejected: %v", err),
+		"rejected_files": rejections,
+	})
+}
+
+// notifyError logs an error to the console, the activity table and Discord.
+// It doesn't need a request, so background workers use it directly; path identifies where the error happened.
+func (h *Handler) notifyError(ctx context.Context, userID uuid.UUID, statusCode int, errorContext string, path string, err error) {
 	// 1. Log to console (as before)
 	log.Printf("ERROR: %s: %v (UserID: %s)", errorContext, err, userID)
 
 	// 2. Log activity
 	// Ensure logActivity is called correctly. Pass userID directly, let logActivity handle pgtype conversion.
-	h.logActivity(c.Request.Context(), userID, db.ActivityActionError,
+	h.logActivity(ctx, userID, db.ActivityActionError,
 		db.NullActivityTargetType{}, // No specific target type for general errors
 		pgtype.UUID{},               // No specific target ID for general errors
 		map[string]interface{}{
@@ -184,7 +251,7 @@ func (h *Handler) handleErrorAndNotify(c *gin.Context, userID uuid.UUID, statusC
 			"error_context":    errorContext, // Kept original context for consistency
 			"error_message":    err.Error(),
 			"user_id":          userID.String(), // Include user ID string in details if available
-			"request_path":     c.Request.URL.Path,
+			"request_path":     path,
 			"http_status":      statusCode,
 		})
 
@@ -204,12 +271,9 @@ func (h *Handler) handleErrorAndNotify(c *gin.Context, userID uuid.UUID, statusC
 	}
 	// Add Status and Path fields
 	errorEmbed.Fields = append(errorEmbed.Fields, DiscordEmbedField{Name: "HTTP Status", Value: fmt.Sprintf("%d", statusCode), Inline: true})
-	errorEmbed.Fields = append(errorEmbed.Fields, DiscordEmbedField{Name: "Path", Value: c.Request.URL.Path, Inline: false})
+	errorEmbed.Fields = append(errorEmbed.Fields, DiscordEmbedField{Name: "Path", Value: path, Inline: false})
 
 	h.sendDiscordNotification(errorEmbed)
-
-	// 4. Abort request with JSON response
-	c.AbortWithStatusJSON(statusCode, gin.H{"error": fmt.Sprintf("%s: %v", errorContext, err)})
 }
 
 // logActivity is a helper function to create activity log entries.
@@ -244,6 +308,27 @@ func (h *Handler) logActivity(ctx context.Context, userID uuid.UUID, action db.A
 	}
 }
 
+// parsePagination reads the limit and offset query parameters.
+// limit defaults to defaultLimit and may not exceed maxLimit; offset defaults to 0.
+func parsePagination(c *gin.Context, defaultLimit, maxLimit int32) (limit int32, offset int32, err error) {
+	limit, offset = defaultLimit, 0
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 1 || int32(n) > maxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		limit = int32(n)
+	}
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("offset must be a non-negative number")
+		}
+		offset = int32(n)
+	}
+	return limit, offset, nil
+}
+
 // --- Feedback Handlers ---
 
 // CreateFeedbackRequest defines the structure for the feedback creation request body.
@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// materialDownloadExpiry is how long a presigned download URL of a material stays valid
+const materialDownloadExpiry = 15 * time.Minute
+
+// storeMaterialFile keeps the original of an uploaded file in the storage and records its key on the material.
+// The quiz doesn't depend on the original, so failures are logged and the material stays without one.
+func (h *Handler) storeMaterialFile(ctx context.Context, userID, materialID uuid.UUID, file generationJobFile) {
+	if h.Storage == nil {
+		return
+	}
+	f, err := os.Open(file.Path)
+	if err != nil {
+		log.Printf("WARN: Failed to open %s to store material %s: %v", file.Path, materialID, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		log.Printf("WARN: Failed to stat %s to store material %s: %v", file.Path, materialID, err)
+		return
+	}
+
+	key := storage.MaterialKey(userID, materialID, file.Name)
+	contentType := mime.TypeByExtension(filepath.Ext(file.Name))
+	if err := h.Storage.Put(ctx, key, f, info.Size(), contentType); err != nil {
+		log.Printf("WARN: Failed to store material %s in %s: %v", materialID, h.Storage.Name(), err)
+		return
+	}
+	if err := h.DB.Queries.SetMaterialStorage(ctx, db.SetMaterialStorageParams{
+		ID:         materialID,
+		StorageKey: pgtype.Text{String: key, Valid: true},
+		SizeBytes:  pgtype.Int8{Int64: info.Size(), Valid: true},
+	}); err != nil {
+		// The object is unreachable without its key, so it is removed again
+		log.Printf("WARN: Failed to record storage key of material %s: %v", materialID, err)
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			log.Printf("WARN: Failed to remove unrecorded object %s: %v", key, err)
+		}
+		return
+	}
+	log.Printf("INFO: Stored material %s in %s as %s", materialID, h.Storage.Name(), key)
+}
+
+// HandleDownloadMaterial downloads the original of an uploaded material. Only its owner may download it.
+// Bucket storage redirects to a short-lived presigned URL; local storage is served directly.
+func (h *Handler) HandleDownloadMaterial(c *gin.Context) {
+	ctx := c.Request.Context()
+	materialIDStr := c.Param("materialId")
+
+	// 1. Get User ID from context
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, fmt.Sprintf("User ID not found in context for downloading material %s", materialIDStr), errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, fmt.Sprintf("User ID in context is not UUID for downloading material %s", materialIDStr), errors.New("invalid user ID type in context"))
+		return
+	}
+
+	// 2. Fetch the material, only its owner may download it
+	material, ok := h.ownMaterial(c, userID, materialIDStr)
+	if !ok {
+		return
+	}
+	materialID := material.ID
+	if !material.StorageKey.Valid || h.Storage == nil {
+		h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Material %s has no stored file", materialID), errors.New("only uploaded files are stored, and only while storage is configured"))
+		return
+	}
+	key := material.StorageKey.String
+
+	// 3. Redirect to a presigned URL where the storage can make one
+	url, err := h.Storage.PresignGet(ctx, key, material.Title, materialDownloadExpiry)
+	if err == nil {
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+	if !errors.Is(err, storage.ErrPresignNotSupported) {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create download URL for material %s", materialID), err)
+		return
+	}
+
+	// 4. Otherwise serve the file itself
+	content, err := h.Storage.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Stored file of material %s is missing", materialID), err)
+		return
+	}
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to open stored file of material %s", materialID), err)
+		return
+	}
+	defer content.Close()
+
+	size := int64(-1)
+	if material.SizeBytes.Valid {
+		size = material.SizeBytes.Int64
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(material.Title))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": material.Title})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	c.DataFromReader(http.StatusOK, size, contentType, content, map[string]string{"Content-Disposition": disposition})
+}
+
+// ownMaterial fetches a material of the user, responding and returning false if the ID is invalid or
+// the material doesn't exist. Materials of other users are reported as missing so their IDs can't be probed.
+func (h *Handler) ownMaterial(c *gin.Context, userID uuid.UUID, materialIDStr string) (db.Material, bool) {
+	materialID, err := uuid.Parse(materialIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid Material ID format '%s'", materialIDStr), err)
+		return db.Material{}, false
+	}
+	material, err := h.DB.Queries.GetMaterialByID(c.Request.Context(), materialID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Material not found: %s", materialID), err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get material %s", materialID), err)
+		}
+		return db.Material{}, false
+	}
+	if material.UserID != userID {
+		h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Material not found: %s", materialID), errors.New("material belongs to another user"))
+		return db.Material{}, false
+	}
+	return material, true
+}
+
+// Sources of materials, as reported to the frontend
+const (
+	materialSourceUpload  = "upload"
+	materialSourceYoutube = "youtube"
+	materialSourceWeb     = "web"
+)
+
+// materialSource tells uploaded files, YouTube videos and web pages apart
+func materialSource(material db.Material) string {
+	var metadata materialMetadata
+	if err := json.Unmarshal(material.Metadata, &metadata); err == nil && metadata.Source != "" {
+		return metadata.Source
+	}
+	if material.Url.Valid && material.Url.String != "" {
+		// Before materials had metadata, only videos were stored with a URL
+		return materialSourceYoutube
+	}
+	return materialSourceUpload
+}
+
+// ResponseMaterial is a material as returned to the frontend
+type ResponseMaterial struct {
+	ID        uuid.UUID       `json:"id"`
+	Title     string          `json:"title"`
+	Source    string          `json:"source"`               // "upload", "youtube" or "web"
+	URL       *string         `json:"url,omitempty"`        // Video or page URL
+	SizeBytes *int64          `json:"size_bytes,omitempty"` // Size of a stored upload
+	Metadata  json.RawMessage `json:"metadata"`             // Details of the source, e.g. the channel of a video
+	// Downloadable is set for uploads whose original is stored, see GET /api/materials/:materialId/download
+	Downloadable bool `json:"downloadable"`
+	// Reusable is set for materials new quizzes can be generated from by passing their ID as materialIds
+	Reusable  bool      `json:"reusable"`
+	QuizCount *int64    `json:"quiz_count,omitempty"` // Number of quizzes generated from the material, in the materials list
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ResponseMaterialList holds one page of the user's materials
+type ResponseMaterialList struct {
+	Materials []ResponseMaterial `json:"materials"`
+	Total     int64              `json:"total"` // Number of materials across all pages
+	Limit     int32              `json:"limit"`
+	Offset    int32              `json:"offset"`
+}
+
+// newResponseMaterial converts a material for the frontend
+func (h *Handler) newResponseMaterial(material db.Material) ResponseMaterial {
+	response := ResponseMaterial{
+		ID:        material.ID,
+		Title:     material.Title,
+		Source:    materialSource(material),
+		Metadata:  json.RawMessage(material.Metadata),
+		CreatedAt: material.CreatedAt,
+	}
+	if len(response.Metadata) == 0 {
+		response.Metadata = json.RawMessage("{}")
+	}
+	if material.Url.Valid && material.Url.String != "" {
+		url := material.Url.String
+		response.URL = &url
+	}
+	if material.SizeBytes.Valid {
+		size := material.SizeBytes.Int64
+		response.SizeBytes = &size
+	}
+	response.Downloadable = material.StorageKey.Valid && h.Storage != nil
+	response.Reusable = response.Downloadable || (response.Source != materialSourceUpload && response.URL != nil)
+	return response
+}
+
+// HandleListMaterials returns a page of the current user's materials, newest first
+func (h *Handler) HandleListMaterials(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get User ID from context (set by AuthRequired middleware)
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, "User ID not found in context for listing materials", errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, "User ID in context is not UUID for listing materials", errors.New("invalid user ID type in context"))
+		return
+	}
+
+	// 2. Read pagination parameters
+	limit, offset, err := parsePagination(c, 20, 100)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "Invalid pagination parameters", err)
+		return
+	}
+
+	// 3. Fetch the requested page
+	materials, err := h.DB.Queries.ListMaterialsByUserIDPaginated(ctx, db.ListMaterialsByUserIDPaginatedParams{
+		UserID: userID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to list materials for user %s", userID), err)
+		return
+	}
+	total, err := h.DB.Queries.CountMaterialsByUserID(ctx, userID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to count materials for user %s", userID), err)
+		return
+	}
+
+	// 4. Build the response
+	response := ResponseMaterialList{
+		Materials: make([]ResponseMaterial, 0, len(materials)),
+		Total:     total,
+		Limit:     limit,
+		Offset:    offset,
+	}
+	for _, row := range materials {
+		material := h.newResponseMaterial(db.Material{
+			ID:          row.ID,
+			UserID:      row.UserID,
+			Title:       row.Title,
+			Url:         row.Url,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Metadata:    row.Metadata,
+			StorageKey:  row.StorageKey,
+			SizeBytes:   row.SizeBytes,
+			ContentHash: row.ContentHash,
+		})
+		quizCount := row.QuizCount
+		material.QuizCount = &quizCount
+		response.Materials = append(response.Materials, material)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleDeleteMaterial deletes a material of the current user and its stored original.
+// Quizzes generated from it are kept; their questions just lose the link to their source.
+func (h *Handler) HandleDeleteMaterial(c *gin.Context) {
+	ctx := c.Request.Context()
+	materialIDStr := c.Param("materialId")
+
+	// 1. Get User ID from context
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, fmt.Sprintf("User ID not found in context for deleting material %s", materialIDStr), errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, fmt.Sprintf("User ID in context is not UUID for deleting material %s", materialIDStr), errors.New("invalid user ID type in context"))
+		return
+	}
+
+	// 2. Fetch the material, only its owner may delete it
+	material, ok := h.ownMaterial(c, userID, materialIDStr)
+	if !ok {
+		return
+	}
+
+	// 3. Delete the record; links to quizzes and sources cascade
+	if err := h.DB.Queries.DeleteMaterial(ctx, material.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to delete material %s", material.ID), err)
+		return
+	}
+	log.Printf("INFO: Deleted material %s (%s) of user %s", material.ID, material.Title, userID)
+
+	// 4. Remove the stored original. The material is gone either way, so a failure only leaves an orphaned object.
+	if material.StorageKey.Valid {
+		if h.Storage == nil {
+			log.Printf("WARN: Material %s had stored file %s but no storage is configured, the file was not removed", material.ID, material.StorageKey.String)
+		} else if err := h.Storage.Delete(ctx, material.StorageKey.String); err != nil {
+			log.Printf("WARN: Failed to remove stored file of deleted material %s: %v", material.ID, err)
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// HandleListQuizMaterials returns the materials a quiz was generated from. Only the quiz creator may list them.
+func (h *Handler) HandleListQuizMaterials(c *gin.Context) {
+	ctx := c.Request.Context()
+	quizIDStr := c.Param("quizId")
+
+	// 1. Get User ID from context
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, fmt.Sprintf("User ID not found in context for listing materials of quiz %s", quizIDStr), errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, fmt.Sprintf("User ID in context is not UUID for listing materials of quiz %s", quizIDStr), errors.New("invalid user ID type in context"))
+		return
+	}
+
+	// 2. Parse Quiz ID
+	quizID, err := uuid.Parse(quizIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid Quiz ID format '%s'", quizIDStr), err)
+		return
+	}
+
+	// 3. Verify Quiz Ownership, materials are private to the user who uploaded them
+	dbQuiz, err := h.DB.Queries.GetQuizByID(ctx, quizID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Quiz not found: %s", quizID), err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get quiz %s", quizID), err)
+		}
+		return
+	}
+	if !dbQuiz.CreatorID.Valid || dbQuiz.CreatorID.Bytes != userID {
+		h.handleErrorAndNotify(c, userID, http.StatusForbidden, fmt.Sprintf("User %s attempted to list materials of quiz %s owned by %s", userID, quizID, dbQuiz.CreatorID.Bytes), errors.New("you do not have permission to view the materials of this quiz"))
+		return
+	}
+
+	// 4. Fetch the materials
+	materials, err := h.DB.Queries.ListMaterialsByQuizID(ctx, quizID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to list materials of quiz %s", quizID), err)
+		return
+	}
+	response := make([]ResponseMaterial, 0, len(materials))
+	for _, material := range materials {
+		response = append(response, h.newResponseMaterial(material))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// reusableMaterials looks up the materials given as materialIds to generate a quiz from. They must belong to
+// the user and be reusable: stored uploads, or videos and pages whose URL can be fetched again.
+// Duplicate IDs are used once. On failure it returns the HTTP status to respond with.
+func (h *Handler) reusableMaterials(ctx context.Context, userID uuid.UUID, materialIDStrs []string) ([]db.Material, int, error) {
+	var materials []db.Material
+	seen := make(map[uuid.UUID]bool)
+	for _, materialIDStr := range materialIDStrs {
+		if strings.TrimSpace(materialIDStr) == "" {
+			continue
+		}
+		materialID, err := uuid.Parse(strings.TrimSpace(materialIDStr))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid material ID %q", materialIDStr)
+		}
+		if seen[materialID] {
+			continue
+		}
+		seen[materialID] = true
+
+		material, err := h.DB.Queries.GetMaterialByID(ctx, materialID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && material.UserID != userID) {
+			return nil, http.StatusNotFound, fmt.Errorf("material %s not found", materialID)
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("failed to get material %s: %w", materialID, err)
+		}
+		if !h.newResponseMaterial(material).Reusable {
+			return nil, http.StatusUnprocessableEntity, fmt.Errorf("material %s (%s) has no stored file to generate from, upload it again", materialID, material.Title)
+		}
+		materials = append(materials, material)
+	}
+	return materials, 0, nil
+}
+
+// restoreMaterialFile copies the stored original of a material to path, returning the bytes written
+// and the hex encoded SHA-256 of the content
+func (h *Handler) restoreMaterialFile(ctx context.Context, material db.Material, path string) (int64, string, error) {
+	content, err := h.Storage.Open(ctx, material.StorageKey.String)
+	if err != nil {
+		return 0, "", err
+	}
+	defer content.Close()
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dst, hash), content)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, "", fmt.Errorf("failed to restore material %s: %w", material.ID, err)
+	}
+	return written, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// takeReusedMaterial returns the reused material of a video or page URL. Each material is returned once,
+// so a URL that was also submitted directly is linked to the material only once.
+func takeReusedMaterial(reused map[string]uuid.UUID, url string) *uuid.UUID {
+	materialID, ok := reused[url]
+	if !ok {
+		return nil
+	}
+	delete(reused, url)
+	return &materialID
+}
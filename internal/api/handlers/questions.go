@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// --- Question Types ---
+// Choice questions (multiple choice, true/false, multi-select) store their options as answers with is_correct.
+// The other types store their answer key in the answer rows too:
+//   - short_answer: one row per accepted answer
+//   - numeric: one row with numeric_value and tolerance
+//   - ordering: one row per item with its correct_position
+//   - matching: one row per pair, the left item as the answer and the right item as match_text
+
+// createQuestionAnswers stores the answer key of a generated question, which must be valid
+func createQuestionAnswers(ctx context.Context, qtx *db.Queries, questionID uuid.UUID, q models.GeminiQuestion) error {
+	explanation := pgtype.Text{String: q.Explanation, Valid: q.Explanation != ""}
+	var params []db.CreateAnswerParams
+
+	switch q.QuestionType() {
+	case models.QuestionTypeShortAnswer:
+		for _, accepted := range q.AcceptedAnswers {
+			params = append(params, db.CreateAnswerParams{
+				Answer:    strings.TrimSpace(accepted),
+				IsCorrect: true,
+			})
+		}
+		params[0].Explanation = explanation // Explained once, on the main answer
+	case models.QuestionTypeNumeric:
+		params = append(params, db.CreateAnswerParams{
+			Answer:       strconv.FormatFloat(*q.NumericAnswer, 'g', -1, 64),
+			IsCorrect:    true,
+			Explanation:  explanation,
+			NumericValue: pgtype.Float8{Float64: *q.NumericAnswer, Valid: true},
+			Tolerance:    pgtype.Float8{Float64: q.Tolerance, Valid: true},
+		})
+	case models.QuestionTypeOrdering:
+		for i, option := range q.Options {
+			params = append(params, db.CreateAnswerParams{
+				Answer:          option.Text,
+				IsCorrect:       true,
+				Explanation:     pgtype.Text{String: option.Explanation, Valid: option.Explanation != ""},
+				CorrectPosition: pgtype.Int4{Int32: int32(i + 1), Valid: true},
+			})
+		}
+		// Answers are listed by their position, which mustn't give the solution away
+		rand.Shuffle(len(params), func(i, j int) { params[i], params[j] = params[j], params[i] })
+	case models.QuestionTypeMatching:
+		for _, pair := range q.Pairs {
+			params = append(params, db.CreateAnswerParams{
+				Answer:    strings.TrimSpace(pair.Left),
+				IsCorrect: true,
+				MatchText: pgtype.Text{String: strings.TrimSpace(pair.Right), Valid: true},
+			})
+		}
+		params[0].Explanation = explanation // Explained once, for all pairs
+	default:
+		// Multiple choice, true/false and multi-select
+		for _, option := range q.Options {
+			params = append(params, db.CreateAnswerParams{
+				Answer:      option.Text,
+				IsCorrect:   option.IsCorrect,
+				Explanation: pgtype.Text{String: option.Explanation, Valid: option.Explanation != ""}, // Add explanation from Gemini
+			})
+		}
+	}
+
+	for i, p := range params {
+		p.QuestionID = questionID
+		p.Position = int32(i + 1)
+		if _, err := qtx.CreateAnswer(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// questionFromAnswers rebuilds a question in its generated form from its stored answer key, the reverse of
+// createQuestionAnswers, so edited questions can be checked with the same rules as generated ones
+func questionFromAnswers(questionType db.QuestionType, text string, answers []db.Answer) models.GeminiQuestion {
+	q := models.GeminiQuestion{Text: text, Type: string(questionType)}
+
+	switch q.QuestionType() {
+	case models.QuestionTypeShortAnswer:
+		for _, a := range answers {
+			if a.IsCorrect {
+				q.AcceptedAnswers = append(q.AcceptedAnswers, a.Answer)
+			}
+		}
+	case models.QuestionTypeNumeric:
+		for _, a := range answers {
+			if a.NumericValue.Valid {
+				value := a.NumericValue.Float64
+				q.NumericAnswer = &value
+				q.Tolerance = a.Tolerance.Float64
+				break
+			}
+		}
+	case models.QuestionTypeOrdering:
+		sorted := slices.Clone(answers)
+		slices.SortFunc(sorted, func(a, b db.Answer) int { return int(a.CorrectPosition.Int32 - b.CorrectPosition.Int32) })
+		for _, a := range sorted {
+			q.Options = append(q.Options, models.GeminiOption{Text: a.Answer, IsCorrect: true, Explanation: a.Explanation.String})
+		}
+	case models.QuestionTypeMatching:
+		for _, a := range answers {
+			q.Pairs = append(q.Pairs, models.GeminiPair{Left: a.Answer, Right: a.MatchText.String})
+		}
+	default:
+		for _, a := range answers {
+			q.Options = append(q.Options, models.GeminiOption{Text: a.Answer, IsCorrect: a.IsCorrect, Explanation: a.Explanation.String})
+		}
+	}
+	for _, a := range answers {
+		if a.Explanation.Valid && q.Explanation == "" {
+			q.Explanation = a.Explanation.String
+		}
+	}
+	return q
+}
+
+// attemptResponse is what a user answered to a question that isn't a single selected answer.
+// It is stored as the attempt answer's response.
+type attemptResponse struct {
+	SelectedAnswerIDs []uuid.UUID          `json:"selected_answer_ids,omitempty"` // Multi-select
+	Text              *string              `json:"text,omitempty"`                // Short answer
+	Number            *float64             `json:"number,omitempty"`              // Numeric
+	Order             []uuid.UUID          `json:"order,omitempty"`               // Ordering
+	Matches           map[uuid.UUID]string `json:"matches,omitempty"`             // Matching
+}
+
+// gradedAnswer is the result of grading an answer to a question
+type gradedAnswer struct {
+	IsCorrect        bool
+	SelectedAnswerID pgtype.UUID // Set for single choice questions
+	Response         []byte      // Set for all other question types
+}
+
+// errInvalidAttemptAnswer is returned when an answer doesn't fit the type of its question
+var errInvalidAttemptAnswer = errors.New("invalid answer for this question")
+
+// gradeAttemptAnswer grades the answer in req against the answer key of the question.
+// Answers that don't fit the question type wrap errInvalidAttemptAnswer.
+func gradeAttemptAnswer(questionType db.QuestionType, answers []db.Answer, req SaveAttemptAnswerRequest) (gradedAnswer, error) {
+	var graded gradedAnswer
+	byID := make(map[uuid.UUID]db.Answer, len(answers))
+	for _, a := range answers {
+		byID[a.ID] = a
+	}
+	invalid := func(format string, args ...interface{}) (gradedAnswer, error) {
+		return graded, fmt.Errorf("%w: %s", errInvalidAttemptAnswer, fmt.Sprintf(format, args...))
+	}
+
+	var response attemptResponse
+	switch questionType {
+	case db.QuestionTypeMultipleChoice, db.QuestionTypeTrueFalse:
+		selected, ok := byID[req.SelectedAnswerID]
+		if !ok {
+			return invalid("selected answer %s is not an option of question %s", req.SelectedAnswerID, req.QuestionID)
+		}
+		graded.IsCorrect = selected.IsCorrect
+		graded.SelectedAnswerID = pgtype.UUID{Bytes: selected.ID, Valid: true}
+		return graded, nil
+
+	case db.QuestionTypeMultiSelect:
+		if len(req.SelectedAnswerIDs) == 0 {
+			return invalid("select at least one answer")
+		}
+		chosen := make(map[uuid.UUID]bool, len(req.SelectedAnswerIDs))
+		for _, id := range req.SelectedAnswerIDs {
+			if _, ok := byID[id]; !ok {
+				return invalid("selected answer %s is not an option of question %s", id, req.QuestionID)
+			}
+			chosen[id] = true
+		}
+		// Correct only if exactly the correct options were selected
+		graded.IsCorrect = true
+		for _, a := range answers {
+			if a.IsCorrect != chosen[a.ID] {
+				graded.IsCorrect = false
+			}
+		}
+		response.SelectedAnswerIDs = req.SelectedAnswerIDs
+
+	case db.QuestionTypeShortAnswer:
+		if req.TextAnswer == nil || strings.TrimSpace(*req.TextAnswer) == "" {
+			return invalid("textAnswer is required")
+		}
+		given := normalizeShortAnswer(*req.TextAnswer)
+		for _, a := range answers {
+			if a.IsCorrect && normalizeShortAnswer(a.Answer) == given {
+				graded.IsCorrect = true
+				break
+			}
+		}
+		response.Text = req.TextAnswer
+
+	case db.QuestionTypeNumeric:
+		if req.NumericAnswer == nil || math.IsNaN(*req.NumericAnswer) || math.IsInf(*req.NumericAnswer, 0) {
+			return invalid("numericAnswer is required")
+		}
+		for _, a := range answers {
+			if !a.NumericValue.Valid {
+				continue
+			}
+			// A small epsilon keeps answers exactly at the tolerance from failing on rounding
+			if math.Abs(*req.NumericAnswer-a.NumericValue.Float64) <= a.Tolerance.Float64+1e-9 {
+				graded.IsCorrect = true
+				break
+			}
+		}
+		response.Number = req.NumericAnswer
+
+	case db.QuestionTypeOrdering:
+		if len(req.Order) != len(answers) {
+			return invalid("order must contain each of the %d items exactly once", len(answers))
+		}
+		seen := make(map[uuid.UUID]bool, len(req.Order))
+		graded.IsCorrect = true
+		for i, id := range req.Order {
+			item, ok := byID[id]
+			if !ok || seen[id] {
+				return invalid("order must contain each of the %d items exactly once", len(answers))
+			}
+			seen[id] = true
+			if item.CorrectPosition.Int32 != int32(i+1) {
+				graded.IsCorrect = false
+			}
+		}
+		response.Order = req.Order
+
+	case db.QuestionTypeMatching:
+		if len(req.Matches) != len(answers) {
+			return invalid("matches must match each of the %d items", len(answers))
+		}
+		graded.IsCorrect = true
+		for id, match := range req.Matches {
+			item, ok := byID[id]
+			if !ok {
+				return invalid("item %s is not part of question %s", id, req.QuestionID)
+			}
+			// Compared like short answers, the taker's client may change case or spacing
+			if normalizeShortAnswer(match) != normalizeShortAnswer(item.MatchText.String) {
+				graded.IsCorrect = false
+			}
+		}
+		response.Matches = req.Matches
+
+	default:
+		return graded, fmt.Errorf("unsupported question type %q", questionType)
+	}
+
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return graded, fmt.Errorf("failed to encode answer: %w", err)
+	}
+	graded.Response = encoded
+	return graded, nil
+}
+
+// normalizeShortAnswer makes short answers and matches comparable regardless of case, spacing and surrounding punctuation
+func normalizeShortAnswer(answer string) string {
+	answer = strings.Join(strings.Fields(strings.ToLower(answer)), " ")
+	return strings.Trim(answer, ".,;:!?\"'()")
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"quizbuilderai/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestGradeAttemptAnswer(t *testing.T) {
+	questionID := uuid.New()
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	unknown := uuid.New()
+	text := func(s string) *string { return &s }
+	number := func(f float64) *float64 { return &f }
+
+	// Three options, the correct ones given by index
+	choices := func(correct ...int) []db.Answer {
+		answers := make([]db.Answer, len(ids))
+		for i, id := range ids {
+			answers[i] = db.Answer{ID: id, QuestionID: questionID, Answer: "Option"}
+		}
+		for _, i := range correct {
+			answers[i].IsCorrect = true
+		}
+		return answers
+	}
+	shortAnswers := []db.Answer{
+		{ID: ids[0], Answer: "Photosynthesis", IsCorrect: true},
+		{ID: ids[1], Answer: "light-dependent reactions", IsCorrect: true},
+	}
+	numericAnswers := []db.Answer{
+		{ID: ids[0], Answer: "9.81", IsCorrect: true, NumericValue: pgtype.Float8{Float64: 9.81, Valid: true}, Tolerance: pgtype.Float8{Float64: 0.01, Valid: true}},
+	}
+	orderingAnswers := []db.Answer{
+		{ID: ids[0], Answer: "Light reactions", CorrectPosition: pgtype.Int4{Int32: 1, Valid: true}},
+		{ID: ids[1], Answer: "Calvin cycle", CorrectPosition: pgtype.Int4{Int32: 2, Valid: true}},
+		{ID: ids[2], Answer: "Glucose export", CorrectPosition: pgtype.Int4{Int32: 3, Valid: true}},
+	}
+	matchingAnswers := []db.Answer{
+		{ID: ids[0], Answer: "Gas exchange", MatchText: pgtype.Text{String: "Stomata", Valid: true}},
+		{ID: ids[1], Answer: "Water transport", MatchText: pgtype.Text{String: "Xylem vessels", Valid: true}},
+	}
+
+	tests := []struct {
+		name        string
+		typ         db.QuestionType
+		answers     []db.Answer
+		req         SaveAttemptAnswerRequest
+		wantCorrect bool
+		wantInvalid bool // errInvalidAttemptAnswer
+		wantErr     bool // Any other error
+	}{
+		{name: "multiple choice correct", typ: db.QuestionTypeMultipleChoice, answers: choices(1), req: SaveAttemptAnswerRequest{SelectedAnswerID: ids[1]}, wantCorrect: true},
+		{name: "multiple choice wrong", typ: db.QuestionTypeMultipleChoice, answers: choices(1), req: SaveAttemptAnswerRequest{SelectedAnswerID: ids[0]}},
+		{name: "multiple choice unknown option", typ: db.QuestionTypeMultipleChoice, answers: choices(1), req: SaveAttemptAnswerRequest{SelectedAnswerID: unknown}, wantInvalid: true},
+		{name: "true/false correct", typ: db.QuestionTypeTrueFalse, answers: choices(0)[:2], req: SaveAttemptAnswerRequest{SelectedAnswerID: ids[0]}, wantCorrect: true},
+		{name: "true/false wrong", typ: db.QuestionTypeTrueFalse, answers: choices(0)[:2], req: SaveAttemptAnswerRequest{SelectedAnswerID: ids[1]}},
+
+		{name: "multi select exactly the correct options", typ: db.QuestionTypeMultiSelect, answers: choices(0, 2), req: SaveAttemptAnswerRequest{SelectedAnswerIDs: []uuid.UUID{ids[2], ids[0]}}, wantCorrect: true},
+		{name: "multi select missing a correct option", typ: db.QuestionTypeMultiSelect, answers: choices(0, 2), req: SaveAttemptAnswerRequest{SelectedAnswerIDs: []uuid.UUID{ids[0]}}},
+		{name: "multi select with a wrong option", typ: db.QuestionTypeMultiSelect, answers: choices(0, 2), req: SaveAttemptAnswerRequest{SelectedAnswerIDs: ids}},
+		{name: "multi select nothing", typ: db.QuestionTypeMultiSelect, answers: choices(0, 2), req: SaveAttemptAnswerRequest{}, wantInvalid: true},
+		{name: "multi select unknown option", typ: db.QuestionTypeMultiSelect, answers: choices(0, 2), req: SaveAttemptAnswerRequest{SelectedAnswerIDs: []uuid.UUID{ids[0], unknown}}, wantInvalid: true},
+
+		{name: "short answer exact", typ: db.QuestionTypeShortAnswer, answers: shortAnswers, req: SaveAttemptAnswerRequest{TextAnswer: text("Photosynthesis")}, wantCorrect: true},
+		{name: "short answer case, spacing and punctuation", typ: db.QuestionTypeShortAnswer, answers: shortAnswers, req: SaveAttemptAnswerRequest{TextAnswer: text("  Light-Dependent   reactions. ")}, wantCorrect: true},
+		{name: "short answer wrong", typ: db.QuestionTypeShortAnswer, answers: shortAnswers, req: SaveAttemptAnswerRequest{TextAnswer: text("respiration")}},
+		{name: "short answer blank", typ: db.QuestionTypeShortAnswer, answers: shortAnswers, req: SaveAttemptAnswerRequest{TextAnswer: text("  ")}, wantInvalid: true},
+		{name: "short answer missing", typ: db.QuestionTypeShortAnswer, answers: shortAnswers, req: SaveAttemptAnswerRequest{}, wantInvalid: true},
+
+		{name: "numeric exact", typ: db.QuestionTypeNumeric, answers: numericAnswers, req: SaveAttemptAnswerRequest{NumericAnswer: number(9.81)}, wantCorrect: true},
+		{name: "numeric at the tolerance", typ: db.QuestionTypeNumeric, answers: numericAnswers, req: SaveAttemptAnswerRequest{NumericAnswer: number(9.82)}, wantCorrect: true},
+		{name: "numeric outside the tolerance", typ: db.QuestionTypeNumeric, answers: numericAnswers, req: SaveAttemptAnswerRequest{NumericAnswer: number(9.9)}},
+		{name: "numeric missing", typ: db.QuestionTypeNumeric, answers: numericAnswers, req: SaveAttemptAnswerRequest{}, wantInvalid: true},
+		{name: "numeric NaN", typ: db.QuestionTypeNumeric, answers: numericAnswers, req: SaveAttemptAnswerRequest{NumericAnswer: number(math.NaN())}, wantInvalid: true},
+
+		{name: "ordering correct", typ: db.QuestionTypeOrdering, answers: orderingAnswers, req: SaveAttemptAnswerRequest{Order: []uuid.UUID{ids[0], ids[1], ids[2]}}, wantCorrect: true},
+		{name: "ordering swapped", typ: db.QuestionTypeOrdering, answers: orderingAnswers, req: SaveAttemptAnswerRequest{Order: []uuid.UUID{ids[1], ids[0], ids[2]}}},
+		{name: "ordering missing an item", typ: db.QuestionTypeOrdering, answers: orderingAnswers, req: SaveAttemptAnswerRequest{Order: []uuid.UUID{ids[0], ids[1]}}, wantInvalid: true},
+		{name: "ordering duplicate item", typ: db.QuestionTypeOrdering, answers: orderingAnswers, req: SaveAttemptAnswerRequest{Order: []uuid.UUID{ids[0], ids[0], ids[2]}}, wantInvalid: true},
+		{name: "ordering unknown item", typ: db.QuestionTypeOrdering, answers: orderingAnswers, req: SaveAttemptAnswerRequest{Order: []uuid.UUID{ids[0], ids[1], unknown}}, wantInvalid: true},
+
+		{name: "matching exact", typ: db.QuestionTypeMatching, answers: matchingAnswers, req: SaveAttemptAnswerRequest{Matches: map[uuid.UUID]string{ids[0]: "Stomata", ids[1]: "Xylem vessels"}}, wantCorrect: true},
+		{name: "matching case and spacing", typ: db.QuestionTypeMatching, answers: matchingAnswers, req: SaveAttemptAnswerRequest{Matches: map[uuid.UUID]string{ids[0]: "stomata", ids[1]: " XYLEM  vessels "}}, wantCorrect: true},
+		{name: "matching swapped", typ: db.QuestionTypeMatching, answers: matchingAnswers, req: SaveAttemptAnswerRequest{Matches: map[uuid.UUID]string{ids[0]: "Xylem vessels", ids[1]: "Stomata"}}},
+		{name: "matching missing an item", typ: db.QuestionTypeMatching, answers: matchingAnswers, req: SaveAttemptAnswerRequest{Matches: map[uuid.UUID]string{ids[0]: "Stomata"}}, wantInvalid: true},
+		{name: "matching unknown item", typ: db.QuestionTypeMatching, answers: matchingAnswers, req: SaveAttemptAnswerRequest{Matches: map[uuid.UUID]string{ids[0]: "Stomata", unknown: "Xylem vessels"}}, wantInvalid: true},
+
+		{name: "unsupported type", typ: db.QuestionType("essay"), answers: shortAnswers, req: SaveAttemptAnswerRequest{TextAnswer: text("Photosynthesis")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.QuestionID = questionID
+			graded, err := gradeAttemptAnswer(tt.typ, tt.answers, tt.req)
+			switch {
+			case tt.wantInvalid:
+				if !errors.Is(err, errInvalidAttemptAnswer) {
+					t.Fatalf("err = %v, want errInvalidAttemptAnswer", err)
+				}
+				return
+			case tt.wantErr:
+				if err == nil || errors.Is(err, errInvalidAttemptAnswer) {
+					t.Fatalf("err = %v, want an error other than errInvalidAttemptAnswer", err)
+				}
+				return
+			case err != nil:
+				t.Fatalf("gradeAttemptAnswer: %v", err)
+			}
+
+			if graded.IsCorrect != tt.wantCorrect {
+				t.Errorf("IsCorrect = %v, want %v", graded.IsCorrect, tt.wantCorrect)
+			}
+			// Single choice answers are stored as the selected answer, all others as a response
+			singleChoice := tt.typ == db.QuestionTypeMultipleChoice || tt.typ == db.QuestionTypeTrueFalse
+			if graded.SelectedAnswerID.Valid != singleChoice {
+				t.Errorf("SelectedAnswerID = %v, want set: %v", graded.SelectedAnswerID, singleChoice)
+			}
+			if (len(graded.Response) > 0) == singleChoice {
+				t.Errorf("Response = %s, want set: %v", graded.Response, !singleChoice)
+			}
+		})
+	}
+}
@@ -1,18 +1,23 @@
 package handlers
 
 import (
-	"database/sql" // Added for sql.ErrNoRows
-	"errors"       // Import the standard errors package
-	"fmt"          // Added for error formatting
-	"io"           // Added for file operations
-	"log"          // Added for logging errors
-	"mime/multipart"
+	"context"
+	"database/sql"  // Added for sql.ErrNoRows
+	"encoding/json" // Added for encoding generation job input
+	"errors"        // Import the standard errors package
+	"fmt"           // Added for error formatting
+	"log"           // Added for logging errors
 	"net/http"
 	"os"
-	"time" // Added for response struct timestamps
+	"slices"  // Added for joining submitted and reused URLs
+	"strconv" // Added for parsing the useCache option
+	"time"    // Added for response struct timestamps
 
 	"quizbuilderai/internal/db"
 	"quizbuilderai/internal/gemini"
+	"quizbuilderai/internal/storage"
+	"quizbuilderai/internal/upload"
+	"quizbuilderai/internal/youtube"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"         // Added for user ID
@@ -23,21 +28,103 @@ import (
 type ResponseOption struct {
 	ID          uuid.UUID `json:"id"`
 	Text        string    `json:"text"`
-	IsCorrect   bool      `json:"is_correct"`
+	IsCorrect   *bool     `json:"is_correct,omitempty"`  // Omitted in the taker view
 	Explanation *string   `json:"explanation,omitempty"` // Use pointer for optional string
+	// Answer key of the question types that need more than is_correct
+	CorrectPosition *int32   `json:"correct_position,omitempty"` // Ordering
+	MatchText       *string  `json:"match_text,omitempty"`       // Matching
+	NumericValue    *float64 `json:"numeric_value,omitempty"`    // Numeric
+	Tolerance       *float64 `json:"tolerance,omitempty"`        // Numeric
 }
 
 type ResponseQuestion struct {
 	ID         uuid.UUID        `json:"id"`
 	Text       string           `json:"text"`
+	Type       db.QuestionType  `json:"type"`
 	TopicTitle *string          `json:"topic_title,omitempty"` // Use pointer for optional string
 	Options    []ResponseOption `json:"options"`
+	Source     *ResponseSource  `json:"source,omitempty"` // Where the question was generated from, if known
+	Position   int32            `json:"position"`         // Questions are listed by position
+	// Taker view of matching questions: the items the options are matched with, shuffled
+	MatchOptions []string `json:"match_options,omitempty"`
+}
+
+// newResponseOption maps an answer to its response form
+func newResponseOption(dbA db.Answer) ResponseOption {
+	// Handle nullable Explanation
+	var explanation *string
+	if dbA.Explanation.Valid {
+		explanationStr := dbA.Explanation.String // Assign to temp variable
+		explanation = &explanationStr
+	}
+	option := ResponseOption{
+		ID:          dbA.ID,
+		Text:        dbA.Answer, // Use 'Answer' field from db.Answer
+		IsCorrect:   &dbA.IsCorrect,
+		Explanation: explanation, // Use the *string variable
+	}
+	// Type-specific answer key
+	if dbA.CorrectPosition.Valid {
+		option.CorrectPosition = &dbA.CorrectPosition.Int32
+	}
+	if dbA.MatchText.Valid {
+		option.MatchText = &dbA.MatchText.String
+	}
+	if dbA.NumericValue.Valid {
+		option.NumericValue = &dbA.NumericValue.Float64
+		option.Tolerance = &dbA.Tolerance.Float64
+	}
+	return option
+}
+
+// ResponseSource is the material and passage a question was generated from
+type ResponseSource struct {
+	MaterialID       *uuid.UUID `json:"material_id,omitempty"`
+	MaterialTitle    *string    `json:"material_title,omitempty"`
+	PageStart        *int32     `json:"page_start,omitempty"`        // Paged documents such as PDFs
+	PageEnd          *int32     `json:"page_end,omitempty"`          // Paged documents such as PDFs
+	TimestampSeconds *int32     `json:"timestamp_seconds,omitempty"` // Videos
+	Quote            *string    `json:"quote,omitempty"`
+	URL              *string    `json:"url,omitempty"` // Link to the material, for videos starting at the timestamp
+}
+
+// newResponseSource maps a question source to its response form
+func newResponseSource(src db.ListQuestionSourcesByQuizIDRow) *ResponseSource {
+	source := &ResponseSource{}
+	if src.MaterialID.Valid {
+		materialID := uuid.UUID(src.MaterialID.Bytes)
+		source.MaterialID = &materialID
+	}
+	if src.MaterialTitle.Valid {
+		source.MaterialTitle = &src.MaterialTitle.String
+	}
+	if src.PageStart.Valid {
+		source.PageStart = &src.PageStart.Int32
+		source.PageEnd = &src.PageEnd.Int32
+	}
+	if src.TimestampSeconds.Valid {
+		source.TimestampSeconds = &src.TimestampSeconds.Int32
+	}
+	if src.Quote.Valid {
+		source.Quote = &src.Quote.String
+	}
+	if src.MaterialUrl.Valid {
+		url := src.MaterialUrl.String
+		if src.TimestampSeconds.Valid {
+			// Deep link YouTube videos to the moment the question is based on
+			if timestampURL, err := youtube.TimestampURL(url, int(src.TimestampSeconds.Int32)); err == nil {
+				url = timestampURL
+			}
+		}
+		source.URL = &url
+	}
+	return source
 }
 
 // ResponseQuizDetail represents the detailed quiz data sent to the frontend, including creator info.
 // Note: We use pointers for optional fields to allow null/omitted values in JSON.
 type ResponseQuizDetail struct {
-	ID             uuid.UUID          `json:"id"`
+	ID             *uuid.UUID         `json:"id,omitempty"` // Left out of shared quizzes
 	Title          string             `json:"title"`
 	Description    *string            `json:"description,omitempty"` // Use pointer for optional string
 	Visibility     db.QuizVisibility  `json:"visibility"`
@@ -46,6 +133,9 @@ type ResponseQuizDetail struct {
 	UpdatedAt      time.Time          `json:"updated_at"`
 	CreatorName    *string            `json:"creator_name,omitempty"`    // Add creator name (optional)
 	CreatorPicture *string            `json:"creator_picture,omitempty"` // Add creator picture (optional)
+	// Options the quiz was generated with, nil for quizzes generated before options existed
+	GenerationOptions *gemini.GenerationOptions `json:"generation_options,omitempty"`
+	View              string                    `json:"view"` // "owner" with the answer key, "taker" without
 }
 
 // contains checks if a string is in a slice
@@ -63,9 +153,9 @@ func cleanupTempFile(path string) error {
 	return os.Remove(path)
 }
 
-// HandleGenerateQuiz handles the request to generate a quiz from uploaded content
+// HandleGenerateQuiz handles the request to generate a quiz from uploaded content.
+// The quiz is generated in the background: the response carries a job ID to poll with GET /api/jobs/:jobId.
 func (h *Handler) HandleGenerateQuiz(c *gin.Context) {
-	startTime := time.Now() // Record start time
 	ctx := c.Request.Context()
 	// _ = ctx // Mark ctx as used to avoid compiler error, will be used later
 
@@ -112,480 +202,407 @@ func (h *Handler) HandleGenerateQuiz(c *gin.Context) {
 		// userName and userEmail will keep their default values ("Unknown User", "")
 	}
 	// 2. Parse Multipart Form Data
-	// Set a reasonable limit (e.g., 64 MB) for memory storage of parts
-	// Adjust this based on expected file sizes and server resources
-	err := c.Request.ParseMultipartForm(64 << 20) // 64 MB
+	// The body is capped at the upload limits; file parts beyond upload.MaxMemory are spooled to disk
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Uploads.MaxRequestBytes())
+	err := c.Request.ParseMultipartForm(upload.MaxMemory)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.handleErrorAndNotify(c, userID, http.StatusRequestEntityTooLarge, "Upload is too large",
+			fmt.Errorf("files may be at most %d MB in total", h.Uploads.MaxTotalBytes>>20))
+		return
+	}
 	if err != nil {
 		// Use handleErrorAndNotify
 		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "Failed to parse multipart form", err)
 		return
 	}
+	// Spooled file parts are removed once the request is done
+	defer c.Request.MultipartForm.RemoveAll()
 
-	// Structure to hold info about uploaded files for later processing (DB)
-	type uploadedFileInfo struct {
-		Header   *multipart.FileHeader // Keep header for original filename, size etc.
-		TempPath string                // Path to the temporary file on disk
+	// Validate the generation options before any work is done
+	options, err := parseGenerationOptions(c.Request.MultipartForm)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "Invalid generation options", err)
+		return
 	}
-	var uploadedFiles []uploadedFileInfo // Holds info only for actual file uploads
-
-	// Slice to hold info about processed documents for Gemini (files + transcripts)
-	var documentFiles []gemini.DocumentFile
-	// Slice to hold paths of ALL temporary files (files + transcripts) for cleanup
-	var tempFilePaths []string
 
-	// Defer cleanup of all temporary files
-	defer func() {
-		for _, path := range tempFilePaths {
-			log.Printf("INFO: Cleaning up temporary file: %s", path)
-			if err := os.Remove(path); err != nil {
-				log.Printf("WARN: Failed to remove temporary file %s: %v", path, err)
-			}
+	// useCache builds the quiz from an identical earlier generation if there is one, without using tokens
+	useCache := false
+	if values := c.Request.MultipartForm.Value["useCache"]; len(values) > 0 && values[0] != "" {
+		useCache, err = strconv.ParseBool(values[0])
+		if err != nil {
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "Invalid generation options", errors.New("useCache must be true or false"))
+			return
 		}
-	}()
+	}
 
-	// 3. Process Uploaded Files
+	// Validate the uploaded files by their size and content, again before any work is done
 	files := c.Request.MultipartForm.File["files"] // Key matches frontend FormData
-	log.Printf("INFO: Received %d files for processing", len(files))
-
-	for _, fileHeader := range files {
-		log.Printf("INFO: Processing file: %s (Size: %d)", fileHeader.Filename, fileHeader.Size)
+	uploads, rejections := upload.Check(files, h.Uploads, gemini.SupportedExtensions)
+	if len(rejections) > 0 {
+		h.rejectUploads(c, userID, rejections)
+		return
+	}
 
-		// Basic validation (optional, add more as needed)
-		if fileHeader.Size == 0 {
-			log.Printf("WARN: Skipping empty file: %s", fileHeader.Filename)
-			continue
-		}
-		// Add size limit check if necessary
-		// Add MIME type check if necessary
+	// Materials of earlier quizzes to generate from again: stored files are restored from the storage,
+	// videos and pages are fetched again from their URL
+	reused, status, err := h.reusableMaterials(ctx, userID, c.Request.MultipartForm.Value["materialIds"])
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, status, "Invalid materials to generate from", err)
+		return
+	}
+	var reusedFiles []db.Material
+	var reusedVideoURLs, reusedPageURLs []string
+	reusedURLs := make(map[string]uuid.UUID) // Material of each reused video or page URL
+	for _, material := range reused {
+		switch {
+		case material.StorageKey.Valid:
+			reusedFiles = append(reusedFiles, material)
+		case materialSource(material) == materialSourceWeb:
+			reusedPageURLs = append(reusedPageURLs, material.Url.String)
+			reusedURLs[material.Url.String] = material.ID
+		default:
+			reusedVideoURLs = append(reusedVideoURLs, material.Url.String)
+			reusedURLs[material.Url.String] = material.ID
+		}
+	}
+	if len(uploads)+len(reusedFiles) > h.Uploads.MaxFiles {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "Too many files to generate from",
+			fmt.Errorf("%d files were uploaded or reused, at most %d are accepted", len(uploads)+len(reusedFiles), h.Uploads.MaxFiles))
+		return
+	}
 
-		file, err := fileHeader.Open()
-		if err != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to open uploaded file %s", fileHeader.Filename), err)
-			return // Stop processing on error
-		}
-		// Ensure file is closed (although saving to temp might make this redundant)
-		defer file.Close()
+	// Every request becomes a generation job; its inputs are saved to a job directory
+	// so a background worker can pick them up after this request returns.
+	jobID := uuid.New()
+	jobDir, err := newJobDir(jobID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to create job directory", err)
+		return
+	}
+	input := generationJobInput{
+		Dir:       jobDir,
+		Options:   options,
+		UserName:  userName,
+		UserEmail: userEmail,
+	}
+	// Progress is published under the job ID right away; subscribers get the earlier events replayed
+	progress := h.Progress.Func(jobID)
 
-		// Read file content (needed for SaveTempFile)
-		fileBytes, err := io.ReadAll(file)
-		if err != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to read uploaded file %s", fileHeader.Filename), err)
+	// Remove the job directory unless the job was handed to a worker
+	queued := false
+	defer func() {
+		if queued {
 			return
 		}
+		h.Progress.Close(jobID)
+		log.Printf("INFO: Cleaning up job directory: %s", jobDir)
+		if err := os.RemoveAll(jobDir); err != nil {
+			log.Printf("WARN: Failed to remove job directory %s: %v", jobDir, err)
+		}
+	}()
+
+	// 3. Process Uploaded Files
+	log.Printf("INFO: Received %d files for processing, %d of them not empty", len(files), len(uploads))
+
+	for i, file := range uploads {
+		log.Printf("INFO: Processing file: %s as %s (Size: %d)", file.Header.Filename, file.Name, file.Header.Size)
 
-		// Save to temporary location using gemini helper
-		// Note: SaveTempFile expects []byte
-		tempPath, err := gemini.SaveTempFile(fileBytes, fileHeader.Filename)
+		// Stream to the job directory
+		jobPath := jobFilePath(jobDir, i, file.Name)
+		size, hash, err := upload.Save(file.Header, jobPath)
 		if err != nil {
 			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to save temporary file for %s", fileHeader.Filename), err)
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to save job file for %s", file.Header.Filename), err)
 			return
 		}
-		tempFilePaths = append(tempFilePaths, tempPath) // Add path for deferred cleanup
-		log.Printf("INFO: Saved file %s temporarily to %s", fileHeader.Filename, tempPath)
-
-		// Store info needed for DB processing within the transaction
-		uploadedFiles = append(uploadedFiles, uploadedFileInfo{
-			Header:   fileHeader,
-			TempPath: tempPath,
+		log.Printf("INFO: Saved file %s for job %s to %s", file.Name, jobID, jobPath)
+		progress.Emit(gemini.ProgressEvent{
+			Stage:   gemini.StageFileSaved,
+			Message: fmt.Sprintf("Saved %s", file.Name),
+			Files:   []string{file.Name},
 		})
-		// Note: We no longer need the placeholder materialIDs slice here,
-		// as materials will be created and linked within the transaction directly.
-
-		// Prepare document for Gemini processing
-		documentFiles = append(documentFiles, gemini.DocumentFile{
-			Name: fileHeader.Filename,
-			Path: tempPath,
-			Size: fileHeader.Size,
+
+		input.Files = append(input.Files, generationJobFile{
+			Name: file.Name,
+			Path: jobPath,
+			Size: size,
+			Hash: hash,
 		})
 	}
 
 	// 4. Process Video URLs
-	videoURLs := c.Request.MultipartForm.Value["videoUrls"] // Key matches frontend FormData
+	videoURLs := slices.Concat(c.Request.MultipartForm.Value["videoUrls"], reusedVideoURLs) // Key matches frontend FormData
 	log.Printf("INFO: Received %d video URLs for processing", len(videoURLs))
 	log.Printf("DEBUG: Video URLs received: %v", videoURLs) // Log the actual URLs received
 
-	for _, url := range videoURLs {
+	// Caption languages in order of preference, e.g. transcriptLanguages=de&transcriptLanguages=en;
+	// without them the quiz language is tried before the video's own captions
+	transcriptLanguages := c.Request.MultipartForm.Value["transcriptLanguages"]
+	if len(transcriptLanguages) == 0 && options.Language != "" {
+		transcriptLanguages = []string{options.Language}
+	}
+
+	for i, url := range videoURLs {
 		if url == "" {
 			log.Printf("WARN: Skipping empty video URL")
 			continue
 		}
 		log.Printf("INFO: Processing video URL: %s", url)
 
-		// Fetch transcript (pass empty string for default language)
+		// Fetch transcript in the first preferred language the video has captions in
 		log.Printf("DEBUG: Calling GetTranscript for URL: %s", url)
-		transcript, err := h.Youtube.GetTranscript(url, "") // Corrected: Removed ctx
+		transcript, err := h.Youtube.GetTranscript(ctx, url, transcriptLanguages)
 		if err != nil {
 			// Log error but continue processing other URLs/files? Or abort?
 			// For now, let's log and continue, but return an error later if *no* content was processed.
 			log.Printf("WARN: Failed to get transcript for URL %s: %v. Skipping this URL.", url, err)
-			// Optionally: Add this error to a list to return to the user later
-			log.Printf("DEBUG: Skipping URL %s due to GetTranscript error: %v", url, err)
 			continue
 		}
 
-		if transcript == "" {
+		if len(transcript.Segments) == 0 {
 			log.Printf("WARN: Skipping URL %s as transcript was empty.", url)
 			continue
 		}
-		log.Printf("DEBUG: Successfully fetched transcript for URL %s (length: %d)", url, len(transcript))
-		// Removed extra closing brace from here
+		// The transcript is preceded by the video title, channel and duration as context for the generator
+		transcriptText := transcript.Document()
+		log.Printf("DEBUG: Successfully fetched %s transcript of %q for URL %s (%d segments, length: %d)", transcript.Language, transcript.Title, url, len(transcript.Segments), len(transcriptText))
 
-		// Save transcript to temporary file
-		transcriptFilename := fmt.Sprintf("transcript_%s.txt", uuid.New().String()) // Unique temp name
-		tempPath, err := gemini.SaveTempFile([]byte(transcript), transcriptFilename)
+		// Save transcript to the job directory, named after the video
+		jobPath, err := saveJobFile(jobDir, len(files)+i, titledFileName(transcript.Title, "transcript_"+transcript.VideoID), []byte(transcriptText))
 		if err != nil {
 			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to save temporary transcript file for %s", url), err)
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to save transcript job file for %s", url), err)
 			return
 		}
-		tempFilePaths = append(tempFilePaths, tempPath) // Add path for deferred cleanup
-		log.Printf("INFO: Saved transcript for %s temporarily to %s", url, tempPath)
+		log.Printf("INFO: Saved transcript for %s for job %s to %s", url, jobID, jobPath)
+		progress.Emit(gemini.ProgressEvent{
+			Stage:   gemini.StageTranscriptFetched,
+			Message: fmt.Sprintf("Fetched transcript for %s", url),
+			Files:   []string{url},
+		})
+
+		// Note: The material record for transcripts is created by the worker using the video URL and details.
+		input.Videos = append(input.Videos, generationJobVideo{
+			URL:             url,
+			Path:            jobPath,
+			Size:            int64(len(transcriptText)),
+			VideoID:         transcript.VideoID,
+			Title:           transcript.Title,
+			Channel:         transcript.Channel,
+			DurationSeconds: transcript.DurationSeconds,
+			Language:        transcript.Language,
+			Hash:            contentHash([]byte(transcriptText)),
+			MaterialID:      takeReusedMaterial(reusedURLs, url),
+		})
+	}
+
+	// 5. Process Page URLs: articles, documentation or other web pages
+	pageURLs := slices.Concat(c.Request.MultipartForm.Value["pageUrls"], reusedPageURLs)
+	log.Printf("INFO: Received %d page URLs for processing", len(pageURLs))
+	for i, url := range pageURLs {
+		if url == "" {
+			log.Printf("WARN: Skipping empty page URL")
+			continue
+		}
+		page, err := h.Webpages.Fetch(ctx, url)
+		if err != nil {
+			// Like videos, pages that can't be used are skipped
+			log.Printf("WARN: Failed to fetch page %s: %v. Skipping this URL.", url, err)
+			continue
+		}
 
-		// Get file info for size
-		fileInfo, err := os.Stat(tempPath)
+		// The content is preceded by the page title and URL as context for the generator
+		pageText := page.Document()
+		jobPath, err := saveJobFile(jobDir, len(files)+len(videoURLs)+i, titledFileName(page.Title, fmt.Sprintf("page_%d", i+1)), []byte(pageText))
 		if err != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get file info for temporary transcript %s", tempPath), err)
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to save page job file for %s", url), err)
 			return
 		}
+		log.Printf("INFO: Saved page %s (%q, %d characters) for job %s to %s", page.URL, page.Title, len(page.Text), jobID, jobPath)
+		progress.Emit(gemini.ProgressEvent{
+			Stage:   gemini.StagePageFetched,
+			Message: fmt.Sprintf("Fetched page %s", url),
+			Files:   []string{url},
+		})
 
-		// Note: Transcripts are processed for Gemini but NOT stored in uploadedFiles
-		// The material record for transcripts will be created in the transaction using the video URL.
+		input.Pages = append(input.Pages, generationJobPage{
+			URL:        page.URL,
+			Path:       jobPath,
+			Size:       int64(len(pageText)),
+			Title:      page.Title,
+			SiteName:   page.SiteName,
+			Hash:       contentHash([]byte(pageText)),
+			MaterialID: takeReusedMaterial(reusedURLs, url),
+		})
+	}
 
-		// Prepare document for Gemini processing
-		documentFiles = append(documentFiles, gemini.DocumentFile{
-			Name: transcriptFilename, // Use the temp filename
-			Path: tempPath,
-			Size: fileInfo.Size(),
+	// 6. Restore the stored files of reused materials
+	for i, material := range reusedFiles {
+		jobPath := jobFilePath(jobDir, len(files)+len(videoURLs)+len(pageURLs)+i, material.Title)
+		size, hash, err := h.restoreMaterialFile(ctx, material, jobPath)
+		if errors.Is(err, storage.ErrNotFound) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Stored file of material %s is missing", material.ID), err)
+			return
+		}
+		if err != nil {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to restore material %s", material.ID), err)
+			return
+		}
+		log.Printf("INFO: Restored material %s (%s) for job %s to %s", material.ID, material.Title, jobID, jobPath)
+		progress.Emit(gemini.ProgressEvent{
+			Stage:   gemini.StageFileSaved,
+			Message: fmt.Sprintf("Restored %s", material.Title),
+			Files:   []string{material.Title},
 		})
-		log.Printf("DEBUG: Added transcript from URL %s as document file: %s", url, transcriptFilename)
 
-	} // <-- Moved this closing brace after the log message
+		materialID := material.ID
+		input.Files = append(input.Files, generationJobFile{
+			Name:       material.Title,
+			Path:       jobPath,
+			Size:       size,
+			Hash:       hash,
+			MaterialID: &materialID,
+		})
+	}
 
 	// Check if any content was processed
-	if len(documentFiles) == 0 {
+	if len(input.Files) == 0 && len(input.Videos) == 0 && len(input.Pages) == 0 {
 		// Use handleErrorAndNotify
-		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "No valid files or video URLs were processed", errors.New("no valid content provided or processed. Please check files and URLs"))
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "No valid files, video URLs or page URLs were processed", errors.New("no valid content provided or processed. Please check files and URLs"))
 		return
 	}
 
-	// 5. Call Gemini to generate the quiz
-	log.Printf("INFO: Calling Gemini to process %d documents for user %s", len(documentFiles), userID)
-	// Receive token counts from ProcessDocuments
-	geminiResponse, promptTokens, candidateTokens, totalTokens, err := h.Gemini.ProcessDocuments(ctx, documentFiles)
-	if err != nil {
-		// Use handleErrorAndNotify
-		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Gemini processing failed", err)
-		return
+	// 7. Look for an identical earlier generation if asked to; a quiz built from it uses no tokens
+	if useCache {
+		entry, err := h.lookupGenerationCache(ctx, input)
+		if err != nil {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to look up cached generation", err)
+			return
+		}
+		if entry != nil {
+			log.Printf("INFO: Job %s will be built from cached generation %s", jobID, entry.ID)
+			input.CacheID = &entry.ID
+		}
 	}
 
-	// Log received token counts (even if quiz generation failed partially)
-	log.Printf("INFO: Gemini Token Usage Reported: User=%s, Prompt=%d, Candidates=%d, Total=%d", userID, promptTokens, candidateTokens, totalTokens)
+	// 8. Estimate the token usage before anything is generated
+	var estimate gemini.TokenUsage
+	if input.CacheID == nil {
+		documentFiles, err := input.documentFiles()
+		if errors.Is(err, gemini.ErrUnreadableDocument) {
+			h.handleErrorAndNotify(c, userID, http.StatusUnprocessableEntity, "Failed to read the text of an uploaded document", err)
+			return
+		}
+		if err != nil {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to prepare the uploaded documents", err)
+			return
+		}
+		estimate, err = h.Generator.EstimateUsage(ctx, documentFiles, input.Options)
+		if err != nil {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to estimate token usage", err)
+			return
+		}
+		log.Printf("INFO: Estimated token usage for job %s: Input=%d, Output=%d", jobID, estimate.PromptTokens, estimate.CandidateTokens)
+	}
 
-	if geminiResponse == nil || len(geminiResponse.Questions) == 0 {
-		// Use handleErrorAndNotify
-		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Gemini returned no questions", errors.New("quiz generation resulted in no questions"))
+	// 9. Create the job and reserve its estimated tokens together, then hand it to the workers
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to encode generation job input", err)
 		return
 	}
 
-	log.Printf("INFO: Gemini generated quiz titled '%s' with %d questions for user %s", geminiResponse.Title, len(geminiResponse.Questions), userID)
-
-	// 6. Process Gemini Response &amp; DB Insertion (Transaction)
-	var createdQuiz db.Quize // Variable to hold the created quiz
-
-	// Start transaction using the connection pool from the DB struct
 	tx, err := h.DB.Pool.Begin(ctx)
 	if err != nil {
-		// Use handleErrorAndNotify
 		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to begin database transaction", err)
 		return
 	}
-	// Ensure rollback on error
 	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
-
 	qtx := h.DB.Queries.WithTx(tx)
 
-	// --- Token Transaction and Balance Update (Inside Transaction) ---
-	// Create token usage record (negative amount for consumption)
-	if totalTokens > 0 { // Only record if tokens were used
-		_, tokenErr := qtx.CreateTokenTransaction(ctx, db.CreateTokenTransactionParams{
-			UserID: userID,
-			Amount: -totalTokens, // Use negative value for usage
-			// Type is automatically set to 'usage' by the query
-		})
-		if tokenErr != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to create token transaction record", tokenErr)
-			return // Rollback happens via defer
-		}
-
-		// Update user's token balance
-		_, balanceErr := qtx.UpdateUserTokenBalance(ctx, db.UpdateUserTokenBalanceParams{
-			ID:                  userID,
-			InputTokensBalance:  promptTokens,    // Amount to decrement input balance by
-			OutputTokensBalance: candidateTokens, // Amount to decrement output balance by
-		})
-		if balanceErr != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to update token balance", balanceErr)
-			return // Rollback happens via defer
-		}
-		log.Printf("INFO: Recorded token usage and updated balance for user %s: Prompt=%d, Candidates=%d, Total=%d", userID, promptTokens, candidateTokens, totalTokens)
-	}
-	// --- End Token Transaction ---
-
-	// Create the main Quiz record
-	quizParams := db.CreateQuizParams{
-		CreatorID: pgtype.UUID{Bytes: userID, Valid: true},
-		Title:     geminiResponse.Title,
-		// Description: pgtype.Text{String: "Generated by AI", Valid: true}, // Optional description
-		Visibility: db.QuizVisibilityPublic, // Default visibility set to public
-	}
-	createdQuiz, err = qtx.CreateQuiz(ctx, quizParams)
+	job, err := qtx.CreateGenerationJob(ctx, db.CreateGenerationJobParams{
+		ID:                   jobID,
+		UserID:               userID,
+		Input:                inputJSON,
+		ReservedInputTokens:  estimate.PromptTokens,
+		ReservedOutputTokens: estimate.CandidateTokens,
+		NodeID:               pgtype.Text{String: h.NodeID, Valid: h.NodeID != ""}, // The inputs are on this node's disk
+	})
 	if err != nil {
-		// Use handleErrorAndNotify
-		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to create quiz record", err)
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to create generation job", err)
 		return
 	}
-	log.Printf("INFO: Created quiz with ID %s for user %s", createdQuiz.ID, userID)
-
-	// Create and Link Materials to the Quiz (Inside Transaction)
-	processedMaterialCount := 0
-
-	// Process uploaded files (DB record creation and linking)
-	for _, uploadedFile := range uploadedFiles {
-		fileHeader := uploadedFile.Header
-		// tempPath := uploadedFile.TempPath // Removed as it's no longer used after R2 removal
-
-		// 1. Create Material Record (URL will remain empty/null as R2 is removed)
-		materialParams := db.CreateMaterialParams{
-			UserID: userID,
-			Title:  fileHeader.Filename,
-			// Url is NULL/empty
-		}
-		material, err := qtx.CreateMaterial(ctx, materialParams)
-		if err != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create material record for file %s", fileHeader.Filename), err)
-			return // Rollback happens via defer
-		}
-		log.Printf("INFO: Created material record %s for file %s", material.ID, fileHeader.Filename)
-
-		// 2. R2 Upload Logic Removed
-		// The material URL will remain empty/null in the database.
-
-		// 4. Link Material to Quiz
-		_, linkErr := qtx.LinkQuizMaterial(ctx, db.LinkQuizMaterialParams{
-			QuizID:     createdQuiz.ID,
-			MaterialID: material.ID,
-		})
-		if linkErr != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to link material %s to quiz %s", material.ID, createdQuiz.ID), linkErr)
-			return // Rollback happens via defer
-		}
-		processedMaterialCount++
-	} // End loop for uploaded files
 
-	// Process video URLs (Create material with YouTube URL, link to quiz)
-	for _, url := range videoURLs {
-		if url == "" {
-			continue
-		} // Skip empty ones again
-
-		// Simple title generation
-		videoTitle := fmt.Sprintf("YouTube Transcript Source: %s", url)
-		if len(videoTitle) > 255 {
-			videoTitle = videoTitle[:252] + "..."
-		}
-
-		// Create material record with the original YouTube URL
-		materialParams := db.CreateMaterialParams{
-			UserID: userID,
-			Title:  videoTitle,
-			Url:    pgtype.Text{String: url, Valid: true}, // Store the YouTube URL
-		}
-		material, err := qtx.CreateMaterial(ctx, materialParams)
-		if err != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create material record for video %s", url), err)
-			return // Rollback happens via defer
-		}
-
-		// Link material to quiz
-		_, linkErr := qtx.LinkQuizMaterial(ctx, db.LinkQuizMaterialParams{
-			QuizID:     createdQuiz.ID,
-			MaterialID: material.ID,
-		})
-		if linkErr != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to link video material %s to quiz %s", material.ID, createdQuiz.ID), linkErr)
-			return // Rollback happens via defer
-		}
-		processedMaterialCount++
-	} // End loop for video URLs
-
-	log.Printf("INFO: Created and linked %d total materials (files + videos) to quiz %s", processedMaterialCount, createdQuiz.ID)
-	// Process Questions and Answers
-	topicCache := make(map[string]uuid.UUID) // Cache found/created topic IDs
-
-	for _, geminiQuestion := range geminiResponse.Questions {
-		if geminiQuestion.Text == "" || len(geminiQuestion.Options) != 4 {
-			log.Printf("WARN: Skipping invalid question from Gemini: %+v", geminiQuestion)
-			continue
-		}
-
-		// Get or Create Topic
-		topicTitle := geminiQuestion.Topic
-		if topicTitle == "" {
-			topicTitle = "General" // Default topic if Gemini didn't provide one
-			log.Printf("WARN: Gemini question missing topic, using default: '%s'", topicTitle)
-		}
-
-		topicID, found := topicCache[topicTitle]
-		if !found {
-			topic, err := qtx.GetTopicByTitleAndUser(ctx, db.GetTopicByTitleAndUserParams{
-				Title:     topicTitle,
-				CreatorID: pgtype.UUID{Bytes: userID, Valid: true},
-			})
-			if err != nil {
-				if errors.Is(err, sql.ErrNoRows) {
-					// Topic doesn't exist, create it
-					log.Printf("INFO: Topic '%s' not found for user %s, creating new topic.", topicTitle, userID)
-					newTopic, err := qtx.CreateTopic(ctx, db.CreateTopicParams{
-						CreatorID: pgtype.UUID{Bytes: userID, Valid: true},
-						Title:     topicTitle,
-						// Description: pgtype.Text{}, // Optional description
-					})
-					if err != nil {
-						// Use handleErrorAndNotify
-						h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create topic '%s'", topicTitle), err)
-						return
-					}
-					topicID = newTopic.ID
-					topicCache[topicTitle] = topicID
-					log.Printf("INFO: Created topic '%s' with ID %s for user %s", topicTitle, topicID, userID)
-				} else {
-					// Other database error
-					// Use handleErrorAndNotify
-					h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Database error checking topic '%s'", topicTitle), err)
-					return
-				}
-			} else {
-				// Topic found
-				topicID = topic.ID
-				topicCache[topicTitle] = topicID
-				log.Printf("INFO: Found existing topic '%s' with ID %s for user %s", topicTitle, topicID, userID)
-			}
-		}
-
-		// Create Question
-		dbQuestion, err := qtx.CreateQuestion(ctx, db.CreateQuestionParams{
-			QuizID:   createdQuiz.ID,
-			TopicID:  topicID,
-			Question: geminiQuestion.Text,
-		})
-		if err != nil {
-			// Use handleErrorAndNotify
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create question for quiz %s", createdQuiz.ID), err)
-			return
-		}
-
-		// Create Answers
-		correctAnswerCount := 0
-		for _, geminiOption := range geminiQuestion.Options {
-			if geminiOption.IsCorrect {
-				correctAnswerCount++
-			}
-			_, err = qtx.CreateAnswer(ctx, db.CreateAnswerParams{
-				QuestionID:  dbQuestion.ID,
-				Answer:      geminiOption.Text,
-				IsCorrect:   geminiOption.IsCorrect,
-				Explanation: pgtype.Text{String: geminiOption.Explanation, Valid: geminiOption.Explanation != ""}, // Add explanation from Gemini
-			})
-			if err != nil {
-				// Use handleErrorAndNotify
-				h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create answer for question %s", dbQuestion.ID), err)
-				return
-			}
-		}
-
-		// Validate that exactly one correct answer was provided by Gemini
-		if correctAnswerCount != 1 {
-			// Log the problematic question structure for debugging
-			// Use handleErrorAndNotify
-			errInvalidAnswers := fmt.Errorf("invalid number of correct answers (%d) for question: %s", correctAnswerCount, geminiQuestion.Text)
-			log.Printf("ERROR: %v. Rolling back. Question Details: %+v", errInvalidAnswers, geminiQuestion)
-			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Invalid question data received from AI", errInvalidAnswers)
+	if err := reserveTokens(ctx, qtx, userID, job.ID, estimate); err != nil {
+		if errors.Is(err, errInsufficientTokens) {
+			// Not an error worth a notification, the user just needs more tokens
+			tx.Rollback(ctx)
+			h.respondInsufficientTokens(c, userID, estimate)
 			return
 		}
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to reserve tokens", err)
+		return
 	}
 
-	// Commit the transaction
-	err = tx.Commit(ctx)
-	if err != nil {
-		// Use handleErrorAndNotify
-		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to commit transaction for quiz %s", createdQuiz.ID), err)
+	if err := tx.Commit(ctx); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to commit generation job", err)
 		return
 	}
 
-	log.Printf("INFO: Successfully created quiz %s with %d questions for user %s", createdQuiz.ID, len(geminiResponse.Questions), userID)
-
-	// Calculate duration
-	duration := time.Since(startTime)
-	log.Printf("INFO: Quiz %s generation took %s", createdQuiz.ID, duration)
-
-	// Log quiz creation activity
-	h.logActivity(ctx, userID, db.ActivityActionQuizCreate,
-		db.NullActivityTargetType{ActivityTargetType: db.ActivityTargetTypeQuiz, Valid: true},
-		pgtype.UUID{Bytes: createdQuiz.ID, Valid: true},
-		map[string]interface{}{
-			"title":            createdQuiz.Title,
-			"question_count":   len(geminiResponse.Questions),
-			"material_count":   processedMaterialCount,
-			"prompt_tokens":    promptTokens,            // Add token info
-			"candidate_tokens": candidateTokens,         // Add token info
-			"total_tokens":     totalTokens,             // Add token info
-			"duration_ms":      duration.Milliseconds(), // Add duration
-		}) // Add token and duration details to the log
-
-	// Send Discord notification for quiz creation using Embed
-	quizEmbed := DiscordEmbed{
-		Title: "📝 Quiz Created",
-		Color: 0x4CAF50, // Green color
-		Fields: []DiscordEmbedField{
-			{Name: "Title", Value: createdQuiz.Title, Inline: true},
-			{Name: "Questions", Value: fmt.Sprintf("%d", len(geminiResponse.Questions)), Inline: true},
-			{Name: "Materials", Value: fmt.Sprintf("%d", processedMaterialCount), Inline: true},
-			{Name: "Tokens Used", Value: fmt.Sprintf("%d", totalTokens), Inline: true},
-			{Name: "Time Taken", Value: fmt.Sprintf("%.2fs", duration.Seconds()), Inline: true},
-			{Name: "Created By", Value: fmt.Sprintf("%s (%s)", userName, userEmail), Inline: false},
-			{Name: "Quiz ID", Value: fmt.Sprintf("`%s`", createdQuiz.ID.String()), Inline: false},
-		},
-		Timestamp: time.Now().Format(time.RFC3339),
+	if err := h.Jobs.Enqueue(job.ID); err != nil {
+		// Don't leave the job queued forever, nobody will pick it up
+		if _, failErr := h.DB.Queries.FailGenerationJob(ctx, db.FailGenerationJobParams{
+			ID:    job.ID,
+			Error: pgtype.Text{String: fmt.Sprintf("Failed to queue generation job: %v", err), Valid: true},
+		}); failErr != nil {
+			log.Printf("ERROR: Failed to mark generation job %s as failed: %v", job.ID, failErr)
+		}
+		if releaseErr := h.releaseTokenReservation(ctx, job, gemini.TokenUsage{}); releaseErr != nil {
+			log.Printf("ERROR: Failed to release token reservation of generation job %s: %v", job.ID, releaseErr)
+		}
+		progress.Emit(gemini.ProgressEvent{
+			Stage:   gemini.StageFailed,
+			Message: "Failed to queue generation job",
+			Error:   err.Error(),
+		})
+		h.handleErrorAndNotify(c, userID, http.StatusServiceUnavailable, "Failed to queue generation job, please try again later", err)
+		return
 	}
-	h.sendDiscordNotification(quizEmbed)
+	queued = true
+	log.Printf("INFO: Queued generation job %s for user %s with %d files and %d videos", job.ID, userID, len(input.Files), len(input.Videos))
 
-	// 7. Return Response
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Quiz generated successfully!",
-		"quizId":  createdQuiz.ID.String(), // Return the new quiz ID as a string
+	// 10. Return Response; the client polls GET /api/jobs/:jobId for the result,
+	// or follows GET /api/jobs/:jobId/events for live progress
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Quiz generation started",
+		"jobId":   job.ID.String(),
+		"status":  job.Status,
+		"cached":  input.CacheID != nil, // Built from an earlier generation, no tokens are used
 	})
 }
 
 // HandleGetQuiz retrieves a specific quiz by its ID, including its questions, answers, and creator info.
+// Private quizzes are only shown to their creator. Everyone else gets the taker view without the
+// answer key; the creator can preview it with ?view=taker.
 func (h *Handler) HandleGetQuiz(c *gin.Context) {
 	ctx := c.Request.Context()
 	quizIDStr := c.Param("quizId")
 
-	// 1. Parse UUID
+	// 1. Get User ID from context and parse the quiz UUID
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, fmt.Sprintf("User ID not found in context for getting quiz %s", quizIDStr), errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, fmt.Sprintf("User ID in context is not UUID for getting quiz %s", quizIDStr), errors.New("invalid user ID type in context"))
+		return
+	}
 	quizID, err := uuid.Parse(quizIDStr)
 	if err != nil {
-		// Use handleErrorAndNotify (userID is not available here, pass Nil)
-		h.handleErrorAndNotify(c, uuid.Nil, http.StatusBadRequest, fmt.Sprintf("Invalid Quiz ID format '%s'", quizIDStr), err)
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid Quiz ID format '%s'", quizIDStr), err)
 		return
 	}
 	log.Printf("INFO: Handling request for quiz ID: %s", quizID)
@@ -595,67 +612,40 @@ func (h *Handler) HandleGetQuiz(c *gin.Context) {
 	dbQuizData, err := h.DB.Queries.GetQuizByID(ctx, quizID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			// Use handleErrorAndNotify (userID is not available here, pass Nil)
-			h.handleErrorAndNotify(c, uuid.Nil, http.StatusNotFound, fmt.Sprintf("Quiz not found: %s", quizID), err)
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Quiz not found: %s", quizID), err)
 		} else {
-			// Use handleErrorAndNotify (userID is not available here, pass Nil)
-			h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, fmt.Sprintf("Failed to get quiz %s", quizID), err)
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get quiz %s", quizID), err)
 		}
 		return
 	}
-
-	// 3. Fetch Questions for the Quiz
-	dbQuestions, err := h.DB.Queries.ListQuestionsByQuizID(ctx, quizID)
-	if err != nil && !errors.Is(err, sql.ErrNoRows) { // It's okay if a quiz has no questions yet
-		// Use handleErrorAndNotify (userID is not available here, pass Nil)
-		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, fmt.Sprintf("Failed to get questions for quiz %s", quizID), err)
+	if !canViewQuiz(dbQuizData.CreatorID, dbQuizData.Visibility, userID, false) {
+		h.handleErrorAndNotify(c, userID, http.StatusForbidden, fmt.Sprintf("User %s attempted to view private quiz %s", userID, quizID), errors.New("this quiz is private"))
 		return
 	}
-	log.Printf("INFO: Found %d questions for quiz %s", len(dbQuestions), quizID)
-
-	// 4. Fetch Answers for each Question and build response questions
-	responseQuestions := make([]ResponseQuestion, 0, len(dbQuestions))
-	for _, dbQ := range dbQuestions {
-		dbAnswers, err := h.DB.Queries.ListAnswersByQuestionID(ctx, dbQ.ID)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			log.Printf("WARN: Failed to get answers for question %s (quiz %s): %v", dbQ.ID, quizID, err)
-			// Continue processing other questions, this one will have no options
-		}
-
-		// Map db.Answer to ResponseOption
-		responseOptions := make([]ResponseOption, 0, len(dbAnswers))
-		for _, dbA := range dbAnswers {
-			// Handle nullable Explanation
-			var explanation *string
-			if dbA.Explanation.Valid {
-				explanationStr := dbA.Explanation.String // Assign to temp variable
-				explanation = &explanationStr
-			}
-			responseOptions = append(responseOptions, ResponseOption{
-				ID:          dbA.ID,
-				Text:        dbA.Answer, // Use 'Answer' field from db.Answer
-				IsCorrect:   dbA.IsCorrect,
-				Explanation: explanation, // Use the *string variable
-			})
-		}
+	view := quizViewOwner
+	if !isQuizCreator(dbQuizData.CreatorID, userID) || c.Query("view") == quizViewTaker {
+		view = quizViewTaker
+	}
 
-		// Handle nullable TopicTitle
-		var topicTitle *string
-		if dbQ.TopicTitle.Valid {
-			topicTitleStr := dbQ.TopicTitle.String // Assign to temp variable
-			topicTitle = &topicTitleStr
+	// 3. Fetch Questions with their answers and sources
+	responseQuestions, err := h.quizQuestions(ctx, quizID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get questions for quiz %s", quizID), err)
+		return
+	}
+	if view == quizViewTaker {
+		for i, q := range responseQuestions {
+			responseQuestions[i] = q.withoutAnswerKey()
 		}
-
-		// Map db.Question to ResponseQuestion
-		responseQuestions = append(responseQuestions, ResponseQuestion{
-			ID:         dbQ.ID,
-			Text:       dbQ.Question, // Use 'Question' field from db.Question
-			TopicTitle: topicTitle,   // Use the *string variable
-			Options:    responseOptions,
-		})
 	}
 
-	// 5. Structure the final response using ResponseQuizDetail
+	log.Printf("INFO: Successfully prepared detailed %s view of quiz %s", view, quizID)
+	// 4. Return JSON response
+	c.JSON(http.StatusOK, newResponseQuizDetail(dbQuizData, responseQuestions, view))
+}
+
+// newResponseQuizDetail structures a quiz and its questions as ResponseQuizDetail
+func newResponseQuizDetail(dbQuizData db.GetQuizByIDRow, responseQuestions []ResponseQuestion, view string) ResponseQuizDetail {
 	// Handle nullable Description, CreatorName, CreatorPicture
 	var description *string
 	if dbQuizData.Description.Valid {
@@ -674,7 +664,7 @@ func (h *Handler) HandleGetQuiz(c *gin.Context) {
 	}
 
 	response := ResponseQuizDetail{
-		ID:             dbQuizData.ID,
+		ID:             &dbQuizData.ID,
 		Title:          dbQuizData.Title,
 		Description:    description,
 		Visibility:     dbQuizData.Visibility,
@@ -683,11 +673,73 @@ func (h *Handler) HandleGetQuiz(c *gin.Context) {
 		CreatorName:    creatorName,
 		CreatorPicture: creatorPicture,
 		Questions:      responseQuestions, // Assign the processed questions
+		View:           view,
 	}
+	if len(dbQuizData.GenerationOptions) > 0 {
+		var options gemini.GenerationOptions
+		if err := json.Unmarshal(dbQuizData.GenerationOptions, &options); err != nil {
+			log.Printf("WARN: Failed to decode generation options of quiz %s: %v", dbQuizData.ID, err)
+		} else {
+			response.GenerationOptions = &options
+		}
+	}
+	return response
+}
 
-	log.Printf("INFO: Successfully prepared detailed response for quiz %s", quizID)
-	// 6. Return JSON response
-	c.JSON(http.StatusOK, response)
+// quizQuestions returns the questions of a quiz in order, with their answers and sources
+func (h *Handler) quizQuestions(ctx context.Context, quizID uuid.UUID) ([]ResponseQuestion, error) {
+	dbQuestions, err := h.DB.Queries.ListQuestionsByQuizID(ctx, quizID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) { // It's okay if a quiz has no questions yet
+		return nil, err
+	}
+	log.Printf("INFO: Found %d questions for quiz %s", len(dbQuestions), quizID)
+
+	// Sources of the questions, keyed by question ID
+	dbSources, err := h.DB.Queries.ListQuestionSourcesByQuizID(ctx, quizID)
+	if err != nil {
+		log.Printf("WARN: Failed to get question sources for quiz %s: %v", quizID, err)
+		// Continue, the questions are returned without sources
+	}
+	sources := make(map[uuid.UUID]*ResponseSource, len(dbSources))
+	for _, src := range dbSources {
+		sources[src.QuestionID] = newResponseSource(src)
+	}
+
+	// Fetch Answers for each Question and build response questions
+	responseQuestions := make([]ResponseQuestion, 0, len(dbQuestions))
+	for _, dbQ := range dbQuestions {
+		dbAnswers, err := h.DB.Queries.ListAnswersByQuestionID(ctx, dbQ.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("WARN: Failed to get answers for question %s (quiz %s): %v", dbQ.ID, quizID, err)
+			// Continue processing other questions, this one will have no options
+		}
+
+		// Map db.Answer to ResponseOption
+		responseOptions := make([]ResponseOption, 0, len(dbAnswers))
+		for _, dbA := range dbAnswers {
+			responseOptions = append(responseOptions, newResponseOption(dbA))
+		}
+
+		// Handle nullable TopicTitle
+		var topicTitle *string
+		if dbQ.TopicTitle.Valid {
+			topicTitleStr := dbQ.TopicTitle.String // Assign to temp variable
+			topicTitle = &topicTitleStr
+		}
+
+		// Map db.Question to ResponseQuestion
+		responseQuestion := ResponseQuestion{
+			ID:         dbQ.ID,
+			Text:       dbQ.Question, // Use 'Question' field from db.Question
+			Type:       dbQ.QuestionType,
+			TopicTitle: topicTitle, // Use the *string variable
+			Options:    responseOptions,
+			Source:     sources[dbQ.ID],
+			Position:   dbQ.Position,
+		}
+		responseQuestions = append(responseQuestions, responseQuestion)
+	}
+	return responseQuestions, nil
 }
 
 // HandleListUserQuizzes retrieves all quizzes created by the currently authenticated user.
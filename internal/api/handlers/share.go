@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"quizbuilderai/internal/db"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// --- Share Links ---
+// A share link makes a quiz reachable through /api/shared/:token, without knowing its ID. Links can
+// expire, be limited to a number of attempts started through them, and be revoked by the owner.
+// Only unlisted and public quizzes can be shared. Creating a link doesn't change the visibility, the owner
+// makes a private quiz unlisted first. The shared quiz leaves out its ID, so the by-ID routes, which
+// don't accept unlisted quizzes, can't be used to get around the limits of the link.
+
+// shareTokenBytes is the number of random bytes in a share link token
+const shareTokenBytes = 24
+
+// CreateShareLinkRequest is the body for creating a share link, both fields are optional
+type CreateShareLinkRequest struct {
+	ExpiresAt   *time.Time `json:"expires_at"`
+	MaxAttempts *int32     `json:"max_attempts"`
+}
+
+// ResponseShareLink is a share link as returned to the owner of the quiz
+type ResponseShareLink struct {
+	ID           uuid.UUID  `json:"id"`
+	Token        string     `json:"token"`
+	Path         string     `json:"path"` // Where the shared quiz can be reached
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxAttempts  *int32     `json:"max_attempts,omitempty"`
+	AttemptCount int32      `json:"attempt_count"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	Active       bool       `json:"active"` // Neither revoked, expired nor used up
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// newShareToken returns a random URL safe token
+func newShareToken() (string, error) {
+	tokenBytes := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// shareLinkInactive returns why the link can't be used anymore, nil if it can
+func shareLinkInactive(link db.QuizShareLink) error {
+	switch {
+	case link.RevokedAt.Valid:
+		return errors.New("this share link was revoked")
+	case link.ExpiresAt.Valid && !link.ExpiresAt.Time.After(time.Now()):
+		return errors.New("this share link has expired")
+	case link.MaxAttempts.Valid && link.AttemptCount >= link.MaxAttempts.Int32:
+		return errors.New("this share link has no attempts left")
+	}
+	return nil
+}
+
+func newResponseShareLink(link db.QuizShareLink) ResponseShareLink {
+	response := ResponseShareLink{
+		ID:           link.ID,
+		Token:        link.Token,
+		Path:         "/api/shared/" + link.Token,
+		AttemptCount: link.AttemptCount,
+		Active:       shareLinkInactive(link) == nil,
+		CreatedAt:    link.CreatedAt,
+	}
+	if link.ExpiresAt.Valid {
+		response.ExpiresAt = &link.ExpiresAt.Time
+	}
+	if link.MaxAttempts.Valid {
+		response.MaxAttempts = &link.MaxAttempts.Int32
+	}
+	if link.RevokedAt.Valid {
+		response.RevokedAt = &link.RevokedAt.Time
+	}
+	return response
+}
+
+// logShareUse logs a use of the share link as quiz_share activity of the user
+func (h *Handler) logShareUse(c *gin.Context, userID uuid.UUID, link db.QuizShareLink, details map[string]interface{}) {
+	details["link_id"] = link.ID.String()
+	h.logActivity(c.Request.Context(), userID, db.ActivityActionQuizShare,
+		db.NullActivityTargetType{ActivityTargetType: db.ActivityTargetTypeQuiz, Valid: true},
+		pgtype.UUID{Bytes: link.QuizID, Valid: true},
+		details)
+}
+
+// HandleCreateShareLink creates a share link for a quiz the user owns
+func (h *Handler) HandleCreateShareLink(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get the quiz, which the user must own
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+	if dbQuiz.Visibility == db.QuizVisibilityPrivate {
+		h.handleErrorAndNotify(c, userID, http.StatusConflict, fmt.Sprintf("User %s attempted to share private quiz %s", userID, dbQuiz.ID), errors.New("make the quiz unlisted or public to share it"))
+		return
+	}
+
+	// 2. Parse and validate the optional limits
+	var req CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid request body for sharing quiz %s", dbQuiz.ID), err)
+		return
+	}
+	params := db.CreateQuizShareLinkParams{
+		QuizID:    dbQuiz.ID,
+		CreatorID: userID,
+	}
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid expiry for share link of quiz %s", dbQuiz.ID), errors.New("expires_at must be in the future"))
+			return
+		}
+		params.ExpiresAt = pgtype.Timestamptz{Time: *req.ExpiresAt, Valid: true}
+	}
+	if req.MaxAttempts != nil {
+		if *req.MaxAttempts < 1 {
+			h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid max attempts for share link of quiz %s", dbQuiz.ID), errors.New("max_attempts must be at least 1"))
+			return
+		}
+		params.MaxAttempts = pgtype.Int4{Int32: *req.MaxAttempts, Valid: true}
+	}
+	token, err := newShareToken()
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create share link for quiz %s", dbQuiz.ID), err)
+		return
+	}
+	params.Token = token
+
+	// 3. Create the link
+	link, err := h.DB.Queries.CreateQuizShareLink(ctx, params)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create share link for quiz %s", dbQuiz.ID), err)
+		return
+	}
+	log.Printf("INFO: User %s created share link %s for quiz %s", userID, link.ID, dbQuiz.ID)
+
+	// 4. Return the link and the visibility of the quiz
+	c.JSON(http.StatusCreated, gin.H{
+		"link":       newResponseShareLink(link),
+		"visibility": dbQuiz.Visibility,
+	})
+}
+
+// HandleListShareLinks lists all share links of a quiz the user owns, newest first
+func (h *Handler) HandleListShareLinks(c *gin.Context) {
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+
+	links, err := h.DB.Queries.ListQuizShareLinksByQuizID(c.Request.Context(), dbQuiz.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to list share links of quiz %s", dbQuiz.ID), err)
+		return
+	}
+	response := make([]ResponseShareLink, 0, len(links))
+	for _, link := range links {
+		response = append(response, newResponseShareLink(link))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleRevokeShareLink revokes a share link of a quiz the user owns. Revoking twice is fine.
+func (h *Handler) HandleRevokeShareLink(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, dbQuiz, ok := h.ownQuiz(c)
+	if !ok {
+		return
+	}
+	linkIDStr := c.Param("linkId")
+	linkID, err := uuid.Parse(linkIDStr)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, fmt.Sprintf("Invalid share link ID format '%s'", linkIDStr), err)
+		return
+	}
+
+	link, err := h.DB.Queries.GetQuizShareLinkByID(ctx, linkID)
+	if err == nil && link.QuizID != dbQuiz.ID {
+		err = sql.ErrNoRows // Links of other quizzes don't exist here
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, fmt.Sprintf("Share link %s not found for quiz %s", linkID, dbQuiz.ID), err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get share link %s", linkID), err)
+		}
+		return
+	}
+
+	if _, err := h.DB.Queries.RevokeQuizShareLink(ctx, link.ID); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to revoke share link %s", link.ID), err)
+		return
+	}
+	log.Printf("INFO: User %s revoked share link %s of quiz %s", userID, link.ID, dbQuiz.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// sharedLink returns the usable share link of the request and its quiz.
+// If it returns false, the error response was already sent.
+func (h *Handler) sharedLink(c *gin.Context, userID uuid.UUID) (db.QuizShareLink, db.GetQuizByIDRow, bool) {
+	ctx := c.Request.Context()
+
+	link, err := h.DB.Queries.GetQuizShareLinkByToken(ctx, c.Param("token"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// The token isn't logged, it grants access to the quiz
+			h.handleErrorAndNotify(c, userID, http.StatusNotFound, "Share link not found", err)
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to get share link", err)
+		}
+		return db.QuizShareLink{}, db.GetQuizByIDRow{}, false
+	}
+	if err := shareLinkInactive(link); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusGone, fmt.Sprintf("Share link %s can't be used anymore", link.ID), err)
+		return db.QuizShareLink{}, db.GetQuizByIDRow{}, false
+	}
+
+	dbQuiz, err := h.DB.Queries.GetQuizByID(ctx, link.QuizID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get quiz %s of share link %s", link.QuizID, link.ID), err)
+		return db.QuizShareLink{}, db.GetQuizByIDRow{}, false
+	}
+	// The owner may have made the quiz private again after sharing it
+	if !canViewQuiz(dbQuiz.CreatorID, dbQuiz.Visibility, userID, true) {
+		h.handleErrorAndNotify(c, userID, http.StatusForbidden, fmt.Sprintf("User %s used share link %s of private quiz %s", userID, link.ID, dbQuiz.ID), errors.New("this quiz is private"))
+		return db.QuizShareLink{}, db.GetQuizByIDRow{}, false
+	}
+	return link, dbQuiz, true
+}
+
+// contextUserID returns the user of the request.
+// If it returns false, the error response was already sent.
+func (h *Handler) contextUserID(c *gin.Context) (uuid.UUID, bool) {
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, "User ID not found in context for shared quiz", errors.New("user not authenticated"))
+		return uuid.Nil, false
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, "User ID in context is not UUID for shared quiz", errors.New("invalid user ID type in context"))
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// HandleGetSharedQuiz returns the quiz of a share link as a quiz taker sees it
+func (h *Handler) HandleGetSharedQuiz(c *gin.Context) {
+	userID, ok := h.contextUserID(c)
+	if !ok {
+		return
+	}
+	link, dbQuiz, ok := h.sharedLink(c, userID)
+	if !ok {
+		return
+	}
+
+	responseQuestions, err := h.quizQuestions(c.Request.Context(), dbQuiz.ID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get questions of shared quiz %s", dbQuiz.ID), err)
+		return
+	}
+	for i := range responseQuestions {
+		responseQuestions[i] = responseQuestions[i].withoutAnswerKey()
+	}
+
+	log.Printf("INFO: User %s viewed quiz %s through share link %s", userID, dbQuiz.ID, link.ID)
+	h.logShareUse(c, userID, link, map[string]interface{}{"use": "view"})
+	response := newResponseQuizDetail(dbQuiz, responseQuestions, quizViewTaker)
+	response.ID = nil // The link is the only way in, the ID would bypass its limits
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleCreateSharedQuizAttempt starts an attempt for the quiz of a share link, counting it
+// against the link's max attempts
+func (h *Handler) HandleCreateSharedQuizAttempt(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, ok := h.contextUserID(c)
+	if !ok {
+		return
+	}
+	link, dbQuiz, ok := h.sharedLink(c, userID)
+	if !ok {
+		return
+	}
+	mode, ok := h.attemptMode(c, userID, dbQuiz.ID)
+	if !ok {
+		return
+	}
+
+	// Claim an attempt of the link and create it together, so a failed attempt isn't counted
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to begin transaction for shared quiz attempt", err)
+		return
+	}
+	defer tx.Rollback(ctx) // Rollback if commit fails or on error
+	qtx := h.DB.Queries.WithTx(tx)
+
+	if _, err := qtx.ClaimQuizShareLinkAttempt(ctx, link.ID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Revoked, expired or used up since it was checked
+			h.handleErrorAndNotify(c, userID, http.StatusGone, fmt.Sprintf("Share link %s can't be used anymore", link.ID), errors.New("this share link can't be used anymore"))
+		} else {
+			h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to claim an attempt of share link %s", link.ID), err)
+		}
+		return
+	}
+	newAttempt, err := qtx.CreateQuizAttempt(ctx, db.CreateQuizAttemptParams{
+		QuizID: dbQuiz.ID,
+		UserID: userID,
+		Mode:   mode,
+	})
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to create quiz attempt for shared quiz %s", dbQuiz.ID), err)
+		return
+	}
+	if err := tx.Commit(ctx); err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, "Failed to commit transaction for shared quiz attempt", err)
+		return
+	}
+
+	log.Printf("INFO: Created quiz attempt %s for quiz %s, user %s through share link %s", newAttempt.ID, dbQuiz.ID, userID, link.ID)
+	h.recordAttemptStart(c, userID, dbQuiz.Title, newAttempt)
+	h.logShareUse(c, userID, link, map[string]interface{}{"use": "attempt", "attempt_id": newAttempt.ID.String()})
+
+	c.JSON(http.StatusCreated, gin.H{"attemptId": newAttempt.ID.String(), "mode": newAttempt.Mode})
+}
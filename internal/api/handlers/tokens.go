@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"quizbuilderai/internal/db"
+	"quizbuilderai/internal/gemini"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// errInsufficientTokens is returned when a user's balances cannot cover a job's estimated usage
+var errInsufficientTokens = errors.New("insufficient token balance")
+
+// reserveTokens takes a job's estimated usage from the user's balances and records it as a
+// pending reservation in the tokens ledger. It must run in the transaction that creates the job.
+// Returns errInsufficientTokens if either balance is too low.
+func reserveTokens(ctx context.Context, qtx *db.Queries, userID, jobID uuid.UUID, estimate gemini.TokenUsage) error {
+	_, err := qtx.ReserveUserTokens(ctx, db.ReserveUserTokensParams{
+		ID:                  userID,
+		InputTokensBalance:  estimate.PromptTokens,
+		OutputTokensBalance: estimate.CandidateTokens,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errInsufficientTokens
+		}
+		return fmt.Errorf("failed to reserve token balance: %w", err)
+	}
+
+	_, err = qtx.CreateTokenReservation(ctx, db.CreateTokenReservationParams{
+		UserID:          userID,
+		Amount:          -(estimate.PromptTokens + estimate.CandidateTokens), // Negative like usage
+		InputAmount:     -estimate.PromptTokens,
+		OutputAmount:    -estimate.CandidateTokens,
+		GenerationJobID: pgtype.UUID{Bytes: jobID, Valid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create token reservation: %w", err)
+	}
+
+	log.Printf("INFO: Reserved tokens for user %s (job %s): Input=%d, Output=%d", userID, jobID, estimate.PromptTokens, estimate.CandidateTokens)
+	return nil
+}
+
+// settleTokenReservation charges a finished job's actual usage. The reservation becomes the
+// usage record and the difference between reserved and used tokens is returned to (or taken
+// from) the user's balances. It must run in the transaction that saves the job's quiz.
+// Usage beyond the estimate is charged in full, as the tokens were spent, even if that takes a
+// balance below zero; ReserveUserTokens then refuses further generations until it is positive again.
+// Returns errGenerationJobLost if the reservation was released already, as the job was failed.
+func settleTokenReservation(ctx context.Context, qtx *db.Queries, job db.GenerationJob, usage gemini.TokenUsage) error {
+	reservation, err := qtx.GetPendingTokenReservationByJobID(ctx, pgtype.UUID{Bytes: job.ID, Valid: true})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("failed to get token reservation: %w", err)
+		}
+		// Jobs queued before reservations existed are charged directly. A job whose reservation
+		// was already released, e.g. because another instance failed it, must not be charged again.
+		count, err := qtx.CountTokensByGenerationJobID(ctx, pgtype.UUID{Bytes: job.ID, Valid: true})
+		if err != nil {
+			return fmt.Errorf("failed to look up token records of the job: %w", err)
+		}
+		if count > 0 {
+			return errGenerationJobLost
+		}
+		return chargeTokens(ctx, qtx, job.UserID, usage)
+	}
+
+	// Positive deltas take more tokens, negative ones give back what was over-reserved
+	user, err := qtx.UpdateUserTokenBalance(ctx, db.UpdateUserTokenBalanceParams{
+		ID:                  job.UserID,
+		InputTokensBalance:  usage.PromptTokens - job.ReservedInputTokens,
+		OutputTokensBalance: usage.CandidateTokens - job.ReservedOutputTokens,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update token balance: %w", err)
+	}
+	if user.InputTokensBalance < 0 || user.OutputTokensBalance < 0 {
+		log.Printf("WARN: Generation job %s used more tokens than reserved (Input=%d/%d, Output=%d/%d), user %s is at Input=%d, Output=%d and can't generate until topped up",
+			job.ID, usage.PromptTokens, job.ReservedInputTokens, usage.CandidateTokens, job.ReservedOutputTokens, job.UserID, user.InputTokensBalance, user.OutputTokensBalance)
+	}
+
+	_, err = qtx.SettleTokenReservation(ctx, db.SettleTokenReservationParams{
+		ID:           reservation.ID,
+		Amount:       -usage.TotalTokens, // Use negative value for usage
+		InputAmount:  -usage.PromptTokens,
+		OutputAmount: -usage.CandidateTokens,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to settle token reservation: %w", err)
+	}
+
+	log.Printf("INFO: Settled token reservation %s for user %s (job %s): Reserved=%d, Used=%d", reservation.ID, job.UserID, job.ID, -reservation.Amount, usage.TotalTokens)
+	return nil
+}
+
+// chargeTokens records token usage and takes it from the user's balances
+func chargeTokens(ctx context.Context, qtx *db.Queries, userID uuid.UUID, usage gemini.TokenUsage) error {
+	if usage.TotalTokens <= 0 { // Only record if tokens were used
+		return nil
+	}
+
+	// Create token usage record (negative amount for consumption)
+	_, err := qtx.CreateTokenTransaction(ctx, db.CreateTokenTransactionParams{
+		UserID:       userID,
+		Amount:       -usage.TotalTokens, // Use negative value for usage
+		InputAmount:  -usage.PromptTokens,
+		OutputAmount: -usage.CandidateTokens,
+		// Type is automatically set to 'usage' by the query
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create token transaction record: %w", err)
+	}
+
+	// Update user's token balance
+	_, err = qtx.UpdateUserTokenBalance(ctx, db.UpdateUserTokenBalanceParams{
+		ID:                  userID,
+		InputTokensBalance:  usage.PromptTokens,    // Amount to decrement input balance by
+		OutputTokensBalance: usage.CandidateTokens, // Amount to decrement output balance by
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update token balance: %w", err)
+	}
+
+	log.Printf("INFO: Recorded token usage and updated balance for user %s: Prompt=%d, Candidates=%d, Total=%d", userID, usage.PromptTokens, usage.CandidateTokens, usage.TotalTokens)
+	return nil
+}
+
+// releaseTokenReservation gives a job that produced no quiz its reserved tokens back.
+// Tokens the job consumed anyway are recorded as usage together with a matching refund,
+// so the ledger shows what was spent while the user's balances end up unchanged.
+// It does nothing if the job's reservation was already settled or released, so it is safe to call more than once.
+func (h *Handler) releaseTokenReservation(ctx context.Context, job db.GenerationJob, consumed gemini.TokenUsage) error {
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin database transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+
+	qtx := h.DB.Queries.WithTx(tx)
+	jobID := pgtype.UUID{Bytes: job.ID, Valid: true}
+
+	reservation, err := qtx.GetPendingTokenReservationByJobID(ctx, jobID)
+	switch {
+	case err == nil:
+		if consumed.TotalTokens > 0 {
+			// The reservation becomes the usage record, the refund below cancels it out
+			_, err = qtx.SettleTokenReservation(ctx, db.SettleTokenReservationParams{
+				ID:           reservation.ID,
+				Amount:       -consumed.TotalTokens,
+				InputAmount:  -consumed.PromptTokens,
+				OutputAmount: -consumed.CandidateTokens,
+			})
+		} else {
+			_, err = qtx.ReleaseTokenReservation(ctx, reservation.ID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to release token reservation: %w", err)
+		}
+
+		// Negative amounts add the reserved tokens back
+		_, err = qtx.UpdateUserTokenBalance(ctx, db.UpdateUserTokenBalanceParams{
+			ID:                  job.UserID,
+			InputTokensBalance:  -job.ReservedInputTokens,
+			OutputTokensBalance: -job.ReservedOutputTokens,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update token balance: %w", err)
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("failed to get token reservation: %w", err)
+	case job.ReservedInputTokens != 0 || job.ReservedOutputTokens != 0:
+		// The reservation was already settled or released
+		return nil
+	case consumed.TotalTokens > 0:
+		// Jobs queued before reservations existed were never charged, only the ledger needs the usage
+		_, err = qtx.CreateTokenTransaction(ctx, db.CreateTokenTransactionParams{
+			UserID:       job.UserID,
+			Amount:       -consumed.TotalTokens, // Use negative value for usage
+			InputAmount:  -consumed.PromptTokens,
+			OutputAmount: -consumed.CandidateTokens,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create token transaction record: %w", err)
+		}
+	default:
+		return nil
+	}
+
+	if consumed.TotalTokens > 0 {
+		_, err = qtx.CreateTokenRefund(ctx, db.CreateTokenRefundParams{
+			UserID:          job.UserID,
+			Amount:          consumed.TotalTokens,
+			InputAmount:     consumed.PromptTokens,
+			OutputAmount:    consumed.CandidateTokens,
+			GenerationJobID: jobID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create token refund record: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit token release: %w", err)
+	}
+
+	log.Printf("INFO: Released tokens of generation job %s for user %s: Reserved Input=%d, Output=%d, Refunded=%d", job.ID, job.UserID, job.ReservedInputTokens, job.ReservedOutputTokens, consumed.TotalTokens)
+	return nil
+}
+
+// respondInsufficientTokens aborts a request with 402 Payment Required, telling the user
+// how many tokens the request needs and how many they have
+func (h *Handler) respondInsufficientTokens(c *gin.Context, userID uuid.UUID, estimate gemini.TokenUsage) {
+	response := gin.H{
+		"error":                  "Not enough tokens to generate this quiz",
+		"required_input_tokens":  estimate.PromptTokens,
+		"required_output_tokens": estimate.CandidateTokens,
+	}
+	user, err := h.DB.Queries.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("WARN: Failed to get token balances of user %s: %v", userID, err)
+	} else {
+		response["input_tokens_balance"] = user.InputTokensBalance
+		response["output_tokens_balance"] = user.OutputTokensBalance
+	}
+
+	log.Printf("INFO: User %s has insufficient tokens for generation: Required Input=%d, Output=%d", userID, estimate.PromptTokens, estimate.CandidateTokens)
+	c.AbortWithStatusJSON(http.StatusPaymentRequired, response)
+}
+
+// createUserWithSignupGift creates a user and records their starting balances as a gift in the
+// tokens ledger, so the balances can always be recomputed from the ledger
+func (h *Handler) createUserWithSignupGift(ctx context.Context, params db.CreateUserParams) (db.User, error) {
+	var user db.User
+	tx, err := h.DB.Pool.Begin(ctx)
+	if err != nil {
+		return user, fmt.Errorf("failed to begin database transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) // Rollback is ignored if Commit() succeeds
+
+	qtx := h.DB.Queries.WithTx(tx)
+	user, err = qtx.CreateUser(ctx, params)
+	if err != nil {
+		return user, err
+	}
+
+	// The starting balances come from the column defaults
+	_, err = qtx.CreateTokenGrant(ctx, db.CreateTokenGrantParams{
+		UserID:       user.ID,
+		Amount:       user.InputTokensBalance + user.OutputTokensBalance,
+		InputAmount:  user.InputTokensBalance,
+		OutputAmount: user.OutputTokensBalance,
+		Type:         db.TokenTypeGift,
+	})
+	if err != nil {
+		return user, fmt.Errorf("failed to create signup gift: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return user, fmt.Errorf("failed to commit user creation: %w", err)
+	}
+	return user, nil
+}
+
+// ResponseTokenEntry is one row of the tokens ledger. Usage and reservations are negative.
+type ResponseTokenEntry struct {
+	ID              uuid.UUID      `json:"id"`
+	Type            db.TokenType   `json:"type"`
+	Status          db.TokenStatus `json:"status"` // Released reservations don't count towards the balances
+	Amount          int32          `json:"amount"`
+	InputAmount     int32          `json:"input_amount"`
+	OutputAmount    int32          `json:"output_amount"`
+	GenerationJobID *uuid.UUID     `json:"generation_job_id,omitempty"`
+	// Total of rows recorded before usage was split between the balances. Those rows have no
+	// input or output amount, the opening gift of the ledger accounts for them.
+	LegacyAmount *int32    `json:"legacy_amount,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ResponseTokenLedger holds the current balances and one page of the ledger
+type ResponseTokenLedger struct {
+	InputTokensBalance  int32                `json:"input_tokens_balance"`
+	OutputTokensBalance int32                `json:"output_tokens_balance"`
+	Entries             []ResponseTokenEntry `json:"entries"`
+	Total               int64                `json:"total"` // Number of ledger rows across all pages
+	Limit               int32                `json:"limit"`
+	Offset              int32                `json:"offset"`
+}
+
+// HandleGetUserTokens returns the current user's token balances and a page of their ledger, newest first
+func (h *Handler) HandleGetUserTokens(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	// 1. Get User ID from context (set by AuthRequired middleware)
+	userIDValue, exists := c.Get("userID")
+	if !exists {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusUnauthorized, "User ID not found in context for getting tokens", errors.New("user not authenticated"))
+		return
+	}
+	userID, ok := userIDValue.(uuid.UUID)
+	if !ok {
+		h.handleErrorAndNotify(c, uuid.Nil, http.StatusInternalServerError, "User ID in context is not UUID for getting tokens", errors.New("invalid user ID type in context"))
+		return
+	}
+
+	// 2. Read pagination parameters
+	limit, offset, err := parsePagination(c, 20, 100)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusBadRequest, "Invalid pagination parameters", err)
+		return
+	}
+
+	// 3. Fetch balances and the requested page
+	user, err := h.DB.Queries.GetUserByID(ctx, userID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to get user %s", userID), err)
+		return
+	}
+	tokens, err := h.DB.Queries.ListTokensByUserIDPaginated(ctx, db.ListTokensByUserIDPaginatedParams{
+		UserID: userID,
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to list tokens for user %s", userID), err)
+		return
+	}
+	total, err := h.DB.Queries.CountTokensByUserID(ctx, userID)
+	if err != nil {
+		h.handleErrorAndNotify(c, userID, http.StatusInternalServerError, fmt.Sprintf("Failed to count tokens for user %s", userID), err)
+		return
+	}
+
+	// 4. Build the response
+	response := ResponseTokenLedger{
+		InputTokensBalance:  user.InputTokensBalance,
+		OutputTokensBalance: user.OutputTokensBalance,
+		Entries:             make([]ResponseTokenEntry, 0, len(tokens)),
+		Total:               total,
+		Limit:               limit,
+		Offset:              offset,
+	}
+	for _, token := range tokens {
+		entry := ResponseTokenEntry{
+			ID:           token.ID,
+			Type:         token.Type,
+			Status:       token.Status,
+			Amount:       token.Amount,
+			InputAmount:  token.InputAmount,
+			OutputAmount: token.OutputAmount,
+			CreatedAt:    token.CreatedAt,
+		}
+		if token.GenerationJobID.Valid {
+			jobID := uuid.UUID(token.GenerationJobID.Bytes)
+			entry.GenerationJobID = &jobID
+		}
+		if token.LegacyAmount.Valid {
+			entry.LegacyAmount = &token.LegacyAmount.Int32
+		}
+		response.Entries = append(response.Entries, entry)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
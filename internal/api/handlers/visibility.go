@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"math/rand"
+
+	"quizbuilderai/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// --- Quiz Visibility ---
+// Public quizzes can be taken by everyone. Unlisted quizzes only by those who were given a share link:
+// the quiz ID alone isn't enough, so revoking or expiring the link takes the access away again.
+// Private quizzes can only be seen and taken by their creator.
+
+// Views of a quiz
+const (
+	quizViewOwner = "owner" // With the answer key, for the creator
+	quizViewTaker = "taker" // Without the answer key, for everyone taking the quiz
+)
+
+// isQuizCreator reports whether the user created the quiz
+func isQuizCreator(creatorID pgtype.UUID, userID uuid.UUID) bool {
+	return creatorID.Valid && creatorID.Bytes == userID
+}
+
+// canViewQuiz reports whether the user may see and attempt a quiz with the visibility. viaShareLink
+// tells whether the request came through a usable share link, which unlisted quizzes require.
+func canViewQuiz(creatorID pgtype.UUID, visibility db.QuizVisibility, userID uuid.UUID, viaShareLink bool) bool {
+	if isQuizCreator(creatorID, userID) {
+		return true
+	}
+	switch visibility {
+	case db.QuizVisibilityPublic:
+		return true
+	case db.QuizVisibilityUnlisted:
+		return viaShareLink
+	}
+	// Private quizzes, and visibilities this code doesn't know, stay with the creator
+	return false
+}
+
+// withoutAnswerKey returns the question as a quiz taker sees it before answering: the options without
+// correctness, explanations and the type-specific answer key. The source is removed too, its quote
+// usually gives the answer away.
+func (q ResponseQuestion) withoutAnswerKey() ResponseQuestion {
+	taker := q
+	taker.Source = nil
+	taker.Options = make([]ResponseOption, 0, len(q.Options))
+
+	switch q.Type {
+	case db.QuestionTypeShortAnswer, db.QuestionTypeNumeric:
+		// Their answer rows are the accepted answers themselves
+		return taker
+	case db.QuestionTypeMatching:
+		// The items to match with are listed separately, shuffled, so their order doesn't pair them up
+		for _, option := range q.Options {
+			if option.MatchText != nil {
+				taker.MatchOptions = append(taker.MatchOptions, *option.MatchText)
+			}
+		}
+		rand.Shuffle(len(taker.MatchOptions), func(i, j int) {
+			taker.MatchOptions[i], taker.MatchOptions[j] = taker.MatchOptions[j], taker.MatchOptions[i]
+		})
+	}
+	for _, option := range q.Options {
+		taker.Options = append(taker.Options, ResponseOption{ID: option.ID, Text: option.Text})
+	}
+	return taker
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"quizbuilderai/internal/db"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestCanViewQuiz(t *testing.T) {
+	creator := uuid.New()
+	other := uuid.New()
+	creatorID := pgtype.UUID{Bytes: creator, Valid: true}
+
+	tests := []struct {
+		name         string
+		creatorID    pgtype.UUID
+		visibility   db.QuizVisibility
+		userID       uuid.UUID
+		viaShareLink bool
+		want         bool
+	}{
+		{"creator, private", creatorID, db.QuizVisibilityPrivate, creator, false, true},
+		{"creator, unlisted", creatorID, db.QuizVisibilityUnlisted, creator, false, true},
+		{"creator, public", creatorID, db.QuizVisibilityPublic, creator, false, true},
+		{"other, public", creatorID, db.QuizVisibilityPublic, other, false, true},
+		{"other, public through link", creatorID, db.QuizVisibilityPublic, other, true, true},
+		{"other, unlisted by ID", creatorID, db.QuizVisibilityUnlisted, other, false, false},
+		{"other, unlisted through link", creatorID, db.QuizVisibilityUnlisted, other, true, true},
+		{"other, private", creatorID, db.QuizVisibilityPrivate, other, false, false},
+		{"other, private through link", creatorID, db.QuizVisibilityPrivate, other, true, false},
+		{"other, unknown visibility", creatorID, db.QuizVisibility("friends"), other, true, false},
+		{"no creator, private", pgtype.UUID{}, db.QuizVisibilityPrivate, uuid.UUID{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canViewQuiz(tt.creatorID, tt.visibility, tt.userID, tt.viaShareLink); got != tt.want {
+				t.Errorf("canViewQuiz = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithoutAnswerKey(t *testing.T) {
+	yes, no := true, false
+	explanation := "Because"
+	quote := "Plants turn light into chemical energy."
+	position := int32(1)
+	first, second := "Stomata", "Xylem"
+	value, tolerance := 9.81, 0.01
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+
+	tests := []struct {
+		name             string
+		typ              db.QuestionType
+		options          []ResponseOption
+		wantOptions      []ResponseOption
+		wantMatchOptions []string
+	}{
+		{
+			name: "multiple choice",
+			typ:  db.QuestionTypeMultipleChoice,
+			options: []ResponseOption{
+				{ID: ids[0], Text: "Chlorophyll", IsCorrect: &yes, Explanation: &explanation},
+				{ID: ids[1], Text: "Keratin", IsCorrect: &no, Explanation: &explanation},
+			},
+			wantOptions: []ResponseOption{{ID: ids[0], Text: "Chlorophyll"}, {ID: ids[1], Text: "Keratin"}},
+		},
+		{
+			name: "true/false",
+			typ:  db.QuestionTypeTrueFalse,
+			options: []ResponseOption{
+				{ID: ids[0], Text: "True", IsCorrect: &yes},
+				{ID: ids[1], Text: "False", IsCorrect: &no},
+			},
+			wantOptions: []ResponseOption{{ID: ids[0], Text: "True"}, {ID: ids[1], Text: "False"}},
+		},
+		{
+			name: "multi select",
+			typ:  db.QuestionTypeMultiSelect,
+			options: []ResponseOption{
+				{ID: ids[0], Text: "Oxygen", IsCorrect: &yes},
+				{ID: ids[1], Text: "Glucose", IsCorrect: &yes},
+			},
+			wantOptions: []ResponseOption{{ID: ids[0], Text: "Oxygen"}, {ID: ids[1], Text: "Glucose"}},
+		},
+		{
+			name:        "short answer",
+			typ:         db.QuestionTypeShortAnswer,
+			options:     []ResponseOption{{ID: ids[0], Text: "photosynthesis", IsCorrect: &yes}},
+			wantOptions: []ResponseOption{},
+		},
+		{
+			name:        "numeric",
+			typ:         db.QuestionTypeNumeric,
+			options:     []ResponseOption{{ID: ids[0], Text: "9.81", IsCorrect: &yes, NumericValue: &value, Tolerance: &tolerance}},
+			wantOptions: []ResponseOption{},
+		},
+		{
+			name: "ordering",
+			typ:  db.QuestionTypeOrdering,
+			options: []ResponseOption{
+				{ID: ids[0], Text: "Light reactions", CorrectPosition: &position},
+				{ID: ids[1], Text: "Calvin cycle", CorrectPosition: &position},
+			},
+			wantOptions: []ResponseOption{{ID: ids[0], Text: "Light reactions"}, {ID: ids[1], Text: "Calvin cycle"}},
+		},
+		{
+			name: "matching",
+			typ:  db.QuestionTypeMatching,
+			options: []ResponseOption{
+				{ID: ids[0], Text: "Gas exchange", MatchText: &first},
+				{ID: ids[1], Text: "Water transport", MatchText: &second},
+			},
+			wantOptions:      []ResponseOption{{ID: ids[0], Text: "Gas exchange"}, {ID: ids[1], Text: "Water transport"}},
+			wantMatchOptions: []string{first, second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			question := ResponseQuestion{
+				ID:      uuid.New(),
+				Text:    "Question",
+				Type:    tt.typ,
+				Options: tt.options,
+				Source:  &ResponseSource{Quote: &quote},
+			}
+			got := question.withoutAnswerKey()
+
+			if got.Source != nil {
+				t.Errorf("source = %+v, want none", got.Source)
+			}
+			if !reflect.DeepEqual(got.Options, tt.wantOptions) {
+				t.Errorf("options = %+v, want %+v", got.Options, tt.wantOptions)
+			}
+			matchOptions := append([]string(nil), got.MatchOptions...)
+			sort.Strings(matchOptions)
+			if !reflect.DeepEqual(matchOptions, tt.wantMatchOptions) {
+				t.Errorf("match options = %q, want %q", matchOptions, tt.wantMatchOptions)
+			}
+			// The owner's copy keeps its answer key
+			if question.Source == nil || !reflect.DeepEqual(question.Options, tt.options) {
+				t.Error("withoutAnswerKey changed the original question")
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"expvar"
+	"net/http"
+
 	"quizbuilderai/internal/api/handlers" // Import the new handlers package
 
 	"github.com/gin-gonic/gin"
@@ -26,8 +29,9 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler) { // Update hand
 		authorized.Use(AuthRequired())
 		{
 			// Routes that require authentication go here
-			authorized.GET("/user/profile", handler.HandleUserProfile) // Get current user's profile
-			authorized.POST("/logout", handler.HandleLogout)           // Log the user out
+			authorized.GET("/user/profile", handler.HandleUserProfile)  // Get current user's profile
+			authorized.GET("/user/tokens", handler.HandleGetUserTokens) // Get token balances and a page of the ledger
+			authorized.POST("/logout", handler.HandleLogout)            // Log the user out
 
 			// Add other protected application routes below
 			authorized.POST("/quizzes/generate", handler.HandleGenerateQuiz) // Generate quiz from uploaded content
@@ -35,6 +39,31 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler) { // Update hand
 			authorized.GET("/quizzes", handler.HandleListUserQuizzes)        // Get quizzes created by the current user
 			authorized.DELETE("/quizzes/:quizId", handler.HandleDeleteQuiz)  // Delete a specific quiz
 
+			// --- Quiz Editing Routes (creator only) ---
+			authorized.PATCH("/quizzes/:quizId", handler.HandleUpdateQuiz)                                           // Change title, description or visibility
+			authorized.POST("/quizzes/:quizId/questions", handler.HandleCreateQuestion)                              // Add a question
+			authorized.PATCH("/quizzes/:quizId/questions/:questionId", handler.HandleUpdateQuestion)                 // Change the text or topic of a question
+			authorized.PUT("/quizzes/:quizId/questions/order", handler.HandleReorderQuestions)                       // Put the questions in a new order
+			authorized.DELETE("/quizzes/:quizId/questions/:questionId", handler.HandleDeleteQuestion)                // Delete a question
+			authorized.PATCH("/quizzes/:quizId/questions/:questionId/answers/:answerId", handler.HandleUpdateAnswer) // Change the text, correctness or explanation of an answer
+
+			// --- Share Link Routes ---
+			authorized.POST("/quizzes/:quizId/share-links", handler.HandleCreateShareLink)           // Create a share link (creator only)
+			authorized.GET("/quizzes/:quizId/share-links", handler.HandleListShareLinks)             // List the share links of a quiz (creator only)
+			authorized.DELETE("/quizzes/:quizId/share-links/:linkId", handler.HandleRevokeShareLink) // Revoke a share link (creator only)
+			authorized.GET("/shared/:token", handler.HandleGetSharedQuiz)                            // Get a quiz through its share link
+			authorized.POST("/shared/:token/attempts", handler.HandleCreateSharedQuizAttempt)        // Start an attempt through a share link
+
+			// --- Material Routes ---
+			authorized.GET("/materials", handler.HandleListMaterials)                         // List the current user's materials
+			authorized.DELETE("/materials/:materialId", handler.HandleDeleteMaterial)         // Delete a material and its stored file
+			authorized.GET("/quizzes/:quizId/materials", handler.HandleListQuizMaterials)     // List the materials a quiz was generated from
+			authorized.GET("/materials/:materialId/download", handler.HandleDownloadMaterial) // Download the original of an uploaded material
+
+			// --- Generation Job Routes ---
+			authorized.GET("/jobs/:jobId", handler.HandleGetGenerationJob)           // Poll the status of a quiz generation job
+			authorized.GET("/jobs/:jobId/events", handler.HandleGenerationJobEvents) // Stream generation progress (Server-Sent Events)
+
 			// --- Quiz Attempt Routes ---
 			authorized.POST("/quizzes/:quizId/attempts", handler.HandleCreateQuizAttempt)    // Start a new attempt for a quiz
 			authorized.GET("/attempts/:attemptId", handler.HandleGetQuizAttempt)             // Get details of a specific attempt (including saved answers)
@@ -60,3 +89,12 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler) { // Update hand
 	//  protected.POST("/logout", handler.HandleLogout) // Example: /logout instead of /api/logout
 	// }
 }
+
+// MetricsHandler serves the expvar counters, e.g. how often generated JSON needed repair.
+// expvar also publishes the command line and memory statistics of the process, so this
+// must only be served on an internal listener, never on the public router.
+func MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
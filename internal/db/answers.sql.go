@@ -14,18 +14,23 @@ import (
 
 const createAnswer = `-- name: CreateAnswer :one
 INSERT INTO answers (
-    question_id, answer, is_correct, explanation
+    question_id, answer, is_correct, explanation, correct_position, match_text, numeric_value, tolerance, position
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
 )
-RETURNING id, question_id, answer, is_correct, explanation, created_at, updated_at
+RETURNING id, question_id, answer, is_correct, explanation, created_at, updated_at, correct_position, match_text, numeric_value, tolerance, position
 `
 
 type CreateAnswerParams struct {
-	QuestionID  uuid.UUID   `json:"question_id"`
-	Answer      string      `json:"answer"`
-	IsCorrect   bool        `json:"is_correct"`
-	Explanation pgtype.Text `json:"explanation"`
+	QuestionID      uuid.UUID     `json:"question_id"`
+	Answer          string        `json:"answer"`
+	IsCorrect       bool          `json:"is_correct"`
+	Explanation     pgtype.Text   `json:"explanation"`
+	CorrectPosition pgtype.Int4   `json:"correct_position"`
+	MatchText       pgtype.Text   `json:"match_text"`
+	NumericValue    pgtype.Float8 `json:"numeric_value"`
+	Tolerance       pgtype.Float8 `json:"tolerance"`
+	Position        int32         `json:"position"`
 }
 
 func (q *Queries) CreateAnswer(ctx context.Context, arg CreateAnswerParams) (Answer, error) {
@@ -34,6 +39,11 @@ func (q *Queries) CreateAnswer(ctx context.Context, arg CreateAnswerParams) (Ans
 		arg.Answer,
 		arg.IsCorrect,
 		arg.Explanation,
+		arg.CorrectPosition,
+		arg.MatchText,
+		arg.NumericValue,
+		arg.Tolerance,
+		arg.Position,
 	)
 	var i Answer
 	err := row.Scan(
@@ -44,6 +54,11 @@ func (q *Queries) CreateAnswer(ctx context.Context, arg CreateAnswerParams) (Ans
 		&i.Explanation,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CorrectPosition,
+		&i.MatchText,
+		&i.NumericValue,
+		&i.Tolerance,
+		&i.Position,
 	)
 	return i, err
 }
@@ -69,7 +84,7 @@ func (q *Queries) DeleteAnswersByQuestionID(ctx context.Context, questionID uuid
 }
 
 const getAnswerByID = `-- name: GetAnswerByID :one
-SELECT id, question_id, answer, is_correct, explanation, created_at, updated_at FROM answers
+SELECT id, question_id, answer, is_correct, explanation, created_at, updated_at, correct_position, match_text, numeric_value, tolerance, position FROM answers
 WHERE id = $1 LIMIT 1
 `
 
@@ -84,6 +99,11 @@ func (q *Queries) GetAnswerByID(ctx context.Context, id uuid.UUID) (Answer, erro
 		&i.Explanation,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CorrectPosition,
+		&i.MatchText,
+		&i.NumericValue,
+		&i.Tolerance,
+		&i.Position,
 	)
 	return i, err
 }
@@ -102,8 +122,8 @@ func (q *Queries) GetAnswerCorrectness(ctx context.Context, id uuid.UUID) (bool,
 }
 
 const listAnswers = `-- name: ListAnswers :many
-SELECT id, question_id, answer, is_correct, explanation, created_at, updated_at FROM answers
-ORDER BY created_at ASC
+SELECT id, question_id, answer, is_correct, explanation, created_at, updated_at, correct_position, match_text, numeric_value, tolerance, position FROM answers
+ORDER BY question_id, position ASC
 `
 
 func (q *Queries) ListAnswers(ctx context.Context) ([]Answer, error) {
@@ -123,6 +143,11 @@ func (q *Queries) ListAnswers(ctx context.Context) ([]Answer, error) {
 			&i.Explanation,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CorrectPosition,
+			&i.MatchText,
+			&i.NumericValue,
+			&i.Tolerance,
+			&i.Position,
 		); err != nil {
 			return nil, err
 		}
@@ -135,9 +160,9 @@ func (q *Queries) ListAnswers(ctx context.Context) ([]Answer, error) {
 }
 
 const listAnswersByQuestionID = `-- name: ListAnswersByQuestionID :many
-SELECT id, question_id, answer, is_correct, explanation, created_at, updated_at FROM answers
+SELECT id, question_id, answer, is_correct, explanation, created_at, updated_at, correct_position, match_text, numeric_value, tolerance, position FROM answers
 WHERE question_id = $1
-ORDER BY created_at ASC
+ORDER BY position ASC
 `
 
 func (q *Queries) ListAnswersByQuestionID(ctx context.Context, questionID uuid.UUID) ([]Answer, error) {
@@ -157,6 +182,11 @@ func (q *Queries) ListAnswersByQuestionID(ctx context.Context, questionID uuid.U
 			&i.Explanation,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.CorrectPosition,
+			&i.MatchText,
+			&i.NumericValue,
+			&i.Tolerance,
+			&i.Position,
 		); err != nil {
 			return nil, err
 		}
@@ -169,7 +199,6 @@ func (q *Queries) ListAnswersByQuestionID(ctx context.Context, questionID uuid.U
 }
 
 const updateAnswer = `-- name: UpdateAnswer :one
-
 UPDATE answers
 SET
     question_id = $2,
@@ -177,7 +206,7 @@ SET
     is_correct = $4,
     explanation = $5
 WHERE id = $1
-RETURNING id, question_id, answer, is_correct, explanation, created_at, updated_at
+RETURNING id, question_id, answer, is_correct, explanation, created_at, updated_at, correct_position, match_text, numeric_value, tolerance, position
 `
 
 type UpdateAnswerParams struct {
@@ -188,7 +217,6 @@ type UpdateAnswerParams struct {
 	Explanation pgtype.Text `json:"explanation"`
 }
 
-// Or some other defined order
 func (q *Queries) UpdateAnswer(ctx context.Context, arg UpdateAnswerParams) (Answer, error) {
 	row := q.db.QueryRow(ctx, updateAnswer,
 		arg.ID,
@@ -206,6 +234,57 @@ func (q *Queries) UpdateAnswer(ctx context.Context, arg UpdateAnswerParams) (Ans
 		&i.Explanation,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.CorrectPosition,
+		&i.MatchText,
+		&i.NumericValue,
+		&i.Tolerance,
+		&i.Position,
+	)
+	return i, err
+}
+
+const updateAnswerContent = `-- name: UpdateAnswerContent :one
+UPDATE answers
+SET
+    answer = $2,
+    is_correct = $3,
+    explanation = $4,
+    numeric_value = $5
+WHERE id = $1
+RETURNING id, question_id, answer, is_correct, explanation, created_at, updated_at, correct_position, match_text, numeric_value, tolerance, position
+`
+
+type UpdateAnswerContentParams struct {
+	ID           uuid.UUID     `json:"id"`
+	Answer       string        `json:"answer"`
+	IsCorrect    bool          `json:"is_correct"`
+	Explanation  pgtype.Text   `json:"explanation"`
+	NumericValue pgtype.Float8 `json:"numeric_value"`
+}
+
+// Edits the text, correctness and explanation of an answer; numeric answers keep their value in step with the text
+func (q *Queries) UpdateAnswerContent(ctx context.Context, arg UpdateAnswerContentParams) (Answer, error) {
+	row := q.db.QueryRow(ctx, updateAnswerContent,
+		arg.ID,
+		arg.Answer,
+		arg.IsCorrect,
+		arg.Explanation,
+		arg.NumericValue,
+	)
+	var i Answer
+	err := row.Scan(
+		&i.ID,
+		&i.QuestionID,
+		&i.Answer,
+		&i.IsCorrect,
+		&i.Explanation,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CorrectPosition,
+		&i.MatchText,
+		&i.NumericValue,
+		&i.Tolerance,
+		&i.Position,
 	)
 	return i, err
 }
@@ -13,13 +13,11 @@ import (
 )
 
 const calculateQuizAttemptScore = `-- name: CalculateQuizAttemptScore :one
-
 SELECT COUNT(*)
 FROM attempt_answers
 WHERE quiz_attempt_id = $1 AND is_correct = TRUE
 `
 
-// Or order by question order if needed, requires joining questions
 func (q *Queries) CalculateQuizAttemptScore(ctx context.Context, quizAttemptID uuid.UUID) (int64, error) {
 	row := q.db.QueryRow(ctx, calculateQuizAttemptScore, quizAttemptID)
 	var count int64
@@ -27,19 +25,31 @@ func (q *Queries) CalculateQuizAttemptScore(ctx context.Context, quizAttemptID u
 	return count, err
 }
 
-const getAttemptAnswer = `-- name: GetAttemptAnswer :one
-SELECT id, quiz_attempt_id, question_id, selected_answer_id, is_correct, created_at, updated_at
-FROM attempt_answers
-WHERE quiz_attempt_id = $1 AND question_id = $2
+const insertAttemptAnswer = `-- name: InsertAttemptAnswer :one
+INSERT INTO attempt_answers (quiz_attempt_id, question_id, selected_answer_id, is_correct, response)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (quiz_attempt_id, question_id) DO NOTHING
+RETURNING id, quiz_attempt_id, question_id, selected_answer_id, is_correct, created_at, updated_at, response
 `
 
-type GetAttemptAnswerParams struct {
-	QuizAttemptID uuid.UUID `json:"quiz_attempt_id"`
-	QuestionID    uuid.UUID `json:"question_id"`
+type InsertAttemptAnswerParams struct {
+	QuizAttemptID    uuid.UUID   `json:"quiz_attempt_id"`
+	QuestionID       uuid.UUID   `json:"question_id"`
+	SelectedAnswerID pgtype.UUID `json:"selected_answer_id"`
+	IsCorrect        pgtype.Bool `json:"is_correct"`
+	Response         []byte      `json:"response"`
 }
 
-func (q *Queries) GetAttemptAnswer(ctx context.Context, arg GetAttemptAnswerParams) (AttemptAnswer, error) {
-	row := q.db.QueryRow(ctx, getAttemptAnswer, arg.QuizAttemptID, arg.QuestionID)
+// Saves the first answer to a question and never replaces it, as practice attempts reveal the
+// answer key once a question is answered. Returns no row when the question was already answered.
+func (q *Queries) InsertAttemptAnswer(ctx context.Context, arg InsertAttemptAnswerParams) (AttemptAnswer, error) {
+	row := q.db.QueryRow(ctx, insertAttemptAnswer,
+		arg.QuizAttemptID,
+		arg.QuestionID,
+		arg.SelectedAnswerID,
+		arg.IsCorrect,
+		arg.Response,
+	)
 	var i AttemptAnswer
 	err := row.Scan(
 		&i.ID,
@@ -49,15 +59,17 @@ func (q *Queries) GetAttemptAnswer(ctx context.Context, arg GetAttemptAnswerPara
 		&i.IsCorrect,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Response,
 	)
 	return i, err
 }
 
 const listAttemptAnswersByAttempt = `-- name: ListAttemptAnswersByAttempt :many
-SELECT id, quiz_attempt_id, question_id, selected_answer_id, is_correct, created_at, updated_at
-FROM attempt_answers
-WHERE quiz_attempt_id = $1
-ORDER BY created_at
+SELECT aa.id, aa.quiz_attempt_id, aa.question_id, aa.selected_answer_id, aa.is_correct, aa.created_at, aa.updated_at, aa.response
+FROM attempt_answers aa
+JOIN questions q ON q.id = aa.question_id
+WHERE aa.quiz_attempt_id = $1
+ORDER BY q.position
 `
 
 func (q *Queries) ListAttemptAnswersByAttempt(ctx context.Context, quizAttemptID uuid.UUID) ([]AttemptAnswer, error) {
@@ -77,6 +89,7 @@ func (q *Queries) ListAttemptAnswersByAttempt(ctx context.Context, quizAttemptID
 			&i.IsCorrect,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Response,
 		); err != nil {
 			return nil, err
 		}
@@ -89,14 +102,15 @@ func (q *Queries) ListAttemptAnswersByAttempt(ctx context.Context, quizAttemptID
 }
 
 const upsertAttemptAnswer = `-- name: UpsertAttemptAnswer :one
-INSERT INTO attempt_answers (quiz_attempt_id, question_id, selected_answer_id, is_correct)
-VALUES ($1, $2, $3, $4)
+INSERT INTO attempt_answers (quiz_attempt_id, question_id, selected_answer_id, is_correct, response)
+VALUES ($1, $2, $3, $4, $5)
 ON CONFLICT (quiz_attempt_id, question_id)
 DO UPDATE SET
     selected_answer_id = EXCLUDED.selected_answer_id,
     is_correct = EXCLUDED.is_correct,
+    response = EXCLUDED.response,
     updated_at = NOW()
-RETURNING id, quiz_attempt_id, question_id, selected_answer_id, is_correct, created_at, updated_at
+RETURNING id, quiz_attempt_id, question_id, selected_answer_id, is_correct, created_at, updated_at, response
 `
 
 type UpsertAttemptAnswerParams struct {
@@ -104,6 +118,7 @@ type UpsertAttemptAnswerParams struct {
 	QuestionID       uuid.UUID   `json:"question_id"`
 	SelectedAnswerID pgtype.UUID `json:"selected_answer_id"`
 	IsCorrect        pgtype.Bool `json:"is_correct"`
+	Response         []byte      `json:"response"`
 }
 
 func (q *Queries) UpsertAttemptAnswer(ctx context.Context, arg UpsertAttemptAnswerParams) (AttemptAnswer, error) {
@@ -112,6 +127,7 @@ func (q *Queries) UpsertAttemptAnswer(ctx context.Context, arg UpsertAttemptAnsw
 		arg.QuestionID,
 		arg.SelectedAnswerID,
 		arg.IsCorrect,
+		arg.Response,
 	)
 	var i AttemptAnswer
 	err := row.Scan(
@@ -122,6 +138,7 @@ func (q *Queries) UpsertAttemptAnswer(ctx context.Context, arg UpsertAttemptAnsw
 		&i.IsCorrect,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Response,
 	)
 	return i, err
 }
@@ -7,28 +7,49 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countMaterialsByUserID = `-- name: CountMaterialsByUserID :one
+SELECT COUNT(*) FROM materials
+WHERE user_id = $1
+`
+
+func (q *Queries) CountMaterialsByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countMaterialsByUserID, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createMaterial = `-- name: CreateMaterial :one
 INSERT INTO materials (
-    user_id, title, url
+    user_id, title, url, metadata, content_hash
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5
 )
-RETURNING id, user_id, title, url, created_at, updated_at
+RETURNING id, user_id, title, url, created_at, updated_at, metadata, storage_key, size_bytes, content_hash
 `
 
 type CreateMaterialParams struct {
-	UserID uuid.UUID   `json:"user_id"`
-	Title  string      `json:"title"`
-	Url    pgtype.Text `json:"url"`
+	UserID      uuid.UUID   `json:"user_id"`
+	Title       string      `json:"title"`
+	Url         pgtype.Text `json:"url"`
+	Metadata    []byte      `json:"metadata"`
+	ContentHash pgtype.Text `json:"content_hash"`
 }
 
 func (q *Queries) CreateMaterial(ctx context.Context, arg CreateMaterialParams) (Material, error) {
-	row := q.db.QueryRow(ctx, createMaterial, arg.UserID, arg.Title, arg.Url)
+	row := q.db.QueryRow(ctx, createMaterial,
+		arg.UserID,
+		arg.Title,
+		arg.Url,
+		arg.Metadata,
+		arg.ContentHash,
+	)
 	var i Material
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +58,10 @@ func (q *Queries) CreateMaterial(ctx context.Context, arg CreateMaterialParams)
 		&i.Url,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Metadata,
+		&i.StorageKey,
+		&i.SizeBytes,
+		&i.ContentHash,
 	)
 	return i, err
 }
@@ -52,7 +77,7 @@ func (q *Queries) DeleteMaterial(ctx context.Context, id uuid.UUID) error {
 }
 
 const getMaterialByID = `-- name: GetMaterialByID :one
-SELECT id, user_id, title, url, created_at, updated_at FROM materials
+SELECT id, user_id, title, url, created_at, updated_at, metadata, storage_key, size_bytes, content_hash FROM materials
 WHERE id = $1 LIMIT 1
 `
 
@@ -66,12 +91,48 @@ func (q *Queries) GetMaterialByID(ctx context.Context, id uuid.UUID) (Material,
 		&i.Url,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Metadata,
+		&i.StorageKey,
+		&i.SizeBytes,
+		&i.ContentHash,
+	)
+	return i, err
+}
+
+const getMaterialByUserIDAndContentHash = `-- name: GetMaterialByUserIDAndContentHash :one
+-- The earliest material of a user with the given content, to reuse for repeat uploads
+SELECT id, user_id, title, url, created_at, updated_at, metadata, storage_key, size_bytes, content_hash FROM materials
+WHERE user_id = $1 AND content_hash = $2
+ORDER BY created_at, id
+LIMIT 1
+`
+
+type GetMaterialByUserIDAndContentHashParams struct {
+	UserID      uuid.UUID   `json:"user_id"`
+	ContentHash pgtype.Text `json:"content_hash"`
+}
+
+// The earliest material of a user with the given content, to reuse for repeat uploads
+func (q *Queries) GetMaterialByUserIDAndContentHash(ctx context.Context, arg GetMaterialByUserIDAndContentHashParams) (Material, error) {
+	row := q.db.QueryRow(ctx, getMaterialByUserIDAndContentHash, arg.UserID, arg.ContentHash)
+	var i Material
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Title,
+		&i.Url,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Metadata,
+		&i.StorageKey,
+		&i.SizeBytes,
+		&i.ContentHash,
 	)
 	return i, err
 }
 
 const listMaterials = `-- name: ListMaterials :many
-SELECT id, user_id, title, url, created_at, updated_at FROM materials
+SELECT id, user_id, title, url, created_at, updated_at, metadata, storage_key, size_bytes, content_hash FROM materials
 ORDER BY created_at DESC
 `
 
@@ -91,6 +152,50 @@ func (q *Queries) ListMaterials(ctx context.Context) ([]Material, error) {
 			&i.Url,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Metadata,
+			&i.StorageKey,
+			&i.SizeBytes,
+			&i.ContentHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMaterialsByQuizID = `-- name: ListMaterialsByQuizID :many
+-- Lists the materials a quiz was generated from, in the order they were linked
+SELECT m.id, m.user_id, m.title, m.url, m.created_at, m.updated_at, m.metadata, m.storage_key, m.size_bytes, m.content_hash FROM materials m
+JOIN quiz_materials qm ON qm.material_id = m.id
+WHERE qm.quiz_id = $1
+ORDER BY qm.created_at, m.title
+`
+
+// Lists the materials a quiz was generated from, in the order they were linked
+func (q *Queries) ListMaterialsByQuizID(ctx context.Context, quizID uuid.UUID) ([]Material, error) {
+	rows, err := q.db.Query(ctx, listMaterialsByQuizID, quizID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Material{}
+	for rows.Next() {
+		var i Material
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Title,
+			&i.Url,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Metadata,
+			&i.StorageKey,
+			&i.SizeBytes,
+			&i.ContentHash,
 		); err != nil {
 			return nil, err
 		}
@@ -103,7 +208,7 @@ func (q *Queries) ListMaterials(ctx context.Context) ([]Material, error) {
 }
 
 const listMaterialsByUserID = `-- name: ListMaterialsByUserID :many
-SELECT id, user_id, title, url, created_at, updated_at FROM materials
+SELECT id, user_id, title, url, created_at, updated_at, metadata, storage_key, size_bytes, content_hash FROM materials
 WHERE user_id = $1
 ORDER BY created_at DESC
 `
@@ -124,6 +229,74 @@ func (q *Queries) ListMaterialsByUserID(ctx context.Context, userID uuid.UUID) (
 			&i.Url,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Metadata,
+			&i.StorageKey,
+			&i.SizeBytes,
+			&i.ContentHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMaterialsByUserIDPaginated = `-- name: ListMaterialsByUserIDPaginated :many
+-- Lists the materials of a user with the number of quizzes each was used for
+SELECT m.id, m.user_id, m.title, m.url, m.created_at, m.updated_at, m.metadata, m.storage_key, m.size_bytes, m.content_hash, COUNT(qm.id) AS quiz_count
+FROM materials m
+LEFT JOIN quiz_materials qm ON qm.material_id = m.id
+WHERE m.user_id = $1
+GROUP BY m.id
+ORDER BY m.created_at DESC, m.id
+LIMIT $2 OFFSET $3
+`
+
+type ListMaterialsByUserIDPaginatedParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Limit  int32     `json:"limit"`
+	Offset int32     `json:"offset"`
+}
+
+type ListMaterialsByUserIDPaginatedRow struct {
+	ID          uuid.UUID   `json:"id"`
+	UserID      uuid.UUID   `json:"user_id"`
+	Title       string      `json:"title"`
+	Url         pgtype.Text `json:"url"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Metadata    []byte      `json:"metadata"`
+	StorageKey  pgtype.Text `json:"storage_key"`
+	SizeBytes   pgtype.Int8 `json:"size_bytes"`
+	ContentHash pgtype.Text `json:"content_hash"`
+	QuizCount   int64       `json:"quiz_count"`
+}
+
+// Lists the materials of a user with the number of quizzes each was used for
+func (q *Queries) ListMaterialsByUserIDPaginated(ctx context.Context, arg ListMaterialsByUserIDPaginatedParams) ([]ListMaterialsByUserIDPaginatedRow, error) {
+	rows, err := q.db.Query(ctx, listMaterialsByUserIDPaginated, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListMaterialsByUserIDPaginatedRow{}
+	for rows.Next() {
+		var i ListMaterialsByUserIDPaginatedRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Title,
+			&i.Url,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Metadata,
+			&i.StorageKey,
+			&i.SizeBytes,
+			&i.ContentHash,
+			&i.QuizCount,
 		); err != nil {
 			return nil, err
 		}
@@ -135,6 +308,25 @@ func (q *Queries) ListMaterialsByUserID(ctx context.Context, userID uuid.UUID) (
 	return items, nil
 }
 
+const setMaterialStorage = `-- name: SetMaterialStorage :exec
+-- Records where the original of an uploaded file was stored
+UPDATE materials
+SET storage_key = $2, size_bytes = $3
+WHERE id = $1
+`
+
+type SetMaterialStorageParams struct {
+	ID         uuid.UUID   `json:"id"`
+	StorageKey pgtype.Text `json:"storage_key"`
+	SizeBytes  pgtype.Int8 `json:"size_bytes"`
+}
+
+// Records where the original of an uploaded file was stored
+func (q *Queries) SetMaterialStorage(ctx context.Context, arg SetMaterialStorageParams) error {
+	_, err := q.db.Exec(ctx, setMaterialStorage, arg.ID, arg.StorageKey, arg.SizeBytes)
+	return err
+}
+
 const updateMaterial = `-- name: UpdateMaterial :one
 UPDATE materials
 SET
@@ -142,7 +334,7 @@ SET
     title = $3,
     url = $4
 WHERE id = $1
-RETURNING id, user_id, title, url, created_at, updated_at
+RETURNING id, user_id, title, url, created_at, updated_at, metadata, storage_key, size_bytes, content_hash
 `
 
 type UpdateMaterialParams struct {
@@ -167,6 +359,10 @@ func (q *Queries) UpdateMaterial(ctx context.Context, arg UpdateMaterialParams)
 		&i.Url,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Metadata,
+		&i.StorageKey,
+		&i.SizeBytes,
+		&i.ContentHash,
 	)
 	return i, err
 }
@@ -122,6 +122,139 @@ func (ns NullActivityTargetType) Value() (driver.Value, error) {
 	return string(ns.ActivityTargetType), nil
 }
 
+type AttemptMode string
+
+const (
+	AttemptModeExam     AttemptMode = "exam"
+	AttemptModePractice AttemptMode = "practice"
+)
+
+func (e *AttemptMode) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = AttemptMode(s)
+	case string:
+		*e = AttemptMode(s)
+	default:
+		return fmt.Errorf("unsupported scan type for AttemptMode: %T", src)
+	}
+	return nil
+}
+
+type NullAttemptMode struct {
+	AttemptMode AttemptMode `json:"attempt_mode"`
+	Valid       bool        `json:"valid"` // Valid is true if AttemptMode is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullAttemptMode) Scan(value interface{}) error {
+	if value == nil {
+		ns.AttemptMode, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.AttemptMode.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullAttemptMode) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.AttemptMode), nil
+}
+
+type GenerationJobStatus string
+
+const (
+	GenerationJobStatusQueued    GenerationJobStatus = "queued"
+	GenerationJobStatusRunning   GenerationJobStatus = "running"
+	GenerationJobStatusSucceeded GenerationJobStatus = "succeeded"
+	GenerationJobStatusFailed    GenerationJobStatus = "failed"
+)
+
+func (e *GenerationJobStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = GenerationJobStatus(s)
+	case string:
+		*e = GenerationJobStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for GenerationJobStatus: %T", src)
+	}
+	return nil
+}
+
+type NullGenerationJobStatus struct {
+	GenerationJobStatus GenerationJobStatus `json:"generation_job_status"`
+	Valid               bool                `json:"valid"` // Valid is true if GenerationJobStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullGenerationJobStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.GenerationJobStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.GenerationJobStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullGenerationJobStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.GenerationJobStatus), nil
+}
+
+type QuestionType string
+
+const (
+	QuestionTypeMultipleChoice QuestionType = "multiple_choice"
+	QuestionTypeTrueFalse      QuestionType = "true_false"
+	QuestionTypeMultiSelect    QuestionType = "multi_select"
+	QuestionTypeShortAnswer    QuestionType = "short_answer"
+	QuestionTypeNumeric        QuestionType = "numeric"
+	QuestionTypeOrdering       QuestionType = "ordering"
+	QuestionTypeMatching       QuestionType = "matching"
+)
+
+func (e *QuestionType) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = QuestionType(s)
+	case string:
+		*e = QuestionType(s)
+	default:
+		return fmt.Errorf("unsupported scan type for QuestionType: %T", src)
+	}
+	return nil
+}
+
+type NullQuestionType struct {
+	QuestionType QuestionType `json:"question_type"`
+	Valid        bool         `json:"valid"` // Valid is true if QuestionType is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullQuestionType) Scan(value interface{}) error {
+	if value == nil {
+		ns.QuestionType, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.QuestionType.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullQuestionType) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.QuestionType), nil
+}
+
 type QuizVisibility string
 
 const (
@@ -165,6 +298,49 @@ func (ns NullQuizVisibility) Value() (driver.Value, error) {
 	return string(ns.QuizVisibility), nil
 }
 
+type TokenStatus string
+
+const (
+	TokenStatusPending  TokenStatus = "pending"
+	TokenStatusSettled  TokenStatus = "settled"
+	TokenStatusReleased TokenStatus = "released"
+)
+
+func (e *TokenStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = TokenStatus(s)
+	case string:
+		*e = TokenStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for TokenStatus: %T", src)
+	}
+	return nil
+}
+
+type NullTokenStatus struct {
+	TokenStatus TokenStatus `json:"token_status"`
+	Valid       bool        `json:"valid"` // Valid is true if TokenStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullTokenStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.TokenStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.TokenStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullTokenStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.TokenStatus), nil
+}
+
 type TokenType string
 
 const (
@@ -174,6 +350,7 @@ const (
 	TokenTypeRefund            TokenType = "refund"
 	TokenTypeBonus             TokenType = "bonus"
 	TokenTypeSubscriptionGrant TokenType = "subscription_grant"
+	TokenTypeReservation       TokenType = "reservation"
 )
 
 func (e *TokenType) Scan(src interface{}) error {
@@ -223,13 +400,18 @@ type ActivityLog struct {
 }
 
 type Answer struct {
-	ID          uuid.UUID   `json:"id"`
-	QuestionID  uuid.UUID   `json:"question_id"`
-	Answer      string      `json:"answer"`
-	IsCorrect   bool        `json:"is_correct"`
-	Explanation pgtype.Text `json:"explanation"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
+	ID              uuid.UUID     `json:"id"`
+	QuestionID      uuid.UUID     `json:"question_id"`
+	Answer          string        `json:"answer"`
+	IsCorrect       bool          `json:"is_correct"`
+	Explanation     pgtype.Text   `json:"explanation"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	CorrectPosition pgtype.Int4   `json:"correct_position"`
+	MatchText       pgtype.Text   `json:"match_text"`
+	NumericValue    pgtype.Float8 `json:"numeric_value"`
+	Tolerance       pgtype.Float8 `json:"tolerance"`
+	Position        int32         `json:"position"`
 }
 
 type AttemptAnswer struct {
@@ -240,6 +422,7 @@ type AttemptAnswer struct {
 	IsCorrect        pgtype.Bool `json:"is_correct"`
 	CreatedAt        time.Time   `json:"created_at"`
 	UpdatedAt        time.Time   `json:"updated_at"`
+	Response         []byte      `json:"response"`
 }
 
 type Feedback struct {
@@ -251,22 +434,69 @@ type Feedback struct {
 	UpdatedAt time.Time   `json:"updated_at"`
 }
 
+type GenerationCache struct {
+	ID            uuid.UUID          `json:"id"`
+	ContentHash   string             `json:"content_hash"`
+	PromptVersion string             `json:"prompt_version"`
+	OptionsHash   string             `json:"options_hash"`
+	Generator     string             `json:"generator"`
+	Response      []byte             `json:"response"`
+	Hits          int32              `json:"hits"`
+	CreatedAt     time.Time          `json:"created_at"`
+	LastHitAt     pgtype.Timestamptz `json:"last_hit_at"`
+}
+
+type GenerationJob struct {
+	ID                   uuid.UUID           `json:"id"`
+	UserID               uuid.UUID           `json:"user_id"`
+	Status               GenerationJobStatus `json:"status"`
+	Input                []byte              `json:"input"`
+	QuizID               pgtype.UUID         `json:"quiz_id"`
+	Error                pgtype.Text         `json:"error"`
+	StartedAt            pgtype.Timestamptz  `json:"started_at"`
+	FinishedAt           pgtype.Timestamptz  `json:"finished_at"`
+	CreatedAt            time.Time           `json:"created_at"`
+	UpdatedAt            time.Time           `json:"updated_at"`
+	ReservedInputTokens  int32               `json:"reserved_input_tokens"`
+	ReservedOutputTokens int32               `json:"reserved_output_tokens"`
+	MergedQuestions      int32               `json:"merged_questions"`
+	HeartbeatAt          pgtype.Timestamptz  `json:"heartbeat_at"`
+	NodeID               pgtype.Text         `json:"node_id"`
+}
+
 type Material struct {
-	ID        uuid.UUID   `json:"id"`
-	UserID    uuid.UUID   `json:"user_id"`
-	Title     string      `json:"title"`
-	Url       pgtype.Text `json:"url"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+	ID          uuid.UUID   `json:"id"`
+	UserID      uuid.UUID   `json:"user_id"`
+	Title       string      `json:"title"`
+	Url         pgtype.Text `json:"url"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Metadata    []byte      `json:"metadata"`
+	StorageKey  pgtype.Text `json:"storage_key"`
+	SizeBytes   pgtype.Int8 `json:"size_bytes"`
+	ContentHash pgtype.Text `json:"content_hash"`
 }
 
 type Question struct {
-	ID        uuid.UUID `json:"id"`
-	QuizID    uuid.UUID `json:"quiz_id"`
-	TopicID   uuid.UUID `json:"topic_id"`
-	Question  string    `json:"question"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID           uuid.UUID    `json:"id"`
+	QuizID       uuid.UUID    `json:"quiz_id"`
+	TopicID      uuid.UUID    `json:"topic_id"`
+	Question     string       `json:"question"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	QuestionType QuestionType `json:"question_type"`
+	Position     int32        `json:"position"`
+}
+
+type QuestionSource struct {
+	ID               uuid.UUID   `json:"id"`
+	QuestionID       uuid.UUID   `json:"question_id"`
+	MaterialID       pgtype.UUID `json:"material_id"`
+	PageStart        pgtype.Int4 `json:"page_start"`
+	PageEnd          pgtype.Int4 `json:"page_end"`
+	TimestampSeconds pgtype.Int4 `json:"timestamp_seconds"`
+	Quote            pgtype.Text `json:"quote"`
+	CreatedAt        time.Time   `json:"created_at"`
 }
 
 type QuizAttempt struct {
@@ -278,6 +508,7 @@ type QuizAttempt struct {
 	EndTime   pgtype.Timestamptz `json:"end_time"`
 	CreatedAt time.Time          `json:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at"`
+	Mode      AttemptMode        `json:"mode"`
 }
 
 type QuizMaterial struct {
@@ -288,6 +519,19 @@ type QuizMaterial struct {
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+type QuizShareLink struct {
+	ID           uuid.UUID          `json:"id"`
+	QuizID       uuid.UUID          `json:"quiz_id"`
+	CreatorID    uuid.UUID          `json:"creator_id"`
+	Token        string             `json:"token"`
+	ExpiresAt    pgtype.Timestamptz `json:"expires_at"`
+	MaxAttempts  pgtype.Int4        `json:"max_attempts"`
+	AttemptCount int32              `json:"attempt_count"`
+	RevokedAt    pgtype.Timestamptz `json:"revoked_at"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+}
+
 type QuizTopic struct {
 	ID        uuid.UUID `json:"id"`
 	QuizID    uuid.UUID `json:"quiz_id"`
@@ -297,13 +541,14 @@ type QuizTopic struct {
 }
 
 type Quize struct {
-	ID          uuid.UUID      `json:"id"`
-	CreatorID   pgtype.UUID    `json:"creator_id"`
-	Title       string         `json:"title"`
-	Description pgtype.Text    `json:"description"`
-	Visibility  QuizVisibility `json:"visibility"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
+	ID                uuid.UUID      `json:"id"`
+	CreatorID         pgtype.UUID    `json:"creator_id"`
+	Title             string         `json:"title"`
+	Description       pgtype.Text    `json:"description"`
+	Visibility        QuizVisibility `json:"visibility"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	GenerationOptions []byte         `json:"generation_options"`
 }
 
 type Session struct {
@@ -313,12 +558,17 @@ type Session struct {
 }
 
 type Token struct {
-	ID        uuid.UUID `json:"id"`
-	UserID    uuid.UUID `json:"user_id"`
-	Amount    int32     `json:"amount"`
-	Type      TokenType `json:"type"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uuid.UUID   `json:"id"`
+	UserID          uuid.UUID   `json:"user_id"`
+	Amount          int32       `json:"amount"`
+	Type            TokenType   `json:"type"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+	Status          TokenStatus `json:"status"`
+	GenerationJobID pgtype.UUID `json:"generation_job_id"`
+	InputAmount     int32       `json:"input_amount"`
+	OutputAmount    int32       `json:"output_amount"`
+	LegacyAmount    pgtype.Int4 `json:"legacy_amount"`
 }
 
 type Topic struct {
@@ -341,3 +591,14 @@ type User struct {
 	CreatedAt           time.Time   `json:"created_at"`
 	UpdatedAt           time.Time   `json:"updated_at"`
 }
+
+type YoutubeTranscript struct {
+	VideoID         string      `json:"video_id"`
+	Language        string      `json:"language"`
+	Title           pgtype.Text `json:"title"`
+	Languages       []string    `json:"languages"`
+	Segments        []byte      `json:"segments"`
+	FetchedAt       time.Time   `json:"fetched_at"`
+	Channel         pgtype.Text `json:"channel"`
+	DurationSeconds pgtype.Int4 `json:"duration_seconds"`
+}
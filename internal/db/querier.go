@@ -6,22 +6,41 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
-	// Or order by question order if needed, requires joining questions
 	CalculateQuizAttemptScore(ctx context.Context, quizAttemptID uuid.UUID) (int64, error)
+	// Counts an attempt started through the link, only while the link is usable, so concurrent
+	// attempts can't go past max_attempts
+	ClaimQuizShareLinkAttempt(ctx context.Context, id uuid.UUID) (QuizShareLink, error)
+	// Takes over running jobs without a heartbeat for lease_seconds by renewing it,
+	// so only one instance fails each of them
+	ClaimStaleGenerationJobs(ctx context.Context, leaseSeconds int32) ([]GenerationJob, error)
+	// Only completes running jobs, a job another instance failed meanwhile stays failed
+	CompleteGenerationJob(ctx context.Context, arg CompleteGenerationJobParams) (GenerationJob, error)
+	CountMaterialsByUserID(ctx context.Context, userID uuid.UUID) (int64, error)
+	CountQuestionsByQuizID(ctx context.Context, quizID uuid.UUID) (int64, error)
+	// Jobs queued before reservations existed have no ledger rows
+	CountTokensByGenerationJobID(ctx context.Context, generationJobID pgtype.UUID) (int64, error)
+	CountTokensByUserID(ctx context.Context, userID uuid.UUID) (int64, error)
 	CreateActivityLog(ctx context.Context, arg CreateActivityLogParams) (ActivityLog, error)
 	CreateAnswer(ctx context.Context, arg CreateAnswerParams) (Answer, error)
 	CreateFeedback(ctx context.Context, arg CreateFeedbackParams) (Feedback, error)
+	CreateGenerationJob(ctx context.Context, arg CreateGenerationJobParams) (GenerationJob, error)
 	CreateMaterial(ctx context.Context, arg CreateMaterialParams) (Material, error)
 	CreateQuestion(ctx context.Context, arg CreateQuestionParams) (Question, error)
+	CreateQuestionSource(ctx context.Context, arg CreateQuestionSourceParams) (QuestionSource, error)
 	CreateQuiz(ctx context.Context, arg CreateQuizParams) (Quize, error)
 	CreateQuizAttempt(ctx context.Context, arg CreateQuizAttemptParams) (QuizAttempt, error)
+	CreateQuizShareLink(ctx context.Context, arg CreateQuizShareLinkParams) (QuizShareLink, error)
 	CreateToken(ctx context.Context, arg CreateTokenParams) (Token, error)
+	CreateTokenGrant(ctx context.Context, arg CreateTokenGrantParams) (Token, error)
+	CreateTokenRefund(ctx context.Context, arg CreateTokenRefundParams) (Token, error)
+	CreateTokenReservation(ctx context.Context, arg CreateTokenReservationParams) (Token, error)
 	CreateTokenTransaction(ctx context.Context, arg CreateTokenTransactionParams) (Token, error)
 	CreateTopic(ctx context.Context, arg CreateTopicParams) (Topic, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
@@ -29,6 +48,7 @@ type Querier interface {
 	DeleteActivityLog(ctx context.Context, id uuid.UUID) error
 	DeleteAnswer(ctx context.Context, id uuid.UUID) error
 	DeleteAnswersByQuestionID(ctx context.Context, questionID uuid.UUID) error
+	DeleteExpiredYoutubeTranscripts(ctx context.Context, fetchedAt time.Time) (int64, error)
 	DeleteFeedback(ctx context.Context, id uuid.UUID) error
 	DeleteMaterial(ctx context.Context, id uuid.UUID) error
 	DeleteQuestion(ctx context.Context, id uuid.UUID) error
@@ -36,12 +56,20 @@ type Querier interface {
 	DeleteToken(ctx context.Context, id uuid.UUID) error
 	DeleteTopic(ctx context.Context, id uuid.UUID) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
+	// Jobs that already finished keep their result
+	FailGenerationJob(ctx context.Context, arg FailGenerationJobParams) (GenerationJob, error)
 	GetActivityLogByID(ctx context.Context, id uuid.UUID) (ActivityLog, error)
 	GetAnswerByID(ctx context.Context, id uuid.UUID) (Answer, error)
 	GetAnswerCorrectness(ctx context.Context, id uuid.UUID) (bool, error)
-	GetAttemptAnswer(ctx context.Context, arg GetAttemptAnswerParams) (AttemptAnswer, error)
 	GetFeedback(ctx context.Context, id uuid.UUID) (Feedback, error)
+	GetGenerationCache(ctx context.Context, arg GetGenerationCacheParams) (GenerationCache, error)
+	GetGenerationCacheByID(ctx context.Context, id uuid.UUID) (GenerationCache, error)
+	GetGenerationJob(ctx context.Context, id uuid.UUID) (GenerationJob, error)
 	GetMaterialByID(ctx context.Context, id uuid.UUID) (Material, error)
+	// The earliest material of a user with the given content, to reuse for repeat uploads
+	GetMaterialByUserIDAndContentHash(ctx context.Context, arg GetMaterialByUserIDAndContentHashParams) (Material, error)
+	// Locks the reservation so it is settled or released only once
+	GetPendingTokenReservationByJobID(ctx context.Context, generationJobID pgtype.UUID) (Token, error)
 	GetQuestionByID(ctx context.Context, id uuid.UUID) (Question, error)
 	GetQuizAttempt(ctx context.Context, id uuid.UUID) (QuizAttempt, error)
 	GetQuizAttemptWithDetails(ctx context.Context, id uuid.UUID) (GetQuizAttemptWithDetailsRow, error)
@@ -49,6 +77,8 @@ type Querier interface {
 	// Less common to fetch by its own ID, but included for completeness
 	GetQuizMaterialByID(ctx context.Context, id uuid.UUID) (QuizMaterial, error)
 	GetQuizMaterialByQuizAndMaterialID(ctx context.Context, arg GetQuizMaterialByQuizAndMaterialIDParams) (QuizMaterial, error)
+	GetQuizShareLinkByID(ctx context.Context, id uuid.UUID) (QuizShareLink, error)
+	GetQuizShareLinkByToken(ctx context.Context, token string) (QuizShareLink, error)
 	// Less common to fetch by its own ID, but included for completeness
 	GetQuizTopicByID(ctx context.Context, id uuid.UUID) (QuizTopic, error)
 	GetQuizTopicByQuizAndTopicID(ctx context.Context, arg GetQuizTopicByQuizAndTopicIDParams) (QuizTopic, error)
@@ -58,6 +88,15 @@ type Querier interface {
 	GetUserByEmail(ctx context.Context, email string) (User, error)
 	GetUserByGoogleID(ctx context.Context, googleID pgtype.Text) (User, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (User, error)
+	// A transcript fetched after the given time
+	GetYoutubeTranscript(ctx context.Context, arg GetYoutubeTranscriptParams) (YoutubeTranscript, error)
+	// Caption languages of a video as of its latest transcript fetched after the given time
+	GetYoutubeTranscriptLanguages(ctx context.Context, arg GetYoutubeTranscriptLanguagesParams) ([]string, error)
+	// Affects no row once the job stopped running, e.g. because another instance failed it
+	HeartbeatGenerationJob(ctx context.Context, id uuid.UUID) (int64, error)
+	// Saves the first answer to a question and never replaces it, as practice attempts reveal the
+	// answer key once a question is answered. Returns no row when the question was already answered.
+	InsertAttemptAnswer(ctx context.Context, arg InsertAttemptAnswerParams) (AttemptAnswer, error)
 	LinkQuizMaterial(ctx context.Context, arg LinkQuizMaterialParams) (QuizMaterial, error)
 	LinkQuizTopic(ctx context.Context, arg LinkQuizTopicParams) (QuizTopic, error)
 	ListActivityLogs(ctx context.Context) ([]ActivityLog, error)
@@ -70,38 +109,72 @@ type Querier interface {
 	ListFeedbacks(ctx context.Context) ([]Feedback, error)
 	ListMaterialIDsByQuizID(ctx context.Context, quizID uuid.UUID) ([]uuid.UUID, error)
 	ListMaterials(ctx context.Context) ([]Material, error)
+	// Lists the materials a quiz was generated from, in the order they were linked
+	ListMaterialsByQuizID(ctx context.Context, quizID uuid.UUID) ([]Material, error)
 	ListMaterialsByUserID(ctx context.Context, userID uuid.UUID) ([]Material, error)
+	// Lists the materials of a user with the number of quizzes each was used for
+	ListMaterialsByUserIDPaginated(ctx context.Context, arg ListMaterialsByUserIDPaginatedParams) ([]ListMaterialsByUserIDPaginatedRow, error)
 	ListPublicQuizes(ctx context.Context) ([]Quize, error)
+	// Sources of all questions of a quiz with the title and URL of their material
+	ListQuestionSourcesByQuizID(ctx context.Context, quizID uuid.UUID) ([]ListQuestionSourcesByQuizIDRow, error)
 	ListQuestions(ctx context.Context) ([]Question, error)
 	ListQuestionsByQuizAndTopicID(ctx context.Context, arg ListQuestionsByQuizAndTopicIDParams) ([]Question, error)
-	// Or by position/order if added
 	ListQuestionsByQuizID(ctx context.Context, quizID uuid.UUID) ([]ListQuestionsByQuizIDRow, error)
 	ListQuestionsByTopicID(ctx context.Context, topicID uuid.UUID) ([]Question, error)
+	// The queued jobs whose inputs the node has, and those from before jobs had a node
+	ListQueuedGenerationJobsByNode(ctx context.Context, nodeID pgtype.Text) ([]GenerationJob, error)
 	ListQuizAttemptsByUser(ctx context.Context, userID uuid.UUID) ([]QuizAttempt, error)
 	ListQuizAttemptsWithDetailsByUser(ctx context.Context, userID uuid.UUID) ([]ListQuizAttemptsWithDetailsByUserRow, error)
 	ListQuizIDsByMaterialID(ctx context.Context, materialID uuid.UUID) ([]uuid.UUID, error)
 	ListQuizIDsByTopicID(ctx context.Context, topicID uuid.UUID) ([]uuid.UUID, error)
 	ListQuizMaterialsByQuizID(ctx context.Context, quizID uuid.UUID) ([]QuizMaterial, error)
+	ListQuizShareLinksByQuizID(ctx context.Context, quizID uuid.UUID) ([]QuizShareLink, error)
 	ListQuizTopicsByQuizID(ctx context.Context, quizID uuid.UUID) ([]QuizTopic, error)
 	ListQuizes(ctx context.Context) ([]Quize, error)
 	ListQuizesByCreatorID(ctx context.Context, creatorID pgtype.UUID) ([]Quize, error)
 	ListQuizesByVisibility(ctx context.Context, visibility QuizVisibility) ([]Quize, error)
 	ListQuizzesByCreator(ctx context.Context, creatorID pgtype.UUID) ([]ListQuizzesByCreatorRow, error)
+	// Users whose balances differ from the sum of their ledger; released reservations don't count
+	ListTokenBalanceDrift(ctx context.Context) ([]ListTokenBalanceDriftRow, error)
 	ListTokens(ctx context.Context) ([]Token, error)
 	ListTokensByUserID(ctx context.Context, userID uuid.UUID) ([]Token, error)
+	ListTokensByUserIDPaginated(ctx context.Context, arg ListTokensByUserIDPaginatedParams) ([]Token, error)
 	ListTopicIDsByQuizID(ctx context.Context, quizID uuid.UUID) ([]uuid.UUID, error)
 	ListTopics(ctx context.Context) ([]Topic, error)
 	ListTopicsByCreatorID(ctx context.Context, creatorID pgtype.UUID) ([]Topic, error)
 	ListUserAttemptsWithQuizName(ctx context.Context, userID uuid.UUID) ([]ListUserAttemptsWithQuizNameRow, error)
 	ListUsers(ctx context.Context) ([]User, error)
+	// Position after the last question of a quiz, for questions added to it
+	NextQuestionPosition(ctx context.Context, quizID uuid.UUID) (int32, error)
+	// Sets both balances to the sum of the user's ledger; released reservations don't count
+	ReconcileUserTokenBalance(ctx context.Context, userID uuid.UUID) (User, error)
+	RecordGenerationCacheHit(ctx context.Context, id uuid.UUID) error
+	ReleaseTokenReservation(ctx context.Context, id uuid.UUID) (Token, error)
+	// Only succeeds if both balances cover the reservation
+	// A negative balance, left by a job that used more than it reserved, fails every reservation,
+	// even an empty one, so the user can't generate until they get tokens again
+	ReserveUserTokens(ctx context.Context, arg ReserveUserTokensParams) (User, error)
+	RevokeQuizShareLink(ctx context.Context, id uuid.UUID) (QuizShareLink, error)
+	// Records where the original of an uploaded file was stored
+	SetMaterialStorage(ctx context.Context, arg SetMaterialStorageParams) error
+	// Puts the questions of a quiz in the given order in one statement, numbering them from 1.
+	// The unique positions are checked at the end of the statement, so positions can be swapped.
+	SetQuestionPositions(ctx context.Context, arg SetQuestionPositionsParams) (int64, error)
+	// The reservation becomes the usage record of the job
+	SettleTokenReservation(ctx context.Context, arg SettleTokenReservationParams) (Token, error)
+	// Only claims queued jobs, so a job is never run by two workers
+	StartGenerationJob(ctx context.Context, id uuid.UUID) (GenerationJob, error)
+	// Marks a quiz as updated when its questions or answers change
+	TouchQuiz(ctx context.Context, id uuid.UUID) error
 	UnlinkAllMaterialsFromQuiz(ctx context.Context, quizID uuid.UUID) error
 	UnlinkAllTopicsFromQuiz(ctx context.Context, quizID uuid.UUID) error
 	UnlinkMaterialFromAllQuizes(ctx context.Context, materialID uuid.UUID) error
 	UnlinkQuizMaterial(ctx context.Context, arg UnlinkQuizMaterialParams) error
 	UnlinkQuizTopic(ctx context.Context, arg UnlinkQuizTopicParams) error
 	UnlinkTopicFromAllQuizes(ctx context.Context, topicID uuid.UUID) error
-	// Or some other defined order
 	UpdateAnswer(ctx context.Context, arg UpdateAnswerParams) (Answer, error)
+	// Edits the text, correctness and explanation of an answer; numeric answers keep their value in step with the text
+	UpdateAnswerContent(ctx context.Context, arg UpdateAnswerContentParams) (Answer, error)
 	UpdateFeedback(ctx context.Context, arg UpdateFeedbackParams) (Feedback, error)
 	UpdateMaterial(ctx context.Context, arg UpdateMaterialParams) (Material, error)
 	UpdateQuestion(ctx context.Context, arg UpdateQuestionParams) (Question, error)
@@ -113,6 +186,8 @@ type Querier interface {
 	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
 	UpdateUserTokenBalance(ctx context.Context, arg UpdateUserTokenBalanceParams) (User, error)
 	UpsertAttemptAnswer(ctx context.Context, arg UpsertAttemptAnswerParams) (AttemptAnswer, error)
+	UpsertGenerationCache(ctx context.Context, arg UpsertGenerationCacheParams) error
+	UpsertYoutubeTranscript(ctx context.Context, arg UpsertYoutubeTranscriptParams) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -13,23 +13,43 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countQuestionsByQuizID = `-- name: CountQuestionsByQuizID :one
+SELECT COUNT(*) FROM questions
+WHERE quiz_id = $1
+`
+
+func (q *Queries) CountQuestionsByQuizID(ctx context.Context, quizID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countQuestionsByQuizID, quizID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createQuestion = `-- name: CreateQuestion :one
 INSERT INTO questions (
-    quiz_id, topic_id, question
+    quiz_id, topic_id, question, question_type, position
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5
 )
-RETURNING id, quiz_id, topic_id, question, created_at, updated_at
+RETURNING id, quiz_id, topic_id, question, created_at, updated_at, question_type, position
 `
 
 type CreateQuestionParams struct {
-	QuizID   uuid.UUID `json:"quiz_id"`
-	TopicID  uuid.UUID `json:"topic_id"`
-	Question string    `json:"question"`
+	QuizID       uuid.UUID    `json:"quiz_id"`
+	TopicID      uuid.UUID    `json:"topic_id"`
+	Question     string       `json:"question"`
+	QuestionType QuestionType `json:"question_type"`
+	Position     int32        `json:"position"`
 }
 
 func (q *Queries) CreateQuestion(ctx context.Context, arg CreateQuestionParams) (Question, error) {
-	row := q.db.QueryRow(ctx, createQuestion, arg.QuizID, arg.TopicID, arg.Question)
+	row := q.db.QueryRow(ctx, createQuestion,
+		arg.QuizID,
+		arg.TopicID,
+		arg.Question,
+		arg.QuestionType,
+		arg.Position,
+	)
 	var i Question
 	err := row.Scan(
 		&i.ID,
@@ -38,6 +58,8 @@ func (q *Queries) CreateQuestion(ctx context.Context, arg CreateQuestionParams)
 		&i.Question,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.QuestionType,
+		&i.Position,
 	)
 	return i, err
 }
@@ -53,7 +75,7 @@ func (q *Queries) DeleteQuestion(ctx context.Context, id uuid.UUID) error {
 }
 
 const getQuestionByID = `-- name: GetQuestionByID :one
-SELECT id, quiz_id, topic_id, question, created_at, updated_at FROM questions
+SELECT id, quiz_id, topic_id, question, created_at, updated_at, question_type, position FROM questions
 WHERE id = $1 LIMIT 1
 `
 
@@ -67,13 +89,15 @@ func (q *Queries) GetQuestionByID(ctx context.Context, id uuid.UUID) (Question,
 		&i.Question,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.QuestionType,
+		&i.Position,
 	)
 	return i, err
 }
 
 const listQuestions = `-- name: ListQuestions :many
-SELECT id, quiz_id, topic_id, question, created_at, updated_at FROM questions
-ORDER BY created_at ASC
+SELECT id, quiz_id, topic_id, question, created_at, updated_at, question_type, position FROM questions
+ORDER BY quiz_id, position ASC
 `
 
 func (q *Queries) ListQuestions(ctx context.Context) ([]Question, error) {
@@ -92,6 +116,8 @@ func (q *Queries) ListQuestions(ctx context.Context) ([]Question, error) {
 			&i.Question,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.QuestionType,
+			&i.Position,
 		); err != nil {
 			return nil, err
 		}
@@ -104,9 +130,9 @@ func (q *Queries) ListQuestions(ctx context.Context) ([]Question, error) {
 }
 
 const listQuestionsByQuizAndTopicID = `-- name: ListQuestionsByQuizAndTopicID :many
-SELECT id, quiz_id, topic_id, question, created_at, updated_at FROM questions
+SELECT id, quiz_id, topic_id, question, created_at, updated_at, question_type, position FROM questions
 WHERE quiz_id = $1 AND topic_id = $2
-ORDER BY created_at ASC
+ORDER BY position ASC
 `
 
 type ListQuestionsByQuizAndTopicIDParams struct {
@@ -130,6 +156,8 @@ func (q *Queries) ListQuestionsByQuizAndTopicID(ctx context.Context, arg ListQue
 			&i.Question,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.QuestionType,
+			&i.Position,
 		); err != nil {
 			return nil, err
 		}
@@ -142,9 +170,8 @@ func (q *Queries) ListQuestionsByQuizAndTopicID(ctx context.Context, arg ListQue
 }
 
 const listQuestionsByQuizID = `-- name: ListQuestionsByQuizID :many
-
 SELECT
-    q.id, q.quiz_id, q.topic_id, q.question, q.created_at, q.updated_at,
+    q.id, q.quiz_id, q.topic_id, q.question, q.created_at, q.updated_at, q.question_type, q.position,
     t.title AS topic_title
 FROM
     questions q
@@ -153,20 +180,21 @@ LEFT JOIN
 WHERE
     q.quiz_id = $1
 ORDER BY
-    q.created_at ASC
+    q.position ASC
 `
 
 type ListQuestionsByQuizIDRow struct {
-	ID         uuid.UUID   `json:"id"`
-	QuizID     uuid.UUID   `json:"quiz_id"`
-	TopicID    uuid.UUID   `json:"topic_id"`
-	Question   string      `json:"question"`
-	CreatedAt  time.Time   `json:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at"`
-	TopicTitle pgtype.Text `json:"topic_title"`
+	ID           uuid.UUID    `json:"id"`
+	QuizID       uuid.UUID    `json:"quiz_id"`
+	TopicID      uuid.UUID    `json:"topic_id"`
+	Question     string       `json:"question"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	QuestionType QuestionType `json:"question_type"`
+	Position     int32        `json:"position"`
+	TopicTitle   pgtype.Text  `json:"topic_title"`
 }
 
-// Or by position/order if added
 func (q *Queries) ListQuestionsByQuizID(ctx context.Context, quizID uuid.UUID) ([]ListQuestionsByQuizIDRow, error) {
 	rows, err := q.db.Query(ctx, listQuestionsByQuizID, quizID)
 	if err != nil {
@@ -183,6 +211,8 @@ func (q *Queries) ListQuestionsByQuizID(ctx context.Context, quizID uuid.UUID) (
 			&i.Question,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.QuestionType,
+			&i.Position,
 			&i.TopicTitle,
 		); err != nil {
 			return nil, err
@@ -196,9 +226,9 @@ func (q *Queries) ListQuestionsByQuizID(ctx context.Context, quizID uuid.UUID) (
 }
 
 const listQuestionsByTopicID = `-- name: ListQuestionsByTopicID :many
-SELECT id, quiz_id, topic_id, question, created_at, updated_at FROM questions
+SELECT id, quiz_id, topic_id, question, created_at, updated_at, question_type, position FROM questions
 WHERE topic_id = $1
-ORDER BY created_at ASC
+ORDER BY quiz_id, position ASC
 `
 
 func (q *Queries) ListQuestionsByTopicID(ctx context.Context, topicID uuid.UUID) ([]Question, error) {
@@ -217,6 +247,8 @@ func (q *Queries) ListQuestionsByTopicID(ctx context.Context, topicID uuid.UUID)
 			&i.Question,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.QuestionType,
+			&i.Position,
 		); err != nil {
 			return nil, err
 		}
@@ -228,6 +260,42 @@ func (q *Queries) ListQuestionsByTopicID(ctx context.Context, topicID uuid.UUID)
 	return items, nil
 }
 
+const nextQuestionPosition = `-- name: NextQuestionPosition :one
+SELECT (COALESCE(MAX(position), 0) + 1)::INTEGER AS position
+FROM questions
+WHERE quiz_id = $1
+`
+
+// Position after the last question of a quiz, for questions added to it
+func (q *Queries) NextQuestionPosition(ctx context.Context, quizID uuid.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, nextQuestionPosition, quizID)
+	var position int32
+	err := row.Scan(&position)
+	return position, err
+}
+
+const setQuestionPositions = `-- name: SetQuestionPositions :execrows
+UPDATE questions q
+SET position = ordered.position::INTEGER
+FROM unnest($1::UUID[]) WITH ORDINALITY AS ordered(id, position)
+WHERE q.id = ordered.id AND q.quiz_id = $2
+`
+
+type SetQuestionPositionsParams struct {
+	QuestionIds []uuid.UUID `json:"question_ids"`
+	QuizID      uuid.UUID   `json:"quiz_id"`
+}
+
+// Puts the questions of a quiz in the given order in one statement, numbering them from 1.
+// The unique positions are checked at the end of the statement, so positions can be swapped.
+func (q *Queries) SetQuestionPositions(ctx context.Context, arg SetQuestionPositionsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setQuestionPositions, arg.QuestionIds, arg.QuizID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateQuestion = `-- name: UpdateQuestion :one
 UPDATE questions
 SET
@@ -235,7 +303,7 @@ SET
     topic_id = $3,
     question = $4
 WHERE id = $1
-RETURNING id, quiz_id, topic_id, question, created_at, updated_at
+RETURNING id, quiz_id, topic_id, question, created_at, updated_at, question_type, position
 `
 
 type UpdateQuestionParams struct {
@@ -260,6 +328,8 @@ func (q *Queries) UpdateQuestion(ctx context.Context, arg UpdateQuestionParams)
 		&i.Question,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.QuestionType,
+		&i.Position,
 	)
 	return i, err
 }
@@ -14,18 +14,19 @@ import (
 )
 
 const createQuizAttempt = `-- name: CreateQuizAttempt :one
-INSERT INTO quiz_attempts (quiz_id, user_id, start_time)
-VALUES ($1, $2, NOW())
-RETURNING id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at
+INSERT INTO quiz_attempts (quiz_id, user_id, start_time, mode)
+VALUES ($1, $2, NOW(), $3)
+RETURNING id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at, mode
 `
 
 type CreateQuizAttemptParams struct {
-	QuizID uuid.UUID `json:"quiz_id"`
-	UserID uuid.UUID `json:"user_id"`
+	QuizID uuid.UUID   `json:"quiz_id"`
+	UserID uuid.UUID   `json:"user_id"`
+	Mode   AttemptMode `json:"mode"`
 }
 
 func (q *Queries) CreateQuizAttempt(ctx context.Context, arg CreateQuizAttemptParams) (QuizAttempt, error) {
-	row := q.db.QueryRow(ctx, createQuizAttempt, arg.QuizID, arg.UserID)
+	row := q.db.QueryRow(ctx, createQuizAttempt, arg.QuizID, arg.UserID, arg.Mode)
 	var i QuizAttempt
 	err := row.Scan(
 		&i.ID,
@@ -36,12 +37,13 @@ func (q *Queries) CreateQuizAttempt(ctx context.Context, arg CreateQuizAttemptPa
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Mode,
 	)
 	return i, err
 }
 
 const getQuizAttempt = `-- name: GetQuizAttempt :one
-SELECT id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at
+SELECT id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at, mode
 FROM quiz_attempts
 WHERE id = $1
 `
@@ -58,6 +60,7 @@ func (q *Queries) GetQuizAttempt(ctx context.Context, id uuid.UUID) (QuizAttempt
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Mode,
 	)
 	return i, err
 }
@@ -111,7 +114,7 @@ func (q *Queries) GetQuizAttemptWithDetails(ctx context.Context, id uuid.UUID) (
 }
 
 const listQuizAttemptsByUser = `-- name: ListQuizAttemptsByUser :many
-SELECT id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at
+SELECT id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at, mode
 FROM quiz_attempts
 WHERE user_id = $1
 ORDER BY start_time DESC
@@ -135,6 +138,7 @@ func (q *Queries) ListQuizAttemptsByUser(ctx context.Context, userID uuid.UUID)
 			&i.EndTime,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Mode,
 		); err != nil {
 			return nil, err
 		}
@@ -267,7 +271,7 @@ const updateQuizAttemptScoreAndEndTime = `-- name: UpdateQuizAttemptScoreAndEndT
 UPDATE quiz_attempts
 SET score = $2, end_time = $3, updated_at = NOW()
 WHERE id = $1
-RETURNING id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at
+RETURNING id, quiz_id, user_id, score, start_time, end_time, created_at, updated_at, mode
 `
 
 type UpdateQuizAttemptScoreAndEndTimeParams struct {
@@ -288,6 +292,7 @@ func (q *Queries) UpdateQuizAttemptScoreAndEndTime(ctx context.Context, arg Upda
 		&i.EndTime,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Mode,
 	)
 	return i, err
 }
@@ -15,18 +15,19 @@ import (
 
 const createQuiz = `-- name: CreateQuiz :one
 INSERT INTO quizes (
-    creator_id, title, description, visibility
+    creator_id, title, description, visibility, generation_options
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5
 )
-RETURNING id, creator_id, title, description, visibility, created_at, updated_at
+RETURNING id, creator_id, title, description, visibility, created_at, updated_at, generation_options
 `
 
 type CreateQuizParams struct {
-	CreatorID   pgtype.UUID    `json:"creator_id"`
-	Title       string         `json:"title"`
-	Description pgtype.Text    `json:"description"`
-	Visibility  QuizVisibility `json:"visibility"`
+	CreatorID         pgtype.UUID    `json:"creator_id"`
+	Title             string         `json:"title"`
+	Description       pgtype.Text    `json:"description"`
+	Visibility        QuizVisibility `json:"visibility"`
+	GenerationOptions []byte         `json:"generation_options"`
 }
 
 func (q *Queries) CreateQuiz(ctx context.Context, arg CreateQuizParams) (Quize, error) {
@@ -35,6 +36,7 @@ func (q *Queries) CreateQuiz(ctx context.Context, arg CreateQuizParams) (Quize,
 		arg.Title,
 		arg.Description,
 		arg.Visibility,
+		arg.GenerationOptions,
 	)
 	var i Quize
 	err := row.Scan(
@@ -45,6 +47,7 @@ func (q *Queries) CreateQuiz(ctx context.Context, arg CreateQuizParams) (Quize,
 		&i.Visibility,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.GenerationOptions,
 	)
 	return i, err
 }
@@ -68,6 +71,7 @@ SELECT
     q.visibility,
     q.created_at,
     q.updated_at,
+    q.generation_options,
     u.name AS creator_name,
     u.picture AS creator_picture
 FROM
@@ -80,15 +84,16 @@ LIMIT 1
 `
 
 type GetQuizByIDRow struct {
-	ID             uuid.UUID      `json:"id"`
-	CreatorID      pgtype.UUID    `json:"creator_id"`
-	Title          string         `json:"title"`
-	Description    pgtype.Text    `json:"description"`
-	Visibility     QuizVisibility `json:"visibility"`
-	CreatedAt      time.Time      `json:"created_at"`
-	UpdatedAt      time.Time      `json:"updated_at"`
-	CreatorName    pgtype.Text    `json:"creator_name"`
-	CreatorPicture pgtype.Text    `json:"creator_picture"`
+	ID                uuid.UUID      `json:"id"`
+	CreatorID         pgtype.UUID    `json:"creator_id"`
+	Title             string         `json:"title"`
+	Description       pgtype.Text    `json:"description"`
+	Visibility        QuizVisibility `json:"visibility"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	GenerationOptions []byte         `json:"generation_options"`
+	CreatorName       pgtype.Text    `json:"creator_name"`
+	CreatorPicture    pgtype.Text    `json:"creator_picture"`
 }
 
 func (q *Queries) GetQuizByID(ctx context.Context, id uuid.UUID) (GetQuizByIDRow, error) {
@@ -102,6 +107,7 @@ func (q *Queries) GetQuizByID(ctx context.Context, id uuid.UUID) (GetQuizByIDRow
 		&i.Visibility,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.GenerationOptions,
 		&i.CreatorName,
 		&i.CreatorPicture,
 	)
@@ -109,7 +115,7 @@ func (q *Queries) GetQuizByID(ctx context.Context, id uuid.UUID) (GetQuizByIDRow
 }
 
 const listPublicQuizes = `-- name: ListPublicQuizes :many
-SELECT id, creator_id, title, description, visibility, created_at, updated_at FROM quizes
+SELECT id, creator_id, title, description, visibility, created_at, updated_at, generation_options FROM quizes
 WHERE visibility = 'public'
 ORDER BY created_at DESC
 `
@@ -131,6 +137,7 @@ func (q *Queries) ListPublicQuizes(ctx context.Context) ([]Quize, error) {
 			&i.Visibility,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.GenerationOptions,
 		); err != nil {
 			return nil, err
 		}
@@ -143,7 +150,7 @@ func (q *Queries) ListPublicQuizes(ctx context.Context) ([]Quize, error) {
 }
 
 const listQuizes = `-- name: ListQuizes :many
-SELECT id, creator_id, title, description, visibility, created_at, updated_at FROM quizes
+SELECT id, creator_id, title, description, visibility, created_at, updated_at, generation_options FROM quizes
 ORDER BY created_at DESC
 `
 
@@ -164,6 +171,7 @@ func (q *Queries) ListQuizes(ctx context.Context) ([]Quize, error) {
 			&i.Visibility,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.GenerationOptions,
 		); err != nil {
 			return nil, err
 		}
@@ -176,7 +184,7 @@ func (q *Queries) ListQuizes(ctx context.Context) ([]Quize, error) {
 }
 
 const listQuizesByCreatorID = `-- name: ListQuizesByCreatorID :many
-SELECT id, creator_id, title, description, visibility, created_at, updated_at FROM quizes
+SELECT id, creator_id, title, description, visibility, created_at, updated_at, generation_options FROM quizes
 WHERE creator_id = $1
 ORDER BY created_at DESC
 `
@@ -198,6 +206,7 @@ func (q *Queries) ListQuizesByCreatorID(ctx context.Context, creatorID pgtype.UU
 			&i.Visibility,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.GenerationOptions,
 		); err != nil {
 			return nil, err
 		}
@@ -210,7 +219,7 @@ func (q *Queries) ListQuizesByCreatorID(ctx context.Context, creatorID pgtype.UU
 }
 
 const listQuizesByVisibility = `-- name: ListQuizesByVisibility :many
-SELECT id, creator_id, title, description, visibility, created_at, updated_at FROM quizes
+SELECT id, creator_id, title, description, visibility, created_at, updated_at, generation_options FROM quizes
 WHERE visibility = $1
 ORDER BY created_at DESC
 `
@@ -232,6 +241,7 @@ func (q *Queries) ListQuizesByVisibility(ctx context.Context, visibility QuizVis
 			&i.Visibility,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.GenerationOptions,
 		); err != nil {
 			return nil, err
 		}
@@ -281,6 +291,18 @@ func (q *Queries) ListQuizzesByCreator(ctx context.Context, creatorID pgtype.UUI
 	return items, nil
 }
 
+const touchQuiz = `-- name: TouchQuiz :exec
+UPDATE quizes
+SET updated_at = NOW()
+WHERE id = $1
+`
+
+// Marks a quiz as updated when its questions or answers change
+func (q *Queries) TouchQuiz(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, touchQuiz, id)
+	return err
+}
+
 const updateQuiz = `-- name: UpdateQuiz :one
 UPDATE quizes
 SET
@@ -289,7 +311,7 @@ SET
     description = $4,
     visibility = $5
 WHERE id = $1
-RETURNING id, creator_id, title, description, visibility, created_at, updated_at
+RETURNING id, creator_id, title, description, visibility, created_at, updated_at, generation_options
 `
 
 type UpdateQuizParams struct {
@@ -317,6 +339,7 @@ func (q *Queries) UpdateQuiz(ctx context.Context, arg UpdateQuizParams) (Quize,
 		&i.Visibility,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.GenerationOptions,
 	)
 	return i, err
 }
@@ -9,15 +9,41 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const countTokensByGenerationJobID = `-- name: CountTokensByGenerationJobID :one
+SELECT COUNT(*) FROM tokens
+WHERE generation_job_id = $1
+`
+
+// Jobs queued before reservations existed have no ledger rows
+func (q *Queries) CountTokensByGenerationJobID(ctx context.Context, generationJobID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countTokensByGenerationJobID, generationJobID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countTokensByUserID = `-- name: CountTokensByUserID :one
+SELECT COUNT(*) FROM tokens
+WHERE user_id = $1
+`
+
+func (q *Queries) CountTokensByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countTokensByUserID, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createToken = `-- name: CreateToken :one
 INSERT INTO tokens (
     user_id, amount, type
 ) VALUES (
     $1, $2, $3
 )
-RETURNING id, user_id, amount, type, created_at, updated_at
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
 `
 
 type CreateTokenParams struct {
@@ -36,26 +62,164 @@ func (q *Queries) CreateToken(ctx context.Context, arg CreateTokenParams) (Token
 		&i.Type,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
+	)
+	return i, err
+}
+
+const createTokenGrant = `-- name: CreateTokenGrant :one
+INSERT INTO tokens (
+    user_id, amount, input_amount, output_amount, type
+) VALUES (
+    $1, $2, $3, $4, $5 -- Amounts are positive, e.g. the signup gift
+)
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
+`
+
+type CreateTokenGrantParams struct {
+	UserID       uuid.UUID `json:"user_id"`
+	Amount       int32     `json:"amount"`
+	InputAmount  int32     `json:"input_amount"`
+	OutputAmount int32     `json:"output_amount"`
+	Type         TokenType `json:"type"`
+}
+
+func (q *Queries) CreateTokenGrant(ctx context.Context, arg CreateTokenGrantParams) (Token, error) {
+	row := q.db.QueryRow(ctx, createTokenGrant,
+		arg.UserID,
+		arg.Amount,
+		arg.InputAmount,
+		arg.OutputAmount,
+		arg.Type,
+	)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Amount,
+		&i.Type,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
+	)
+	return i, err
+}
+
+const createTokenRefund = `-- name: CreateTokenRefund :one
+INSERT INTO tokens (
+    user_id, amount, input_amount, output_amount, type, generation_job_id
+) VALUES (
+    $1, $2, $3, $4, 'refund', $5 -- Amounts are positive, they cancel out a usage record
+)
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
+`
+
+type CreateTokenRefundParams struct {
+	UserID          uuid.UUID   `json:"user_id"`
+	Amount          int32       `json:"amount"`
+	InputAmount     int32       `json:"input_amount"`
+	OutputAmount    int32       `json:"output_amount"`
+	GenerationJobID pgtype.UUID `json:"generation_job_id"`
+}
+
+func (q *Queries) CreateTokenRefund(ctx context.Context, arg CreateTokenRefundParams) (Token, error) {
+	row := q.db.QueryRow(ctx, createTokenRefund,
+		arg.UserID,
+		arg.Amount,
+		arg.InputAmount,
+		arg.OutputAmount,
+		arg.GenerationJobID,
+	)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Amount,
+		&i.Type,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
+	)
+	return i, err
+}
+
+const createTokenReservation = `-- name: CreateTokenReservation :one
+INSERT INTO tokens (
+    user_id, amount, input_amount, output_amount, type, status, generation_job_id
+) VALUES (
+    $1, $2, $3, $4, 'reservation', 'pending', $5 -- Amounts are negative, like usage
+)
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
+`
+
+type CreateTokenReservationParams struct {
+	UserID          uuid.UUID   `json:"user_id"`
+	Amount          int32       `json:"amount"`
+	InputAmount     int32       `json:"input_amount"`
+	OutputAmount    int32       `json:"output_amount"`
+	GenerationJobID pgtype.UUID `json:"generation_job_id"`
+}
+
+func (q *Queries) CreateTokenReservation(ctx context.Context, arg CreateTokenReservationParams) (Token, error) {
+	row := q.db.QueryRow(ctx, createTokenReservation,
+		arg.UserID,
+		arg.Amount,
+		arg.InputAmount,
+		arg.OutputAmount,
+		arg.GenerationJobID,
+	)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Amount,
+		&i.Type,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
 	)
 	return i, err
 }
 
 const createTokenTransaction = `-- name: CreateTokenTransaction :one
 INSERT INTO tokens (
-    user_id, amount, type
+    user_id, amount, input_amount, output_amount, type
 ) VALUES (
-    $1, $2, 'usage' -- Amount should be negative for usage
+    $1, $2, $3, $4, 'usage' -- Amounts should be negative for usage
 )
-RETURNING id, user_id, amount, type, created_at, updated_at
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
 `
 
 type CreateTokenTransactionParams struct {
-	UserID uuid.UUID `json:"user_id"`
-	Amount int32     `json:"amount"`
+	UserID       uuid.UUID `json:"user_id"`
+	Amount       int32     `json:"amount"`
+	InputAmount  int32     `json:"input_amount"`
+	OutputAmount int32     `json:"output_amount"`
 }
 
 func (q *Queries) CreateTokenTransaction(ctx context.Context, arg CreateTokenTransactionParams) (Token, error) {
-	row := q.db.QueryRow(ctx, createTokenTransaction, arg.UserID, arg.Amount)
+	row := q.db.QueryRow(ctx, createTokenTransaction,
+		arg.UserID,
+		arg.Amount,
+		arg.InputAmount,
+		arg.OutputAmount,
+	)
 	var i Token
 	err := row.Scan(
 		&i.ID,
@@ -64,6 +228,11 @@ func (q *Queries) CreateTokenTransaction(ctx context.Context, arg CreateTokenTra
 		&i.Type,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
 	)
 	return i, err
 }
@@ -78,8 +247,35 @@ func (q *Queries) DeleteToken(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const getPendingTokenReservationByJobID = `-- name: GetPendingTokenReservationByJobID :one
+SELECT id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount FROM tokens
+WHERE generation_job_id = $1 AND type = 'reservation' AND status = 'pending'
+LIMIT 1
+FOR UPDATE
+`
+
+// Locks the reservation so it is settled or released only once
+func (q *Queries) GetPendingTokenReservationByJobID(ctx context.Context, generationJobID pgtype.UUID) (Token, error) {
+	row := q.db.QueryRow(ctx, getPendingTokenReservationByJobID, generationJobID)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Amount,
+		&i.Type,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
+	)
+	return i, err
+}
+
 const getTokenByID = `-- name: GetTokenByID :one
-SELECT id, user_id, amount, type, created_at, updated_at FROM tokens
+SELECT id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount FROM tokens
 WHERE id = $1 LIMIT 1
 `
 
@@ -93,12 +289,70 @@ func (q *Queries) GetTokenByID(ctx context.Context, id uuid.UUID) (Token, error)
 		&i.Type,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
 	)
 	return i, err
 }
 
+const listTokenBalanceDrift = `-- name: ListTokenBalanceDrift :many
+SELECT
+    u.id AS user_id,
+    u.email,
+    u.input_tokens_balance,
+    u.output_tokens_balance,
+    COALESCE(SUM(t.input_amount), 0)::int AS ledger_input_balance,
+    COALESCE(SUM(t.output_amount), 0)::int AS ledger_output_balance
+FROM users u
+LEFT JOIN tokens t ON t.user_id = u.id AND t.status <> 'released'
+GROUP BY u.id
+HAVING u.input_tokens_balance <> COALESCE(SUM(t.input_amount), 0)
+    OR u.output_tokens_balance <> COALESCE(SUM(t.output_amount), 0)
+ORDER BY u.email
+`
+
+type ListTokenBalanceDriftRow struct {
+	UserID              uuid.UUID `json:"user_id"`
+	Email               string    `json:"email"`
+	InputTokensBalance  int32     `json:"input_tokens_balance"`
+	OutputTokensBalance int32     `json:"output_tokens_balance"`
+	LedgerInputBalance  int32     `json:"ledger_input_balance"`
+	LedgerOutputBalance int32     `json:"ledger_output_balance"`
+}
+
+// Users whose balances differ from the sum of their ledger; released reservations don't count
+func (q *Queries) ListTokenBalanceDrift(ctx context.Context) ([]ListTokenBalanceDriftRow, error) {
+	rows, err := q.db.Query(ctx, listTokenBalanceDrift)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListTokenBalanceDriftRow{}
+	for rows.Next() {
+		var i ListTokenBalanceDriftRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Email,
+			&i.InputTokensBalance,
+			&i.OutputTokensBalance,
+			&i.LedgerInputBalance,
+			&i.LedgerOutputBalance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listTokens = `-- name: ListTokens :many
-SELECT id, user_id, amount, type, created_at, updated_at FROM tokens
+SELECT id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount FROM tokens
 ORDER BY created_at DESC
 `
 
@@ -118,6 +372,11 @@ func (q *Queries) ListTokens(ctx context.Context) ([]Token, error) {
 			&i.Type,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Status,
+			&i.GenerationJobID,
+			&i.InputAmount,
+			&i.OutputAmount,
+			&i.LegacyAmount,
 		); err != nil {
 			return nil, err
 		}
@@ -130,7 +389,7 @@ func (q *Queries) ListTokens(ctx context.Context) ([]Token, error) {
 }
 
 const listTokensByUserID = `-- name: ListTokensByUserID :many
-SELECT id, user_id, amount, type, created_at, updated_at FROM tokens
+SELECT id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount FROM tokens
 WHERE user_id = $1
 ORDER BY created_at DESC
 `
@@ -151,6 +410,11 @@ func (q *Queries) ListTokensByUserID(ctx context.Context, userID uuid.UUID) ([]T
 			&i.Type,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Status,
+			&i.GenerationJobID,
+			&i.InputAmount,
+			&i.OutputAmount,
+			&i.LegacyAmount,
 		); err != nil {
 			return nil, err
 		}
@@ -162,6 +426,116 @@ func (q *Queries) ListTokensByUserID(ctx context.Context, userID uuid.UUID) ([]T
 	return items, nil
 }
 
+const listTokensByUserIDPaginated = `-- name: ListTokensByUserIDPaginated :many
+SELECT id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount FROM tokens
+WHERE user_id = $1
+ORDER BY created_at DESC, id
+LIMIT $2 OFFSET $3
+`
+
+type ListTokensByUserIDPaginatedParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Limit  int32     `json:"limit"`
+	Offset int32     `json:"offset"`
+}
+
+func (q *Queries) ListTokensByUserIDPaginated(ctx context.Context, arg ListTokensByUserIDPaginatedParams) ([]Token, error) {
+	rows, err := q.db.Query(ctx, listTokensByUserIDPaginated, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Token{}
+	for rows.Next() {
+		var i Token
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Amount,
+			&i.Type,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Status,
+			&i.GenerationJobID,
+			&i.InputAmount,
+			&i.OutputAmount,
+			&i.LegacyAmount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const releaseTokenReservation = `-- name: ReleaseTokenReservation :one
+UPDATE tokens
+SET status = 'released'
+WHERE id = $1
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
+`
+
+func (q *Queries) ReleaseTokenReservation(ctx context.Context, id uuid.UUID) (Token, error) {
+	row := q.db.QueryRow(ctx, releaseTokenReservation, id)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Amount,
+		&i.Type,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
+	)
+	return i, err
+}
+
+const settleTokenReservation = `-- name: SettleTokenReservation :one
+UPDATE tokens
+SET type = 'usage', status = 'settled', amount = $2, input_amount = $3, output_amount = $4
+WHERE id = $1
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
+`
+
+type SettleTokenReservationParams struct {
+	ID           uuid.UUID `json:"id"`
+	Amount       int32     `json:"amount"`
+	InputAmount  int32     `json:"input_amount"`
+	OutputAmount int32     `json:"output_amount"`
+}
+
+// The reservation becomes the usage record of the job
+func (q *Queries) SettleTokenReservation(ctx context.Context, arg SettleTokenReservationParams) (Token, error) {
+	row := q.db.QueryRow(ctx, settleTokenReservation,
+		arg.ID,
+		arg.Amount,
+		arg.InputAmount,
+		arg.OutputAmount,
+	)
+	var i Token
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Amount,
+		&i.Type,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
+	)
+	return i, err
+}
+
 const updateToken = `-- name: UpdateToken :one
 UPDATE tokens
 SET
@@ -169,7 +543,7 @@ SET
     amount = $3,
     type = $4
 WHERE id = $1
-RETURNING id, user_id, amount, type, created_at, updated_at
+RETURNING id, user_id, amount, type, created_at, updated_at, status, generation_job_id, input_amount, output_amount, legacy_amount
 `
 
 type UpdateTokenParams struct {
@@ -194,6 +568,11 @@ func (q *Queries) UpdateToken(ctx context.Context, arg UpdateTokenParams) (Token
 		&i.Type,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Status,
+		&i.GenerationJobID,
+		&i.InputAmount,
+		&i.OutputAmount,
+		&i.LegacyAmount,
 	)
 	return i, err
 }
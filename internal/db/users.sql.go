@@ -161,6 +161,75 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
+const reconcileUserTokenBalance = `-- name: ReconcileUserTokenBalance :one
+UPDATE users
+SET
+    input_tokens_balance = ledger.input_balance,
+    output_tokens_balance = ledger.output_balance
+FROM (
+    SELECT
+        COALESCE(SUM(input_amount), 0)::int AS input_balance,
+        COALESCE(SUM(output_amount), 0)::int AS output_balance
+    FROM tokens
+    WHERE user_id = $1 AND status <> 'released'
+) AS ledger
+WHERE users.id = $1
+RETURNING users.id, users.google_id, users.email, users.name, users.picture, users.input_tokens_balance, users.output_tokens_balance, users.created_at, users.updated_at
+`
+
+// Sets both balances to the sum of the user's ledger; released reservations don't count
+func (q *Queries) ReconcileUserTokenBalance(ctx context.Context, userID uuid.UUID) (User, error) {
+	row := q.db.QueryRow(ctx, reconcileUserTokenBalance, userID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.GoogleID,
+		&i.Email,
+		&i.Name,
+		&i.Picture,
+		&i.InputTokensBalance,
+		&i.OutputTokensBalance,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const reserveUserTokens = `-- name: ReserveUserTokens :one
+UPDATE users
+SET
+    input_tokens_balance = input_tokens_balance - $2,
+    output_tokens_balance = output_tokens_balance - $3
+WHERE id = $1 AND input_tokens_balance >= $2 AND output_tokens_balance >= $3
+RETURNING id, google_id, email, name, picture, input_tokens_balance, output_tokens_balance, created_at, updated_at
+`
+
+type ReserveUserTokensParams struct {
+	ID                  uuid.UUID `json:"id"`
+	InputTokensBalance  int32     `json:"input_tokens_balance"`
+	OutputTokensBalance int32     `json:"output_tokens_balance"`
+}
+
+// Only succeeds if both balances cover the reservation
+// A negative balance, left by a job that used more than it reserved, fails every reservation,
+// even an empty one, so the user can't generate until they get tokens again
+func (q *Queries) ReserveUserTokens(ctx context.Context, arg ReserveUserTokensParams) (User, error) {
+	row := q.db.QueryRow(ctx, reserveUserTokens, arg.ID, arg.InputTokensBalance, arg.OutputTokensBalance)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.GoogleID,
+		&i.Email,
+		&i.Name,
+		&i.Picture,
+		&i.InputTokensBalance,
+		&i.OutputTokensBalance,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const updateUser = `-- name: UpdateUser :one
 
 UPDATE users
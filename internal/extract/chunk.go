@@ -0,0 +1,124 @@
+package extract
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunk is a run of consecutive pages whose text is sent to the generator together
+type Chunk struct {
+	FirstPage int    // First page covered by the chunk
+	LastPage  int    // Last page covered by the chunk
+	Heading   string // First section heading in the chunk, empty if it has none
+	Text      string // Text of the pages, each preceded by a marker such as [Page N] or [Slide N]
+	Tokens    int    // Estimated tokens of Text
+}
+
+// ChunkPages groups pages into chunks of at most maxTokens each. Chunks end at page boundaries,
+// and once a chunk is half full it ends early before a page that starts a new section, so that
+// sections stay together where they fit. Pages larger than maxTokens are split by lines into
+// several chunks of the same page. Pages without text are skipped.
+func ChunkPages(pages []Page, maxTokens int) []Chunk {
+	var chunks []Chunk
+	var current []Page
+	tokens := 0
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		chunk := Chunk{FirstPage: current[0].Number, LastPage: current[len(current)-1].Number}
+		var text strings.Builder
+		for _, page := range current {
+			if chunk.Heading == "" && len(page.Headings) > 0 {
+				chunk.Heading = page.Headings[0]
+			}
+			text.WriteString(pageMarker(page))
+			fmt.Fprintf(&text, "%s\n\n", strings.TrimSpace(page.Text))
+		}
+		chunk.Text = text.String()
+		chunk.Tokens = EstimateTokens(chunk.Text)
+		chunks = append(chunks, chunk)
+		current, tokens = nil, 0
+	}
+
+	for _, page := range pages {
+		if strings.TrimSpace(page.Text) == "" {
+			continue
+		}
+		pageTokens := EstimateTokens(page.Text)
+		if pageTokens > maxTokens {
+			flush()
+			chunks = append(chunks, splitPage(page, maxTokens)...)
+			continue
+		}
+		if len(current) > 0 && (tokens+pageTokens > maxTokens || (page.startsSection() && tokens >= maxTokens/2)) {
+			flush()
+		}
+		current = append(current, page)
+		tokens += pageTokens
+	}
+	flush()
+	return chunks
+}
+
+// splitPage splits the text of a page that exceeds maxTokens into chunks at line boundaries
+func splitPage(page Page, maxTokens int) []Chunk {
+	var chunks []Chunk
+	var text strings.Builder
+	heading := ""
+	if len(page.Headings) > 0 {
+		heading = page.Headings[0]
+	}
+
+	flush := func() {
+		if strings.TrimSpace(text.String()) == "" {
+			return
+		}
+		body := fmt.Sprintf("%s%s\n\n", pageMarker(page), strings.TrimSpace(text.String()))
+		chunks = append(chunks, Chunk{
+			FirstPage: page.Number,
+			LastPage:  page.Number,
+			Heading:   heading,
+			Text:      body,
+			Tokens:    EstimateTokens(body),
+		})
+		text.Reset()
+	}
+
+	for _, line := range strings.Split(page.Text, "\n") {
+		// Lines longer than the budget on their own are cut, no real page has them
+		for EstimateTokens(line) > maxTokens {
+			cut := maxTokens * 4
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			flush()
+			text.WriteString(line[:cut])
+			flush()
+			line = line[cut:]
+		}
+		if EstimateTokens(text.String())+EstimateTokens(line) > maxTokens {
+			flush()
+		}
+		text.WriteString(line)
+		text.WriteByte('\n')
+	}
+	flush()
+	return chunks
+}
+
+// pageMarker marks where a page starts in the text of a chunk, so questions can name their page,
+// e.g. "[Page 12]" or "[Slide 3]". Sections of documents without pages have no marker, their
+// headings mark where they start.
+func pageMarker(page Page) string {
+	switch {
+	case page.Label != "":
+		return fmt.Sprintf("[%s]\n", page.Label)
+	case page.Number > 0:
+		return fmt.Sprintf("[Page %d]\n", page.Number)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,284 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// wordNS is the namespace of WordprocessingML, the XML of DOCX documents
+const wordNS = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+// markupCompatibilityNS is the namespace of mc:AlternateContent, which gives the same content
+// in several forms; only the first (mc:Choice) is read so it isn't extracted twice
+const markupCompatibilityNS = "http://schemas.openxmlformats.org/markup-compatibility/2006"
+
+// headingStylePattern matches the built-in heading style names, e.g. "heading 2"
+var headingStylePattern = regexp.MustCompile(`(?i)^heading\s*([1-9])$`)
+
+// DOCXPages extracts the text of the DOCX document at path
+func DOCXPages(path string) ([]Page, error) {
+	doc, err := readZipDocument(path, "DOCX")
+	if err != nil {
+		return nil, err
+	}
+	return parseDOCX(doc)
+}
+
+// ParseDOCX extracts the text of a DOCX document, one line per paragraph or table row.
+// Word documents have no fixed pages, so the text is split into sections at headings instead:
+// each returned page is a section starting with its heading, marked like "## Heading", and has
+// no number. List items start with "- " and table cells are separated by " | ".
+// It returns ErrNoText when the document has no text.
+func ParseDOCX(data []byte) ([]Page, error) {
+	doc, err := openZipDocument(data, "DOCX")
+	if err != nil {
+		return nil, err
+	}
+	return parseDOCX(doc)
+}
+
+// parseDOCX extracts the text of the main document part of a DOCX document
+func parseDOCX(doc *zipDocument) ([]Page, error) {
+	if doc.has("EncryptionInfo") {
+		// Password protected Office files are an encrypted container that merely looks like a document
+		return nil, ErrEncrypted
+	}
+	data, err := doc.read("word/document.xml")
+	if err != nil {
+		return nil, err
+	}
+	// Heading styles are optional, without them only paragraphs with an outline level are headings
+	styles := map[string]int{}
+	if doc.has("word/styles.xml") {
+		if stylesData, err := doc.read("word/styles.xml"); err == nil {
+			styles = docxHeadingStyles(stylesData)
+		}
+	}
+
+	var sections sectionWriter
+	if err := readDOCXBody(data, styles, &sections); err != nil {
+		return nil, fmt.Errorf("failed to parse DOCX document: %w", err)
+	}
+	pages := sections.finish()
+	if len(pages) == 0 {
+		return nil, ErrNoText
+	}
+	return pages, nil
+}
+
+// docxHeadingStyles returns the heading level of each paragraph style that is a heading, by style ID.
+// Style IDs are localised ("Überschrift1" in German Word), so headings are found by the style's
+// outline level or its built-in name instead.
+func docxHeadingStyles(data []byte) map[string]int {
+	var styles struct {
+		Styles []struct {
+			Type string `xml:"type,attr"`
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+			OutlineLevel *struct {
+				Val string `xml:"val,attr"`
+			} `xml:"pPr>outlineLvl"`
+		} `xml:"style"`
+	}
+	levels := make(map[string]int)
+	if err := xml.Unmarshal(data, &styles); err != nil {
+		return levels
+	}
+	for _, style := range styles.Styles {
+		if style.Type != "paragraph" {
+			continue
+		}
+		name := strings.TrimSpace(style.Name.Val)
+		switch {
+		case style.OutlineLevel != nil:
+			// Level 9 is body text
+			if level, err := strconv.Atoi(style.OutlineLevel.Val); err == nil && level < 9 {
+				levels[style.ID] = level + 1
+			}
+		case strings.EqualFold(name, "title"):
+			levels[style.ID] = 1
+		default:
+			if m := headingStylePattern.FindStringSubmatch(name); m != nil {
+				levels[style.ID] = int(m[1][0] - '0')
+			}
+		}
+	}
+	return levels
+}
+
+// docxParagraph is a paragraph being read; paragraphs nest when a paragraph holds a text box
+type docxParagraph struct {
+	text  strings.Builder
+	level int  // Heading level, 0 for body text
+	list  bool // Whether the paragraph is a list item
+}
+
+// readDOCXBody reads the paragraphs and tables of document.xml into sections
+func readDOCXBody(data []byte, styles map[string]int, sections *sectionWriter) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var paragraphs []*docxParagraph
+	var cell strings.Builder // Text of the current table cell
+	var cells []string       // Cells of the current table row
+	tableDepth := 0
+	inText := false
+
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == markupCompatibilityNS && t.Name.Local == "Fallback" {
+				if err := dec.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if t.Name.Space != wordNS {
+				continue
+			}
+			var p *docxParagraph
+			if len(paragraphs) > 0 {
+				p = paragraphs[len(paragraphs)-1]
+			}
+			switch t.Name.Local {
+			case "p":
+				paragraphs = append(paragraphs, &docxParagraph{})
+			case "pStyle":
+				if p != nil && p.level == 0 {
+					p.level = styles[xmlAttr(t, "val")]
+				}
+			case "outlineLvl":
+				if level, err := strconv.Atoi(xmlAttr(t, "val")); p != nil && err == nil && level < 9 {
+					p.level = level + 1
+				}
+			case "numPr":
+				if p != nil {
+					p.list = true
+				}
+			case "t":
+				inText = true
+			case "tab":
+				// Tab stops in the paragraph properties are w:tab too, but carry a position
+				if p != nil && xmlAttr(t, "pos") == "" {
+					p.text.WriteByte(' ')
+				}
+			case "br", "cr":
+				if p != nil {
+					p.text.WriteByte('\n')
+				}
+			case "noBreakHyphen":
+				if p != nil {
+					p.text.WriteByte('-')
+				}
+			case "tbl":
+				tableDepth++
+			case "tr":
+				if tableDepth == 1 {
+					cells = nil
+				}
+			}
+
+		case xml.EndElement:
+			if t.Name.Space != wordNS {
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if len(paragraphs) == 0 {
+					continue
+				}
+				p := paragraphs[len(paragraphs)-1]
+				paragraphs = paragraphs[:len(paragraphs)-1]
+				text := cleanLines(p.text.String())
+				switch {
+				case text == "":
+				case tableDepth > 0:
+					// Paragraphs of a cell are joined into the cell's text
+					if cell.Len() > 0 {
+						cell.WriteByte(' ')
+					}
+					cell.WriteString(strings.ReplaceAll(text, "\n", " "))
+				case p.level > 0:
+					sections.heading(headingLine(p.level, strings.ReplaceAll(text, "\n", " ")))
+				case p.list:
+					sections.line("- " + text)
+				default:
+					sections.line(text)
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cells = append(cells, cell.String())
+					cell.Reset()
+				}
+			case "tr":
+				if tableDepth == 1 {
+					if row := strings.Join(cells, " | "); strings.Trim(row, " |") != "" {
+						sections.line(row)
+					}
+					cells = nil
+				}
+			case "tbl":
+				tableDepth--
+			}
+
+		case xml.CharData:
+			if inText && len(paragraphs) > 0 {
+				paragraphs[len(paragraphs)-1].text.Write(t)
+			}
+		}
+	}
+	return nil
+}
+
+// sectionWriter collects the lines of a document without fixed pages into sections, each
+// starting at a heading. The sections are returned as pages without numbers.
+type sectionWriter struct {
+	pages    []Page
+	lines    []string
+	headings []string
+}
+
+// heading starts a new section with a heading line. Headings in a row, e.g. of a chapter
+// and its first section, start one section together.
+func (s *sectionWriter) heading(line string) {
+	if len(s.lines) > len(s.headings) {
+		s.flush()
+	}
+	s.lines = append(s.lines, line)
+	s.headings = append(s.headings, line)
+}
+
+// line adds a line of text to the current section
+func (s *sectionWriter) line(line string) {
+	s.lines = append(s.lines, line)
+}
+
+// flush ends the current section
+func (s *sectionWriter) flush() {
+	if len(s.lines) > 0 {
+		s.pages = append(s.pages, Page{Text: strings.Join(s.lines, "\n"), Headings: s.headings})
+	}
+	s.lines, s.headings = nil, nil
+}
+
+// finish ends the last section and returns all of them
+func (s *sectionWriter) finish() []Page {
+	s.flush()
+	return s.pages
+}
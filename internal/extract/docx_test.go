@@ -0,0 +1,55 @@
+package extract
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkPages compares extracted pages with the expected ones
+func checkPages(t *testing.T, got, want []Page) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d pages, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("page %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDOCXPages(t *testing.T) {
+	pages, err := DOCXPages(filepath.Join("testdata", "sample.docx"))
+	if err != nil {
+		t.Fatalf("DOCXPages: %v", err)
+	}
+	// Sections start at the headings, whose style IDs are localised and found by the style names
+	checkPages(t, pages, []Page{
+		{
+			Text:     "# The Cell\nAll living things are made of cells.\n- Nucleus\n- Cell membrane\nOrganelle | Function\nRibosome | Makes proteins",
+			Headings: []string{"# The Cell"},
+		},
+		{
+			Text:     "## Energy\nMitochondria release energy from glucose.",
+			Headings: []string{"## Energy"},
+		},
+	})
+}
+
+func TestDOCXPagesInvalidArchive(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"not-a-document.zip", "DOCX file has no word/document.xml"},
+		{"compressed.pdf", "not a DOCX file"},
+	}
+	for _, tt := range tests {
+		_, err := DOCXPages(filepath.Join("testdata", tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("DOCXPages(%s) error = %v, want %q", tt.file, err, tt.err)
+		}
+	}
+}
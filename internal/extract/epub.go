@@ -0,0 +1,243 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// EPUBPages extracts the text of the EPUB book at path
+func EPUBPages(path string) ([]Page, error) {
+	doc, err := readZipDocument(path, "EPUB")
+	if err != nil {
+		return nil, err
+	}
+	return parseEPUB(doc)
+}
+
+// ParseEPUB extracts the text of each chapter of an EPUB book. Each returned page is a content
+// document of the book's reading order, usually a chapter, labelled "Chapter N" and without a
+// number. Headings are marked like "## Heading" and list items start with "- ".
+// It returns ErrEncrypted for books protected by DRM and ErrNoText when the book has no text.
+func ParseEPUB(data []byte) ([]Page, error) {
+	doc, err := openZipDocument(data, "EPUB")
+	if err != nil {
+		return nil, err
+	}
+	return parseEPUB(doc)
+}
+
+// parseEPUB extracts the text of the content documents in the spine of the package document
+func parseEPUB(doc *zipDocument) ([]Page, error) {
+	chapters, err := epubChapters(doc)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := epubEncryptedParts(doc)
+
+	var pages []Page
+	for _, chapter := range chapters {
+		if encrypted[chapter] {
+			return nil, ErrEncrypted
+		}
+		data, err := doc.read(chapter)
+		if err != nil {
+			return nil, err
+		}
+		lines, headings, err := htmlLines(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", chapter, err)
+		}
+		if len(lines) == 0 {
+			continue // Cover images, blank pages and the like
+		}
+		pages = append(pages, Page{
+			Label:    fmt.Sprintf("Chapter %d", len(pages)+1),
+			Text:     strings.Join(lines, "\n"),
+			Headings: headings,
+		})
+	}
+	if len(pages) == 0 {
+		return nil, ErrNoText
+	}
+	return pages, nil
+}
+
+// epubChapters returns the content documents of the reading order (the spine), leaving out
+// those marked as not part of it such as footnote pages
+func epubChapters(doc *zipDocument) ([]string, error) {
+	data, err := doc.read("META-INF/container.xml")
+	if err != nil {
+		return nil, err
+	}
+	var container struct {
+		Rootfiles []struct {
+			FullPath  string `xml:"full-path,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	if err := xml.Unmarshal(data, &container); err != nil {
+		return nil, fmt.Errorf("failed to parse EPUB container: %w", err)
+	}
+	packagePath := ""
+	for _, rootfile := range container.Rootfiles {
+		if rootfile.MediaType == "" || rootfile.MediaType == "application/oebps-package+xml" {
+			packagePath = rootfile.FullPath
+			break
+		}
+	}
+	if packagePath == "" {
+		return nil, errors.New("EPUB file has no package document")
+	}
+
+	data, err = doc.read(packagePath)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Items []struct {
+			ID        string `xml:"id,attr"`
+			Href      string `xml:"href,attr"`
+			MediaType string `xml:"media-type,attr"`
+		} `xml:"manifest>item"`
+		Spine []struct {
+			IDRef  string `xml:"idref,attr"`
+			Linear string `xml:"linear,attr"`
+		} `xml:"spine>itemref"`
+	}
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse EPUB package document: %w", err)
+	}
+
+	items := make(map[string]string)
+	for _, item := range pkg.Items {
+		if item.MediaType != "application/xhtml+xml" && item.MediaType != "text/html" {
+			continue
+		}
+		// Hrefs are URLs relative to the package document
+		href, err := url.PathUnescape(strings.SplitN(item.Href, "#", 2)[0])
+		if err != nil {
+			href = item.Href
+		}
+		items[item.ID] = resolvePart(packagePath, href)
+	}
+	var chapters []string
+	for _, ref := range pkg.Spine {
+		if chapter, ok := items[ref.IDRef]; ok && ref.Linear != "no" {
+			chapters = append(chapters, chapter)
+		}
+	}
+	if len(chapters) == 0 {
+		return nil, errors.New("EPUB file has no chapters")
+	}
+	return chapters, nil
+}
+
+// epubEncryptedParts returns the parts listed as encrypted. Books often obfuscate their embedded
+// fonts this way, only encrypted content documents make a book unreadable.
+func epubEncryptedParts(doc *zipDocument) map[string]bool {
+	parts := make(map[string]bool)
+	if !doc.has("META-INF/encryption.xml") {
+		return parts
+	}
+	data, err := doc.read("META-INF/encryption.xml")
+	if err != nil {
+		return parts
+	}
+	var encryption struct {
+		Data []struct {
+			URI string `xml:"CipherData>CipherReference>URI,attr"`
+		} `xml:"EncryptedData"`
+	}
+	if err := xml.Unmarshal(data, &encryption); err != nil {
+		return parts
+	}
+	for _, d := range encryption.Data {
+		if uri, err := url.PathUnescape(d.URI); err == nil {
+			parts[path.Clean(uri)] = true
+		}
+	}
+	return parts
+}
+
+// htmlBlockTags are elements that start a new line of text
+var htmlBlockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Aside: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Table: true, atom.Tr: true, atom.Br: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Hr: true, atom.Header: true, atom.Footer: true,
+}
+
+// htmlLines returns the text of an XHTML content document, one line per paragraph, heading or
+// list item, and the heading lines among them
+func htmlLines(data []byte) (lines, headings []string, err error) {
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	var current strings.Builder
+	heading := false
+	flush := func() {
+		text := strings.TrimPrefix(strings.Join(strings.Fields(current.String()), " "), "| ")
+		if text != "" && strings.Trim(text, "-#| ") != "" {
+			lines = append(lines, text)
+			if heading {
+				headings = append(headings, text)
+			}
+		}
+		current.Reset()
+		heading = false
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			current.WriteString(n.Data)
+			return
+		case html.ElementNode:
+		case html.DocumentNode:
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+			return
+		default:
+			return
+		}
+
+		switch n.DataAtom {
+		case atom.Head, atom.Script, atom.Style, atom.Noscript, atom.Svg, atom.Math:
+			return
+		}
+		isBlock := htmlBlockTags[n.DataAtom]
+		if isBlock {
+			flush()
+		}
+		switch n.DataAtom {
+		case atom.Li:
+			current.WriteString("- ")
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			current.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+			heading = true
+		case atom.Td, atom.Th:
+			current.WriteString(" | ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if isBlock {
+			flush()
+		}
+	}
+	walk(doc)
+	flush()
+	return lines, headings, nil
+}
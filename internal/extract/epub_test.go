@@ -0,0 +1,44 @@
+package extract
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEPUBPages(t *testing.T) {
+	pages, err := EPUBPages(filepath.Join("testdata", "sample.epub"))
+	if err != nil {
+		t.Fatalf("EPUBPages: %v", err)
+	}
+	// The cover has no text and the footnotes aren't in the reading order, so neither is a chapter
+	checkPages(t, pages, []Page{
+		{
+			Label:    "Chapter 1",
+			Text:     "# Stars\nStars are balls of hot gas.\n- Red dwarfs\n- Giants",
+			Headings: []string{"# Stars"},
+		},
+		{
+			Label:    "Chapter 2",
+			Text:     "## Planets\nPlanets orbit stars.",
+			Headings: []string{"## Planets"},
+		},
+	})
+}
+
+func TestEPUBPagesInvalidArchive(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"not-a-document.zip", "EPUB file has no META-INF/container.xml"},
+		{"sample.pptx", "EPUB file has no META-INF/container.xml"},
+		{"compressed.pdf", "not a EPUB file"},
+	}
+	for _, tt := range tests {
+		_, err := EPUBPages(filepath.Join("testdata", tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("EPUBPages(%s) error = %v, want %q", tt.file, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Package extract pulls the text out of documents locally, so that large documents can be split
+// by their content before they are sent to a quiz generator.
+package extract
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// ErrEncrypted is returned for documents that can't be read without decrypting them
+	ErrEncrypted = errors.New("document is encrypted")
+	// ErrNoText is returned for documents without extractable text, e.g. scans
+	ErrNoText = errors.New("document has no extractable text")
+	// ErrUnsupportedFormat is returned for documents of a type that can't be extracted
+	ErrUnsupportedFormat = errors.New("unsupported document format")
+)
+
+// Pages extracts the text of the document at path by the format its extension names: PDF, DOCX, PPTX or EPUB
+func Pages(path string) ([]Page, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return PDFPages(path)
+	case ".docx":
+		return DOCXPages(path)
+	case ".pptx":
+		return PPTXPages(path)
+	case ".epub":
+		return EPUBPages(path)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, filepath.Ext(path))
+	}
+}
+
+// Page is the text of one page of a document, or of a slide, chapter or section of documents
+// without fixed pages
+type Page struct {
+	Number   int      // 1-based page or slide number, 0 for documents without numbered pages
+	Label    string   // What the page is called in the text sent to the generator, e.g. "Slide 3"; "Page N" if empty
+	Text     string   // Text of the page, one line per line of text
+	Headings []string // Lines of the page that look like section headings
+}
+
+// startsSection reports whether the page begins with a heading, which makes it a good place to start a chunk
+func (p Page) startsSection() bool {
+	if len(p.Headings) == 0 {
+		return false
+	}
+	for _, line := range strings.Split(p.Text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line == p.Headings[0]
+		}
+	}
+	return false
+}
+
+// EstimateTokens approximates the tokens of a text at 4 bytes per token
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,657 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// --- PDF Objects ---
+// The parser reads PDFs leniently: instead of trusting the cross-reference table, which is often
+// broken in real files, it scans the whole file for "N G obj" definitions. Later definitions replace
+// earlier ones, as incremental updates are appended to the file.
+
+type pdfName string
+type pdfString string
+type pdfKeyword string // Keywords, content stream operators and delimiters such as "<<" and "["
+type pdfArray []interface{}
+type pdfDict map[pdfName]interface{}
+
+type pdfRef struct {
+	num, gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte // Raw, still encoded data
+}
+
+// maxStreamBytes bounds the decoded size of one stream, so a small compressed stream can't expand into gigabytes
+const maxStreamBytes = 64 << 20
+
+// maxResolveDepth bounds chains of references, which may be circular in broken files
+const maxResolveDepth = 32
+
+// objectPattern finds the start of indirect object definitions
+var objectPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// pdfDocument holds the objects of a parsed PDF
+type pdfDocument struct {
+	objects map[int]interface{}
+	trailer pdfDict
+	fonts   map[pdfRef]*pdfFont // Fonts are shared between pages, so they are parsed once
+}
+
+// PDFPages extracts the text of each page of the PDF at path
+func PDFPages(path string) ([]Page, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return ParsePDF(data)
+}
+
+// ParsePDF extracts the text of each page of a PDF. Pages are returned in document order,
+// including pages without text. It returns ErrEncrypted for encrypted PDFs and ErrNoText
+// when no page has any text.
+func ParsePDF(data []byte) (pages []Page, err error) {
+	// Malformed files can trip up the parser in ways not worth checking for one by one
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	doc := loadPDF(data)
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+
+	pageDicts := doc.pages()
+	if len(pageDicts) == 0 {
+		return nil, errors.New("PDF has no pages")
+	}
+
+	var all [][]textLine
+	for _, page := range pageDicts {
+		all = append(all, doc.pageLines(page))
+	}
+	pages = linesToPages(all)
+	for _, page := range pages {
+		if page.Text != "" {
+			return pages, nil
+		}
+	}
+	return nil, ErrNoText
+}
+
+// loadPDF collects the objects and trailer of a PDF
+func loadPDF(data []byte) *pdfDocument {
+	doc := &pdfDocument{objects: make(map[int]interface{}), trailer: pdfDict{}, fonts: make(map[pdfRef]*pdfFont)}
+
+	end := 0
+	for _, match := range objectPattern.FindAllSubmatchIndex(data, -1) {
+		// Matches inside the data of a stream that was already read aren't objects
+		if match[0] < end {
+			continue
+		}
+		// The object number must not continue a longer number, e.g. "12 0 obj" inside "112 0 obj"
+		if match[0] > 0 && data[match[0]-1] >= '0' && data[match[0]-1] <= '9' {
+			continue
+		}
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+		lex := &lexer{data: data, pos: match[1]}
+		obj, ok := lex.readObject()
+		if !ok {
+			continue
+		}
+		if dict, isDict := obj.(pdfDict); isDict {
+			if stream, ok := readStreamData(lex, dict); ok {
+				obj = stream
+			}
+		}
+		doc.objects[num] = obj
+		end = lex.pos
+	}
+
+	doc.readTrailers(data)
+	doc.readObjectStreams()
+	return doc
+}
+
+// readStreamData reads the data of a stream whose dictionary was just read, if one follows
+func readStreamData(lex *lexer, dict pdfDict) (*pdfStream, bool) {
+	save := lex.pos
+	tok, ok := lex.next()
+	if !ok || tok != pdfKeyword("stream") {
+		lex.pos = save
+		return nil, false
+	}
+	// The keyword is followed by CRLF or LF, then the data
+	start := lex.pos
+	if start < len(lex.data) && lex.data[start] == '\r' {
+		start++
+	}
+	if start < len(lex.data) && lex.data[start] == '\n' {
+		start++
+	}
+
+	// Trust a direct /Length if "endstream" follows it, otherwise search for the keyword
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && start+int(length) <= len(lex.data) {
+		stop := start + int(length)
+		rest := bytes.TrimLeft(lex.data[stop:], " \t\r\n")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			lex.pos = len(lex.data) - len(rest) + len("endstream")
+			return &pdfStream{dict: dict, data: lex.data[start:stop]}, true
+		}
+	}
+	i := bytes.Index(lex.data[start:], []byte("endstream"))
+	if i < 0 {
+		lex.pos = len(lex.data)
+		return &pdfStream{dict: dict, data: lex.data[start:]}, true
+	}
+	streamData := bytes.TrimRight(lex.data[start:start+i], "\r\n")
+	lex.pos = start + i + len("endstream")
+	return &pdfStream{dict: dict, data: streamData}, true
+}
+
+// readTrailers merges the trailer dictionaries and cross-reference stream dictionaries of the file,
+// the last one (the newest revision) taking precedence
+func (d *pdfDocument) readTrailers(data []byte) {
+	var trailers []pdfDict
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		lex := &lexer{data: data, pos: i + j + len("trailer")}
+		if dict, ok := lex.readDict(); ok {
+			trailers = append(trailers, dict)
+		}
+		i += j + len("trailer")
+	}
+
+	// Cross-reference streams carry the trailer entries in their dictionary
+	var nums []int
+	for num, obj := range d.objects {
+		if stream, ok := obj.(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		trailers = append(trailers, d.objects[num].(*pdfStream).dict)
+	}
+
+	for _, trailer := range trailers {
+		for key, value := range trailer {
+			d.trailer[key] = value
+		}
+	}
+}
+
+// readObjectStreams adds the objects stored compressed in object streams (PDF 1.5 and later)
+func (d *pdfDocument) readObjectStreams() {
+	var streams []*pdfStream
+	for _, obj := range d.objects {
+		if stream, ok := obj.(*pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			streams = append(streams, stream)
+		}
+	}
+	for _, stream := range streams {
+		data, err := d.streamData(stream)
+		if err != nil {
+			continue
+		}
+		n, _ := stream.dict["N"].(float64)
+		first, _ := stream.dict["First"].(float64)
+		header := &lexer{data: data}
+		for i := 0; i < int(n); i++ {
+			numTok, ok1 := header.next()
+			offTok, ok2 := header.next()
+			num, isNum := numTok.(float64)
+			off, isOff := offTok.(float64)
+			if !ok1 || !ok2 || !isNum || !isOff {
+				break
+			}
+			// Objects defined directly in the file are newer than those in object streams
+			if _, exists := d.objects[int(num)]; exists {
+				continue
+			}
+			pos := int(first) + int(off)
+			if pos < 0 || pos >= len(data) {
+				continue
+			}
+			lex := &lexer{data: data, pos: pos}
+			if obj, ok := lex.readObject(); ok {
+				d.objects[int(num)] = obj
+			}
+		}
+	}
+}
+
+// resolve follows references until it reaches a direct object; missing objects resolve to nil
+func (d *pdfDocument) resolve(v interface{}) interface{} {
+	for i := 0; i < maxResolveDepth; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[ref.num]
+	}
+	return nil
+}
+
+// dict resolves v to a dictionary, the dictionary of a stream included; nil if it is neither
+func (d *pdfDocument) dict(v interface{}) pdfDict {
+	switch obj := d.resolve(v).(type) {
+	case pdfDict:
+		return obj
+	case *pdfStream:
+		return obj.dict
+	}
+	return nil
+}
+
+// number resolves v to a number, 0 if it isn't one
+func (d *pdfDocument) number(v interface{}) float64 {
+	n, _ := d.resolve(v).(float64)
+	return n
+}
+
+// array resolves v to an array, wrapping a single object in one
+func (d *pdfDocument) array(v interface{}) pdfArray {
+	switch obj := d.resolve(v).(type) {
+	case pdfArray:
+		return obj
+	case nil:
+		return nil
+	default:
+		return pdfArray{obj}
+	}
+}
+
+// streamData decodes the data of a stream. Only the filters used for text and fonts are supported.
+func (d *pdfDocument) streamData(stream *pdfStream) ([]byte, error) {
+	data := stream.data
+	for _, filter := range d.array(stream.dict["Filter"]) {
+		var err error
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflate(data)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = decodeASCIIHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data. Truncated streams are common, so what was read before an error is kept.
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inflate stream: %w", err)
+	}
+	defer r.Close()
+	// Read one byte more than the limit to tell a stream of exactly the limit from a larger one
+	out, err := io.ReadAll(io.LimitReader(r, maxStreamBytes+1))
+	if len(out) > maxStreamBytes {
+		return nil, fmt.Errorf("inflated stream is larger than %d bytes", maxStreamBytes)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("failed to inflate stream: %w", err)
+	}
+	return out, nil
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	if i := bytes.IndexByte(data, '>'); i >= 0 {
+		data = data[:i]
+	}
+	digits := bytes.Map(func(r rune) rune {
+		if isWhite(byte(r)) {
+			return -1
+		}
+		return r
+	}, data)
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode ASCII85 stream: %w", err)
+	}
+	return out[:n], nil
+}
+
+// pages returns the page dictionaries in document order, with inherited resources filled in.
+// Files with a broken page tree fall back to all page objects in object number order.
+func (d *pdfDocument) pages() []pdfDict {
+	var pages []pdfDict
+	visited := make(map[pdfRef]bool)
+
+	var walk func(node interface{}, resources interface{}, depth int)
+	walk = func(node interface{}, resources interface{}, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil || depth > maxResolveDepth {
+			return
+		}
+		if r, ok := dict["Resources"]; ok {
+			resources = r
+		}
+		if kids, ok := dict["Kids"]; ok && dict["Type"] != pdfName("Page") {
+			for _, kid := range d.array(kids) {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		page := pdfDict{}
+		for key, value := range dict {
+			page[key] = value
+		}
+		page["Resources"] = resources
+		pages = append(pages, page)
+	}
+
+	if catalog := d.dict(d.trailer["Root"]); catalog != nil {
+		walk(catalog["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	var nums []int
+	for num, obj := range d.objects {
+		if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			nums = append(nums, num)
+		}
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		pages = append(pages, d.objects[num].(pdfDict))
+	}
+	return pages
+}
+
+// --- Lexer ---
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhite(b byte) bool {
+	return b == 0 || b == '\t' || b == '\n' || b == '\f' || b == '\r' || b == ' '
+}
+
+func isDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips whitespace and comments
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if isWhite(b) {
+			l.pos++
+			continue
+		}
+		if b == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// next returns the next token: a float64, pdfName, pdfString or pdfKeyword. It returns false at the end of the data.
+func (l *lexer) next() (interface{}, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, false
+	}
+	b := l.data[l.pos]
+	switch {
+	case b == '/':
+		return l.readName(), true
+	case b == '(':
+		return l.readLiteralString(), true
+	case b == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), true
+		}
+		return l.readHexString(), true
+	case b == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>"), true
+		}
+		l.pos++
+		return pdfKeyword(">"), true
+	case b == '[' || b == ']' || b == '{' || b == '}' || b == ')':
+		l.pos++
+		return pdfKeyword(string(b)), true
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if n, err := strconv.ParseFloat(word, 64); err == nil && (word[0] == '-' || word[0] == '+' || word[0] == '.' || (word[0] >= '0' && word[0] <= '9')) {
+		return n, true
+	}
+	return pdfKeyword(word), true
+}
+
+func (l *lexer) readName() pdfName {
+	l.pos++ // Skip the slash
+	var name []byte
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		b := l.data[l.pos]
+		// #xx escapes a byte in hex
+		if b == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				name = append(name, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, b)
+		l.pos++
+	}
+	return pdfName(name)
+}
+
+func (l *lexer) readLiteralString() pdfString {
+	l.pos++ // Skip the opening parenthesis
+	var s []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(s)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return pdfString(s)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b = '\n'
+			case 'r':
+				b = '\r'
+			case 't':
+				b = '\t'
+			case 'b':
+				b = '\b'
+			case 'f':
+				b = '\f'
+			case '\r':
+				// A backslash at the end of a line continues the string on the next one
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = byte(v)
+				} else {
+					b = e // \( \) \\ and unknown escapes stand for the character itself
+				}
+			}
+		}
+		s = append(s, b)
+	}
+	return pdfString(s)
+}
+
+func (l *lexer) readHexString() pdfString {
+	l.pos++ // Skip the opening bracket
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		l.pos++
+	}
+	decoded, _ := decodeASCIIHex(l.data[start:l.pos])
+	l.pos++ // Skip the closing bracket
+	return pdfString(decoded)
+}
+
+// readObject reads a complete object: a dictionary, array, reference or single token.
+// It returns false at the end of the data.
+func (l *lexer) readObject() (interface{}, bool) {
+	tok, ok := l.next()
+	if !ok {
+		return nil, false
+	}
+	switch t := tok.(type) {
+	case pdfKeyword:
+		switch t {
+		case "<<":
+			return l.readDictBody(), true
+		case "[":
+			var arr pdfArray
+			for {
+				save := l.pos
+				item, ok := l.next()
+				if !ok || item == pdfKeyword("]") {
+					return arr, true
+				}
+				l.pos = save
+				obj, ok := l.readObject()
+				if !ok {
+					return arr, true
+				}
+				arr = append(arr, obj)
+			}
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		case "null":
+			return nil, true
+		}
+		return t, true
+	case float64:
+		// Two integers followed by R are a reference
+		if t == float64(int(t)) && t >= 0 {
+			save := l.pos
+			gen, ok1 := l.next()
+			r, ok2 := l.next()
+			if g, isNum := gen.(float64); ok1 && ok2 && isNum && g == float64(int(g)) && r == pdfKeyword("R") {
+				return pdfRef{num: int(t), gen: int(g)}, true
+			}
+			l.pos = save
+		}
+		return t, true
+	}
+	return tok, true
+}
+
+// readDict reads a dictionary starting at the next token
+func (l *lexer) readDict() (pdfDict, bool) {
+	tok, ok := l.next()
+	if !ok || tok != pdfKeyword("<<") {
+		return nil, false
+	}
+	return l.readDictBody(), true
+}
+
+// readDictBody reads the entries of a dictionary whose opening "<<" was already read
+func (l *lexer) readDictBody() pdfDict {
+	dict := pdfDict{}
+	for {
+		key, ok := l.next()
+		if !ok || key == pdfKeyword(">>") {
+			return dict
+		}
+		name, isName := key.(pdfName)
+		if !isName {
+			continue // Skip garbage instead of giving up on the dictionary
+		}
+		value, ok := l.readObject()
+		if !ok {
+			return dict
+		}
+		if value == pdfKeyword(">>") {
+			return dict
+		}
+		dict[name] = value
+	}
+}
@@ -0,0 +1,77 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPDFPagesCompressedStreams(t *testing.T) {
+	pages, err := PDFPages(filepath.Join("testdata", "compressed.pdf"))
+	if err != nil {
+		t.Fatalf("PDFPages: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+	want := []Page{
+		{Number: 1, Text: "Chapter 1 Photosynthesis\nPlants turn light into chemical energy.", Headings: []string{"Chapter 1 Photosynthesis"}},
+		{Number: 2, Text: "Chlorophyll absorbs red and blue light."},
+	}
+	for i, page := range pages {
+		if page.Number != want[i].Number || page.Text != want[i].Text {
+			t.Errorf("page %d = %d %q, want %d %q", i, page.Number, page.Text, want[i].Number, want[i].Text)
+		}
+		if strings.Join(page.Headings, "|") != strings.Join(want[i].Headings, "|") {
+			t.Errorf("page %d headings = %q, want %q", i, page.Headings, want[i].Headings)
+		}
+	}
+}
+
+func TestPDFPagesTruncatedStream(t *testing.T) {
+	pages, err := PDFPages(filepath.Join("testdata", "truncated.pdf"))
+	if err != nil {
+		t.Fatalf("PDFPages: %v", err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+	// The text before the cut is kept, the rest is gone
+	if want := "The mitochondria is the powerhouse of the cell."; pages[0].Text != want {
+		t.Errorf("text = %q, want %q", pages[0].Text, want)
+	}
+}
+
+func TestPDFPagesXRefStream(t *testing.T) {
+	pages, err := PDFPages(filepath.Join("testdata", "xref-stream.pdf"))
+	if err != nil {
+		t.Fatalf("PDFPages: %v", err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+	if want := "Tectonic plates float on the mantle."; pages[0].Text != want {
+		t.Errorf("text = %q, want %q", pages[0].Text, want)
+	}
+}
+
+func TestPDFPagesScanned(t *testing.T) {
+	_, err := PDFPages(filepath.Join("testdata", "scanned.pdf"))
+	if !errors.Is(err, ErrNoText) {
+		t.Errorf("err = %v, want ErrNoText", err)
+	}
+}
+
+func TestInflateLimit(t *testing.T) {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(make([]byte, maxStreamBytes+1))
+	w.Close()
+
+	if _, err := inflate(compressed.Bytes()); err == nil {
+		t.Error("inflate accepted a stream larger than maxStreamBytes")
+	}
+}
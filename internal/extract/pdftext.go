@@ -0,0 +1,718 @@
+package extract
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// --- Text Extraction ---
+// Page content streams are interpreted just far enough to know which text is shown where:
+// text operators, the text and transformation matrices, fonts and form XObjects. Glyph widths
+// are used to tell word gaps from kerning, and the vertical position to break lines.
+
+// maxFormDepth bounds nested form XObjects
+const maxFormDepth = 8
+
+// textLine is a line of text on a page and the largest font size on it
+type textLine struct {
+	text string
+	size float64
+}
+
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m × n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// graphicsState is the part of the PDF graphics state that affects where text goes
+type graphicsState struct {
+	ctm         matrix
+	font        *pdfFont
+	size        float64
+	charSpacing float64
+	wordSpacing float64
+	scale       float64 // Horizontal scaling as a fraction
+	leading     float64
+}
+
+// textWriter assembles shown text into lines
+type textWriter struct {
+	lines   []textLine
+	current strings.Builder
+	size    float64
+	lastX   float64 // Device position where the last shown text ended
+	lastY   float64
+	started bool
+}
+
+// show adds text that starts at (x, y) and ends at endX, in the given font size
+func (w *textWriter) show(text string, x, y, endX, size float64) {
+	if text == "" {
+		return
+	}
+	if w.started {
+		tolerance := math.Max(size, w.size) * 0.5
+		switch {
+		case math.Abs(y-w.lastY) > tolerance:
+			w.newLine()
+		case x-w.lastX > size*0.15 || x < w.lastX-size:
+			// A gap wider than kerning, or text placed back before the previous text, separates words
+			if !strings.HasSuffix(w.current.String(), " ") && !strings.HasPrefix(text, " ") {
+				w.current.WriteByte(' ')
+			}
+		}
+	}
+	w.current.WriteString(text)
+	w.size = math.Max(w.size, size)
+	w.lastX, w.lastY, w.started = endX, y, true
+}
+
+func (w *textWriter) newLine() {
+	if text := strings.Join(strings.Fields(w.current.String()), " "); text != "" {
+		w.lines = append(w.lines, textLine{text: text, size: w.size})
+	}
+	w.current.Reset()
+	w.size = 0
+}
+
+// pageLines extracts the lines of text of a page
+func (d *pdfDocument) pageLines(page pdfDict) []textLine {
+	var content bytes.Buffer
+	for _, part := range d.array(page["Contents"]) {
+		stream, ok := d.resolve(part).(*pdfStream)
+		if !ok {
+			continue
+		}
+		data, err := d.streamData(stream)
+		if err != nil {
+			continue
+		}
+		content.Write(data)
+		content.WriteByte('\n')
+	}
+
+	w := &textWriter{}
+	state := graphicsState{ctm: identity, scale: 1}
+	d.runContent(content.Bytes(), d.dict(page["Resources"]), &state, w, 0)
+	w.newLine()
+	return w.lines
+}
+
+// runContent interprets a content stream, writing the text it shows to w
+func (d *pdfDocument) runContent(content []byte, resources pdfDict, state *graphicsState, w *textWriter, depth int) {
+	fonts := d.dict(resources["Font"])
+	xobjects := d.dict(resources["XObject"])
+
+	var stack []graphicsState
+	var operands []interface{}
+	tm, tlm := identity, identity
+
+	num := func(i int) float64 {
+		if i < len(operands) {
+			n, _ := operands[i].(float64)
+			return n
+		}
+		return 0
+	}
+	moveLine := func(tx, ty float64) {
+		tlm = matrix{1, 0, 0, 1, tx, ty}.mul(tlm)
+		tm = tlm
+	}
+	showString := func(s pdfString) {
+		if state.font == nil {
+			return
+		}
+		start := tm.mul(state.ctm)
+		size := state.size * math.Hypot(start[2], start[3])
+		var text strings.Builder
+		for _, code := range state.font.codes(string(s)) {
+			text.WriteString(state.font.decode(code))
+			advance := state.font.width(code)*state.size + state.charSpacing
+			if len(code) == 1 && code[0] == ' ' {
+				advance += state.wordSpacing
+			}
+			tm = matrix{1, 0, 0, 1, advance * state.scale, 0}.mul(tm)
+		}
+		end := tm.mul(state.ctm)
+		w.show(text.String(), start[4], start[5], end[4], size)
+	}
+
+	lex := &lexer{data: content}
+	for {
+		obj, ok := lex.readObject()
+		if !ok {
+			return
+		}
+		op, isOp := obj.(pdfKeyword)
+		if !isOp {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, *state)
+		case "Q":
+			if len(stack) > 0 {
+				*state = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			state.ctm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}.mul(state.ctm)
+		case "BT":
+			tm, tlm = identity, identity
+		case "ET":
+		case "Tf":
+			if len(operands) < 2 {
+				break
+			}
+			if name, ok := operands[0].(pdfName); ok {
+				state.font = d.font(fonts[name])
+				state.size = num(1)
+			}
+		case "Tc":
+			state.charSpacing = num(0)
+		case "Tw":
+			state.wordSpacing = num(0)
+		case "Tz":
+			state.scale = num(0) / 100
+		case "TL":
+			state.leading = num(0)
+		case "Td":
+			moveLine(num(0), num(1))
+		case "TD":
+			state.leading = -num(1)
+			moveLine(num(0), num(1))
+		case "Tm":
+			tlm = matrix{num(0), num(1), num(2), num(3), num(4), num(5)}
+			tm = tlm
+		case "T*":
+			moveLine(0, -state.leading)
+		case "Tj":
+			if len(operands) > 0 {
+				if s, ok := operands[0].(pdfString); ok {
+					showString(s)
+				}
+			}
+		case "'", "\"":
+			if op == "\"" && len(operands) == 3 {
+				state.wordSpacing, state.charSpacing = num(0), num(1)
+			}
+			moveLine(0, -state.leading)
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					showString(s)
+				}
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			items, _ := operands[0].(pdfArray)
+			for _, item := range items {
+				switch v := item.(type) {
+				case pdfString:
+					showString(v)
+				case float64:
+					// Adjustments are in thousandths of the font size, negative ones move right
+					tx := -v / 1000 * state.size * state.scale
+					tm = matrix{1, 0, 0, 1, tx, 0}.mul(tm)
+				}
+			}
+		case "Do":
+			if len(operands) == 0 || depth >= maxFormDepth {
+				break
+			}
+			name, _ := operands[0].(pdfName)
+			form, ok := d.resolve(xobjects[name]).(*pdfStream)
+			if !ok || form.dict["Subtype"] != pdfName("Form") {
+				break
+			}
+			data, err := d.streamData(form)
+			if err != nil {
+				break
+			}
+			formResources := d.dict(form.dict["Resources"])
+			if formResources == nil {
+				formResources = resources
+			}
+			formState := *state
+			if m := d.array(form.dict["Matrix"]); len(m) == 6 {
+				formState.ctm = matrix{d.number(m[0]), d.number(m[1]), d.number(m[2]), d.number(m[3]), d.number(m[4]), d.number(m[5])}.mul(state.ctm)
+			}
+			d.runContent(data, formResources, &formState, w, depth+1)
+		case "BI":
+			skipInlineImage(lex)
+		}
+		operands = operands[:0]
+	}
+}
+
+// skipInlineImage skips the data of an inline image, which isn't made of tokens
+func skipInlineImage(lex *lexer) {
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return
+		}
+		if tok == pdfKeyword("ID") {
+			break
+		}
+	}
+	// The data ends at an EI surrounded by whitespace
+	for i := lex.pos + 1; i+2 <= len(lex.data); i++ {
+		if lex.data[i] == 'E' && lex.data[i+1] == 'I' && isWhite(lex.data[i-1]) && (i+2 == len(lex.data) || isWhite(lex.data[i+2])) {
+			lex.pos = i + 2
+			return
+		}
+	}
+	lex.pos = len(lex.data)
+}
+
+// --- Fonts ---
+
+// pdfFont maps the character codes of a font to text and glyph widths
+type pdfFont struct {
+	toUnicode *cmap      // From the font's ToUnicode CMap, nil if it has none
+	encoding  *[256]rune // Simple fonts without ToUnicode
+	composite bool       // Type0 fonts use two byte codes unless their CMap says otherwise
+	widths    map[int]float64
+	defWidth  float64 // Width of codes missing from widths, in text space units
+	scale     float64 // Glyph space to text space, 0.001 for all but Type3 fonts
+}
+
+// font returns the parsed font of a font resource
+func (d *pdfDocument) font(v interface{}) *pdfFont {
+	ref, isRef := v.(pdfRef)
+	if isRef {
+		if f, ok := d.fonts[ref]; ok {
+			return f
+		}
+	}
+	f := d.parseFont(d.dict(v))
+	if isRef {
+		d.fonts[ref] = f
+	}
+	return f
+}
+
+func (d *pdfDocument) parseFont(dict pdfDict) *pdfFont {
+	f := &pdfFont{widths: make(map[int]float64), scale: 0.001}
+	if dict == nil {
+		f.encoding = &standardEncoding
+		return f
+	}
+	if m := d.array(dict["FontMatrix"]); len(m) == 6 {
+		f.scale = d.number(m[0])
+	}
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.streamData(stream); err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+
+	if dict["Subtype"] == pdfName("Type0") {
+		f.composite = true
+		f.defWidth = 1000
+		descendants := d.array(dict["DescendantFonts"])
+		if len(descendants) > 0 {
+			cid := d.dict(descendants[0])
+			if dw, ok := d.resolve(cid["DW"]).(float64); ok {
+				f.defWidth = dw
+			}
+			d.readCIDWidths(f, d.array(cid["W"]))
+		}
+		return f
+	}
+
+	first := int(d.number(dict["FirstChar"]))
+	for i, w := range d.array(dict["Widths"]) {
+		f.widths[first+i] = d.number(w)
+	}
+	if descriptor := d.dict(dict["FontDescriptor"]); descriptor != nil {
+		f.defWidth = d.number(descriptor["MissingWidth"])
+	}
+	if f.defWidth == 0 {
+		f.defWidth = 500 // A typical average, for fonts that give no widths at all
+	}
+	if f.toUnicode == nil {
+		f.encoding = d.simpleEncoding(dict["Encoding"])
+	}
+	return f
+}
+
+// readCIDWidths reads the W array of a CID font: "c [w1 w2 ...]" and "cFirst cLast w" entries
+func (d *pdfDocument) readCIDWidths(f *pdfFont, w pdfArray) {
+	for i := 0; i < len(w); {
+		start := int(d.number(w[i]))
+		if i+1 < len(w) {
+			if list, ok := d.resolve(w[i+1]).(pdfArray); ok {
+				for j, width := range list {
+					f.widths[start+j] = d.number(width)
+				}
+				i += 2
+				continue
+			}
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		end, width := int(d.number(w[i+1])), d.number(w[i+2])
+		for c := start; c <= end && c-start < 0x10000; c++ {
+			f.widths[c] = width
+		}
+		i += 3
+	}
+}
+
+// simpleEncoding builds the code to character table of a simple font
+func (d *pdfDocument) simpleEncoding(v interface{}) *[256]rune {
+	table := standardEncoding
+	switch enc := d.resolve(v).(type) {
+	case pdfName:
+		table = *namedEncoding(enc)
+	case pdfDict:
+		table = *namedEncoding(d.resolve(enc["BaseEncoding"]))
+		code := 0
+		for _, item := range d.array(enc["Differences"]) {
+			switch v := d.resolve(item).(type) {
+			case float64:
+				code = int(v)
+			case pdfName:
+				if code >= 0 && code < 256 {
+					if r, ok := glyphRune(string(v)); ok {
+						table[code] = r
+					}
+				}
+				code++
+			}
+		}
+	}
+	return &table
+}
+
+func namedEncoding(v interface{}) *[256]rune {
+	switch v {
+	case pdfName("WinAnsiEncoding"):
+		return &winAnsiEncoding
+	case pdfName("MacRomanEncoding"):
+		return &macRomanEncoding
+	}
+	return &standardEncoding
+}
+
+// codes splits shown bytes into character codes
+func (f *pdfFont) codes(s string) []string {
+	if f.toUnicode != nil && len(f.toUnicode.spaces) > 0 {
+		return f.toUnicode.split(s)
+	}
+	size := 1
+	if f.composite {
+		size = 2
+	}
+	var codes []string
+	for i := 0; i < len(s); i += size {
+		end := i + size
+		if end > len(s) {
+			end = len(s)
+		}
+		codes = append(codes, s[i:end])
+	}
+	return codes
+}
+
+// decode returns the text of a character code
+func (f *pdfFont) decode(code string) string {
+	if f.toUnicode != nil {
+		if text, ok := f.toUnicode.lookup(code); ok {
+			return text
+		}
+	}
+	if f.encoding != nil && len(code) == 1 {
+		if r := f.encoding[code[0]]; r != 0 {
+			return string(r)
+		}
+	}
+	// Composite fonts without a ToUnicode map give glyph IDs, which say nothing about the text
+	return ""
+}
+
+// width returns the advance of a character code in text space units per unit of font size
+func (f *pdfFont) width(code string) float64 {
+	c := 0
+	for i := 0; i < len(code); i++ {
+		c = c<<8 | int(code[i])
+	}
+	if w, ok := f.widths[c]; ok && w > 0 {
+		return w * f.scale
+	}
+	return f.defWidth * f.scale
+}
+
+// --- CMaps ---
+
+// cmap is a parsed ToUnicode CMap
+type cmap struct {
+	spaces []codeSpace
+	chars  map[string]string
+	ranges []cmapRange
+}
+
+type codeSpace struct {
+	lo, hi []byte
+}
+
+type cmapRange struct {
+	lo, hi []byte
+	base   []rune   // Unicode of lo; the following codes increment its last character
+	dsts   []string // Or the Unicode of each code of the range
+}
+
+func parseCMap(data []byte) *cmap {
+	m := &cmap{chars: make(map[string]string)}
+	lex := &lexer{data: data}
+	var operands []interface{}
+	for {
+		obj, ok := lex.readObject()
+		if !ok {
+			return m
+		}
+		op, isOp := obj.(pdfKeyword)
+		if !isOp {
+			operands = append(operands, obj)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					m.spaces = append(m.spaces, codeSpace{lo: []byte(lo), hi: []byte(hi)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m.chars[string(src)] = utf16Text(string(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) {
+					continue
+				}
+				r := cmapRange{lo: []byte(lo), hi: []byte(hi)}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					r.base = []rune(utf16Text(string(dst)))
+				case pdfArray:
+					for _, item := range dst {
+						s, _ := item.(pdfString)
+						r.dsts = append(r.dsts, utf16Text(string(s)))
+					}
+				}
+				m.ranges = append(m.ranges, r)
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// split splits shown bytes into codes using the code space ranges
+func (m *cmap) split(s string) []string {
+	var codes []string
+	for i := 0; i < len(s); {
+		n := 0
+		for _, space := range m.spaces {
+			size := len(space.lo)
+			if i+size > len(s) {
+				continue
+			}
+			if inRange([]byte(s[i:i+size]), space.lo, space.hi) {
+				n = size
+				break
+			}
+		}
+		if n == 0 {
+			n = len(m.spaces[0].lo) // Not in any code space, take the size of the first one
+			if i+n > len(s) {
+				n = len(s) - i
+			}
+		}
+		codes = append(codes, s[i:i+n])
+		i += n
+	}
+	return codes
+}
+
+func (m *cmap) lookup(code string) (string, bool) {
+	if text, ok := m.chars[code]; ok {
+		return text, true
+	}
+	for _, r := range m.ranges {
+		if len(r.lo) != len(code) || !inRange([]byte(code), r.lo, r.hi) {
+			continue
+		}
+		offset := codeValue([]byte(code)) - codeValue(r.lo)
+		if r.dsts != nil {
+			if offset < len(r.dsts) {
+				return r.dsts[offset], true
+			}
+			return "", false
+		}
+		if len(r.base) == 0 {
+			return "", false
+		}
+		runes := append([]rune(nil), r.base...)
+		runes[len(runes)-1] += rune(offset)
+		return string(runes), true
+	}
+	return "", false
+}
+
+// inRange reports whether code lies within lo and hi, byte by byte as CMaps define ranges
+func inRange(code, lo, hi []byte) bool {
+	for i := range code {
+		if code[i] < lo[i] || code[i] > hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func codeValue(code []byte) int {
+	v := 0
+	for _, b := range code {
+		v = v<<8 | int(b)
+	}
+	return v
+}
+
+// utf16Text decodes the UTF-16BE destination strings of CMaps
+func utf16Text(s string) string {
+	if len(s) == 1 {
+		return s
+	}
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// --- Pages and Headings ---
+
+// headingPattern matches lines that name a section whatever their font size
+var headingPattern = regexp.MustCompile(`(?i)^(chapter|section|part|unit|lesson|module|appendix)\s+([0-9]+|[ivxlc]+|[a-z])\b`)
+
+// linesToPages joins the lines of each page into its text and finds the headings. A line is a
+// heading when it is short and set noticeably larger than the body text of the document, or when
+// it names a chapter or section. Running headers and footers, which repeat on many pages, are not.
+func linesToPages(all [][]textLine) []Page {
+	body := bodySize(all)
+	repeated := repeatedLines(all)
+	pages := make([]Page, len(all))
+	for i, lines := range all {
+		page := Page{Number: i + 1}
+		var text []string
+		for _, line := range lines {
+			text = append(text, line.text)
+			if isHeading(line, body) && !repeated[withoutDigits(line.text)] {
+				page.Headings = append(page.Headings, line.text)
+			}
+		}
+		page.Text = strings.Join(text, "\n")
+		pages[i] = page
+	}
+	return pages
+}
+
+// repeatedLines returns the lines (without their digits, so page numbers don't count)
+// found on more than minRepeats pages
+func repeatedLines(all [][]textLine) map[string]bool {
+	const minRepeats = 2
+	pagesWith := make(map[string]int)
+	for _, lines := range all {
+		seen := make(map[string]bool)
+		for _, line := range lines {
+			key := withoutDigits(line.text)
+			if !seen[key] {
+				seen[key] = true
+				pagesWith[key]++
+			}
+		}
+	}
+	repeated := make(map[string]bool)
+	for key, n := range pagesWith {
+		if n > minRepeats {
+			repeated[key] = true
+		}
+	}
+	return repeated
+}
+
+func withoutDigits(s string) string {
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return -1
+		}
+		return r
+	}, s))
+}
+
+// bodySize is the font size most of the text of a document is set in
+func bodySize(all [][]textLine) float64 {
+	chars := make(map[float64]int)
+	for _, lines := range all {
+		for _, line := range lines {
+			chars[math.Round(line.size*2)/2] += len(line.text)
+		}
+	}
+	var sizes []float64
+	for size := range chars {
+		sizes = append(sizes, size)
+	}
+	sort.Float64s(sizes)
+	body, most := 0.0, 0
+	for _, size := range sizes {
+		if chars[size] > most {
+			body, most = size, chars[size]
+		}
+	}
+	return body
+}
+
+func isHeading(line textLine, body float64) bool {
+	text := line.text
+	if len(text) < 3 || len(text) > 100 || len(strings.Fields(text)) > 15 {
+		return false
+	}
+	if !strings.ContainsFunc(text, unicode.IsLetter) {
+		return false
+	}
+	if headingPattern.MatchString(text) {
+		return true
+	}
+	return body > 0 && line.size >= body*1.2 && !strings.HasSuffix(text, ".")
+}
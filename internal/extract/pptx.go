@@ -0,0 +1,235 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// drawingNS is the namespace of DrawingML, which holds the text of shapes in PPTX slides
+const drawingNS = "http://schemas.openxmlformats.org/drawingml/2006/main"
+
+// notesSlideType is the relationship type from a slide to its speaker notes
+const notesSlideType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide"
+
+// skippedPlaceholders are placeholders that repeat on every slide instead of holding its content
+var skippedPlaceholders = map[string]bool{"sldNum": true, "dt": true, "ftr": true, "hdr": true, "sldImg": true}
+
+// PPTXPages extracts the text of the PPTX presentation at path
+func PPTXPages(path string) ([]Page, error) {
+	doc, err := readZipDocument(path, "PPTX")
+	if err != nil {
+		return nil, err
+	}
+	return parsePPTX(doc)
+}
+
+// ParsePPTX extracts the text of each slide of a PPTX presentation. Each returned page is a
+// slide, numbered in presentation order and labelled "Slide N". The slide's title is its first
+// line, marked like "# Title", followed by one line per paragraph of its other shapes and by
+// its speaker notes. Hidden slides are left out but keep their number.
+// It returns ErrNoText when no slide has any text.
+func ParsePPTX(data []byte) ([]Page, error) {
+	doc, err := openZipDocument(data, "PPTX")
+	if err != nil {
+		return nil, err
+	}
+	return parsePPTX(doc)
+}
+
+// parsePPTX extracts the text of the slides listed in the presentation part
+func parsePPTX(doc *zipDocument) ([]Page, error) {
+	if doc.has("EncryptionInfo") {
+		return nil, ErrEncrypted
+	}
+	slides, err := pptxSlides(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []Page
+	for i, slide := range slides {
+		data, err := doc.read(slide)
+		if err != nil {
+			return nil, err
+		}
+		content, err := readSlide(data, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse slide %d: %w", i+1, err)
+		}
+		if content.hidden {
+			continue
+		}
+
+		page := Page{Number: i + 1, Label: fmt.Sprintf("Slide %d", i+1)}
+		var lines []string
+		if content.title != "" {
+			title := headingLine(1, content.title)
+			lines = append(lines, title)
+			page.Headings = []string{title}
+		}
+		lines = append(lines, content.lines...)
+		// Speaker notes often explain what the slide only lists
+		if notes := slideNotes(doc, slide); notes != "" {
+			lines = append(lines, "Notes: "+notes)
+		}
+		page.Text = strings.Join(lines, "\n")
+		pages = append(pages, page)
+	}
+	for _, page := range pages {
+		if page.Text != "" {
+			return pages, nil
+		}
+	}
+	return nil, ErrNoText
+}
+
+// pptxSlides returns the parts of the slides in presentation order
+func pptxSlides(doc *zipDocument) ([]string, error) {
+	const presentation = "ppt/presentation.xml"
+	data, err := doc.read(presentation)
+	if err != nil {
+		return nil, err
+	}
+	rels, err := doc.relationships(presentation)
+	if err != nil {
+		return nil, err
+	}
+
+	var slides []string
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", presentation, err)
+		}
+		if t, ok := token.(xml.StartElement); ok && t.Name.Local == "sldId" {
+			for _, a := range t.Attr {
+				if a.Name.Space == relationshipsNS && a.Name.Local == "id" {
+					if rel, ok := rels[a.Value]; ok {
+						slides = append(slides, rel.Target)
+					}
+				}
+			}
+		}
+	}
+	if len(slides) == 0 {
+		return nil, errors.New("presentation has no slides")
+	}
+	return slides, nil
+}
+
+// slideNotes returns the speaker notes of a slide on one line, empty if it has none
+func slideNotes(doc *zipDocument, slide string) string {
+	rels, err := doc.relationships(slide)
+	if err != nil {
+		return "" // Slides without notes or other links have no relationships part
+	}
+	for _, rel := range rels {
+		if rel.Type != notesSlideType {
+			continue
+		}
+		data, err := doc.read(rel.Target)
+		if err != nil {
+			return ""
+		}
+		content, err := readSlide(data, true)
+		if err != nil {
+			return ""
+		}
+		return strings.Join(content.lines, " ")
+	}
+	return ""
+}
+
+// slideContent is the text of a slide or notes page
+type slideContent struct {
+	title  string
+	lines  []string // Paragraphs of the other shapes
+	hidden bool
+}
+
+// readSlide reads the text of the shapes of a slide. Notes pages also show a picture of their slide
+// and the slide number, so only their body placeholder, which holds the notes, is read.
+func readSlide(data []byte, notes bool) (slideContent, error) {
+	var content slideContent
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var paragraph strings.Builder
+	var shape []string // Paragraphs of the current shape
+	title, skipped := false, false
+	inText := false
+
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return content, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Space == markupCompatibilityNS && t.Name.Local == "Fallback" {
+				if err := dec.Skip(); err != nil {
+					return content, err
+				}
+				continue
+			}
+			switch t.Name.Local {
+			case "sld":
+				content.hidden = xmlAttr(t, "show") == "0"
+			case "sp", "graphicFrame":
+				shape, title, skipped = nil, false, false
+			case "ph":
+				kind := xmlAttr(t, "type")
+				title = kind == "title" || kind == "ctrTitle"
+				skipped = skippedPlaceholders[kind] || (notes && kind != "body")
+			case "p":
+				if t.Name.Space == drawingNS {
+					paragraph.Reset()
+				}
+			case "t":
+				inText = t.Name.Space == drawingNS
+			case "br":
+				if t.Name.Space == drawingNS {
+					paragraph.WriteByte('\n')
+				}
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if t.Name.Space != drawingNS {
+					continue
+				}
+				if text := cleanLines(paragraph.String()); text != "" {
+					shape = append(shape, strings.ReplaceAll(text, "\n", " "))
+				}
+			case "sp", "graphicFrame":
+				switch {
+				case skipped || len(shape) == 0:
+				case title && content.title == "":
+					content.title = strings.Join(shape, " ")
+				default:
+					content.lines = append(content.lines, shape...)
+				}
+				shape = nil
+			}
+
+		case xml.CharData:
+			if inText {
+				paragraph.Write(t)
+			}
+		}
+	}
+	return content, nil
+}
@@ -0,0 +1,47 @@
+package extract
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPPTXPages(t *testing.T) {
+	pages, err := PPTXPages(filepath.Join("testdata", "sample.pptx"))
+	if err != nil {
+		t.Fatalf("PPTXPages: %v", err)
+	}
+	// Slides are numbered in presentation order; the hidden second slide keeps its number,
+	// and slide number placeholders are left out
+	checkPages(t, pages, []Page{
+		{
+			Number:   1,
+			Label:    "Slide 1",
+			Text:     "# The Water Cycle\nEvaporation\nCondensation",
+			Headings: []string{"# The Water Cycle"},
+		},
+		{
+			Number:   3,
+			Label:    "Slide 3",
+			Text:     "# Precipitation\nRain, snow and hail\nNotes: Mention that hail forms in thunderstorms.",
+			Headings: []string{"# Precipitation"},
+		},
+	})
+}
+
+func TestPPTXPagesInvalidArchive(t *testing.T) {
+	tests := []struct {
+		file string
+		err  string
+	}{
+		{"not-a-document.zip", "PPTX file has no ppt/presentation.xml"},
+		{"sample.docx", "PPTX file has no ppt/presentation.xml"},
+		{"compressed.pdf", "not a PPTX file"},
+	}
+	for _, tt := range tests {
+		_, err := PPTXPages(filepath.Join("testdata", tt.file))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("PPTXPages(%s) error = %v, want %q", tt.file, err, tt.err)
+		}
+	}
+}
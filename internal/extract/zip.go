@@ -0,0 +1,165 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// --- ZIP-based Documents ---
+// DOCX, PPTX and EPUB files are ZIP archives of XML (or XHTML) parts. The helpers below read the
+// parts and the relationships between them; the formats themselves are in docx.go, pptx.go and epub.go.
+
+// maxPartBytes bounds the uncompressed size of one part, so a small archive can't expand into gigabytes
+const maxPartBytes = 64 << 20
+
+// relationshipsNS is the namespace of relationship IDs in Office Open XML parts
+const relationshipsNS = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+// zipDocument is an opened ZIP-based document
+type zipDocument struct {
+	format string // Name of the format for errors, e.g. "DOCX"
+	files  map[string]*zip.File
+}
+
+// readZipDocument reads the ZIP-based document at path
+func readZipDocument(filePath, format string) (*zipDocument, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	return openZipDocument(data, format)
+}
+
+// openZipDocument opens a ZIP-based document held in memory
+func openZipDocument(data []byte, format string) (*zipDocument, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a %s file: %w", format, err)
+	}
+	doc := &zipDocument{format: format, files: make(map[string]*zip.File)}
+	for _, f := range zr.File {
+		doc.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	return doc, nil
+}
+
+// has reports whether the document has a part
+func (d *zipDocument) has(name string) bool {
+	return d.file(name) != nil
+}
+
+// file returns a part by name; names are matched without regard to case if there's no exact match,
+// as some tools write them inconsistently
+func (d *zipDocument) file(name string) *zip.File {
+	if f, ok := d.files[name]; ok {
+		return f
+	}
+	for n, f := range d.files {
+		if strings.EqualFold(n, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// read returns the uncompressed content of a part
+func (d *zipDocument) read(name string) ([]byte, error) {
+	f := d.file(name)
+	if f == nil {
+		return nil, fmt.Errorf("%s file has no %s", d.format, name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in %s file: %w", name, d.format, err)
+	}
+	defer r.Close()
+	// Read one byte more than the limit to tell a part of exactly the limit from a larger one
+	data, err := io.ReadAll(io.LimitReader(r, maxPartBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s in %s file: %w", name, d.format, err)
+	}
+	if len(data) > maxPartBytes {
+		return nil, fmt.Errorf("%s in %s file is larger than %d bytes", name, d.format, maxPartBytes)
+	}
+	return data, nil
+}
+
+// relationship links a part to another, e.g. a presentation to its slides
+type relationship struct {
+	Type   string
+	Target string // Name of the target part
+}
+
+// relationships returns the relationships of a part by ID, read from the _rels/<part>.rels file next to it
+func (d *zipDocument) relationships(part string) (map[string]relationship, error) {
+	relsPath := path.Join(path.Dir(part), "_rels", path.Base(part)+".rels")
+	data, err := d.read(relsPath)
+	if err != nil {
+		return nil, err
+	}
+	var rels struct {
+		Relationships []struct {
+			ID         string `xml:"Id,attr"`
+			Type       string `xml:"Type,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &rels); err != nil {
+		return nil, fmt.Errorf("failed to parse %s in %s file: %w", relsPath, d.format, err)
+	}
+	result := make(map[string]relationship)
+	for _, rel := range rels.Relationships {
+		if rel.TargetMode == "External" {
+			continue // Links to web pages and other files
+		}
+		result[rel.ID] = relationship{Type: rel.Type, Target: resolvePart(part, rel.Target)}
+	}
+	return result, nil
+}
+
+// resolvePart resolves a reference from one part to another: relative to the referring part's
+// folder, or to the root of the archive if it starts with a slash
+func resolvePart(from, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return path.Clean(strings.TrimPrefix(target, "/"))
+	}
+	return path.Join(path.Dir(from), target)
+}
+
+// xmlAttr returns the value of an attribute by its local name, whatever its namespace
+func xmlAttr(e xml.StartElement, local string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// cleanLines collapses the whitespace within each line of a text and drops empty lines
+func cleanLines(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// headingLine marks a heading in extracted text the way Markdown does, e.g. "## Results"
+func headingLine(level int, text string) string {
+	if level < 1 {
+		level = 1
+	} else if level > 6 {
+		level = 6
+	}
+	return strings.Repeat("#", level) + " " + text
+}
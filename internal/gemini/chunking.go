@@ -0,0 +1,132 @@
+package gemini
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"quizbuilderai/internal/extract"
+	"quizbuilderai/internal/models"
+)
+
+// MaxChunkTokens is the text budget of one generation call when a document is split by its content.
+// Smaller chunks spread the questions over the whole document instead of its first pages.
+const MaxChunkTokens = 24000
+
+// minCharsPerPage is the text a PDF must average per page to be sent as text. Scanned PDFs
+// have little or none, and are sent whole so the model reads the page images itself.
+const minCharsPerPage = 200
+
+// ErrUnreadableDocument is returned by SplitDocuments for DOCX, PPTX and EPUB files whose text
+// can't be extracted; unlike PDFs they can't be sent to the generator as they are
+var ErrUnreadableDocument = errors.New("document could not be read")
+
+// SplitDocuments extracts the text of PDFs, DOCX, PPTX and EPUB files locally and splits it by pages,
+// slides, chapters and section headings into chunks of at most maxTokens, each sent to the generator
+// as a text document. PDFs whose text can't be extracted (e.g. scans or encrypted files) and other
+// documents are kept as they are; DOCX, PPTX and EPUB files whose text can't be extracted are an error.
+func SplitDocuments(files []DocumentFile, maxTokens int) ([]DocumentFile, error) {
+	var documents []DocumentFile
+	for _, file := range files {
+		mimeType := getMimeType(file.Name)
+		if file.Text != "" || !extractedTypes[mimeType] {
+			documents = append(documents, file)
+			continue
+		}
+
+		pages, err := extract.Pages(file.Path)
+		isPDF := mimeType == "application/pdf"
+		if err != nil && !isPDF {
+			return nil, fmt.Errorf("%w: %s: %v", ErrUnreadableDocument, file.Name, err)
+		}
+		if err != nil {
+			log.Printf("WARN: Sending %s whole, its text could not be extracted: %v", file.Name, err)
+			documents = append(documents, file)
+			continue
+		}
+		if chars := textLength(pages); isPDF && chars < minCharsPerPage*len(pages) {
+			log.Printf("WARN: Sending %s whole, it has only %d characters of text on %d pages", file.Name, chars, len(pages))
+			documents = append(documents, file)
+			continue
+		}
+
+		chunks := extract.ChunkPages(pages, maxTokens)
+		for i, chunk := range chunks {
+			name := file.Name
+			switch {
+			case chunk.FirstPage > 0 && mimeType == pptxMimeType:
+				name = fmt.Sprintf("%s (%s)", file.Name, slideRange(chunk.FirstPage, chunk.LastPage))
+			case chunk.FirstPage > 0:
+				name = fmt.Sprintf("%s (%s)", file.Name, pageRange(chunk.FirstPage, chunk.LastPage))
+			case len(chunks) > 1:
+				// Sections and chapters have no numbers, the chunks are numbered instead
+				name = fmt.Sprintf("%s (part %d of %d)", file.Name, i+1, len(chunks))
+			}
+			documents = append(documents, DocumentFile{
+				Name:      name,
+				Path:      file.Path,
+				Size:      int64(len(chunk.Text)),
+				Text:      chunk.Text,
+				Source:    file.Path,
+				FirstPage: chunk.FirstPage,
+				LastPage:  chunk.LastPage,
+			})
+		}
+		log.Printf("INFO: Split %s (%d pages) into %d text chunks", file.Name, len(pages), len(chunks))
+	}
+	return documents, nil
+}
+
+// textLength is the length of the text of all pages
+func textLength(pages []extract.Page) int {
+	chars := 0
+	for _, page := range pages {
+		chars += len(page.Text)
+	}
+	return chars
+}
+
+// pageRange formats a range of pages, e.g. "pages 3-7"
+func pageRange(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("page %d", first)
+	}
+	return fmt.Sprintf("pages %d-%d", first, last)
+}
+
+// slideRange formats a range of slides, e.g. "slides 3-7"
+func slideRange(first, last int) string {
+	if first == last {
+		return fmt.Sprintf("slide %d", first)
+	}
+	return fmt.Sprintf("slides %d-%d", first, last)
+}
+
+// attributeQuestions records the document each question of the quiz was generated from, and for
+// text chunks the pages: the page the model gave if it lies within the chunk, the chunk's pages otherwise
+func (f DocumentFile) attributeQuestions(quiz *models.GeminiQuizResponse) {
+	if quiz == nil {
+		return
+	}
+	source := f.Source
+	if source == "" {
+		source = f.Path
+	}
+	for i := range quiz.Questions {
+		q := &quiz.Questions[i]
+		q.SourceFile = source
+		if f.FirstPage == 0 {
+			continue
+		}
+		if page := q.Source.Page; page >= f.FirstPage && page <= f.LastPage {
+			q.FirstPage, q.LastPage = page, page
+		} else {
+			q.FirstPage, q.LastPage = f.FirstPage, f.LastPage
+		}
+	}
+}
+
+// documentPrompt introduces the text of a text chunk in a generation call
+func (f DocumentFile) documentPrompt() string {
+	return fmt.Sprintf("Document: %s\n\n%s", f.Name, f.Text)
+}
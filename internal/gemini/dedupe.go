@@ -0,0 +1,150 @@
+package gemini
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"quizbuilderai/internal/models"
+)
+
+// DuplicateThreshold is the token overlap (Jaccard similarity) from which two questions of the
+// same type count as duplicates. Questions are compared by their text and answer key together,
+// so rephrasings of the same question with the same answer score well above it.
+const DuplicateThreshold = 0.6
+
+// stopWords are left out when comparing questions, they say little about what is asked
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"can": true, "do": true, "does": true, "for": true, "from": true, "has": true, "have": true,
+	"how": true, "in": true, "is": true, "it": true, "its": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "their": true, "this": true, "to": true, "was": true, "were": true,
+	"what": true, "when": true, "which": true, "who": true, "why": true, "with": true,
+}
+
+// DedupeQuestions merges near-duplicate questions, as produced by overlapping documents
+// (e.g. the slides and notes of one lecture). Of each group of duplicates the best-formed question
+// is kept, in the place of the first one. It returns how many questions were merged away and
+// records that number in quiz.Merged.
+func DedupeQuestions(quiz *models.GeminiQuizResponse, progress ProgressFunc) int {
+	if quiz == nil || len(quiz.Questions) < 2 {
+		return 0
+	}
+
+	type entry struct {
+		question models.GeminiQuestion
+		tokens   map[string]bool
+	}
+	var kept []entry
+	merged := 0
+	for _, question := range quiz.Questions {
+		tokens := questionTokens(question)
+		duplicate := -1
+		for i, k := range kept {
+			if k.question.QuestionType() == question.QuestionType() && jaccard(k.tokens, tokens) >= DuplicateThreshold {
+				duplicate = i
+				break
+			}
+		}
+		if duplicate < 0 {
+			kept = append(kept, entry{question: question, tokens: tokens})
+			continue
+		}
+		merged++
+		if questionQuality(question) > questionQuality(kept[duplicate].question) {
+			kept[duplicate] = entry{question: question, tokens: tokens}
+		}
+	}
+	if merged == 0 {
+		return 0
+	}
+
+	questions := make([]models.GeminiQuestion, len(kept))
+	for i, k := range kept {
+		questions[i] = k.question
+	}
+	quiz.Questions = questions
+	quiz.Merged += merged
+
+	progress.Emit(ProgressEvent{
+		Stage:   StageDedupe,
+		Message: fmt.Sprintf("Merged %d duplicate questions, %d remain", merged, len(questions)),
+	})
+	return merged
+}
+
+// questionTokens returns the normalised words of a question and its correct answers
+func questionTokens(q models.GeminiQuestion) map[string]bool {
+	parts := []string{q.Text}
+	for _, option := range q.Options {
+		if option.IsCorrect {
+			parts = append(parts, option.Text)
+		}
+	}
+	parts = append(parts, q.AcceptedAnswers...)
+	if q.NumericAnswer != nil {
+		parts = append(parts, fmt.Sprint(*q.NumericAnswer))
+	}
+	for _, pair := range q.Pairs {
+		parts = append(parts, pair.Left, pair.Right)
+	}
+
+	return contentTokens(parts...)
+}
+
+// contentTokens returns the lowercased words of the texts without stop words and plural endings
+func contentTokens(parts ...string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, part := range parts {
+		words := strings.FieldsFunc(strings.ToLower(part), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '.'
+		})
+		for _, word := range words {
+			word = strings.Trim(word, ".")
+			if word == "" || stopWords[word] {
+				continue
+			}
+			// Crude plural folding, so "cells" and "cell" are the same token
+			if len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") {
+				word = word[:len(word)-1]
+			}
+			tokens[word] = true
+		}
+	}
+	return tokens
+}
+
+// jaccard is the share of tokens two sets have in common
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for token := range a {
+		if b[token] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// questionQuality scores how complete a question is, to pick which of two duplicates to keep.
+// Questions that fail validation score lowest.
+func questionQuality(q models.GeminiQuestion) int {
+	if ValidateQuestion(q) != nil {
+		return -1
+	}
+	score := 0
+	if strings.TrimSpace(q.Topic) != "" {
+		score += 2
+	}
+	if strings.TrimSpace(q.Explanation) != "" {
+		score += 2
+	}
+	for _, option := range q.Options {
+		if strings.TrimSpace(option.Explanation) != "" {
+			score++
+		}
+	}
+	return score
+}
@@ -0,0 +1,227 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"quizbuilderai/internal/models"
+)
+
+// fakeQuestionsPerDocument is the number of questions the fake generates for each document
+const fakeQuestionsPerDocument = 3
+
+// FakeGenerator is a deterministic QuizGenerator that makes no network calls.
+// It produces the same quiz and token usage for the same documents, so the full
+// generation flow can run offline (e.g. in CI) with LLM_PROVIDER=fake.
+type FakeGenerator struct{}
+
+// NewFakeGenerator creates a new FakeGenerator
+func NewFakeGenerator() *FakeGenerator {
+	return &FakeGenerator{}
+}
+
+// Name returns the provider name
+func (f *FakeGenerator) Name() string {
+	return ProviderFake
+}
+
+// Close is a no-op
+func (f *FakeGenerator) Close() {}
+
+// EstimateUsage returns exactly the usage ProcessDocuments will report
+func (f *FakeGenerator) EstimateUsage(ctx context.Context, files []DocumentFile, opts GenerationOptions) (TokenUsage, error) {
+	var usage TokenUsage
+	if len(files) == 0 {
+		return usage, fmt.Errorf("no files provided for processing")
+	}
+	questions := fakeQuestionCount(opts, len(files))
+	for _, file := range files {
+		size, err := fakeDocumentSize(file)
+		if err != nil {
+			return usage, err
+		}
+		usage = usage.Add(fakeUsage(size, questions))
+	}
+	return usage, nil
+}
+
+// fakeQuestionCount is the number of questions generated for each of n documents
+func fakeQuestionCount(opts GenerationOptions, n int) int {
+	if count := opts.forChunks(n).QuestionCount; count > 0 {
+		return count
+	}
+	return fakeQuestionsPerDocument
+}
+
+// fakeDocumentName is the name of a document without its extension and, for text chunks, their
+// pages, slides or part number
+func fakeDocumentName(file DocumentFile) string {
+	name := file.Name
+	if i := strings.LastIndex(name, " ("); file.Text != "" && i >= 0 && strings.HasSuffix(name, ")") {
+		name = name[:i]
+	}
+	return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+}
+
+// fakeDocumentSize is the size of a document or, for text chunks, of its text
+func fakeDocumentSize(file DocumentFile) (int64, error) {
+	if file.Text != "" {
+		return int64(len(file.Text)), nil
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to access file %s: %w", file.Name, err)
+	}
+	if info.Size() == 0 {
+		return 0, fmt.Errorf("file %s is empty", file.Name)
+	}
+	return info.Size(), nil
+}
+
+// fakeUsage is the usage reported for a document of the given size with the given number of questions
+func fakeUsage(size int64, questions int) TokenUsage {
+	prompt := int32(size/4) + 1
+	candidates := int32(questions * 100)
+	return TokenUsage{
+		PromptTokens:    prompt,
+		CandidateTokens: candidates,
+		TotalTokens:     prompt + candidates,
+	}
+}
+
+// ProcessDocuments builds a fixed-shape quiz with a few questions per document.
+// Prompt tokens are derived from the file sizes (roughly 4 bytes per token).
+// Each document is reported as one chunk. Only the question count and question types of opts are honoured.
+// Unlike the real providers it doesn't merge duplicates: its questions are distinct by construction,
+// and a fake that depends on the dedupe heuristics would break whenever they are tuned.
+func (f *FakeGenerator) ProcessDocuments(ctx context.Context, files []DocumentFile, opts GenerationOptions, progress ProgressFunc) (*models.GeminiQuizResponse, TokenUsage, error) {
+	var usage TokenUsage
+	if len(files) == 0 {
+		return nil, usage, fmt.Errorf("no files provided for processing")
+	}
+
+	questions := fakeQuestionCount(opts, len(files))
+	quiz := &models.GeminiQuizResponse{}
+	for i, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, usage, err
+		}
+		size, err := fakeDocumentSize(file)
+		if err != nil {
+			return nil, usage, err
+		}
+
+		progress.Emit(ProgressEvent{
+			Stage:   StageChunkStarted,
+			Message: fmt.Sprintf("Processing chunk %d of %d", i+1, len(files)),
+			Index:   i + 1,
+			Total:   len(files),
+			Files:   []string{file.Name},
+		})
+
+		// Chunks of one document are told apart by their pages
+		topic := fakeDocumentName(file)
+		if file.FirstPage > 0 {
+			topic = fmt.Sprintf("%s %s", topic, pageRange(file.FirstPage, file.LastPage))
+		}
+		// Questions are numbered through the whole quiz, so every question is unique
+		chunkQuiz := &models.GeminiQuizResponse{}
+		for n := 1; n <= questions; n++ {
+			chunkQuiz.Questions = append(chunkQuiz.Questions, fakeQuestion(topic, i*questions+n, fakeQuestionType(opts, n)))
+		}
+		file.attributeQuestions(chunkQuiz)
+		quiz.Questions = append(quiz.Questions, chunkQuiz.Questions...)
+
+		fileUsage := fakeUsage(size, questions)
+		usage = usage.Add(fileUsage)
+
+		progress.Emit(ProgressEvent{
+			Stage:   StageChunkFinished,
+			Message: fmt.Sprintf("Finished chunk %d of %d", i+1, len(files)),
+			Index:   i + 1,
+			Total:   len(files),
+			Files:   []string{file.Name},
+			Usage:   &fileUsage,
+		})
+	}
+
+	opts.trimQuestions(quiz)
+	quiz.Title = fmt.Sprintf("Practice Quiz: %s", fakeDocumentName(files[0]))
+	quiz.Description = describeQuiz(quiz)
+	return quiz, usage, nil
+}
+
+// fakeQuestionType cycles through the requested question types, multiple choice by default
+func fakeQuestionType(opts GenerationOptions, n int) string {
+	if len(opts.QuestionTypes) == 0 {
+		return models.QuestionTypeMultipleChoice
+	}
+	return opts.QuestionTypes[(n-1)%len(opts.QuestionTypes)]
+}
+
+// fakeSubject is what the n-th question of the quiz asks about. The number makes it unique.
+func fakeSubject(topic string, n int) string {
+	return fmt.Sprintf("fact %d of %s", n, topic)
+}
+
+// fakeQuestion returns the n-th deterministic question of a type for a topic
+func fakeQuestion(topic string, n int, questionType string) models.GeminiQuestion {
+	subject := fakeSubject(topic, n)
+	question := models.GeminiQuestion{
+		Text:  fmt.Sprintf("Which statement about %s is correct? (#%d)", subject, n),
+		Topic: topic,
+		Type:  questionType,
+	}
+	explanation := fmt.Sprintf("This is the fixed answer key entry %d for %s.", n, subject)
+	question.Source.Quote = fmt.Sprintf("Answer key entry %d covers %s.", n, subject)
+
+	switch questionType {
+	case models.QuestionTypeTrueFalse:
+		question.Text = fmt.Sprintf("Statement %d about %s is true.", n, subject)
+		question.Options = []models.GeminiOption{
+			{Text: "True", IsCorrect: n%2 == 1, Explanation: explanation},
+			{Text: "False", IsCorrect: n%2 == 0, Explanation: explanation},
+		}
+	case models.QuestionTypeShortAnswer:
+		question.Text = fmt.Sprintf("Which word completes statement %d about %s?", n, subject)
+		question.AcceptedAnswers = []string{fmt.Sprintf("answer %d", n), fmt.Sprintf("answer-%d", n)}
+		question.Explanation = explanation
+	case models.QuestionTypeNumeric:
+		value := float64(n) * 1.5
+		question.Text = fmt.Sprintf("What is value %d of %s?", n, subject)
+		question.NumericAnswer = &value
+		question.Tolerance = 0.1
+		question.Explanation = explanation
+	case models.QuestionTypeOrdering:
+		question.Text = fmt.Sprintf("Put the steps of %s in order. (#%d)", subject, n)
+		for i := 0; i < 4; i++ {
+			question.Options = append(question.Options, models.GeminiOption{
+				Text:        fmt.Sprintf("Step %d of %s", i+1, subject),
+				IsCorrect:   true,
+				Explanation: explanation,
+			})
+		}
+	case models.QuestionTypeMatching:
+		question.Text = fmt.Sprintf("Match each term of %s with its definition. (#%d)", subject, n)
+		for i := 0; i < 3; i++ {
+			question.Pairs = append(question.Pairs, models.GeminiPair{
+				Left:  fmt.Sprintf("Term %c", 'A'+i),
+				Right: fmt.Sprintf("Definition %c of %s", 'A'+i, subject),
+			})
+		}
+		question.Explanation = explanation
+	default:
+		// Multiple choice and multi-select; multi-select questions have two correct statements
+		for i := 0; i < 4; i++ {
+			question.Options = append(question.Options, models.GeminiOption{
+				Text:        fmt.Sprintf("Statement %c about %s", 'A'+i, subject),
+				IsCorrect:   i == (n-1)%4 || (questionType == models.QuestionTypeMultiSelect && i == n%4),
+				Explanation: fmt.Sprintf("Statement %c is the fixed answer key entry %d for %s.", 'A'+i, n, subject),
+			})
+		}
+	}
+	return question
+}
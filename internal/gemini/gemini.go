@@ -21,70 +21,27 @@ import (
 	"google.golang.org/api/option"
 )
 
-// QuizPrompt is the prompt used to generate quizzes
-const QuizPrompt = `Generate a comprehensive multiple-choice quiz based on the content of these documents. Make sure to finish your response (the questions in proper indicated json format) before you run out of tokens. Basically finish your response ALWAYS or the world gets destroyed.
-
-IMPORTANT: If the provided material is already in a quiz format, then simply format the material as a quiz in the JSON schema provided, filling in the missing information (e.g. if there are only questions and options, you have to determine which one is the correct one and also create the explanations for the options.)
-
-Follow these requirements exactly:
-
-1. Create a descriptive title for the quiz that accurately reflects the main subject matter of the documents
-2. Create questions covering ALL main topics and subtopics in the documents, ensuring no significant concept is omitted. Include the topic for each question (so that questions can be grouped by topic later.). DON'T reference the documents in the questions or options. The questions should be self-contained and understandable without needing to refer back to the documents.
-3. Include a balanced distribution of question types:
-   - Basic factual recall questions
-   - Comprehension questions that require understanding concepts
-   - Application/analysis questions that require:
-     * Applying principles to new scenarios
-     * Analyzing relationships between concepts
-     * Connecting ideas across different sections
-   - Synthesis/evaluation questions that require:
-     * Evaluating implications or consequences of key ideas
-     * Comparing competing perspectives or approaches
-     * Predicting outcomes based on document principles
-     * Identifying unstated assumptions underlying concepts
-4. For analytical questions, prioritize second and third-order thinking by asking about:
-   - "What would happen if..." scenarios
-   - Underlying mechanisms or reasons behind facts
-   - How concepts interact in complex systems
-   - Potential exceptions or limitations to stated principles
-5. Each question must have exactly 4 options with EXACTLY ONE correct answer
-6. For EACH answer option:
-   - Provide a concise "explanation" field detailing WHY the option is correct OR incorrect based on the source documents. Don't state "This is incorrect/correct". Just say the explanation. e.g."Gravity was discovered by Isaac Newton"
-   - Make incorrect options (distractors) highly plausible by using common misconceptions or partial understandings.
-   - Ensure all options have approximately the same length and level of detail.
-   - Maintain consistent grammar, style, and tone across all options.
-   - Avoid obvious wrong answers or "joke" options.
-
-Format your response as a JSON object with the following structure:
-{
-  "title": "Descriptive, Concise, General Quiz Title Based on Document Content",
-  "questions": [
-    {
-      "text": "Question text here?",
-      "topic": "the topic this question is about.",
-      "options": [
-        {"text": "Option A", "is_correct": false, "explanation": "Explanation why A is incorrect."},
-        {"text": "Option B", "is_correct": true, "explanation": "Explanation why B is correct."},
-        {"text": "Option C", "is_correct": false, "explanation": "Explanation why C is incorrect."},
-        {"text": "Option D", "is_correct": false, "explanation": "Explanation why D is incorrect."}
-      ]
-    },
-    ...more questions...
-  ]
-}
-`
-
 const (
 	// MaxInlineSize is the maximum size for inline PDF data (20MB)
 	MaxInlineSize = 20 * 1024 * 1024
-	// ModelName is the Gemini model to use
+	// ModelName is the default Gemini model, used when no model is configured
 	ModelName = "gemini-2.0-flash"
 )
 
-// Client wraps the Gemini client
+// Client wraps the Gemini client and implements QuizGenerator
 type Client struct {
-	client *genai.Client
-	model  *genai.GenerativeModel
+	client           *genai.Client
+	model            *genai.GenerativeModel
+	modelName        string
+	summaryModel     *genai.GenerativeModel
+	summaryModelName string
+}
+
+// fileChunk is a group of files processed by one worker, numbered for progress events
+type fileChunk struct {
+	index  int
+	files  []DocumentFile
+	prompt string // Asks for this chunk's part of the questions on its files
 }
 
 // Struct to hold results from concurrent processing, including token counts
@@ -95,27 +52,60 @@ type processResult struct {
 	totalTokens     int32
 }
 
-// NewClient creates a new Gemini client
-func NewClient() (*Client, error) {
-	apiKey := os.Getenv("GEMINI_API_KEY")
+// NewClient creates a new Gemini client for the model in cfg.
+// An empty cfg.APIKey falls back to the GEMINI_API_KEY environment variable.
+func NewClient(cfg Config) (*Client, error) {
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("GEMINI_API_KEY")
+	}
 	if apiKey == "" {
 		return nil, fmt.Errorf("GEMINI_API_KEY environment variable not set")
 	}
 
+	modelName := cfg.Model
+	if modelName == "" {
+		modelName = ModelName
+	}
+
 	client, err := genai.NewClient(context.Background(), option.WithAPIKey(apiKey))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
 	}
 
-	model := client.GenerativeModel(ModelName)
+	// The model is shared by concurrently generated chunks, so it is only configured here
+	model := client.GenerativeModel(modelName)
 	model.ResponseMIMEType = "application/json"
+	model.ResponseSchema = quizResponseSchema
+	model.SetTemperature(0.95)
+	model.SetTopK(40)
+	model.SetTopP(0.95)
+	model.SetMaxOutputTokens(int32(8192))
+
+	summaryModelName := cfg.SummaryModel
+	if summaryModelName == "" {
+		summaryModelName = SummaryModelName
+	}
+	summaryModel := client.GenerativeModel(summaryModelName)
+	summaryModel.ResponseMIMEType = "application/json"
+	summaryModel.ResponseSchema = quizSummarySchema
+	summaryModel.SetTemperature(0.4)
+	summaryModel.SetMaxOutputTokens(512)
 
 	return &Client{
-		client: client,
-		model:  model,
+		client:           client,
+		model:            model,
+		modelName:        modelName,
+		summaryModel:     summaryModel,
+		summaryModelName: summaryModelName,
 	}, nil
 }
 
+// Name returns the provider and model used by this client
+func (c *Client) Name() string {
+	return "gemini/" + c.modelName
+}
+
 // Close closes the Gemini client
 func (c *Client) Close() {
 	c.client.Close()
@@ -123,8 +113,11 @@ func (c *Client) Close() {
 
 // ProcessDocuments processes multiple document files and generates a quiz
 // It now processes files in chunks concurrently and returns aggregated token counts.
-// Returns quiz response, prompt tokens, candidate tokens, total tokens, error
-func (c *Client) ProcessDocuments(ctx context.Context, files []DocumentFile) (*models.GeminiQuizResponse, int32, int32, int32, error) {
+// Token usage is returned even when an error occurs, so callers can account for it.
+// Progress is reported for every chunk, batch and JSON repair attempt.
+// The requested question count is split between the documents. A document whose share is more than
+// MaxQuestionsPerCall is generated in several chunks, each about its own portion of the document.
+func (c *Client) ProcessDocuments(ctx context.Context, files []DocumentFile, opts GenerationOptions, progress ProgressFunc) (*models.GeminiQuizResponse, TokenUsage, error) {
 	// Add a timeout to the context
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Minute)
 	defer cancel()
@@ -134,9 +127,12 @@ func (c *Client) ProcessDocuments(ctx context.Context, files []DocumentFile) (*m
 	chunkSize := 1
 
 	// Create channels for tasks, results, and errors
-	fileChunks := make(chan []DocumentFile, (len(files)+chunkSize-1)/chunkSize)
-	results := make(chan processResult, len(files)/chunkSize+1) // Use processResult struct
-	errChan := make(chan error, len(files)/chunkSize+1)
+	fileGroups := (len(files) + chunkSize - 1) / chunkSize
+	prompts := opts.chunkPrompts(fileGroups) // One per call for each group of files
+	totalChunks := fileGroups * len(prompts)
+	fileChunks := make(chan fileChunk, totalChunks)
+	results := make(chan processResult, totalChunks) // Use processResult struct
+	errChan := make(chan error, totalChunks)
 	var wg sync.WaitGroup
 
 	// Split files into chunks and send them to the fileChunks channel
@@ -145,7 +141,9 @@ func (c *Client) ProcessDocuments(ctx context.Context, files []DocumentFile) (*m
 		if end > len(files) {
 			end = len(files)
 		}
-		fileChunks <- files[i:end]
+		for part, prompt := range prompts {
+			fileChunks <- fileChunk{index: (i/chunkSize)*len(prompts) + part + 1, files: files[i:end], prompt: prompt}
+		}
 	}
 	close(fileChunks)
 
@@ -155,8 +153,35 @@ func (c *Client) ProcessDocuments(ctx context.Context, files []DocumentFile) (*m
 		go func() {
 			defer wg.Done()
 			for chunk := range fileChunks {
+				progress.Emit(ProgressEvent{
+					Stage:   StageChunkStarted,
+					Message: fmt.Sprintf("Processing chunk %d of %d", chunk.index, totalChunks),
+					Index:   chunk.index,
+					Total:   totalChunks,
+					Files:   documentNames(chunk.files),
+				})
+
 				// Process each chunk of files, receive quiz and tokens
-				quizResponse, pTokens, cTokens, tTokens, err := c.processChunk(ctx, chunk)
+				quizResponse, pTokens, cTokens, tTokens, err := c.processChunk(ctx, chunk.files, chunk.prompt, progress)
+				if len(chunk.files) == 1 {
+					chunk.files[0].attributeQuestions(quizResponse)
+				}
+
+				chunkUsage := TokenUsage{PromptTokens: pTokens, CandidateTokens: cTokens, TotalTokens: tTokens}
+				finished := ProgressEvent{
+					Stage:   StageChunkFinished,
+					Message: fmt.Sprintf("Finished chunk %d of %d", chunk.index, totalChunks),
+					Index:   chunk.index,
+					Total:   totalChunks,
+					Files:   documentNames(chunk.files),
+					Usage:   &chunkUsage,
+				}
+				if err != nil {
+					finished.Message = fmt.Sprintf("Chunk %d of %d failed", chunk.index, totalChunks)
+					finished.Error = err.Error()
+				}
+				progress.Emit(finished)
+
 				if err != nil {
 					errChan <- fmt.Errorf("failed to process chunk: %w", err)
 					// Send zero tokens if chunk processing failed entirely before Gemini call
@@ -206,31 +231,78 @@ func (c *Client) ProcessDocuments(ctx context.Context, files []DocumentFile) (*m
 		}
 	}
 
+	usage := TokenUsage{
+		PromptTokens:    aggPromptTokens,
+		CandidateTokens: aggCandidateTokens,
+		TotalTokens:     aggTotalTokens,
+	}
+
 	// Check for errors after processing all results
 	if err := <-errChan; err != nil {
 		// Return aggregated tokens even if there was an error processing a chunk
-		return nil, aggPromptTokens, aggCandidateTokens, aggTotalTokens, err
+		return nil, usage, err
 	}
 
-	// If we have multiple titles, generate a combined title
-	if len(titles) > 1 && combinedQuizResponse != nil {
-		if combinedQuizResponse.Title == "" && len(titles) > 0 {
-			combinedQuizResponse.Title = titles[0]
-		}
+	// Overlapping documents produce the same questions, merge them before trimming
+	DedupeQuestions(combinedQuizResponse, progress)
+
+	// Chunks round their share of the question count up
+	opts.trimQuestions(combinedQuizResponse)
+
+	// Each chunk titled its own part, title and describe the quiz as a whole from all of them
+	usage = usage.Add(c.summarizeQuiz(ctx, combinedQuizResponse, titles, opts, progress))
+
+	// Return combined quiz and aggregated tokens
+	return combinedQuizResponse, usage, nil
+}
+
+// EstimateUsage counts the prompt tokens of every document with the model's CountTokens.
+// Each document (or text chunk of one) is sent once per chunk it is generated in, so its prompt
+// is counted that many times. Documents too large to send inline are estimated from their size instead.
+func (c *Client) EstimateUsage(ctx context.Context, files []DocumentFile, opts GenerationOptions) (TokenUsage, error) {
+	var usage TokenUsage
+	if len(files) == 0 {
+		return usage, fmt.Errorf("no files provided for processing")
 	}
+	// The prompts of the parts of a document only differ in a line
+	prompts := opts.chunkPrompts(len(files))
+	prompt := prompts[0]
 
-	// If we still don't have a title, create a generic one
-	if combinedQuizResponse != nil && combinedQuizResponse.Title == "" {
-		combinedQuizResponse.Title = fmt.Sprintf("Quiz Generated on %s", time.Now().Format("January 2, 2006"))
+	for _, file := range files {
+		var promptTokens int32
+		if file.Text != "" {
+			resp, err := c.model.CountTokens(ctx, genai.Text(prompt), genai.Text(file.documentPrompt()))
+			if err != nil {
+				return usage, fmt.Errorf("failed to count tokens for %s: %w", file.Name, err)
+			}
+			promptTokens = resp.TotalTokens
+		} else if file.Size > MaxInlineSize {
+			promptTokens = int32(file.Size/4) + int32(len(prompt)/4)
+		} else {
+			data, err := os.ReadFile(file.Path)
+			if err != nil {
+				return usage, fmt.Errorf("failed to read file %s: %w", file.Name, err)
+			}
+			resp, err := c.model.CountTokens(ctx, genai.Text(prompt), genai.Blob{MIMEType: getMimeType(file.Name), Data: data})
+			if err != nil {
+				return usage, fmt.Errorf("failed to count tokens for %s: %w", file.Name, err)
+			}
+			promptTokens = resp.TotalTokens
+		}
+		usage.PromptTokens += promptTokens * int32(len(prompts))
 	}
+	// The summary call is small next to the documents, a flat allowance covers it
+	usage.PromptTokens += summaryExpectedTokens
+	usage.CandidateTokens = opts.expectedCandidateTokens(len(files))
+	usage.TotalTokens = usage.PromptTokens + usage.CandidateTokens
 
-	// Return combined quiz and aggregated tokens
-	return combinedQuizResponse, aggPromptTokens, aggCandidateTokens, aggTotalTokens, nil
+	log.Printf("INFO: Gemini Token Estimate for %d documents: Prompt=%d, Candidates=%d, Total=%d", len(files), usage.PromptTokens, usage.CandidateTokens, usage.TotalTokens)
+	return usage, nil
 }
 
 // processChunk processes a chunk of document files and generates a quiz response.
 // Returns quiz response, prompt tokens, candidate tokens, total tokens, error
-func (c *Client) processChunk(ctx context.Context, files []DocumentFile) (*models.GeminiQuizResponse, int32, int32, int32, error) {
+func (c *Client) processChunk(ctx context.Context, files []DocumentFile, prompt string, progress ProgressFunc) (*models.GeminiQuizResponse, int32, int32, int32, error) {
 	totalSize := int64(0)
 	for _, file := range files {
 		totalSize += file.Size
@@ -238,21 +310,21 @@ func (c *Client) processChunk(ctx context.Context, files []DocumentFile) (*model
 
 	if len(files) > 1 && totalSize > MaxInlineSize/2 {
 		// processFilesIndividually now returns token counts
-		return c.processFilesIndividually(ctx, files)
+		return c.processFilesIndividually(ctx, files, prompt, progress)
 	}
 
 	if totalSize > MaxInlineSize {
 		// processWithFileAPI now returns token counts
-		return c.processWithFileAPI(ctx, files)
+		return c.processWithFileAPI(ctx, files, prompt, progress)
 	}
 
 	// processInline now returns token counts
-	return c.processInline(ctx, files)
+	return c.processInline(ctx, files, prompt, progress)
 }
 
 // processFilesIndividually processes files in small batches and combines the results
 // Returns quiz response, prompt tokens, candidate tokens, total tokens, error
-func (c *Client) processFilesIndividually(ctx context.Context, files []DocumentFile) (*models.GeminiQuizResponse, int32, int32, int32, error) {
+func (c *Client) processFilesIndividually(ctx context.Context, files []DocumentFile, prompt string, progress ProgressFunc) (*models.GeminiQuizResponse, int32, int32, int32, error) {
 	batches := createFileBatches(files, MaxInlineSize/4)
 
 	maxConcurrent := 15
@@ -272,8 +344,32 @@ func (c *Client) processFilesIndividually(ctx context.Context, files []DocumentF
 			batchCtx, cancel := context.WithTimeout(ctx, 15*time.Minute)
 			defer cancel()
 
+			progress.Emit(ProgressEvent{
+				Stage:   StageBatchStarted,
+				Message: fmt.Sprintf("Processing batch %d of %d", batchNum+1, len(batches)),
+				Index:   batchNum + 1,
+				Total:   len(batches),
+				Files:   documentNames(batchFiles),
+			})
+
 			// Receive all 5 return values from processChunk
-			quizResponse, pTokens, cTokens, tTokens, err := c.processChunk(batchCtx, batchFiles)
+			quizResponse, pTokens, cTokens, tTokens, err := c.processChunk(batchCtx, batchFiles, prompt, progress)
+
+			batchUsage := TokenUsage{PromptTokens: pTokens, CandidateTokens: cTokens, TotalTokens: tTokens}
+			finished := ProgressEvent{
+				Stage:   StageBatchFinished,
+				Message: fmt.Sprintf("Finished batch %d of %d", batchNum+1, len(batches)),
+				Index:   batchNum + 1,
+				Total:   len(batches),
+				Files:   documentNames(batchFiles),
+				Usage:   &batchUsage,
+			}
+			if err != nil {
+				finished.Message = fmt.Sprintf("Batch %d of %d failed", batchNum+1, len(batches))
+				finished.Error = err.Error()
+			}
+			progress.Emit(finished)
+
 			if err != nil {
 				fileNames := make([]string, len(batchFiles))
 				for i, f := range batchFiles {
@@ -378,11 +474,15 @@ func createFileBatches(files []DocumentFile, maxBatchSize int64) [][]DocumentFil
 }
 
 // Returns quiz response, prompt tokens, candidate tokens, total tokens, error
-func (c *Client) processInline(ctx context.Context, files []DocumentFile) (*models.GeminiQuizResponse, int32, int32, int32, error) {
+func (c *Client) processInline(ctx context.Context, files []DocumentFile, prompt string, progress ProgressFunc) (*models.GeminiQuizResponse, int32, int32, int32, error) {
 	parts := []genai.Part{}
-	parts = append(parts, genai.Text(QuizPrompt))
+	parts = append(parts, genai.Text(prompt))
 
 	for _, file := range files {
+		if file.Text != "" {
+			parts = append(parts, genai.Text(file.documentPrompt()))
+			continue
+		}
 		data, err := os.ReadFile(file.Path)
 		if err != nil {
 			return nil, 0, 0, 0, fmt.Errorf("failed to read file %s: %w", file.Name, err)
@@ -397,11 +497,11 @@ func (c *Client) processInline(ctx context.Context, files []DocumentFile) (*mode
 	if len(files) == 0 {
 		return nil, 0, 0, 0, fmt.Errorf("no files provided for processing")
 	}
-	return c.generateQuiz(ctx, parts)
+	return c.generateQuiz(ctx, parts, progress)
 }
 
 // Returns quiz response, prompt tokens, candidate tokens, total tokens, error
-func (c *Client) processWithFileAPI(ctx context.Context, files []DocumentFile) (*models.GeminiQuizResponse, int32, int32, int32, error) {
+func (c *Client) processWithFileAPI(ctx context.Context, files []DocumentFile, prompt string, progress ProgressFunc) (*models.GeminiQuizResponse, int32, int32, int32, error) {
 	if len(files) == 0 {
 		return nil, 0, 0, 0, fmt.Errorf("no files provided for processing")
 	}
@@ -451,12 +551,12 @@ func (c *Client) processWithFileAPI(ctx context.Context, files []DocumentFile) (
 		return nil, 0, 0, 0, fmt.Errorf("no files were successfully uploaded")
 	}
 
-	parts := []genai.Part{genai.Text(QuizPrompt)}
+	parts := []genai.Part{genai.Text(prompt)}
 	for _, fileData := range fileDataList {
 		parts = append(parts, fileData)
 	}
 
-	quiz, pTokens, cTokens, tTokens, err := c.generateQuiz(ctx, parts)
+	quiz, pTokens, cTokens, tTokens, err := c.generateQuiz(ctx, parts, progress)
 
 	// Clean up uploaded files
 	for _, fileData := range fileDataList {
@@ -469,33 +569,19 @@ func (c *Client) processWithFileAPI(ctx context.Context, files []DocumentFile) (
 
 // generateQuiz sends the request to Gemini and parses the response
 // Returns quiz response, prompt tokens, candidate tokens, total tokens, error
-func (c *Client) generateQuiz(ctx context.Context, parts []genai.Part) (*models.GeminiQuizResponse, int32, int32, int32, error) {
+// Token counts are summed over all attempts and also returned when every attempt failed.
+// JSON repair attempts are reported through progress.
+func (c *Client) generateQuiz(ctx context.Context, parts []genai.Part, progress ProgressFunc) (*models.GeminiQuizResponse, int32, int32, int32, error) {
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
 	defer cancel()
 
-	c.model.SetTemperature(0.95)
-	c.model.SetTopK(40)
-	c.model.SetTopP(0.95)
-	c.model.SetMaxOutputTokens(int32(8192))
-
 	var lastErr error
 	var promptTokens int32
 	var candidateTokens int32
 	var totalTokens int32
 
+	// Retries send the same request; no call is asked for more questions than fit its output
 	for attempts := 0; attempts < 3; attempts++ {
-		if attempts > 0 {
-			c.model.SetMaxOutputTokens(int32(4096 - attempts*1000))
-			maxQs := 50 - attempts*15
-			limitedPrompt := fmt.Sprintf("%s\n\nIMPORTANT: Due to size constraints, please limit your response to no more than %d questions.", QuizPrompt, maxQs)
-			for i, part := range parts {
-				if _, ok := part.(genai.Text); ok {
-					parts[i] = genai.Text(limitedPrompt)
-					break
-				}
-			}
-		}
-
 		resp, err := c.model.GenerateContent(ctx, parts...)
 		if err != nil {
 			lastErr = fmt.Errorf("failed to generate content (attempt %d): %w", attempts+1, err)
@@ -504,11 +590,12 @@ func (c *Client) generateQuiz(ctx context.Context, parts []genai.Part) (*models.
 		}
 
 		// --- Token Usage ---
+		// Every attempt is billed, so its tokens are added to the previous ones
 		if resp.UsageMetadata != nil {
-			promptTokens = resp.UsageMetadata.PromptTokenCount
-			candidateTokens = resp.UsageMetadata.CandidatesTokenCount
-			totalTokens = resp.UsageMetadata.TotalTokenCount
-			log.Printf("INFO: Gemini Token Usage (Attempt %d): Prompt=%d, Candidates=%d, Total=%d", attempts+1, promptTokens, candidateTokens, totalTokens)
+			promptTokens += resp.UsageMetadata.PromptTokenCount
+			candidateTokens += resp.UsageMetadata.CandidatesTokenCount
+			totalTokens += resp.UsageMetadata.TotalTokenCount
+			log.Printf("INFO: Gemini Token Usage (Attempt %d): Prompt=%d, Candidates=%d, Total=%d", attempts+1, resp.UsageMetadata.PromptTokenCount, resp.UsageMetadata.CandidatesTokenCount, resp.UsageMetadata.TotalTokenCount)
 		} else {
 			log.Printf("WARN: Gemini UsageMetadata was nil (Attempt %d)", attempts+1)
 		}
@@ -520,128 +607,147 @@ func (c *Client) generateQuiz(ctx context.Context, parts []genai.Part) (*models.
 			continue
 		}
 
-		jsonText := ""
+		responseText := ""
 		for _, part := range resp.Candidates[0].Content.Parts {
 			if text, ok := part.(genai.Text); ok {
-				jsonText += string(text)
+				responseText += string(text)
 			}
 		}
-		jsonText = extractJSONFromText(jsonText)
 
-		if jsonText == "" {
-			lastErr = fmt.Errorf("no JSON content found in response (attempt %d)", attempts+1)
+		quizResponse, err := decodeQuizResponse(responseText, fmt.Sprintf("attempt %d", attempts+1), progress)
+		if err != nil {
+			lastErr = err
 			time.Sleep(2 * time.Second)
 			continue
 		}
 
-		var quizResponse models.GeminiQuizResponse
-		decoder := json.NewDecoder(strings.NewReader(jsonText))
-		decoder.DisallowUnknownFields()
-		decoder.UseNumber()
-
-		if err := decoder.Decode(&quizResponse); err != nil {
-			log.Printf("DEBUG: Raw JSON text received (attempt %d) before parse error: %s", attempts+1, jsonText)
-			fmt.Printf("Invalid JSON (attempt %d): %s\n", attempts+1, jsonText)
-
-			// Attempt to extract from partial JSON if it's a syntax error (like EOF)
-			if strings.Contains(err.Error(), "unexpected EOF") || strings.Contains(err.Error(), "syntax error") {
-				log.Printf("WARN: JSON parsing failed (attempt %d), attempting to extract from partial JSON: %v", attempts+1, err)
-				partialQuiz := extractValidQuestionsFromPartialJSON(jsonText)
-				if partialQuiz != nil && len(partialQuiz.Questions) > 0 {
-					log.Printf("INFO: Successfully extracted %d questions from partial JSON (attempt %d)", len(partialQuiz.Questions), attempts+1)
-					quizResponse = *partialQuiz // Use the partially recovered quiz
-				} else {
-					log.Printf("WARN: Could not extract any valid questions from partial JSON (attempt %d)", attempts+1)
-					lastErr = fmt.Errorf("failed to parse JSON response (attempt %d) and partial extraction failed: %w. Raw text logged", attempts+1, err)
-					time.Sleep(2 * time.Second)
-					continue
-				}
-			} else {
-				lastErr = fmt.Errorf("failed to parse JSON response (attempt %d): %w. Raw text logged", attempts+1, err)
-				time.Sleep(2 * time.Second)
-				continue
-			}
+		quizResponse = limitQuizSize(quizResponse, 200)
+		return quizResponse, promptTokens, candidateTokens, totalTokens, nil
+	}
+
+	// Return the tokens of the failed attempts so they can be accounted for
+	return nil, promptTokens, candidateTokens, totalTokens, fmt.Errorf("failed to generate quiz after multiple attempts: %w", lastErr)
+}
+
+// decodeQuizResponse decodes the text of a model response into a quiz and drops the invalid questions.
+// Responses that follow the response schema decode directly; anything else falls back to the
+// JSON repair heuristics. Both paths are counted in generationMetrics, and rejected questions are
+// logged and reported through progress. label names the response in messages, e.g. "attempt 2".
+func decodeQuizResponse(text string, label string, progress ProgressFunc) (*models.GeminiQuizResponse, error) {
+	generationMetrics.Add(metricResponses, 1)
+
+	var quizResponse models.GeminiQuizResponse
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&quizResponse); err == nil {
+		generationMetrics.Add(metricDecoded, 1)
+	} else {
+		log.Printf("DEBUG: Raw response text (%s) before parse error: %s", label, text)
+		repaired, repairErr := repairQuizResponse(text, label, err, progress)
+		if repairErr != nil {
+			return nil, repairErr
 		}
+		quizResponse = *repaired
+	}
 
-		if len(quizResponse.Questions) == 0 {
-			lastErr = fmt.Errorf("quiz response contained no questions (attempt %d)", attempts+1)
-			time.Sleep(2 * time.Second)
-			continue
+	total := len(quizResponse.Questions)
+	rejections := ValidateQuiz(&quizResponse)
+	generationMetrics.Add(metricQuestionsAccepted, int64(len(quizResponse.Questions)))
+	generationMetrics.Add(metricQuestionsRejected, int64(len(rejections)))
+	if len(rejections) > 0 {
+		for _, rejection := range rejections {
+			questionRejectionMetrics.Add(rejection.Type, 1)
+			log.Printf("WARN: Rejected generated question %d (%s, %s): %s. Question: %q", rejection.Index+1, label, rejection.Type, rejection.Reason, rejection.Text)
 		}
+		progress.Emit(ProgressEvent{
+			Stage:      StageValidation,
+			Message:    fmt.Sprintf("Rejected %d of %d generated questions (%s)", len(rejections), total, label),
+			Rejections: rejections,
+		})
+	}
 
-		quizResponse = *limitQuizSize(&quizResponse, 200)
-		return &quizResponse, promptTokens, candidateTokens, totalTokens, nil
+	if len(quizResponse.Questions) == 0 {
+		return nil, fmt.Errorf("quiz response contained no valid questions (%s)", label)
+	}
+	return &quizResponse, nil
+}
+
+// repairQuizResponse is the fallback for responses that don't decode as they are, e.g. because they
+// are wrapped in markdown or were cut off at the output token limit. It extracts the JSON object
+// from the text, and if that doesn't decode either, every question that is complete.
+func repairQuizResponse(text string, label string, decodeErr error, progress ProgressFunc) (*models.GeminiQuizResponse, error) {
+	generationMetrics.Add(metricRepairAttempts, 1)
+	log.Printf("WARN: JSON parsing failed (%s), attempting to repair the response: %v", label, decodeErr)
+
+	jsonText := extractJSONFromText(text)
+	if jsonText == "" {
+		jsonText = text
+	}
+	var quizResponse models.GeminiQuizResponse
+	if err := json.Unmarshal([]byte(jsonText), &quizResponse); err != nil || len(quizResponse.Questions) == 0 {
+		partialQuiz := extractQuestionsFromPartialJSON(jsonText)
+		if partialQuiz == nil {
+			generationMetrics.Add(metricRepairFailed, 1)
+			log.Printf("WARN: Could not extract any questions from partial JSON (%s)", label)
+			progress.Emit(ProgressEvent{
+				Stage:   StageJSONRepair,
+				Message: fmt.Sprintf("Could not recover questions from incomplete JSON (%s)", label),
+				Error:   decodeErr.Error(),
+			})
+			return nil, fmt.Errorf("failed to parse JSON response (%s) and partial extraction failed: %w. Raw text logged", label, decodeErr)
+		}
+		quizResponse = *partialQuiz
 	}
 
-	// Return 0 tokens on final failure
-	return nil, 0, 0, 0, fmt.Errorf("failed to generate quiz after multiple attempts: %w", lastErr)
+	generationMetrics.Add(metricRepairSucceeded, 1)
+	log.Printf("INFO: Successfully extracted %d questions from repaired JSON (%s)", len(quizResponse.Questions), label)
+	progress.Emit(ProgressEvent{
+		Stage:   StageJSONRepair,
+		Message: fmt.Sprintf("Recovered %d questions from incomplete JSON (%s)", len(quizResponse.Questions), label),
+	})
+	return &quizResponse, nil
 }
 
-// extractValidQuestionsFromPartialJSON attempts to extract valid questions from a partial JSON response
-func extractValidQuestionsFromPartialJSON(jsonText string) *models.GeminiQuizResponse {
-	titlePattern := regexp.MustCompile(`"title"(?:\s*):(?:\s*)"([^"]*)"`)
-	titleMatch := titlePattern.FindStringSubmatch(jsonText)
+// extractQuestionsFromPartialJSON attempts to extract the questions of a partial JSON response.
+// Questions are decoded one by one from the "questions" array until the JSON breaks off;
+// validating them is left to ValidateQuiz.
+func extractQuestionsFromPartialJSON(jsonText string) *models.GeminiQuizResponse {
+	// The title is decoded as a JSON string so escaped quotes don't cut it short
 	var title string
-	if len(titleMatch) > 1 {
-		title = titleMatch[1]
+	titlePattern := regexp.MustCompile(`"title"\s*:\s*("(?:[^"\\]|\\.)*")`)
+	if titleMatch := titlePattern.FindStringSubmatch(jsonText); len(titleMatch) > 1 {
+		if err := json.Unmarshal([]byte(titleMatch[1]), &title); err != nil {
+			title = ""
+		}
 	}
 
-	questionPattern := regexp.MustCompile(`\{(?s)(?:\s*)"text"(?:\s*):(?:\s*)"([^"]*)"(?:\s*),(?:\s*)"topic"(?:\s*):(?:\s*)"([^"]*)"(?:\s*),(?:\s*)"options"(?:\s*):(?:\s*)\[(.*?)\](?:\s*)\}`)
-	matches := questionPattern.FindAllStringSubmatch(jsonText, -1)
-	if len(matches) == 0 {
+	questionsPattern := regexp.MustCompile(`"questions"\s*:\s*\[`)
+	loc := questionsPattern.FindStringIndex(jsonText)
+	if loc == nil {
 		return nil
 	}
 
-	var validQuestions []models.GeminiQuestion
-	for _, match := range matches {
-		if len(match) < 4 {
-			continue
-		}
-		questionText := match[1]
-		topicText := match[2]
-		optionsText := match[3]
-
-		optionPattern := regexp.MustCompile(`\{(?s)(?:\s*)"text"(?:\s*):(?:\s*)"([^"]*)"(?:\s*),(?:\s*)"is_correct"(?:\s*):(?:\s*)(true|false)(?:\s*),(?:\s*)"explanation"(?:\s*):(?:\s*)"([^"]*)"(?:\s*)\}`)
-		optionMatches := optionPattern.FindAllStringSubmatch(optionsText, -1)
-		if len(optionMatches) != 4 {
-			continue
-		}
-
-		var options []models.GeminiOption
-		correctCount := 0
-		for _, optionMatch := range optionMatches {
-			if len(optionMatch) < 4 {
-				continue
-			}
-			optionText := optionMatch[1]
-			isCorrect := optionMatch[2] == "true"
-			explanationText := optionMatch[3]
-			if isCorrect {
-				correctCount++
-			}
-			options = append(options, models.GeminiOption{
-				Text:        optionText,
-				IsCorrect:   isCorrect,
-				Explanation: explanationText,
-			})
-		}
+	// Start the decoder at the opening bracket so it handles the commas between questions
+	decoder := json.NewDecoder(strings.NewReader(jsonText[loc[1]-1:]))
+	if _, err := decoder.Token(); err != nil {
+		return nil
+	}
 
-		if correctCount != 1 || len(options) != 4 {
-			continue
+	var questions []models.GeminiQuestion
+	for decoder.More() {
+		var question models.GeminiQuestion
+		if err := decoder.Decode(&question); err != nil {
+			break // The rest of the JSON is incomplete or malformed
 		}
-		validQuestions = append(validQuestions, models.GeminiQuestion{
-			Text:    questionText,
-			Topic:   topicText,
-			Options: options,
-		})
+		questions = append(questions, question)
 	}
 
-	if len(validQuestions) == 0 {
+	if len(questions) == 0 {
 		return nil
 	}
 	return &models.GeminiQuizResponse{
 		Title:     title,
-		Questions: validQuestions,
+		Questions: questions,
 	}
 }
 
@@ -726,10 +832,10 @@ func limitQuizSize(quizResponse *models.GeminiQuizResponse, maxQuestions int) *m
 	if quizResponse == nil || len(quizResponse.Questions) <= maxQuestions {
 		return quizResponse
 	}
-	limitedResponse := &models.GeminiQuizResponse{
-		Questions: quizResponse.Questions[:maxQuestions],
-	}
-	return limitedResponse
+	// Copy the response so the title and description are kept
+	limitedResponse := *quizResponse
+	limitedResponse.Questions = quizResponse.Questions[:maxQuestions]
+	return &limitedResponse
 }
 
 // SaveTempFile saves a file to a temporary location
@@ -747,6 +853,12 @@ type DocumentFile struct {
 	Name string
 	Path string
 	Size int64
+
+	// Set for chunks of a document that was split by SplitDocuments
+	Text      string // Extracted text, sent instead of the file
+	Source    string // Path of the document the chunk was taken from
+	FirstPage int    // Pages of the document covered by Text
+	LastPage  int
 }
 
 // NewDocumentFile creates a new DocumentFile from a file
@@ -772,6 +884,25 @@ func NewDocumentFile(file io.Reader, filename string, size int64) (*DocumentFile
 	}, nil
 }
 
+// MIME types of the document formats whose text is extracted locally
+const (
+	docxMimeType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	pptxMimeType = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	epubMimeType = "application/epub+zip"
+)
+
+// extractedTypes are the document formats SplitDocuments extracts the text of. Gemini reads
+// PDFs itself when extraction fails, but doesn't reliably accept the others.
+var extractedTypes = map[string]bool{
+	"application/pdf": true,
+	docxMimeType:      true,
+	pptxMimeType:      true,
+	epubMimeType:      true,
+}
+
+// SupportedExtensions are the extensions of the document formats accepted for quiz generation
+var SupportedExtensions = []string{".pdf", ".txt", ".md", ".docx", ".pptx", ".epub"}
+
 // getMimeType returns the MIME type for a file based on its extension
 func getMimeType(filename string) string {
 	ext := strings.ToLower(filepath.Ext(filename))
@@ -783,7 +914,11 @@ func getMimeType(filename string) string {
 	case ".md":
 		return "text/markdown"
 	case ".docx":
-		return "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+		return docxMimeType
+	case ".pptx":
+		return pptxMimeType
+	case ".epub":
+		return epubMimeType
 	default:
 		return "application/octet-stream"
 	}
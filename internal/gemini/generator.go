@@ -0,0 +1,101 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"quizbuilderai/internal/models"
+)
+
+// Supported quiz generation providers
+const (
+	ProviderGemini = "gemini"
+	ProviderOpenAI = "openai"
+	ProviderFake   = "fake"
+)
+
+// ExpectedCandidateTokensPerChunk is the output expected from one generation call when estimating usage.
+// Calls may produce up to 8192 tokens, but most quizzes need about half of that.
+const ExpectedCandidateTokensPerChunk = 4096
+
+// TokenUsage holds the token counts reported by a generation provider
+type TokenUsage struct {
+	PromptTokens    int32 `json:"prompt_tokens"`
+	CandidateTokens int32 `json:"candidate_tokens"`
+	TotalTokens     int32 `json:"total_tokens"`
+}
+
+// Add returns the sum of two usages
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:    u.PromptTokens + other.PromptTokens,
+		CandidateTokens: u.CandidateTokens + other.CandidateTokens,
+		TotalTokens:     u.TotalTokens + other.TotalTokens,
+	}
+}
+
+// QuizGenerator turns a set of documents into a quiz.
+// Implementations must return the tokens they consumed even when they fail,
+// so that usage can still be recorded against the user.
+type QuizGenerator interface {
+	// Name identifies the provider and model, e.g. "gemini/gemini-2.0-flash"
+	Name() string
+	// EstimateUsage predicts the tokens ProcessDocuments will use for the documents without generating anything
+	EstimateUsage(ctx context.Context, files []DocumentFile, opts GenerationOptions) (TokenUsage, error)
+	// ProcessDocuments generates a quiz from the given documents shaped by opts, which must be valid.
+	// Model-backed providers merge duplicate questions across documents with DedupeQuestions before the quiz is trimmed
+	// to the requested question count, then the quiz gets one title and description covering all
+	// documents. Progress is reported to progress, which may be nil.
+	ProcessDocuments(ctx context.Context, files []DocumentFile, opts GenerationOptions, progress ProgressFunc) (*models.GeminiQuizResponse, TokenUsage, error)
+	// Close releases any resources held by the generator
+	Close()
+}
+
+// Config selects the quiz generation provider and model
+type Config struct {
+	Provider string // One of ProviderGemini, ProviderOpenAI or ProviderFake
+	Model    string // Provider specific model name, empty for the provider default
+	APIKey   string // API key, empty to use the provider's own environment variable
+	BaseURL  string // Base URL for OpenAI-compatible APIs
+	// SummaryModel titles and describes merged quizzes, empty for the provider default (Gemini only)
+	SummaryModel string
+}
+
+// ConfigFromEnv reads the generator configuration from environment variables.
+// LLM_PROVIDER defaults to gemini, LLM_MODEL and LLM_SUMMARY_MODEL to the provider's default models.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Provider:     strings.ToLower(strings.TrimSpace(os.Getenv("LLM_PROVIDER"))),
+		Model:        strings.TrimSpace(os.Getenv("LLM_MODEL")),
+		APIKey:       os.Getenv("LLM_API_KEY"),
+		BaseURL:      os.Getenv("LLM_BASE_URL"),
+		SummaryModel: strings.TrimSpace(os.Getenv("LLM_SUMMARY_MODEL")),
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = ProviderGemini
+	}
+	return cfg
+}
+
+// NewGenerator creates the QuizGenerator selected by cfg
+func NewGenerator(cfg Config) (QuizGenerator, error) {
+	switch cfg.Provider {
+	case ProviderGemini, "":
+		return NewClient(cfg)
+	case ProviderOpenAI:
+		return NewOpenAIClient(cfg)
+	case ProviderFake:
+		return NewFakeGenerator(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q (expected %s, %s or %s)", cfg.Provider, ProviderGemini, ProviderOpenAI, ProviderFake)
+	}
+}
+
+// Compile-time checks that all providers implement QuizGenerator
+var (
+	_ QuizGenerator = (*Client)(nil)
+	_ QuizGenerator = (*OpenAIClient)(nil)
+	_ QuizGenerator = (*FakeGenerator)(nil)
+)
@@ -0,0 +1,21 @@
+package gemini
+
+import "expvar"
+
+// Counters of how generated quiz responses were decoded and validated.
+// They are published with the process' other expvars on the metrics listener (GET /debug/vars on METRICS_ADDR).
+var generationMetrics = expvar.NewMap("quiz_generation")
+
+// Keys of generationMetrics
+const (
+	metricResponses         = "responses"          // Responses with content
+	metricDecoded           = "decoded"            // Responses that decoded as they were
+	metricRepairAttempts    = "repair_attempts"    // Responses that needed the JSON repair fallback
+	metricRepairSucceeded   = "repair_succeeded"   // Repairs that recovered at least one question
+	metricRepairFailed      = "repair_failed"      // Repairs that recovered nothing
+	metricQuestionsAccepted = "questions_accepted" // Questions that passed validation
+	metricQuestionsRejected = "questions_rejected" // Questions that failed validation
+)
+
+// questionRejectionMetrics counts rejected questions per question type
+var questionRejectionMetrics = expvar.NewMap("quiz_generation_rejections")
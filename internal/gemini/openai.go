@@ -0,0 +1,285 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"quizbuilderai/internal/models"
+)
+
+const (
+	// DefaultOpenAIBaseURL is used when no base URL is configured
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	// DefaultOpenAIModel is used when no model is configured
+	DefaultOpenAIModel = "gpt-4o-mini"
+	// maxOpenAIDocumentBytes caps the text sent for a single document
+	maxOpenAIDocumentBytes = 2 * 1024 * 1024
+)
+
+// OpenAIClient generates quizzes through any OpenAI-compatible chat completions API
+type OpenAIClient struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+	model      string
+}
+
+// NewOpenAIClient creates a client for an OpenAI-compatible API.
+// An empty cfg.APIKey falls back to the OPENAI_API_KEY environment variable.
+func NewOpenAIClient(cfg Config) (*OpenAIClient, error) {
+	apiKey := cfg.APIKey
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY environment variable not set")
+	}
+
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	model := cfg.Model
+	if model == "" {
+		model = DefaultOpenAIModel
+	}
+
+	return &OpenAIClient{
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+		baseURL:    baseURL,
+		apiKey:     apiKey,
+		model:      model,
+	}, nil
+}
+
+// Name returns the provider and model used by this client
+func (c *OpenAIClient) Name() string {
+	return "openai/" + c.model
+}
+
+// Close is a no-op, the HTTP client holds no resources that need releasing
+func (c *OpenAIClient) Close() {}
+
+// Request and response shapes of the chat completions API (only the fields we use)
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type openAIChatRequest struct {
+	Model          string               `json:"model"`
+	Messages       []openAIMessage      `json:"messages"`
+	Temperature    float32              `json:"temperature"`
+	MaxTokens      int32                `json:"max_tokens"`
+	ResponseFormat openAIResponseFormat `json:"response_format"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message      openAIMessage `json:"message"`
+		FinishReason string        `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int32 `json:"prompt_tokens"`
+		CompletionTokens int32 `json:"completion_tokens"`
+		TotalTokens      int32 `json:"total_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// EstimateUsage approximates the prompt tokens of every document at 4 bytes per token,
+// as chat completion APIs have no endpoint for counting tokens
+func (c *OpenAIClient) EstimateUsage(ctx context.Context, files []DocumentFile, opts GenerationOptions) (TokenUsage, error) {
+	var usage TokenUsage
+	if len(files) == 0 {
+		return usage, fmt.Errorf("no files provided for processing")
+	}
+	prompts := opts.chunkPrompts(len(files))
+	for _, file := range files {
+		text, err := readDocumentText(file)
+		if err != nil {
+			return usage, err
+		}
+		for _, prompt := range prompts {
+			usage.PromptTokens += int32((len(prompt)+len(text))/4) + 1
+		}
+	}
+	usage.CandidateTokens = opts.expectedCandidateTokens(len(files))
+	usage.TotalTokens = usage.PromptTokens + usage.CandidateTokens
+	return usage, nil
+}
+
+// ProcessDocuments generates a quiz for each document in turn and merges the results.
+// Only text documents are supported, as chat completion APIs don't accept raw PDFs;
+// PDFs, DOCX, PPTX and EPUB files work once SplitDocuments has extracted their text.
+// Each document gets its share of the requested question count and is reported as one chunk, or as
+// several if its share is more than MaxQuestionsPerCall.
+func (c *OpenAIClient) ProcessDocuments(ctx context.Context, files []DocumentFile, opts GenerationOptions, progress ProgressFunc) (*models.GeminiQuizResponse, TokenUsage, error) {
+	var usage TokenUsage
+	if len(files) == 0 {
+		return nil, usage, fmt.Errorf("no files provided for processing")
+	}
+	prompts := opts.chunkPrompts(len(files))
+	total := len(files) * len(prompts)
+
+	ctx, cancel := context.WithTimeout(ctx, 20*time.Minute)
+	defer cancel()
+
+	var combined *models.GeminiQuizResponse
+	var titles []string
+	for i, file := range files {
+		text, err := readDocumentText(file)
+		if err != nil {
+			return nil, usage, err
+		}
+
+		for part, prompt := range prompts {
+			index := i*len(prompts) + part + 1
+			progress.Emit(ProgressEvent{
+				Stage:   StageChunkStarted,
+				Message: fmt.Sprintf("Processing chunk %d of %d", index, total),
+				Index:   index,
+				Total:   total,
+				Files:   []string{file.Name},
+			})
+			quiz, chunkUsage, err := c.generateQuiz(ctx, prompt, file.Name, text, progress)
+			usage = usage.Add(chunkUsage)
+			file.attributeQuestions(quiz)
+			finished := ProgressEvent{
+				Stage:   StageChunkFinished,
+				Message: fmt.Sprintf("Finished chunk %d of %d", index, total),
+				Index:   index,
+				Total:   total,
+				Files:   []string{file.Name},
+				Usage:   &chunkUsage,
+			}
+			if err != nil {
+				finished.Message = fmt.Sprintf("Chunk %d of %d failed", index, total)
+				finished.Error = err.Error()
+			}
+			progress.Emit(finished)
+			if err != nil {
+				return nil, usage, fmt.Errorf("failed to process %s: %w", file.Name, err)
+			}
+
+			if quiz.Title != "" {
+				titles = append(titles, quiz.Title)
+			}
+			if combined == nil {
+				combined = quiz
+			} else {
+				combined.Questions = append(combined.Questions, quiz.Questions...)
+			}
+		}
+	}
+
+	if combined == nil || len(combined.Questions) == 0 {
+		return nil, usage, fmt.Errorf("no questions generated from any files")
+	}
+	DedupeQuestions(combined, progress)
+	opts.trimQuestions(combined)
+	summarizeQuiz(combined, titles)
+	return combined, usage, nil
+}
+
+// generateQuiz sends a single document to the chat completions endpoint and parses the quiz
+func (c *OpenAIClient) generateQuiz(ctx context.Context, prompt string, name string, text string, progress ProgressFunc) (*models.GeminiQuizResponse, TokenUsage, error) {
+	var usage TokenUsage
+
+	reqBody := openAIChatRequest{
+		Model: c.model,
+		Messages: []openAIMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: fmt.Sprintf("Document: %s\n\n%s", name, text)},
+		},
+		Temperature:    0.95,
+		MaxTokens:      8192,
+		ResponseFormat: openAIResponseFormat{Type: "json_object"},
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, usage, fmt.Errorf("failed to marshal chat request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, usage, fmt.Errorf("failed to create chat request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, usage, fmt.Errorf("chat request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, usage, fmt.Errorf("failed to read chat response: %w", err)
+	}
+
+	var chatResp openAIChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil {
+		return nil, usage, fmt.Errorf("failed to parse chat response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 300 {
+		if chatResp.Error != nil {
+			return nil, usage, fmt.Errorf("chat request failed with status %d: %s", resp.StatusCode, chatResp.Error.Message)
+		}
+		return nil, usage, fmt.Errorf("chat request failed with status %d", resp.StatusCode)
+	}
+
+	usage = TokenUsage{
+		PromptTokens:    chatResp.Usage.PromptTokens,
+		CandidateTokens: chatResp.Usage.CompletionTokens,
+		TotalTokens:     chatResp.Usage.TotalTokens,
+	}
+	log.Printf("INFO: OpenAI Token Usage: Prompt=%d, Candidates=%d, Total=%d", usage.PromptTokens, usage.CandidateTokens, usage.TotalTokens)
+
+	if len(chatResp.Choices) == 0 || chatResp.Choices[0].Message.Content == "" {
+		return nil, usage, fmt.Errorf("no content generated")
+	}
+
+	quizResponse, err := decodeQuizResponse(chatResp.Choices[0].Message.Content, name, progress)
+	if err != nil {
+		return nil, usage, err
+	}
+	return limitQuizSize(quizResponse, 200), usage, nil
+}
+
+// readDocumentText reads a text document for providers that can't take binary files
+func readDocumentText(file DocumentFile) (string, error) {
+	if file.Text != "" {
+		return file.Text, nil
+	}
+	mimeType := getMimeType(file.Name)
+	if !strings.HasPrefix(mimeType, "text/") {
+		return "", fmt.Errorf("file %s (%s) is not supported by this provider, only text documents are", file.Name, mimeType)
+	}
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file %s: %w", file.Name, err)
+	}
+	if len(data) == 0 {
+		return "", fmt.Errorf("file %s is empty", file.Name)
+	}
+	if len(data) > maxOpenAIDocumentBytes {
+		data = data[:maxOpenAIDocumentBytes]
+	}
+	return string(data), nil
+}
@@ -0,0 +1,400 @@
+package gemini
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"quizbuilderai/internal/models"
+)
+
+// Limits for generation options
+const (
+	MaxQuestionCount   = 100 // Same as the most questions kept from one generation
+	MaxFocusTopics     = 10
+	MaxFocusTopicChars = 100
+)
+
+// MaxQuestionsPerCall is the most questions asked of one generation call. At about 200 tokens per
+// question more wouldn't reliably fit the 8192 output tokens of a call, so a chunk with a larger
+// share of the question count is generated in several parts.
+const MaxQuestionsPerCall = 30
+
+// Difficulty levels of a generated quiz
+const (
+	DifficultyEasy   = "easy"
+	DifficultyMedium = "medium"
+	DifficultyHard   = "hard"
+	DifficultyMixed  = "mixed"
+)
+
+// Cognitive levels of Bloom's taxonomy, from lowest to highest
+const (
+	BloomRemember   = "remember"
+	BloomUnderstand = "understand"
+	BloomApply      = "apply"
+	BloomAnalyze    = "analyze"
+	BloomEvaluate   = "evaluate"
+	BloomCreate     = "create"
+)
+
+// bloomLevels lists the Bloom levels in order, with the description used in the prompt
+var bloomLevels = []struct {
+	name        string
+	description string
+}{
+	{BloomRemember, "factual recall of definitions, facts and terms"},
+	{BloomUnderstand, "comprehension questions that require explaining or interpreting concepts"},
+	{BloomApply, "applying principles to new scenarios"},
+	{BloomAnalyze, "analyzing relationships between concepts and connecting ideas across sections"},
+	{BloomEvaluate, "evaluating implications, comparing competing approaches and identifying unstated assumptions"},
+	{BloomCreate, "predicting outcomes and combining ideas into new solutions"},
+}
+
+var difficultyDescriptions = map[string]string{
+	DifficultyEasy:   "easy: straightforward questions on the central ideas, with clearly distinguishable options",
+	DifficultyMedium: "of medium difficulty: questions that require a solid understanding of the material",
+	DifficultyHard:   "hard: questions on subtle details and edge cases, with very plausible distractors",
+	DifficultyMixed:  "of mixed difficulty: roughly a third easy, a third medium and a third hard",
+}
+
+// languagePattern accepts language names and codes like "German", "pt-BR" or "Español"
+var languagePattern = regexp.MustCompile(`^\p{L}[\p{L} -]{1,49}$`)
+
+// GenerationOptions lets the user shape a generated quiz. The zero value lets the model decide everything.
+type GenerationOptions struct {
+	QuestionCount int            `json:"question_count,omitempty"` // Number of questions, 0 to cover the material
+	Difficulty    string         `json:"difficulty,omitempty"`     // One of the Difficulty constants
+	BloomMix      map[string]int `json:"bloom_mix,omitempty"`      // Percentage of questions per Bloom level, summing to 100
+	FocusTopics   []string       `json:"focus_topics,omitempty"`   // Topics the questions should concentrate on
+	Language      string         `json:"language,omitempty"`       // Language of the quiz, empty for the language of the documents
+	// Question types to use (see the models.QuestionType constants), empty for multiple choice only
+	QuestionTypes []string `json:"question_types,omitempty"`
+}
+
+// Normalize trims and lowercases the options' values where that doesn't change their meaning
+func (o GenerationOptions) Normalize() GenerationOptions {
+	o.Difficulty = strings.ToLower(strings.TrimSpace(o.Difficulty))
+	o.Language = strings.TrimSpace(o.Language)
+
+	if len(o.BloomMix) > 0 {
+		mix := make(map[string]int, len(o.BloomMix))
+		for level, percent := range o.BloomMix {
+			level = strings.ToLower(strings.TrimSpace(level))
+			mix[level] += percent
+		}
+		o.BloomMix = mix
+	}
+
+	var topics []string
+	for _, topic := range o.FocusTopics {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	o.FocusTopics = topics
+
+	var types []string
+	for _, qt := range o.QuestionTypes {
+		qt = strings.ToLower(strings.TrimSpace(qt))
+		if qt != "" && !slices.Contains(types, qt) {
+			types = append(types, qt)
+		}
+	}
+	o.QuestionTypes = types
+	return o
+}
+
+// Validate reports the first option that is out of range. Call Normalize first.
+func (o GenerationOptions) Validate() error {
+	if o.QuestionCount < 0 || o.QuestionCount > MaxQuestionCount {
+		return fmt.Errorf("question count must be between 1 and %d", MaxQuestionCount)
+	}
+
+	if o.Difficulty != "" {
+		if _, ok := difficultyDescriptions[o.Difficulty]; !ok {
+			return fmt.Errorf("difficulty must be one of %s, %s, %s or %s", DifficultyEasy, DifficultyMedium, DifficultyHard, DifficultyMixed)
+		}
+	}
+
+	if len(o.BloomMix) > 0 {
+		total := 0
+		for level, percent := range o.BloomMix {
+			if !isBloomLevel(level) {
+				return fmt.Errorf("unknown Bloom level %q (expected %s)", level, strings.Join(bloomLevelNames(), ", "))
+			}
+			if percent < 0 || percent > 100 {
+				return fmt.Errorf("percentage for Bloom level %s must be between 0 and 100", level)
+			}
+			total += percent
+		}
+		if total != 100 {
+			return fmt.Errorf("Bloom level percentages must add up to 100, got %d", total)
+		}
+	}
+
+	if len(o.FocusTopics) > MaxFocusTopics {
+		return fmt.Errorf("at most %d focus topics are allowed", MaxFocusTopics)
+	}
+	for _, topic := range o.FocusTopics {
+		if len([]rune(topic)) > MaxFocusTopicChars {
+			return fmt.Errorf("focus topic %q is longer than %d characters", topic, MaxFocusTopicChars)
+		}
+	}
+
+	if o.Language != "" && !languagePattern.MatchString(o.Language) {
+		return fmt.Errorf("language %q is not a valid language name or code", o.Language)
+	}
+
+	for _, qt := range o.QuestionTypes {
+		if !isQuestionType(qt) {
+			return fmt.Errorf("unknown question type %q (expected %s)", qt, strings.Join(QuestionTypeNames(), ", "))
+		}
+	}
+	return nil
+}
+
+// forChunks returns the options for one of n chunks generated separately.
+// The question count is split between the chunks, rounding up; the merged result is trimmed afterwards.
+func (o GenerationOptions) forChunks(n int) GenerationOptions {
+	if o.QuestionCount > 0 && n > 1 {
+		o.QuestionCount = (o.QuestionCount + n - 1) / n
+	}
+	return o
+}
+
+// partsPerChunk is the number of calls each of n chunks is generated in, so that no call is asked
+// for more than MaxQuestionsPerCall questions
+func (o GenerationOptions) partsPerChunk(n int) int {
+	count := o.forChunks(n).QuestionCount
+	return max(1, (count+MaxQuestionsPerCall-1)/MaxQuestionsPerCall)
+}
+
+// chunkPrompts returns the prompt of each call one of n chunks is generated in. When a chunk takes
+// several calls, each asks for its share of the chunk's questions about its own portion of the
+// material, so the parts don't ask the same questions.
+func (o GenerationOptions) chunkPrompts(n int) []string {
+	chunk := o.forChunks(n)
+	parts := o.partsPerChunk(n)
+	if parts == 1 {
+		return []string{BuildPrompt(chunk)}
+	}
+	part := chunk.forChunks(parts)
+	prompts := make([]string, parts)
+	for i := range prompts {
+		prompts[i] = buildPrompt(part, i+1, parts)
+	}
+	return prompts
+}
+
+// expectedCandidateTokens estimates the output of generating n chunks with these options
+func (o GenerationOptions) expectedCandidateTokens(n int) int32 {
+	if o.QuestionCount == 0 {
+		return int32(n) * ExpectedCandidateTokensPerChunk
+	}
+	// About 200 tokens per question with four explained options, plus the title
+	parts := o.partsPerChunk(n)
+	perCall := int32(o.forChunks(n).forChunks(parts).QuestionCount)*200 + 100
+	if perCall > ExpectedCandidateTokensPerChunk*2 {
+		perCall = ExpectedCandidateTokensPerChunk * 2 // The output limit of one call
+	}
+	return int32(n*parts) * perCall
+}
+
+// trimQuestions cuts a merged quiz down to the requested question count
+func (o GenerationOptions) trimQuestions(quiz *models.GeminiQuizResponse) {
+	if quiz != nil && o.QuestionCount > 0 && len(quiz.Questions) > o.QuestionCount {
+		quiz.Questions = quiz.Questions[:o.QuestionCount]
+	}
+}
+
+func isBloomLevel(name string) bool {
+	for _, level := range bloomLevels {
+		if level.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func bloomLevelNames() []string {
+	names := make([]string, len(bloomLevels))
+	for i, level := range bloomLevels {
+		names[i] = level.name
+	}
+	return names
+}
+
+// bloomShare is one line of the Bloom mix in the prompt
+type bloomShare struct {
+	Percent     int
+	Level       string
+	Description string
+}
+
+// questionTypeSpec is one of the question types offered in the prompt
+type questionTypeSpec struct {
+	Name        string
+	Description string
+	Example     string
+}
+
+// promptData is what quizPromptTemplate is executed with
+type promptData struct {
+	QuestionCount int
+	Part, Parts   int // Which of several calls generating one chunk this is, 0 for a single call
+	Difficulty    string
+	BloomShares   []bloomShare
+	FocusTopics   []string
+	Language      string
+	QuestionTypes []questionTypeSpec // Empty for multiple choice only
+}
+
+// quizPromptTemplate is the prompt used to generate quizzes. Without options it asks for a
+// balanced quiz covering all of the material.
+var quizPromptTemplate = template.Must(template.New("quiz").Parse(`Generate a comprehensive {{if not .QuestionTypes}}multiple-choice {{end}}quiz based on the content of these documents. Make sure to finish your response (the questions in proper indicated json format) before you run out of tokens. Basically finish your response ALWAYS or the world gets destroyed.
+
+IMPORTANT: If the provided material is already in a quiz format, then simply format the material as a quiz in the JSON schema provided, filling in the missing information (e.g. if there are only questions and options, you have to determine which one is the correct one and also create the explanations for the options.)
+
+Follow these requirements exactly:
+
+1. Create a descriptive title for the quiz that accurately reflects the main subject matter of the documents
+{{- if .FocusTopics}}
+2. Focus the questions on these topics: {{range $i, $t := .FocusTopics}}{{if $i}}; {{end}}{{$t}}{{end}}. Only cover other content where it is needed to understand these topics. Include the topic for each question (so that questions can be grouped by topic later.). DON'T reference the documents in the questions or options. The questions should be self-contained and understandable without needing to refer back to the documents.
+{{- else}}
+2. Create questions covering ALL main topics and subtopics in the documents, ensuring no significant concept is omitted. Include the topic for each question (so that questions can be grouped by topic later.). DON'T reference the documents in the questions or options. The questions should be self-contained and understandable without needing to refer back to the documents.
+{{- end}}
+{{- if .BloomShares}}
+3. Distribute the questions across these cognitive levels (Bloom's taxonomy), as a share of all questions:
+{{- range .BloomShares}}
+   - {{.Percent}}% {{.Level}}: {{.Description}}
+{{- end}}
+{{- else}}
+3. Include a balanced distribution of question types:
+   - Basic factual recall questions
+   - Comprehension questions that require understanding concepts
+   - Application/analysis questions that require:
+     * Applying principles to new scenarios
+     * Analyzing relationships between concepts
+     * Connecting ideas across different sections
+   - Synthesis/evaluation questions that require:
+     * Evaluating implications or consequences of key ideas
+     * Comparing competing perspectives or approaches
+     * Predicting outcomes based on document principles
+     * Identifying unstated assumptions underlying concepts
+{{- end}}
+4. For analytical questions, prioritize second and third-order thinking by asking about:
+   - "What would happen if..." scenarios
+   - Underlying mechanisms or reasons behind facts
+   - How concepts interact in complex systems
+   - Potential exceptions or limitations to stated principles
+{{- if .QuestionTypes}}
+5. Give each question a "type" and vary the types, choosing for each question the type that suits its content best. Use only these types:
+{{- range .QuestionTypes}}
+   - "{{.Name}}": {{.Description}}
+{{- end}}
+{{- else}}
+5. Each question must have exactly 4 options with EXACTLY ONE correct answer
+{{- end}}
+6. For EACH answer option:
+   - Provide a concise "explanation" field detailing WHY the option is correct OR incorrect based on the source documents. Don't state "This is incorrect/correct". Just say the explanation. e.g."Gravity was discovered by Isaac Newton"
+   - Make incorrect options (distractors) highly plausible by using common misconceptions or partial understandings.
+   - Ensure all options have approximately the same length and level of detail.
+   - Maintain consistent grammar, style, and tone across all options.
+   - Avoid obvious wrong answers or "joke" options.
+7. Give each question a "source": a short verbatim "quote" (at most 30 words) of the passage its answer is found in.
+   - If the document text marks its pages like [Page 12] or its slides like [Slide 12], also set "page" to the page or slide number of that passage.
+   - If a transcript marks its times like [12:34], also set "timestamp" to the seconds into the video of that passage, e.g. 754 for [12:34].
+{{- if or .QuestionCount .Difficulty .Language}}
+
+Additionally:
+{{- if .QuestionCount}}
+- Generate exactly {{.QuestionCount}} questions.
+{{- end}}
+{{- if .Parts}}
+- The questions on these documents are generated in {{.Parts}} separate parts and this is part {{.Part}}. Divide the material into {{.Parts}} portions of about equal length in reading order and only ask about portion {{.Part}} (e.g. part 1 of 3 covers the first third); the other parts cover the rest.
+{{- end}}
+{{- if .Difficulty}}
+- Make the quiz {{.Difficulty}}.
+{{- end}}
+{{- if .Language}}
+- Write the title, questions, topics, options and explanations in {{.Language}}, whatever the language of the documents.
+{{- end}}
+{{- end}}
+
+Format your response as a JSON object with the following structure:
+{{- if .QuestionTypes}}
+{
+  "title": "Descriptive, Concise, General Quiz Title Based on Document Content",
+  "questions": [
+{{- range .QuestionTypes}}
+    {{.Example}},
+{{- end}}
+    ...more questions...
+  ]
+}
+{{- else}}
+{
+  "title": "Descriptive, Concise, General Quiz Title Based on Document Content",
+  "questions": [
+    {
+      "text": "Question text here?",
+      "topic": "the topic this question is about.",
+      "options": [
+        {"text": "Option A", "is_correct": false, "explanation": "Explanation why A is incorrect."},
+        {"text": "Option B", "is_correct": true, "explanation": "Explanation why B is correct."},
+        {"text": "Option C", "is_correct": false, "explanation": "Explanation why C is incorrect."},
+        {"text": "Option D", "is_correct": false, "explanation": "Explanation why D is incorrect."}
+      ],
+      "source": {"quote": "Short quote of the passage the answer is found in.", "page": 12}
+    },
+    ...more questions...
+  ]
+}
+{{- end}}
+`))
+
+// PromptVersion identifies the prompts and the handling of the model output. Cached generations of
+// other versions are not reused, so change it whenever a change affects the generated questions.
+const PromptVersion = "2"
+
+// BuildPrompt renders the quiz prompt for the given options, which must be valid
+func BuildPrompt(opts GenerationOptions) string {
+	return buildPrompt(opts, 0, 0)
+}
+
+// buildPrompt renders the quiz prompt for part of parts calls generating one chunk, 0 of 0 for a single call
+func buildPrompt(opts GenerationOptions, part, parts int) string {
+	data := promptData{
+		QuestionCount: opts.QuestionCount,
+		Part:          part,
+		Parts:         parts,
+		Difficulty:    difficultyDescriptions[opts.Difficulty],
+		FocusTopics:   opts.FocusTopics,
+		Language:      opts.Language,
+	}
+	// Multiple choice only is what the prompt asks for without question types
+	if len(opts.QuestionTypes) > 0 && !slices.Equal(opts.QuestionTypes, []string{models.QuestionTypeMultipleChoice}) {
+		for _, qt := range questionTypes {
+			if slices.Contains(opts.QuestionTypes, qt.name) {
+				data.QuestionTypes = append(data.QuestionTypes, questionTypeSpec{Name: qt.name, Description: qt.description, Example: qt.example})
+			}
+		}
+	}
+	for _, level := range bloomLevels {
+		if percent := opts.BloomMix[level.name]; percent > 0 {
+			data.BloomShares = append(data.BloomShares, bloomShare{Percent: percent, Level: level.name, Description: level.description})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := quizPromptTemplate.Execute(&buf, data); err != nil {
+		// Only possible if the template itself is broken
+		log.Printf("ERROR: Failed to render quiz prompt: %v", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,64 @@
+package gemini
+
+import "time"
+
+// ProgressStage identifies a step of quiz generation
+type ProgressStage string
+
+// Stages reported while a quiz is generated, roughly in the order they happen
+const (
+	StageFileSaved         ProgressStage = "file_saved"
+	StageTranscriptFetched ProgressStage = "transcript_fetched"
+	StagePageFetched       ProgressStage = "page_fetched"
+	StageCacheHit          ProgressStage = "cache_hit" // The quiz is built from an earlier generation of the same material
+	StageChunkStarted      ProgressStage = "chunk_started"
+	StageChunkFinished     ProgressStage = "chunk_finished"
+	StageBatchStarted      ProgressStage = "batch_started"
+	StageBatchFinished     ProgressStage = "batch_finished"
+	StageJSONRepair        ProgressStage = "json_repair"
+	StageValidation        ProgressStage = "question_validation"
+	StageDedupe            ProgressStage = "dedupe"
+	StageSummary           ProgressStage = "summary"
+	StageDBCommit          ProgressStage = "db_commit"
+	StageCompleted         ProgressStage = "completed"
+	StageFailed            ProgressStage = "failed"
+)
+
+// ProgressEvent describes a finished step of quiz generation
+type ProgressEvent struct {
+	Stage   ProgressStage `json:"stage"`
+	Message string        `json:"message"`
+	Index   int           `json:"index,omitempty"` // 1-based chunk or batch number
+	Total   int           `json:"total,omitempty"` // Number of chunks or batches
+	Files   []string      `json:"files,omitempty"` // Documents the event is about
+	Usage   *TokenUsage   `json:"usage,omitempty"` // Tokens used by the chunk or batch
+	QuizID  string        `json:"quiz_id,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Time    time.Time     `json:"time"`
+	// Generated questions that were dropped, and why
+	Rejections []QuestionRejection `json:"rejections,omitempty"`
+}
+
+// ProgressFunc receives progress events. It may be called from several goroutines
+// at once and should return quickly. A nil ProgressFunc discards all events.
+type ProgressFunc func(ProgressEvent)
+
+// Emit sends an event, stamping it with the current time. It is safe to call on a nil ProgressFunc.
+func (f ProgressFunc) Emit(event ProgressEvent) {
+	if f == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	f(event)
+}
+
+// documentNames returns the names of the given documents, for progress events
+func documentNames(files []DocumentFile) []string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = f.Name
+	}
+	return names
+}
@@ -0,0 +1,219 @@
+package gemini
+
+import (
+	"fmt"
+	"strings"
+
+	"quizbuilderai/internal/models"
+)
+
+// Limits on the answers of generated questions
+const (
+	MinChoiceOptions   = 3  // Fewest options of a multi-select question
+	MaxChoiceOptions   = 6  // Most options of a multi-select question
+	MinOrderedItems    = 3  // Fewest items of an ordering question
+	MaxOrderedItems    = 8  // Most items of an ordering question
+	MinMatchPairs      = 3  // Fewest pairs of a matching question
+	MaxMatchPairs      = 8  // Most pairs of a matching question
+	MaxAcceptedAnswers = 10 // Most accepted answers of a short-answer question
+)
+
+// questionTypes lists the question types in the order they are described in the prompt,
+// with the instructions and an example of the JSON the model should produce for them
+var questionTypes = []struct {
+	name        string
+	description string
+	example     string
+}{
+	{
+		models.QuestionTypeMultipleChoice,
+		"exactly 4 options with EXACTLY ONE correct answer",
+		`{"type": "multiple_choice", "text": "Question text here?", "topic": "the topic", "options": [{"text": "Option A", "is_correct": false, "explanation": "..."}, {"text": "Option B", "is_correct": true, "explanation": "..."}, {"text": "Option C", "is_correct": false, "explanation": "..."}, {"text": "Option D", "is_correct": false, "explanation": "..."}], "source": {"quote": "..."}}`,
+	},
+	{
+		models.QuestionTypeTrueFalse,
+		`a statement to judge, with exactly 2 options "True" and "False" of which exactly one is correct`,
+		`{"type": "true_false", "text": "Statement to judge.", "topic": "the topic", "options": [{"text": "True", "is_correct": false, "explanation": "..."}, {"text": "False", "is_correct": true, "explanation": "..."}], "source": {"quote": "..."}}`,
+	},
+	{
+		models.QuestionTypeMultiSelect,
+		fmt.Sprintf("%d to %d options of which at least one, but not all, are correct; the question asks to select all that apply", MinChoiceOptions, MaxChoiceOptions),
+		`{"type": "multi_select", "text": "Which of these ...? Select all that apply.", "topic": "the topic", "options": [{"text": "Option A", "is_correct": true, "explanation": "..."}, {"text": "Option B", "is_correct": true, "explanation": "..."}, {"text": "Option C", "is_correct": false, "explanation": "..."}, {"text": "Option D", "is_correct": false, "explanation": "..."}], "source": {"quote": "..."}}`,
+	},
+	{
+		models.QuestionTypeShortAnswer,
+		`a question answered with a word or short phrase; instead of options, "accepted_answers" lists every acceptable answer (spellings, synonyms, abbreviations) and "explanation" explains the answer`,
+		`{"type": "short_answer", "text": "Question text here?", "topic": "the topic", "accepted_answers": ["answer", "alternative spelling"], "explanation": "...", "source": {"quote": "..."}}`,
+	},
+	{
+		models.QuestionTypeNumeric,
+		`a question answered with a number; instead of options, "numeric_answer" is the correct number, "tolerance" the largest accepted absolute deviation (0 if the answer must be exact) and "explanation" shows how the number is obtained`,
+		`{"type": "numeric", "text": "Question text here?", "topic": "the topic", "numeric_answer": 9.81, "tolerance": 0.01, "explanation": "...", "source": {"quote": "..."}}`,
+	},
+	{
+		models.QuestionTypeOrdering,
+		fmt.Sprintf(`%d to %d items to put in order; "options" lists the items in their CORRECT order, all with "is_correct": true and an explanation of their place, and the question says what to order them by`, MinOrderedItems, MaxOrderedItems),
+		`{"type": "ordering", "text": "Put these ... in chronological order.", "topic": "the topic", "options": [{"text": "First item", "is_correct": true, "explanation": "..."}, {"text": "Second item", "is_correct": true, "explanation": "..."}, {"text": "Third item", "is_correct": true, "explanation": "..."}], "source": {"quote": "..."}}`,
+	},
+	{
+		models.QuestionTypeMatching,
+		fmt.Sprintf(`instead of options, "pairs" lists %d to %d pairs of items that belong together (e.g. terms and definitions), each item unique, and "explanation" explains the matches`, MinMatchPairs, MaxMatchPairs),
+		`{"type": "matching", "text": "Match each ... with its ...", "topic": "the topic", "pairs": [{"left": "Term 1", "right": "Definition 1"}, {"left": "Term 2", "right": "Definition 2"}, {"left": "Term 3", "right": "Definition 3"}], "explanation": "...", "source": {"quote": "..."}}`,
+	},
+}
+
+// QuestionTypeNames returns the names of all question types
+func QuestionTypeNames() []string {
+	names := make([]string, len(questionTypes))
+	for i, qt := range questionTypes {
+		names[i] = qt.name
+	}
+	return names
+}
+
+func isQuestionType(name string) bool {
+	for _, qt := range questionTypes {
+		if qt.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateQuestion reports why a generated question can't be used, or nil if it can
+func ValidateQuestion(q models.GeminiQuestion) error {
+	if strings.TrimSpace(q.Text) == "" {
+		return fmt.Errorf("question has no text")
+	}
+
+	switch q.QuestionType() {
+	case models.QuestionTypeMultipleChoice:
+		return validateChoices(q.Options, 4, 4, true)
+	case models.QuestionTypeTrueFalse:
+		return validateChoices(q.Options, 2, 2, true)
+	case models.QuestionTypeMultiSelect:
+		if err := validateChoices(q.Options, MinChoiceOptions, MaxChoiceOptions, false); err != nil {
+			return err
+		}
+		if correct := countCorrect(q.Options); correct == 0 || correct == len(q.Options) {
+			return fmt.Errorf("multi-select question has %d of %d options correct", correct, len(q.Options))
+		}
+		return nil
+	case models.QuestionTypeShortAnswer:
+		if len(q.AcceptedAnswers) == 0 || len(q.AcceptedAnswers) > MaxAcceptedAnswers {
+			return fmt.Errorf("short-answer question has %d accepted answers, expected 1 to %d", len(q.AcceptedAnswers), MaxAcceptedAnswers)
+		}
+		for _, answer := range q.AcceptedAnswers {
+			if strings.TrimSpace(answer) == "" {
+				return fmt.Errorf("short-answer question has an empty accepted answer")
+			}
+		}
+		return nil
+	case models.QuestionTypeNumeric:
+		if q.NumericAnswer == nil {
+			return fmt.Errorf("numeric question has no numeric answer")
+		}
+		if q.Tolerance < 0 {
+			return fmt.Errorf("numeric question has a negative tolerance")
+		}
+		return nil
+	case models.QuestionTypeOrdering:
+		return validateChoices(q.Options, MinOrderedItems, MaxOrderedItems, false)
+	case models.QuestionTypeMatching:
+		if len(q.Pairs) < MinMatchPairs || len(q.Pairs) > MaxMatchPairs {
+			return fmt.Errorf("matching question has %d pairs, expected %d to %d", len(q.Pairs), MinMatchPairs, MaxMatchPairs)
+		}
+		lefts := make(map[string]bool, len(q.Pairs))
+		rights := make(map[string]bool, len(q.Pairs))
+		for _, pair := range q.Pairs {
+			left, right := strings.TrimSpace(pair.Left), strings.TrimSpace(pair.Right)
+			if left == "" || right == "" {
+				return fmt.Errorf("matching question has an empty item")
+			}
+			if lefts[left] || rights[right] {
+				return fmt.Errorf("matching question has duplicate items")
+			}
+			lefts[left], rights[right] = true, true
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown question type %q", q.Type)
+	}
+}
+
+// validateChoices checks the number of options and that their texts are present and distinct.
+// With singleCorrect, exactly one option must be correct.
+func validateChoices(options []models.GeminiOption, minOptions, maxOptions int, singleCorrect bool) error {
+	if len(options) < minOptions || len(options) > maxOptions {
+		if minOptions == maxOptions {
+			return fmt.Errorf("question has %d options, expected %d", len(options), minOptions)
+		}
+		return fmt.Errorf("question has %d options, expected %d to %d", len(options), minOptions, maxOptions)
+	}
+	seen := make(map[string]bool, len(options))
+	for _, option := range options {
+		text := strings.TrimSpace(option.Text)
+		if text == "" {
+			return fmt.Errorf("question has an empty option")
+		}
+		if seen[text] {
+			return fmt.Errorf("question has duplicate option %q", text)
+		}
+		seen[text] = true
+	}
+	if singleCorrect {
+		switch correct := countCorrect(options); {
+		case correct == 0:
+			return fmt.Errorf("question has no correct answer")
+		case correct > 1:
+			return fmt.Errorf("question has multiple correct answers (%d)", correct)
+		}
+	}
+	return nil
+}
+
+func countCorrect(options []models.GeminiOption) int {
+	correct := 0
+	for _, option := range options {
+		if option.IsCorrect {
+			correct++
+		}
+	}
+	return correct
+}
+
+// QuestionRejection is a generated question that failed validation, and why
+type QuestionRejection struct {
+	Index  int    `json:"index"` // 0-based position of the question in the response
+	Text   string `json:"text"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// ValidateQuiz removes the questions of a generated quiz that fail ValidateQuestion or repeat an
+// earlier question, and returns why each of them was rejected
+func ValidateQuiz(quiz *models.GeminiQuizResponse) []QuestionRejection {
+	var rejections []QuestionRejection
+	seen := make(map[string]bool, len(quiz.Questions))
+	valid := quiz.Questions[:0]
+	for i, question := range quiz.Questions {
+		err := ValidateQuestion(question)
+		key := strings.ToLower(strings.TrimSpace(question.Text))
+		if err == nil && seen[key] {
+			err = fmt.Errorf("question repeats an earlier question")
+		}
+		if err != nil {
+			rejections = append(rejections, QuestionRejection{
+				Index:  i,
+				Text:   question.Text,
+				Type:   question.QuestionType(),
+				Reason: err.Error(),
+			})
+			continue
+		}
+		seen[key] = true
+		valid = append(valid, question)
+	}
+	quiz.Questions = valid
+	return rejections
+}
@@ -0,0 +1,70 @@
+package gemini
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"quizbuilderai/internal/models"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// quizResponseSchema is the response schema of quiz generation, derived from models.GeminiQuizResponse
+// so the model's output always decodes into it. Fields without omitempty are required.
+var quizResponseSchema = buildQuizResponseSchema()
+
+func buildQuizResponseSchema() *genai.Schema {
+	schema := schemaFor(reflect.TypeOf(models.GeminiQuizResponse{}))
+	// Restrict the question type to the known types
+	question := schema.Properties["questions"].Items
+	question.Properties["type"].Enum = QuestionTypeNames()
+	question.Properties["type"].Format = "enum"
+	return schema
+}
+
+// schemaFor derives the Gemini schema of a Go type from its kind and JSON tags.
+// It panics on types that can't be expressed, which only happens when the models change.
+func schemaFor(t reflect.Type) *genai.Schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaFor(t.Elem())
+		schema.Nullable = true
+		return schema
+	case reflect.String:
+		return &genai.Schema{Type: genai.TypeString}
+	case reflect.Bool:
+		return &genai.Schema{Type: genai.TypeBoolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &genai.Schema{Type: genai.TypeInteger}
+	case reflect.Float32:
+		return &genai.Schema{Type: genai.TypeNumber, Format: "float"}
+	case reflect.Float64:
+		return &genai.Schema{Type: genai.TypeNumber, Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &genai.Schema{Type: genai.TypeArray, Items: schemaFor(t.Elem())}
+	case reflect.Struct:
+		schema := &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{}}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			schema.Properties[name] = schemaFor(field.Type)
+			if !strings.Contains(opts, "omitempty") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	default:
+		panic(fmt.Sprintf("gemini: no response schema for type %s", t))
+	}
+}
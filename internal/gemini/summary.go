@@ -0,0 +1,241 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	"quizbuilderai/internal/models"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+const (
+	// SummaryModelName is the default Gemini model for titling merged quizzes.
+	// Its prompt is only the chunk titles and topics, so a small model does the job.
+	SummaryModelName = "gemini-2.0-flash-lite"
+	// summaryMaxQuestions caps the question texts sent along with the topics
+	summaryMaxQuestions = 20
+	// summaryExpectedTokens is what a summary call is expected to cost when estimating usage
+	summaryExpectedTokens = 1024
+	// maxDescriptionTopics is how many topics the fallback description names
+	maxDescriptionTopics = 3
+)
+
+// quizSummary is the title and description of a whole quiz, as returned by the summary model
+type quizSummary struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+// quizSummarySchema is the response schema of the summary model
+var quizSummarySchema = schemaFor(reflect.TypeOf(quizSummary{}))
+
+// summaryPrompt asks for one title and description covering all chunks of a quiz
+const summaryPrompt = `A quiz was generated from documents, one part at a time. Write one title and a short description for the whole quiz.
+
+Titles of the parts:
+%s
+Topics covered (with number of questions):
+%s
+Sample questions:
+%s
+Rules:
+- The title is at most 80 characters and names the common subject, not just one of the parts.
+- The description is one or two sentences (at most 300 characters) telling a student what the quiz covers.
+%s
+Return JSON in the format {"title": "...", "description": "..."}.`
+
+// topicCount is a topic of a quiz and how many questions it has
+type topicCount struct {
+	Topic     string
+	Questions int
+}
+
+// quizTopics returns the distinct topics of a quiz in order of first appearance
+func quizTopics(quiz *models.GeminiQuizResponse) []topicCount {
+	var topics []topicCount
+	index := make(map[string]int)
+	for _, q := range quiz.Questions {
+		topic := strings.TrimSpace(q.Topic)
+		if topic == "" {
+			continue
+		}
+		key := strings.ToLower(topic)
+		if i, ok := index[key]; ok {
+			topics[i].Questions++
+			continue
+		}
+		index[key] = len(topics)
+		topics = append(topics, topicCount{Topic: topic, Questions: 1})
+	}
+	return topics
+}
+
+// centralTitle picks the chunk title that shares the most words with the other titles,
+// so the title of a stray appendix doesn't name the whole quiz. Ties go to the earlier title.
+func centralTitle(titles []string) string {
+	var distinct []string
+	seen := make(map[string]bool)
+	for _, title := range titles {
+		title = strings.TrimSpace(title)
+		if title == "" || seen[strings.ToLower(title)] {
+			continue
+		}
+		seen[strings.ToLower(title)] = true
+		distinct = append(distinct, title)
+	}
+	if len(distinct) == 0 {
+		return ""
+	}
+
+	tokens := make([]map[string]bool, len(distinct))
+	for i, title := range distinct {
+		tokens[i] = contentTokens(title)
+	}
+	best, bestScore := 0, -1.0
+	for i := range distinct {
+		score := 0.0
+		for j := range distinct {
+			if i != j {
+				score += jaccard(tokens[i], tokens[j])
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return distinct[best]
+}
+
+// describeQuiz writes a description of a quiz from its question count and main topics
+func describeQuiz(quiz *models.GeminiQuizResponse) string {
+	topics := quizTopics(quiz)
+	if len(topics) == 0 {
+		return fmt.Sprintf("A quiz of %d questions.", len(quiz.Questions))
+	}
+
+	var names []string
+	for i, t := range topics {
+		if i == maxDescriptionTopics {
+			break
+		}
+		names = append(names, t.Topic)
+	}
+	covers := names[0]
+	switch {
+	case len(topics) > maxDescriptionTopics:
+		more := len(topics) - maxDescriptionTopics
+		covers = fmt.Sprintf("%s and %d more topic", strings.Join(names, ", "), more)
+		if more > 1 {
+			covers += "s"
+		}
+	case len(names) > 1:
+		covers = strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+	}
+	return fmt.Sprintf("A quiz of %d questions on %s.", len(quiz.Questions), covers)
+}
+
+// summarizeQuiz sets the title and description of a merged quiz without calling a model.
+// The title is the most central chunk title, the description lists the main topics.
+func summarizeQuiz(quiz *models.GeminiQuizResponse, titles []string) {
+	if quiz == nil {
+		return
+	}
+	if title := centralTitle(titles); title != "" {
+		quiz.Title = title
+	}
+	if quiz.Title == "" {
+		quiz.Title = fmt.Sprintf("Quiz Generated on %s", time.Now().Format("January 2, 2006"))
+	}
+	quiz.Description = describeQuiz(quiz)
+}
+
+// summarizeQuiz sets the title and description of a merged quiz with the summary model.
+// It falls back to the deterministic summary when the call fails or returns nothing usable,
+// and returns the tokens the call used either way.
+func (c *Client) summarizeQuiz(ctx context.Context, quiz *models.GeminiQuizResponse, titles []string, opts GenerationOptions, progress ProgressFunc) TokenUsage {
+	var usage TokenUsage
+	if quiz == nil {
+		return usage
+	}
+	// The fallback is set first, the model's answer replaces it if it has one
+	summarizeQuiz(quiz, titles)
+	if len(quiz.Questions) == 0 {
+		return usage
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	resp, err := c.summaryModel.GenerateContent(ctx, genai.Text(buildSummaryPrompt(quiz, titles, opts)))
+	if err != nil {
+		log.Printf("WARN: Failed to summarize quiz with %s, keeping %q: %v", c.summaryModelName, quiz.Title, err)
+		return usage
+	}
+	if resp.UsageMetadata != nil {
+		usage = TokenUsage{
+			PromptTokens:    resp.UsageMetadata.PromptTokenCount,
+			CandidateTokens: resp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:     resp.UsageMetadata.TotalTokenCount,
+		}
+		log.Printf("INFO: Gemini Summary Token Usage: Prompt=%d, Candidates=%d, Total=%d", usage.PromptTokens, usage.CandidateTokens, usage.TotalTokens)
+	}
+
+	var text strings.Builder
+	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		for _, part := range resp.Candidates[0].Content.Parts {
+			if t, ok := part.(genai.Text); ok {
+				text.WriteString(string(t))
+			}
+		}
+	}
+	var summary quizSummary
+	if err := json.Unmarshal([]byte(extractJSONFromText(text.String())), &summary); err != nil {
+		log.Printf("WARN: Failed to decode quiz summary, keeping %q: %v", quiz.Title, err)
+		return usage
+	}
+	if title := strings.TrimSpace(summary.Title); title != "" {
+		quiz.Title = title
+	}
+	if description := strings.TrimSpace(summary.Description); description != "" {
+		quiz.Description = description
+	}
+
+	progress.Emit(ProgressEvent{
+		Stage:   StageSummary,
+		Message: fmt.Sprintf("Titled the quiz %q", quiz.Title),
+		Usage:   &usage,
+	})
+	return usage
+}
+
+// buildSummaryPrompt fills summaryPrompt with the chunk titles, topics and some of the questions
+func buildSummaryPrompt(quiz *models.GeminiQuizResponse, titles []string, opts GenerationOptions) string {
+	var titleList, topicList, questionList strings.Builder
+	for _, title := range titles {
+		fmt.Fprintf(&titleList, "- %s\n", title)
+	}
+	if len(titles) == 0 {
+		titleList.WriteString("- (none)\n")
+	}
+	for _, t := range quizTopics(quiz) {
+		fmt.Fprintf(&topicList, "- %s (%d)\n", t.Topic, t.Questions)
+	}
+	for i, q := range quiz.Questions {
+		if i == summaryMaxQuestions {
+			break
+		}
+		fmt.Fprintf(&questionList, "- %s\n", q.Text)
+	}
+
+	language := "- Write both in the language of the questions."
+	if opts.Language != "" {
+		language = fmt.Sprintf("- Write both in %s.", opts.Language)
+	}
+	return fmt.Sprintf(summaryPrompt, titleList.String(), topicList.String(), questionList.String(), language)
+}
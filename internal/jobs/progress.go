@@ -0,0 +1,137 @@
+package jobs
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"quizbuilderai/internal/gemini"
+
+	"github.com/google/uuid"
+)
+
+// subscriberBuffer is the number of events a slow subscriber can fall behind before events are dropped
+const subscriberBuffer = 64
+
+// ProgressBroker fans out the progress events of each job to any number of subscribers.
+// Events are kept per job, so a subscriber that connects late first receives everything
+// that already happened. Finished jobs are forgotten after the retention period.
+type ProgressBroker struct {
+	mu        sync.Mutex
+	streams   map[uuid.UUID]*progressStream
+	retention time.Duration
+}
+
+// progressStream holds the events of a single job
+type progressStream struct {
+	events      []gemini.ProgressEvent
+	subscribers map[chan gemini.ProgressEvent]struct{}
+	closed      bool
+}
+
+// NewProgressBroker creates a broker keeping finished jobs' events for the given retention period
+func NewProgressBroker(retention time.Duration) *ProgressBroker {
+	return &ProgressBroker{
+		streams:   make(map[uuid.UUID]*progressStream),
+		retention: retention,
+	}
+}
+
+// stream returns the stream of a job, creating it if needed. Callers must hold b.mu.
+func (b *ProgressBroker) stream(jobID uuid.UUID) *progressStream {
+	s, ok := b.streams[jobID]
+	if !ok {
+		s = &progressStream{subscribers: make(map[chan gemini.ProgressEvent]struct{})}
+		b.streams[jobID] = s
+	}
+	return s
+}
+
+// Publish records an event for a job and sends it to the current subscribers.
+// Events published after Close are ignored.
+func (b *ProgressBroker) Publish(jobID uuid.UUID, event gemini.ProgressEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stream(jobID)
+	if s.closed {
+		return
+	}
+	s.events = append(s.events, event)
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("WARN: Dropping progress event %s for job %s, subscriber is too slow", event.Stage, jobID)
+		}
+	}
+}
+
+// Func returns a ProgressFunc publishing to the given job
+func (b *ProgressBroker) Func(jobID uuid.UUID) gemini.ProgressFunc {
+	return func(event gemini.ProgressEvent) {
+		b.Publish(jobID, event)
+	}
+}
+
+// Close marks a job's stream as finished and closes all subscriber channels.
+// The events stay available to new subscribers for the retention period.
+func (b *ProgressBroker) Close(jobID uuid.UUID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stream(jobID)
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for ch := range s.subscribers {
+		close(ch)
+	}
+	s.subscribers = nil
+
+	time.AfterFunc(b.retention, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.streams[jobID] == s {
+			delete(b.streams, jobID)
+		}
+	})
+}
+
+// Has reports whether the broker currently knows about a job
+func (b *ProgressBroker) Has(jobID uuid.UUID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.streams[jobID]
+	return ok
+}
+
+// Subscribe returns the events published so far and a channel receiving the following ones.
+// The channel is closed once the job's stream is closed; it is already closed if the job finished.
+// Callers must call unsubscribe when they stop reading.
+func (b *ProgressBroker) Subscribe(jobID uuid.UUID) (history []gemini.ProgressEvent, events <-chan gemini.ProgressEvent, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stream(jobID)
+	history = append([]gemini.ProgressEvent(nil), s.events...)
+
+	ch := make(chan gemini.ProgressEvent, subscriberBuffer)
+	if s.closed {
+		close(ch)
+		return history, ch, func() {}
+	}
+	s.subscribers[ch] = struct{}{}
+
+	unsubscribe = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+	return history, ch, unsubscribe
+}
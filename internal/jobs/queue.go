@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ErrQueueFull is returned by Enqueue when no more jobs can be buffered
+var ErrQueueFull = errors.New("job queue is full")
+
+// ErrQueueStopped is returned by Enqueue after Stop has been called
+var ErrQueueStopped = errors.New("job queue is stopped")
+
+// ProcessFunc runs a single job. The job itself lives in the database;
+// the queue only hands out job IDs.
+type ProcessFunc func(ctx context.Context, jobID uuid.UUID)
+
+// Queue is a fixed-size pool of background workers processing jobs by ID
+type Queue struct {
+	jobs    chan uuid.UUID
+	process ProcessFunc
+	workers int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// NewQueue creates a queue with the given number of workers and buffer size.
+// Workers are not started until Start is called.
+func NewQueue(workers int, buffer int, process ProcessFunc) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Queue{
+		jobs:    make(chan uuid.UUID, buffer),
+		process: process,
+		workers: workers,
+	}
+}
+
+// Start launches the worker goroutines. Jobs run with a context derived from ctx,
+// which is cancelled when Stop is called.
+func (q *Queue) Start(ctx context.Context) {
+	q.ctx, q.cancel = context.WithCancel(ctx)
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work(i)
+	}
+	log.Printf("INFO: Started %d job workers", q.workers)
+}
+
+// work processes jobs until the queue is closed.
+// Jobs still buffered after Stop are skipped; they remain queued in the
+// database and are picked up again on the next start.
+func (q *Queue) work(worker int) {
+	defer q.wg.Done()
+	for jobID := range q.jobs {
+		if q.isStopped() {
+			log.Printf("INFO: Job worker %d skipping job %s, queue is stopping", worker, jobID)
+			continue
+		}
+		q.runJob(worker, jobID)
+	}
+}
+
+// isStopped reports whether Stop has been called
+func (q *Queue) isStopped() bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.stopped
+}
+
+// runJob runs one job, recovering from panics so a bad job can't kill the worker
+func (q *Queue) runJob(worker int, jobID uuid.UUID) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ERROR: Job worker %d panicked while processing job %s: %v", worker, jobID, r)
+		}
+	}()
+	q.process(q.ctx, jobID)
+}
+
+// Enqueue schedules a job without blocking.
+// It returns ErrQueueFull if the buffer is full, in which case the caller decides what to do with the job.
+func (q *Queue) Enqueue(jobID uuid.UUID) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.stopped {
+		return ErrQueueStopped
+	}
+	select {
+	case q.jobs <- jobID:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Stop stops accepting and starting jobs and waits for the running ones to finish,
+// or for ctx to expire, in which case running jobs are cancelled.
+func (q *Queue) Stop(ctx context.Context) {
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		return
+	}
+	q.stopped = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("INFO: All job workers finished")
+	case <-ctx.Done():
+		log.Println("WARN: Timed out waiting for job workers, cancelling running jobs")
+		if q.cancel != nil {
+			q.cancel()
+		}
+		<-done
+	}
+}
@@ -0,0 +1,37 @@
+package ledger
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"quizbuilderai/internal/db"
+)
+
+// Reconcile compares every user's token balances with the sum of their tokens ledger.
+// Pending reservations count towards the balance, released ones don't.
+// With fix set, drifted balances are overwritten with the ledger sums.
+// Returns the users whose balances had drifted.
+func Reconcile(ctx context.Context, q *db.Queries, fix bool) ([]db.ListTokenBalanceDriftRow, error) {
+	drifts, err := q.ListTokenBalanceDrift(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list token balance drift: %w", err)
+	}
+
+	for _, d := range drifts {
+		log.Printf("WARN: Token balance drift for user %s (%s): Input balance=%d ledger=%d, Output balance=%d ledger=%d",
+			d.UserID, d.Email, d.InputTokensBalance, d.LedgerInputBalance, d.OutputTokensBalance, d.LedgerOutputBalance)
+		if !fix {
+			continue
+		}
+
+		// The ledger is summed again when fixing, in case it changed since the report
+		user, err := q.ReconcileUserTokenBalance(ctx, d.UserID)
+		if err != nil {
+			return drifts, fmt.Errorf("failed to reconcile token balance of user %s: %w", d.UserID, err)
+		}
+		log.Printf("INFO: Reconciled token balance of user %s: Input=%d, Output=%d", user.ID, user.InputTokensBalance, user.OutputTokensBalance)
+	}
+
+	return drifts, nil
+}
@@ -51,15 +51,63 @@ type PDFFile struct {
 
 // GeminiQuizResponse represents the structured JSON response from Gemini
 type GeminiQuizResponse struct {
-	Title     string           `json:"title"`
-	Questions []GeminiQuestion `json:"questions"`
+	Title       string           `json:"title"`
+	Description string           `json:"description,omitempty"` // Set when the chunks of a quiz are merged
+	Questions   []GeminiQuestion `json:"questions"`
+	Merged      int              `json:"-"` // Number of duplicate questions merged away, not part of the model's output
 }
 
-// GeminiQuestion represents a question in the Gemini response
+// Question types a generated question can have
+const (
+	QuestionTypeMultipleChoice = "multiple_choice"
+	QuestionTypeTrueFalse      = "true_false"
+	QuestionTypeMultiSelect    = "multi_select"
+	QuestionTypeShortAnswer    = "short_answer"
+	QuestionTypeNumeric        = "numeric"
+	QuestionTypeOrdering       = "ordering"
+	QuestionTypeMatching       = "matching"
+)
+
+// GeminiQuestion represents a question in the Gemini response.
+// Which of the answer fields are set depends on the question type.
 type GeminiQuestion struct {
 	Text    string         `json:"text"`
-	Topic   string         `json:"topic"` // Added field for topic assignment
-	Options []GeminiOption `json:"options"`
+	Topic   string         `json:"topic"`             // Added field for topic assignment
+	Type    string         `json:"type,omitempty"`    // One of the QuestionType constants, multiple choice when empty
+	Options []GeminiOption `json:"options,omitempty"` // Choice questions; ordering questions list them in the correct order
+
+	AcceptedAnswers []string     `json:"accepted_answers,omitempty"` // Short answer: every accepted answer
+	NumericAnswer   *float64     `json:"numeric_answer,omitempty"`   // Numeric: the correct value
+	Tolerance       float64      `json:"tolerance,omitempty"`        // Numeric: the largest accepted absolute deviation
+	Pairs           []GeminiPair `json:"pairs,omitempty"`            // Matching: the items that belong together
+	Explanation     string       `json:"explanation,omitempty"`      // Explanation of the answer for types without options
+	Source          GeminiSource `json:"source"`                     // Where in the material the answer is found
+
+	// Where the question came from, filled in after generation
+	SourceFile string `json:"-"` // Path of the document the question was generated from
+	FirstPage  int    `json:"-"` // Pages of that document the question is based on, 0 if unknown
+	LastPage   int    `json:"-"`
+}
+
+// QuestionType returns the question's type, defaulting to multiple choice
+func (q GeminiQuestion) QuestionType() string {
+	if q.Type == "" {
+		return QuestionTypeMultipleChoice
+	}
+	return q.Type
+}
+
+// GeminiSource is the passage of the material a question is based on
+type GeminiSource struct {
+	Quote     string `json:"quote"`               // Short verbatim quote of the passage
+	Page      int    `json:"page,omitempty"`      // Page or slide of the passage, for documents with [Page N] or [Slide N] markers
+	Timestamp int    `json:"timestamp,omitempty"` // Seconds into the video, for transcripts with [m:ss] markers
+}
+
+// GeminiPair is a pair of items of a matching question
+type GeminiPair struct {
+	Left  string `json:"left"`
+	Right string `json:"right"`
 }
 
 // GeminiOption represents an option in the Gemini response
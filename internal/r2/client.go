@@ -2,119 +2,188 @@ package r2
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime" // Add mime package
-	"net/url"
+	"mime"
 	"os"
-	"path"          // Use path for URL joining
-	"path/filepath" // Add filepath package
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types" // Add types package
-	"github.com/google/uuid"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-// Client holds the necessary configuration for interacting with Cloudflare R2.
+// ErrNotFound is returned for keys without an object
+var ErrNotFound = errors.New("object not found")
+
+// Config configures the bucket of a Client. Cloudflare R2 and other S3-compatible services are
+// reached through Endpoint; without it the client talks to AWS S3.
+type Config struct {
+	Endpoint        string // e.g. https://<ACCOUNT_ID>.r2.cloudflarestorage.com, empty for AWS S3
+	Region          string // "auto" for R2
+	Bucket          string
+	AccessKeyID     string // Empty to use the default AWS credential chain
+	SecretAccessKey string
+	UsePathStyle    bool // Address the bucket in the path instead of the host name, as MinIO needs
+}
+
+// Client holds the necessary configuration for interacting with Cloudflare R2 or another S3-compatible bucket.
+// Objects are private; they are downloaded through presigned URLs.
 type Client struct {
 	s3Client   *s3.Client
+	presigner  *s3.PresignClient
 	bucketName string
-	publicURL  string // Base public URL for the bucket (e.g., https://pub-xxxxxxxx.r2.dev)
 }
 
-// NewClient creates and configures a new R2 client instance using environment variables.
-// It returns (nil, nil) if R2 environment variables are not fully configured,
-// allowing the application to proceed with R2 uploads disabled.
+// NewClient creates and configures a new client instance using environment variables: the R2 variables
+// (CLOUDFLARE_ACCOUNT_ID, R2_BUCKET_NAME, R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY) or, for other
+// S3-compatible storage, S3_BUCKET with the optional S3_REGION, S3_ENDPOINT, S3_ACCESS_KEY_ID,
+// S3_SECRET_ACCESS_KEY and S3_USE_PATH_STYLE.
+// It returns (nil, nil) if neither is configured, allowing the application to proceed without object storage.
 func NewClient() (*Client, error) {
 	accountID := os.Getenv("CLOUDFLARE_ACCOUNT_ID")
 	bucketName := os.Getenv("R2_BUCKET_NAME")
 	accessKeyID := os.Getenv("R2_ACCESS_KEY_ID")
 	secretAccessKey := os.Getenv("R2_SECRET_ACCESS_KEY")
-	publicURL := os.Getenv("R2_PUBLIC_URL")
 
 	// Check if all required R2 variables are set
-	if accountID == "" || bucketName == "" || accessKeyID == "" || secretAccessKey == "" || publicURL == "" {
-		log.Println("WARN: Cloudflare R2 environment variables not fully configured (CLOUDFLARE_ACCOUNT_ID, R2_BUCKET_NAME, R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY, R2_PUBLIC_URL). R2 uploads will be skipped.")
-		return nil, nil // Indicate optional setup by returning nil client and nil error
+	if accountID != "" && bucketName != "" && accessKeyID != "" && secretAccessKey != "" {
+		return New(context.Background(), Config{
+			// R2 endpoint format: https://<ACCOUNT_ID>.r2.cloudflarestorage.com
+			Endpoint:        fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID),
+			Region:          "auto", // R2 is region-agnostic, 'auto' is a common setting
+			Bucket:          bucketName,
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+		})
+	}
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		return New(context.Background(), Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          bucket,
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			UsePathStyle:    os.Getenv("S3_USE_PATH_STYLE") == "true",
+		})
 	}
 
-	// Custom endpoint resolver for Cloudflare R2
-	r2Resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
-		// R2 endpoint format: https://<ACCOUNT_ID>.r2.cloudflarestorage.com
-		return aws.Endpoint{
-			URL: fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID),
-		}, nil
-	})
+	log.Println("WARN: Object storage environment variables not configured (CLOUDFLARE_ACCOUNT_ID, R2_BUCKET_NAME, R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY, or S3_BUCKET). Bucket uploads will be skipped.")
+	return nil, nil // Indicate optional setup by returning nil client and nil error
+}
+
+// New creates a client for the bucket of cfg
+func New(ctx context.Context, cfg Config) (*Client, error) {
+	options := []func(*config.LoadOptions) error{}
+	if cfg.Region != "" {
+		options = append(options, config.WithRegion(cfg.Region))
+	}
+	if cfg.AccessKeyID != "" {
+		options = append(options, config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
+	}
 
 	// Load AWS SDK configuration
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithEndpointResolverWithOptions(r2Resolver),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, "")),
-		config.WithRegion("auto"), // R2 is region-agnostic, 'auto' is a common setting
-	)
+	awsConfig, err := config.LoadDefaultConfig(ctx, options...)
 	if err != nil {
 		// Return an error here as this indicates a problem loading the config itself
-		return nil, fmt.Errorf("failed to load AWS SDK config for R2: %w", err)
+		return nil, fmt.Errorf("failed to load AWS SDK config for bucket %s: %w", cfg.Bucket, err)
 	}
 
 	// Create the S3 client from the configuration
-	s3Client := s3.NewFromConfig(cfg)
+	s3Client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			// S3-compatible services don't all accept the checksums AWS S3 now expects by default
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+			o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+		}
+		o.UsePathStyle = cfg.UsePathStyle
+	})
 
-	log.Printf("INFO: R2 Client initialized for bucket '%s'", bucketName)
+	log.Printf("INFO: Object storage client initialized for bucket '%s'", cfg.Bucket)
 	return &Client{
 		s3Client:   s3Client,
-		bucketName: bucketName,
-		publicURL:  publicURL,
+		presigner:  s3.NewPresignClient(s3Client),
+		bucketName: cfg.Bucket,
 	}, nil
 }
 
-// UploadFile uploads content from an io.Reader to a specified path within the R2 bucket.
-// The object key is constructed as "material/<userID>/<materialID>/<filename>".
-// It returns the publicly accessible URL of the uploaded file or an error.
-func (c *Client) UploadFile(ctx context.Context, userID uuid.UUID, materialID uuid.UUID, filename string, content io.Reader) (string, error) {
+// Name describes the storage for logs
+func (c *Client) Name() string {
+	return "bucket " + c.bucketName
+}
+
+// Put uploads size bytes from body to key. The object is private.
+func (c *Client) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
 	// Check if the client was initialized (it might be nil if env vars were missing)
 	if c == nil || c.s3Client == nil {
-		return "", fmt.Errorf("R2 client not initialized, skipping upload")
+		return fmt.Errorf("object storage client not initialized, skipping upload")
 	}
-
-	// Construct the object key using the desired structure
-	objectKey := fmt.Sprintf("material/%s/%s/%s", userID.String(), materialID.String(), filename)
-
-	// Determine Content-Type
-	contentType := mime.TypeByExtension(filepath.Ext(filename))
 	if contentType == "" {
-		contentType = "application/octet-stream" // Default if extension is unknown
+		contentType = "application/octet-stream" // Default if the type is unknown
 	}
 
-	// Perform the upload using PutObject
 	_, err := c.s3Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(c.bucketName),
-		Key:         aws.String(objectKey),
-		Body:        content,
-		ACL:         types.ObjectCannedACLPublicRead, // Explicitly set ACL for public access
-		ContentType: aws.String(contentType),         // Set Content-Type
+		Bucket:        aws.String(c.bucketName),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
 	})
-
 	if err != nil {
 		// Return specific error for upload failure
-		return "", fmt.Errorf("failed to upload file to R2 (key: %s): %w", objectKey, err)
+		return fmt.Errorf("failed to upload object (key: %s): %w", key, err)
 	}
+	log.Printf("INFO: Successfully uploaded object %s to bucket %s", key, c.bucketName)
+	return nil
+}
 
-	// Construct the public URL safely
-	baseURL, err := url.Parse(c.publicURL)
+// Open returns the content of the object at key
+func (c *Client) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
 	if err != nil {
-		// This should ideally not happen if publicURL env var is validated or correct
-		log.Printf("ERROR: Failed to parse R2 public base URL '%s': %v", c.publicURL, err)
-		return "", fmt.Errorf("invalid R2 public base URL configured")
+		return nil, fmt.Errorf("failed to download object (key: %s): %w", key, err)
 	}
-	// Use path.Join to handle slashes correctly, then ensure it's URL encoded if needed (usually path handles this)
-	baseURL.Path = path.Join(baseURL.Path, objectKey)
+	return out.Body, nil
+}
 
-	publicFileURL := baseURL.String()
-	log.Printf("INFO: Successfully uploaded file to R2: %s", publicFileURL)
-	return publicFileURL, nil
+// Delete removes the object at key; deleting a missing object is not an error
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(c.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object (key: %s): %w", key, err)
+	}
+	return nil
+}
+
+// PresignGet returns a URL that downloads the object at key without credentials until it expires.
+// The download is offered as an attachment named filename.
+func (c *Client) PresignGet(ctx context.Context, key, filename string, expires time.Duration) (string, error) {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	if disposition == "" {
+		disposition = "attachment" // Names FormatMediaType can't encode are left to the browser
+	}
+	req, err := c.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(c.bucketName),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(disposition),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign download (key: %s): %w", key, err)
+	}
+	return req.URL, nil
 }
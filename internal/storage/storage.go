@@ -0,0 +1,97 @@
+// Package storage keeps the originals of uploaded materials, in an R2 or S3 bucket or on the local
+// filesystem, so they can be downloaded again after the quiz was generated.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"quizbuilderai/internal/r2"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNotFound is returned for keys without a stored object
+	ErrNotFound = r2.ErrNotFound
+	// ErrPresignNotSupported is returned by storages that can't hand out download URLs;
+	// their objects are served through Open instead
+	ErrPresignNotSupported = errors.New("storage does not support presigned downloads")
+)
+
+// Storage stores objects under keys such as "material/<user>/<material>/notes.pdf"
+type Storage interface {
+	// Name describes the storage for logs
+	Name() string
+	// Put stores size bytes from body under key, replacing any object there
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Open returns the content of the object at key, ErrNotFound if there is none
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object at key; deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// PresignGet returns a URL that downloads the object at key as filename until it expires
+	PresignGet(ctx context.Context, key, filename string, expires time.Duration) (string, error)
+}
+
+// MaterialKey is the key of the original of a material
+func MaterialKey(userID, materialID uuid.UUID, filename string) string {
+	return fmt.Sprintf("material/%s/%s/%s", userID, materialID, path.Base(filename))
+}
+
+// FromEnv creates the storage named by STORAGE_BACKEND: "r2" or "s3" for a bucket configured as
+// r2.NewClient describes, "local" for the directory STORAGE_DIR (default "data/storage") or "none".
+// Without STORAGE_BACKEND a configured bucket is used, then STORAGE_DIR if it is set.
+// It returns (nil, nil) when no storage is configured, uploads are then not kept.
+func FromEnv() (Storage, error) {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND")))
+	dir := os.Getenv("STORAGE_DIR")
+	switch backend {
+	case "", "r2", "s3":
+		client, err := r2.NewClient()
+		if err != nil {
+			return nil, err
+		}
+		if client != nil {
+			return client, nil
+		}
+		if backend != "" {
+			return nil, fmt.Errorf("STORAGE_BACKEND is %s but no bucket is configured", backend)
+		}
+		if dir == "" {
+			log.Println("WARN: No storage configured (STORAGE_BACKEND, STORAGE_DIR), uploaded files will not be kept.")
+			return nil, nil
+		}
+		return newLocal(dir)
+	case "local":
+		if dir == "" {
+			dir = "data/storage"
+		}
+		return newLocal(dir)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q, use r2, s3, local or none", backend)
+	}
+}
+
+// newLocal is NewLocal returning a nil Storage on errors rather than a Storage holding a nil *Local
+func newLocal(dir string) (Storage, error) {
+	local, err := NewLocal(dir)
+	if err != nil {
+		return nil, err
+	}
+	return local, nil
+}
+
+// Both implementations must satisfy Storage
+var (
+	_ Storage = (*r2.Client)(nil)
+	_ Storage = (*Local)(nil)
+)
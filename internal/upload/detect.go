@@ -0,0 +1,94 @@
+package upload
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// sniffLength is how much of the start of a file is read to detect its format
+const sniffLength = 1024
+
+// Detect detects the format of a file from its content and returns it as the extension of the format
+// (".pdf", ".docx", ".pptx", ".epub", ".md" or ".txt"), or "" when it is none of these. described names
+// the content for messages, e.g. "a PDF document" or "image/png". The name only tells Markdown from
+// plain text, which have the same content.
+func Detect(r io.ReaderAt, size int64, filename string) (format, described string) {
+	head := make([]byte, sniffLength)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return "", "unreadable"
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(bytes.TrimLeft(head, " \t\r\n"), []byte("%PDF-")):
+		// Only whitespace may come before the header, as in the PDF parser. Accepting the header
+		// anywhere in the first kilobyte would let any file that mentions it pass as a PDF.
+		return ".pdf", "a PDF document"
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		if format := zipFormat(r, size); format != "" {
+			return format, "a " + strings.ToUpper(format[1:]) + " document"
+		}
+		return "", "a ZIP archive"
+	case isText(head):
+		if strings.EqualFold(filepath.Ext(filename), ".md") {
+			return ".md", "Markdown text"
+		}
+		return ".txt", "plain text"
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if mediaType == "application/octet-stream" {
+		return "", "binary data of an unknown type"
+	}
+	return "", mediaType
+}
+
+// zipFormat tells the ZIP-based document formats apart by the parts they must contain
+func zipFormat(r io.ReaderAt, size int64) string {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return ""
+	}
+	parts := make(map[string]bool, len(zr.File))
+	for _, f := range zr.File {
+		parts[f.Name] = true
+	}
+	switch {
+	case parts["word/document.xml"]:
+		return ".docx"
+	case parts["ppt/presentation.xml"]:
+		return ".pptx"
+	case parts["META-INF/container.xml"] && parts["mimetype"]:
+		return ".epub"
+	default:
+		return ""
+	}
+}
+
+// isText reports whether the start of a file is UTF-8 text: valid UTF-8 (a character cut off at the
+// end aside) without NUL bytes or control characters other than whitespace
+func isText(head []byte) bool {
+	if len(head) == 0 {
+		return false
+	}
+	// A multi-byte character may be cut off where the sniffed data ends
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	if !utf8.Valid(head) {
+		return false
+	}
+	for _, b := range head {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package upload
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectPDFHeader(t *testing.T) {
+	tests := []struct {
+		content string
+		format  string
+	}{
+		{"%PDF-1.7\n%\xe2\xe3\xcf\xd3\n1 0 obj", ".pdf"},
+		{"\r\n%PDF-1.4\n", ".pdf"},
+		{"Notes on the format: every file starts with %PDF-1.x.\n", ".txt"},
+		{"\x89PNG\r\n\x1a\n%PDF-1.4", ""},
+	}
+	for _, tt := range tests {
+		r := strings.NewReader(tt.content)
+		if format, _ := Detect(r, r.Size(), "upload"); format != tt.format {
+			t.Errorf("Detect(%q) = %q, want %q", tt.content, format, tt.format)
+		}
+	}
+}
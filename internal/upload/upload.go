@@ -0,0 +1,271 @@
+// Package upload validates files uploaded as quiz material: it enforces the size and count limits,
+// detects each file's format from its content rather than its name, and makes names safe to use as paths.
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxFileBytes is the largest file accepted
+	DefaultMaxFileBytes = 25 << 20
+	// DefaultMaxTotalBytes is the largest total size of the files of one request
+	DefaultMaxTotalBytes = 100 << 20
+	// DefaultMaxFiles is the most files accepted in one request
+	DefaultMaxFiles = 10
+	// MaxMemory is how much of a multipart form is held in memory; larger files are spooled to disk
+	MaxMemory = 1 << 20
+	// formOverhead allows for the form fields and multipart boundaries on top of the files
+	formOverhead = 1 << 20
+	// maxNameLength bounds sanitised file names, in bytes
+	maxNameLength = 200
+)
+
+// Limits bounds the files of one upload request
+type Limits struct {
+	MaxFileBytes  int64 // Largest file accepted
+	MaxTotalBytes int64 // Largest total size of all files
+	MaxFiles      int   // Most files accepted
+}
+
+// LimitsFromEnv reads the limits from UPLOAD_MAX_FILE_MB, UPLOAD_MAX_TOTAL_MB and UPLOAD_MAX_FILES,
+// using the defaults for unset or invalid values
+func LimitsFromEnv() Limits {
+	return Limits{
+		MaxFileBytes:  int64(envInt("UPLOAD_MAX_FILE_MB", DefaultMaxFileBytes>>20)) << 20,
+		MaxTotalBytes: int64(envInt("UPLOAD_MAX_TOTAL_MB", DefaultMaxTotalBytes>>20)) << 20,
+		MaxFiles:      envInt("UPLOAD_MAX_FILES", DefaultMaxFiles),
+	}
+}
+
+// envInt reads a positive integer from the environment, falling back to def when unset or invalid
+func envInt(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("WARN: Invalid value %q for %s, using default %d", value, key, def)
+		return def
+	}
+	return n
+}
+
+// MaxRequestBytes is the largest request body accepted for the limits: all files plus the form fields
+func (l Limits) MaxRequestBytes() int64 {
+	return l.MaxTotalBytes + formOverhead
+}
+
+// Rejection says why an uploaded file was refused
+type Rejection struct {
+	File   string `json:"file,omitempty"` // Name of the file as uploaded, empty for the request as a whole
+	Reason string `json:"reason"`
+	Status int    `json:"-"` // HTTP status of the rejection
+}
+
+func (r Rejection) Error() string {
+	if r.File == "" {
+		return r.Reason
+	}
+	return fmt.Sprintf("%s: %s", r.File, r.Reason)
+}
+
+// File is an uploaded file that passed validation
+type File struct {
+	Header *multipart.FileHeader
+	Name   string // Sanitised name, its extension matching the detected format
+	Format string // Detected format as an extension, e.g. ".pdf"
+}
+
+// Check validates uploaded files against the limits and the accepted formats (extensions such as
+// ".pdf"), returning the accepted files and a rejection for each file that failed. Empty files are
+// left out without a rejection, as browsers send them for empty file inputs.
+func Check(headers []*multipart.FileHeader, limits Limits, accepted []string) ([]File, []Rejection) {
+	var files []File
+	var rejections []Rejection
+	if len(headers) > limits.MaxFiles {
+		rejections = append(rejections, Rejection{
+			Reason: fmt.Sprintf("%d files were uploaded, at most %d are accepted", len(headers), limits.MaxFiles),
+			Status: http.StatusBadRequest,
+		})
+		return nil, rejections
+	}
+
+	var total int64
+	for _, header := range headers {
+		if header.Size == 0 {
+			log.Printf("WARN: Skipping empty file: %s", header.Filename)
+			continue
+		}
+		total += header.Size
+		switch {
+		case header.Size > limits.MaxFileBytes:
+			rejections = append(rejections, Rejection{
+				File:   header.Filename,
+				Reason: fmt.Sprintf("file is %s, at most %s are accepted per file", formatBytes(header.Size), formatBytes(limits.MaxFileBytes)),
+				Status: http.StatusRequestEntityTooLarge,
+			})
+			continue
+		case total > limits.MaxTotalBytes:
+			rejections = append(rejections, Rejection{
+				File:   header.Filename,
+				Reason: fmt.Sprintf("files exceed the total limit of %s", formatBytes(limits.MaxTotalBytes)),
+				Status: http.StatusRequestEntityTooLarge,
+			})
+			continue
+		}
+
+		format, described, err := detectFile(header)
+		if err != nil {
+			rejections = append(rejections, Rejection{
+				File:   header.Filename,
+				Reason: fmt.Sprintf("file could not be read: %v", err),
+				Status: http.StatusBadRequest,
+			})
+			continue
+		}
+		if !contains(accepted, format) {
+			rejections = append(rejections, Rejection{
+				File:   header.Filename,
+				Reason: fmt.Sprintf("content is %s, accepted formats are %s", described, strings.Join(accepted, ", ")),
+				Status: http.StatusUnsupportedMediaType,
+			})
+			continue
+		}
+		files = append(files, File{Header: header, Name: nameFor(header.Filename, format), Format: format})
+	}
+	return files, rejections
+}
+
+// detectFile detects the format of an uploaded file from its content
+func detectFile(header *multipart.FileHeader) (format, described string, err error) {
+	f, err := header.Open()
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	format, described = Detect(f, header.Size, header.Filename)
+	return format, described, nil
+}
+
+// contains reports whether list holds value
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// nameFor returns the sanitised name of a file with the extension of its detected format, so a
+// PDF uploaded as "notes" or "notes.docx" becomes "notes.pdf". Text files keep a .txt or .md name.
+func nameFor(filename, format string) string {
+	name := SanitizeFilename(filename)
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == format || (format == ".txt" && ext == ".md") {
+		return name
+	}
+	if knownExtensions[ext] {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	return name + format
+}
+
+// knownExtensions are the extensions replaced when they don't match the content;
+// others, e.g. the ".2" of "report v1.2", are kept as part of the name
+var knownExtensions = map[string]bool{
+	".pdf": true, ".txt": true, ".md": true, ".docx": true, ".pptx": true, ".epub": true,
+	".doc": true, ".ppt": true, ".rtf": true, ".odt": true, ".html": true, ".htm": true,
+}
+
+// SanitizeFilename makes an uploaded file name safe to use as a path component: only the base name is
+// kept, path separators, control and reserved characters are replaced, leading dots removed and the
+// name shortened to at most 200 bytes, keeping its extension. Names with nothing left become "file".
+func SanitizeFilename(filename string) string {
+	// Clients may send full paths with either separator
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r), strings.ContainsRune(`<>:"|?*`, r):
+			return '_'
+		case unicode.IsSpace(r):
+			return ' '
+		}
+		return r
+	}, filename)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	name = strings.TrimRight(name, ". ") // Windows drops trailing dots and spaces
+
+	if len(name) > maxNameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		cut := maxNameLength - len(ext)
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = strings.TrimSpace(name[:cut]) + ext
+	}
+	if strings.TrimSuffix(name, filepath.Ext(name)) == "" {
+		name = "file" + filepath.Ext(name)
+	}
+	return name
+}
+
+// Save streams an uploaded file to path without holding it in memory, returning the bytes written
+// and the hex encoded SHA-256 of the content
+func Save(header *multipart.FileHeader, path string) (int64, string, error) {
+	src, err := header.Open()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(dst, hash), src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return written, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// formatBytes formats a size for messages, e.g. "25 MB" or "312.5 KB"
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return formatUnits(float64(n)/(1<<20), "MB")
+	case n >= 1<<10:
+		return formatUnits(float64(n)/(1<<10), "KB")
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
+// formatUnits formats an amount with one decimal, left out for whole amounts
+func formatUnits(amount float64, unit string) string {
+	return strings.TrimSuffix(strconv.FormatFloat(amount, 'f', 1, 64), ".0") + " " + unit
+}
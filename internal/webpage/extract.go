@@ -0,0 +1,341 @@
+package webpage
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// mainContentShare is the share of a page's text the element chosen as main content must hold.
+// Starting from the body, the extraction descends into the child holding at least this share.
+const mainContentShare = 0.75
+
+// maxLinkDensity is the largest share of a block's text that may be link text; blocks above it
+// are lists of links such as menus, tags or "related articles"
+const maxLinkDensity = 0.5
+
+// removedTags are elements that never hold readable content
+var removedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Object: true, atom.Embed: true,
+	atom.Audio: true, atom.Video: true, atom.Dialog: true,
+}
+
+// removedRoles are ARIA roles of boilerplate
+var removedRoles = map[string]bool{
+	"navigation": true, "banner": true, "contentinfo": true, "complementary": true,
+	"search": true, "dialog": true, "alert": true, "menu": true, "menubar": true,
+}
+
+var (
+	// boilerplatePattern matches class names and IDs of boilerplate elements
+	boilerplatePattern = regexp.MustCompile(`(?i)(^|[-_ ])(nav|navbar|menu|breadcrumbs?|footer|sidebar|comments?|share|sharing|social|cookies?|consent|banner|ads?|advert\w*|promo\w*|related|newsletter|subscribe|popup|modal|toc|skip)([-_ ]|$)`)
+	// contentPattern matches class names and IDs of content, which keeps them even if they look like boilerplate
+	contentPattern = regexp.MustCompile(`(?i)(^|[-_ ])(article|content|main|post|entry|story|body)([-_ ]|$)`)
+	// spacePattern matches runs of whitespace, collapsed to one space in inline text
+	spacePattern = regexp.MustCompile(`\s+`)
+)
+
+// blockTags are elements that start a new block of text
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Table: true, atom.Tr: true, atom.Br: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Hr: true, atom.Address: true, atom.Details: true, atom.Summary: true,
+}
+
+// block is a paragraph, heading, list item or other run of text of a page
+type block struct {
+	node     *html.Node // Element the block belongs to
+	text     string
+	linkText int // Bytes of the text inside links
+}
+
+// extractHTML parses an HTML page and fills in the title, site name and main content of page
+func extractHTML(r io.Reader, page *Page) error {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return fmt.Errorf("failed to parse page: %w", err)
+	}
+
+	readMetadata(doc, page)
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return ErrNoContent
+	}
+	removeBoilerplate(body)
+
+	blocks := collectBlocks(body)
+	root := mainContent(body, blocks)
+	var lines []string
+	for _, b := range blocks {
+		if isWithin(b.node, root) {
+			lines = append(lines, b.text)
+		}
+	}
+	page.Text = strings.Join(lines, "\n")
+
+	if page.Title == "" {
+		if h1 := findElement(root, atom.H1); h1 != nil {
+			page.Title = collapseSpace(textOf(h1))
+		}
+	}
+	return nil
+}
+
+// readMetadata sets the title and site name of page from the <title> and Open Graph tags
+func readMetadata(doc *html.Node, page *Page) {
+	var title, ogTitle string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if title == "" {
+					title = collapseSpace(textOf(n))
+				}
+			case atom.Meta:
+				property := attr(n, "property")
+				if property == "" {
+					property = attr(n, "name")
+				}
+				switch property {
+				case "og:title":
+					ogTitle = collapseSpace(attr(n, "content"))
+				case "og:site_name":
+					page.SiteName = collapseSpace(attr(n, "content"))
+				}
+			case atom.Body:
+				return // Metadata is in the head
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	// The Open Graph title usually lacks the " - Site" suffix of <title>
+	page.Title = ogTitle
+	if page.Title == "" {
+		page.Title = title
+	}
+}
+
+// removeBoilerplate removes the elements below n that hold navigation, scripts, ads and the like
+func removeBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && isBoilerplate(c)) {
+			n.RemoveChild(c)
+		} else {
+			removeBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+// isBoilerplate reports whether an element is boilerplate by its tag, role, visibility, class or ID
+func isBoilerplate(n *html.Node) bool {
+	if removedTags[n.DataAtom] || removedRoles[attr(n, "role")] {
+		return true
+	}
+	if _, hidden := attrOK(n, "hidden"); hidden || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	names := attr(n, "class") + " " + attr(n, "id")
+	return boilerplatePattern.MatchString(names) && !contentPattern.MatchString(names)
+}
+
+// collectBlocks returns the blocks of text below n in document order, leaving out lists of links
+func collectBlocks(n *html.Node) []block {
+	var blocks []block
+	var current strings.Builder
+	var currentNode *html.Node
+	linkText := 0
+
+	flush := func() {
+		text := collapseSpace(current.String())
+		// Headings are often links to themselves, they are kept whatever their links
+		heading := strings.HasPrefix(text, "#")
+		if text != "" && (heading || float64(linkText) <= maxLinkDensity*float64(len(text))) {
+			blocks = append(blocks, block{node: currentNode, text: text, linkText: linkText})
+		}
+		current.Reset()
+		linkText = 0
+	}
+
+	var walk func(n *html.Node, owner *html.Node, inLink bool)
+	walk = func(n *html.Node, owner *html.Node, inLink bool) {
+		switch n.Type {
+		case html.TextNode:
+			if current.Len() == 0 {
+				currentNode = owner
+			}
+			current.WriteString(n.Data)
+			if inLink {
+				linkText += len(strings.TrimSpace(n.Data))
+			}
+			return
+		case html.ElementNode:
+		default:
+			return
+		}
+
+		isBlock := blockTags[n.DataAtom]
+		if isBlock {
+			flush()
+			owner = n
+		}
+		switch n.DataAtom {
+		case atom.A:
+			inLink = true
+		case atom.Pre:
+			// Preformatted text keeps its lines, only the block's surrounding space is trimmed
+			if text := strings.Trim(textOf(n), "\n"); strings.TrimSpace(text) != "" {
+				blocks = append(blocks, block{node: n, text: text})
+			}
+			return
+		case atom.Li:
+			current.WriteString("- ")
+			currentNode = n
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			current.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+			currentNode = n
+		case atom.Td, atom.Th:
+			current.WriteString(" | ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, owner, inLink)
+		}
+		if isBlock {
+			flush()
+		}
+	}
+	walk(n, n, false)
+	flush()
+
+	// Markers of list items and headings alone aren't text
+	kept := blocks[:0]
+	for _, b := range blocks {
+		if strings.Trim(b.text, "-#| ") != "" {
+			kept = append(kept, b)
+		}
+	}
+	return kept
+}
+
+// mainContent returns the element holding the main content: starting from the body, the
+// deepest element holding at least mainContentShare of the text of all blocks
+func mainContent(body *html.Node, blocks []block) *html.Node {
+	size := make(map[*html.Node]int)
+	total := 0
+	for _, b := range blocks {
+		length := len(b.text) - b.linkText
+		total += length
+		for n := b.node; n != nil; n = n.Parent {
+			size[n] += length
+		}
+	}
+
+	root := body
+	for {
+		var next *html.Node
+		for c := root.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && float64(size[c]) >= mainContentShare*float64(total) {
+				next = c
+				break
+			}
+		}
+		if next == nil {
+			return root
+		}
+		root = next
+	}
+}
+
+// isWithin reports whether n is root or below it
+func isWithin(n, root *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n == root {
+			return true
+		}
+	}
+	return false
+}
+
+// findElement returns the first element with the given tag at or below n
+func findElement(n *html.Node, tag atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// textOf returns all text below n
+func textOf(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var text strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		text.WriteString(textOf(c))
+	}
+	return text.String()
+}
+
+// attr returns the value of an attribute of n, empty if it isn't set
+func attr(n *html.Node, key string) string {
+	value, _ := attrOK(n, key)
+	return value
+}
+
+// attrOK returns the value of an attribute of n and whether it is set
+func attrOK(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && strings.EqualFold(a.Key, key) {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// collapseSpace collapses runs of whitespace to single spaces and trims the text
+func collapseSpace(text string) string {
+	return strings.TrimSpace(spacePattern.ReplaceAllString(text, " "))
+}
+
+// normalizeText tidies plain text: Unix line endings, no trailing spaces and at most one blank line in a row
+func normalizeText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	var kept []string
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank++
+			if blank > 1 {
+				continue
+			}
+		} else {
+			blank = 0
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
@@ -0,0 +1,266 @@
+// Package webpage fetches web pages such as articles, documentation or Wikipedia pages and
+// extracts their readable content, so they can be used as quiz material like documents.
+package webpage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// DefaultMaxBytes is the largest page that is read
+	DefaultMaxBytes = 5 << 20
+	// DefaultTimeout bounds fetching a page, redirects included
+	DefaultTimeout = 15 * time.Second
+	// maxRedirects is how many redirects are followed
+	maxRedirects = 5
+	// minTextLength is the least readable text a page must have to be used
+	minTextLength = 200
+)
+
+var (
+	// ErrTooLarge is returned for pages larger than the configured limit
+	ErrTooLarge = errors.New("page is too large")
+	// ErrUnsupportedContent is returned for responses that aren't HTML or plain text
+	ErrUnsupportedContent = errors.New("page is not HTML or plain text")
+	// ErrNoContent is returned for pages without enough readable text, e.g. pages rendered by scripts
+	ErrNoContent = errors.New("page has no readable content")
+	// ErrForbiddenAddress is returned for URLs of local or private network addresses
+	ErrForbiddenAddress = errors.New("address is not public")
+)
+
+// Page is the readable content of a web page
+type Page struct {
+	URL      string // URL the page was fetched from, after redirects
+	Title    string // Title of the page, empty if it has none
+	SiteName string // Name of the site from its metadata, empty if it has none
+	Text     string // Readable text of the main content, one line per paragraph, heading or list item
+}
+
+// Document returns the text of the page preceded by its title and URL, which give the
+// generator the context a file name gives for uploaded documents
+func (p *Page) Document() string {
+	var doc strings.Builder
+	if p.Title != "" {
+		fmt.Fprintf(&doc, "Page title: %s\n", p.Title)
+	}
+	if p.SiteName != "" {
+		fmt.Fprintf(&doc, "Site: %s\n", p.SiteName)
+	}
+	fmt.Fprintf(&doc, "URL: %s\n\n", p.URL)
+	doc.WriteString(p.Text)
+	return doc.String()
+}
+
+// Config configures how pages are fetched
+type Config struct {
+	HTTPClient   *http.Client  // Client for fetching pages, nil for one with Timeout that refuses non-public addresses
+	MaxBytes     int64         // Largest page that is read, DefaultMaxBytes if zero
+	Timeout      time.Duration // Time limit of a fetch, DefaultTimeout if zero
+	AllowPrivate bool          // Allow local and private network addresses, for tests against local servers
+}
+
+// Fetcher fetches web pages and extracts their content
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// New creates a Fetcher
+func New(cfg Config) *Fetcher {
+	f := &Fetcher{client: cfg.HTTPClient, maxBytes: cfg.MaxBytes}
+	if f.maxBytes <= 0 {
+		f.maxBytes = DefaultMaxBytes
+	}
+	if f.client == nil {
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		dialer := &net.Dialer{Timeout: timeout}
+		if !cfg.AllowPrivate {
+			// Checked on the resolved address, so names pointing to internal hosts are refused too
+			dialer.Control = func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+					return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+				}
+				return nil
+			}
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil // A proxy would dial the target for us, bypassing the address check
+		f.client = &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return fmt.Errorf("stopped after %d redirects", maxRedirects)
+				}
+				return checkURL(req.URL)
+			},
+		}
+	}
+	return f
+}
+
+// deniedPrefixes are the address ranges pages are never fetched from: private, shared and
+// special-purpose networks, documentation and benchmarking ranges, multicast and reserved space
+// (see the IANA special-purpose address registries). IPv6 ranges that embed IPv4 addresses, such as
+// NAT64 and 6to4, are denied whole, as the embedded address could be any of the others.
+var deniedPrefixes = mustParsePrefixes(
+	// IPv4
+	"0.0.0.0/8",       // "This network"
+	"10.0.0.0/8",      // Private
+	"100.64.0.0/10",   // Shared address space (carrier-grade NAT)
+	"127.0.0.0/8",     // Loopback
+	"169.254.0.0/16",  // Link-local, cloud metadata services included
+	"172.16.0.0/12",   // Private
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // Documentation (TEST-NET-1)
+	"192.88.99.0/24",  // 6to4 relay anycast
+	"192.168.0.0/16",  // Private
+	"198.18.0.0/15",   // Benchmarking
+	"198.51.100.0/24", // Documentation (TEST-NET-2)
+	"203.0.113.0/24",  // Documentation (TEST-NET-3)
+	"224.0.0.0/4",     // Multicast
+	"240.0.0.0/4",     // Reserved, the broadcast address included
+	// IPv6
+	"::/96",          // Unspecified, loopback and IPv4-compatible addresses
+	"64:ff9b::/96",   // NAT64
+	"64:ff9b:1::/48", // Local-use NAT64
+	"100::/64",       // Discard-only
+	"2001::/23",      // IETF protocol assignments, Teredo included
+	"2001:db8::/32",  // Documentation
+	"2002::/16",      // 6to4
+	"fc00::/7",       // Unique local
+	"fe80::/10",      // Link-local
+	"fec0::/10",      // Site-local (deprecated)
+	"ff00::/8",       // Multicast
+)
+
+func mustParsePrefixes(prefixes ...string) []netip.Prefix {
+	parsed := make([]netip.Prefix, len(prefixes))
+	for i, prefix := range prefixes {
+		parsed[i] = netip.MustParsePrefix(prefix)
+	}
+	return parsed
+}
+
+// isPublic reports whether an IP address is reachable on the public internet. IPv4-mapped IPv6
+// addresses are checked as the IPv4 addresses they map to.
+func isPublic(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkURL accepts absolute http and https URLs
+func checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q, use http or https", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("URL has no host")
+	}
+	return nil
+}
+
+// Fetch downloads a page and extracts its main readable content. HTML pages are stripped of
+// navigation, scripts and other boilerplate; plain text is used as it is.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Page, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if err := checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9")
+	req.Header.Set("User-Agent", "QuizBuilderAI/1.0 (+https://quizbuilder.ai)")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch page: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch page: unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, at most %d are accepted", ErrTooLarge, resp.ContentLength, f.maxBytes)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType = "text/html"
+	}
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" && mediaType != "text/plain" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContent, mediaType)
+	}
+
+	// Read one byte more than the limit to tell a page of exactly the limit from a larger one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page: %w", err)
+	}
+	if int64(len(body)) > f.maxBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, f.maxBytes)
+	}
+
+	// Decode to UTF-8 from the charset of the header, the page's meta tags or a guess
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		log.Printf("WARN: Unknown charset of %s (%q), reading it as UTF-8: %v", u, contentType, err)
+		reader = bytes.NewReader(body)
+	}
+
+	page := &Page{URL: resp.Request.URL.String()}
+	if mediaType == "text/plain" {
+		text, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode page: %w", err)
+		}
+		page.Text = normalizeText(string(text))
+	} else {
+		if err := extractHTML(reader, page); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(page.Text) < minTextLength {
+		return nil, ErrNoContent
+	}
+	return page, nil
+}
@@ -0,0 +1,94 @@
+package youtube
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"quizbuilderai/internal/db"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Cache stores fetched transcripts so the same video isn't fetched again
+type Cache interface {
+	// Get returns the transcript of a video in the language GetTranscript would choose for the preferred
+	// languages, if one fetched after fetchedAfter is cached, and nil otherwise
+	Get(ctx context.Context, videoID string, languages []string, fetchedAfter time.Time) (*Transcript, error)
+	// Put stores a fetched transcript, replacing the cached one of its video and language
+	Put(ctx context.Context, transcript *Transcript) error
+	// DeleteExpired removes the transcripts fetched before fetchedBefore and returns how many there were
+	DeleteExpired(ctx context.Context, fetchedBefore time.Time) (int64, error)
+}
+
+// dbCache caches transcripts in the youtube_transcripts table
+type dbCache struct {
+	queries db.Querier
+}
+
+// NewDBCache returns a Cache backed by the youtube_transcripts table
+func NewDBCache(queries db.Querier) Cache {
+	return &dbCache{queries: queries}
+}
+
+func (c *dbCache) Get(ctx context.Context, videoID string, languages []string, fetchedAfter time.Time) (*Transcript, error) {
+	// The caption languages of the video decide which transcript the preferences select
+	available, err := c.queries.GetYoutubeTranscriptLanguages(ctx, db.GetYoutubeTranscriptLanguagesParams{
+		VideoID:   videoID,
+		FetchedAt: fetchedAfter,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	row, err := c.queries.GetYoutubeTranscript(ctx, db.GetYoutubeTranscriptParams{
+		VideoID:   videoID,
+		Language:  chooseLanguage(available, languages),
+		FetchedAt: fetchedAfter,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := &Transcript{
+		VideoID:         row.VideoID,
+		Title:           row.Title.String,
+		Channel:         row.Channel.String,
+		DurationSeconds: int(row.DurationSeconds.Int32),
+		Language:        row.Language,
+		Languages:       row.Languages,
+	}
+	if err := json.Unmarshal(row.Segments, &transcript.Segments); err != nil {
+		return nil, fmt.Errorf("failed to decode cached segments: %w", err)
+	}
+	return transcript, nil
+}
+
+func (c *dbCache) Put(ctx context.Context, transcript *Transcript) error {
+	segments, err := json.Marshal(transcript.Segments)
+	if err != nil {
+		return fmt.Errorf("failed to encode segments: %w", err)
+	}
+	return c.queries.UpsertYoutubeTranscript(ctx, db.UpsertYoutubeTranscriptParams{
+		VideoID:         transcript.VideoID,
+		Language:        transcript.Language,
+		Title:           pgtype.Text{String: transcript.Title, Valid: transcript.Title != ""},
+		Languages:       transcript.Languages,
+		Segments:        segments,
+		Channel:         pgtype.Text{String: transcript.Channel, Valid: transcript.Channel != ""},
+		DurationSeconds: pgtype.Int4{Int32: int32(transcript.DurationSeconds), Valid: transcript.DurationSeconds > 0},
+	})
+}
+
+func (c *dbCache) DeleteExpired(ctx context.Context, fetchedBefore time.Time) (int64, error) {
+	return c.queries.DeleteExpiredYoutubeTranscripts(ctx, fetchedBefore)
+}
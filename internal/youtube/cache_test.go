@@ -0,0 +1,136 @@
+package youtube
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"quizbuilderai/internal/db"
+)
+
+// fakeTranscriptQueries keeps the youtube_transcripts table in memory. Only the queries of the
+// transcript cache are implemented; the embedded interface panics on any other.
+type fakeTranscriptQueries struct {
+	db.Querier
+	mu   sync.Mutex
+	rows map[[2]string]db.YoutubeTranscript // By video ID and language
+}
+
+func (q *fakeTranscriptQueries) GetYoutubeTranscriptLanguages(ctx context.Context, arg db.GetYoutubeTranscriptLanguagesParams) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var latest *db.YoutubeTranscript
+	for key, row := range q.rows {
+		if key[0] == arg.VideoID && row.FetchedAt.After(arg.FetchedAt) && (latest == nil || row.FetchedAt.After(latest.FetchedAt)) {
+			latest = &row
+		}
+	}
+	if latest == nil {
+		return nil, sql.ErrNoRows
+	}
+	return latest.Languages, nil
+}
+
+func (q *fakeTranscriptQueries) GetYoutubeTranscript(ctx context.Context, arg db.GetYoutubeTranscriptParams) (db.YoutubeTranscript, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	row, ok := q.rows[[2]string{arg.VideoID, arg.Language}]
+	if !ok || !row.FetchedAt.After(arg.FetchedAt) {
+		return db.YoutubeTranscript{}, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (q *fakeTranscriptQueries) UpsertYoutubeTranscript(ctx context.Context, arg db.UpsertYoutubeTranscriptParams) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rows[[2]string{arg.VideoID, arg.Language}] = db.YoutubeTranscript{
+		VideoID:         arg.VideoID,
+		Language:        arg.Language,
+		Title:           arg.Title,
+		Languages:       arg.Languages,
+		Segments:        arg.Segments,
+		FetchedAt:       time.Now(),
+		Channel:         arg.Channel,
+		DurationSeconds: arg.DurationSeconds,
+	}
+	return nil
+}
+
+func (q *fakeTranscriptQueries) DeleteExpiredYoutubeTranscripts(ctx context.Context, fetchedAt time.Time) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var deleted int64
+	for key, row := range q.rows {
+		if !row.FetchedAt.After(fetchedAt) {
+			delete(q.rows, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// age moves the fetch time of every cached transcript back by d
+func (q *fakeTranscriptQueries) age(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key, row := range q.rows {
+		row.FetchedAt = row.FetchedAt.Add(-d)
+		q.rows[key] = row
+	}
+}
+
+func TestGetTranscriptCache(t *testing.T) {
+	videos := map[string]fakeVideo{}
+	server, pageFetches := newFakeYouTube(t, videos)
+	videos["volcanoes01"] = fakeVideo{
+		captions: captionsJSON(server, [2]string{"en", ""}, [2]string{"fr", ""}),
+		tracks: map[string]string{
+			"en": transcriptXML("Magma rises"),
+			"fr": transcriptXML("Le magma monte"),
+		},
+	}
+	queries := &fakeTranscriptQueries{rows: make(map[[2]string]db.YoutubeTranscript)}
+	const ttl = time.Hour
+	yt := New(Config{HTTPClient: server.Client(), BaseURL: server.URL, Cache: NewDBCache(queries), CacheTTL: ttl})
+	ctx := context.Background()
+
+	get := func(languages []string, wantLanguage string, wantFetches int32) *Transcript {
+		t.Helper()
+		transcript, err := yt.GetTranscript(ctx, "volcanoes01", languages)
+		if err != nil {
+			t.Fatalf("GetTranscript(%v): %v", languages, err)
+		}
+		if transcript.Language != wantLanguage {
+			t.Errorf("GetTranscript(%v) language = %s, want %s", languages, transcript.Language, wantLanguage)
+		}
+		if got := pageFetches.Load(); got != wantFetches {
+			t.Errorf("after GetTranscript(%v), %d video page fetches, want %d", languages, got, wantFetches)
+		}
+		return transcript
+	}
+
+	fetched := get([]string{"en"}, "en", 1)
+
+	// A cache hit returns the same transcript without fetching, also for preferences that resolve
+	// to the cached language by the cached list of available languages
+	if cached := get([]string{"en"}, "en", 1); cached.Title != fetched.Title || cached.DurationSeconds != fetched.DurationSeconds ||
+		len(cached.Segments) != 1 || cached.Segments[0] != fetched.Segments[0] {
+		t.Errorf("cached transcript = %+v, want %+v", cached, fetched)
+	}
+	get([]string{"es"}, "en", 1)
+
+	// Another language of the video isn't cached yet
+	get([]string{"fr"}, "fr", 2)
+	get([]string{"fr"}, "fr", 2)
+
+	// Once the TTL has passed the transcript is fetched again, and expired transcripts are deleted
+	queries.age(ttl + time.Minute)
+	get([]string{"en"}, "en", 3)
+	if len(queries.rows) != 1 {
+		t.Errorf("%d cached transcripts after expiry, want only the one fetched again", len(queries.rows))
+	}
+	get([]string{"en"}, "en", 3)
+}
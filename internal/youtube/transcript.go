@@ -1,15 +1,18 @@
 package youtube
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html"
-	"io/ioutil"
+	"io"
 	"log"
 	"net/http"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
@@ -17,130 +20,357 @@ const (
 	RE_XML_TRANSCRIPT = `<text start="([^"]*)" dur="([^"]*)">([^<]*)<\/text>`
 )
 
-type TranscriptResponse struct {
+// markerInterval is the least number of seconds between two time markers in a transcript
+const markerInterval = 30
+
+const (
+	// DefaultBaseURL is where video pages are fetched from
+	DefaultBaseURL = "https://www.youtube.com"
+	// DefaultCacheTTL is how long a fetched transcript is reused
+	DefaultCacheTTL = 7 * 24 * time.Hour
+	// defaultTimeout bounds each request to YouTube
+	defaultTimeout = 15 * time.Second
+)
+
+// Segment is one caption of a transcript
+type Segment struct {
 	Text     string  `json:"text"`
-	Duration float64 `json:"duration"`
-	Offset   float64 `json:"offset"`
-	Lang     string  `json:"lang"`
+	Offset   float64 `json:"offset"`   // Seconds from the start of the video
+	Duration float64 `json:"duration"` // Seconds the caption is shown
+}
+
+// Transcript is the transcript of a video in one caption language
+type Transcript struct {
+	VideoID         string
+	Title           string    // Title of the video, empty if it couldn't be read
+	Channel         string    // Name of the channel that published the video, empty if unknown
+	DurationSeconds int       // Length of the video, 0 if unknown
+	Language        string    // Language code of the caption track, e.g. "en" or "pt-BR"
+	Languages       []string  // Language codes of all caption tracks of the video, manual captions first
+	Segments        []Segment // Captions in order of their offset
 }
 
-type YoutubeTranscript struct{}
+// Document returns the text of the transcript preceded by the title, channel and duration of the video,
+// which give the generator the context a file name gives for uploaded documents
+func (t *Transcript) Document() string {
+	var doc strings.Builder
+	if t.Title != "" {
+		fmt.Fprintf(&doc, "Video title: %s\n", t.Title)
+	}
+	if t.Channel != "" {
+		fmt.Fprintf(&doc, "Channel: %s\n", t.Channel)
+	}
+	if t.DurationSeconds > 0 {
+		fmt.Fprintf(&doc, "Duration: %s\n", strings.Trim(timeMarker(float64(t.DurationSeconds)), "[]"))
+	}
+	if doc.Len() > 0 {
+		doc.WriteString("\nTranscript:\n")
+	}
+	doc.WriteString(t.Text())
+	return doc.String()
+}
 
-func New() *YoutubeTranscript {
-	return &YoutubeTranscript{}
+// Text joins the captions into one text, marking the time every markerInterval seconds
+// so that questions can point to the moment of the video they are based on
+func (t *Transcript) Text() string {
+	var fullText strings.Builder
+	lastMarker := -1.0
+	for _, s := range t.Segments {
+		if lastMarker < 0 || s.Offset-lastMarker >= markerInterval {
+			fullText.WriteString(timeMarker(s.Offset))
+			fullText.WriteString(" ")
+			lastMarker = s.Offset
+		}
+		fullText.WriteString(s.Text)
+		fullText.WriteString(" ")
+	}
+	return fullText.String()
+}
+
+// Config configures how transcripts are fetched and cached
+type Config struct {
+	HTTPClient *http.Client  // Client for requests to YouTube, one with a 15 second timeout if nil
+	BaseURL    string        // Where video pages are fetched from, DefaultBaseURL if empty
+	Cache      Cache         // Cache of fetched transcripts, nil to always fetch
+	CacheTTL   time.Duration // How long cached transcripts are used, DefaultCacheTTL if zero
+}
+
+// ConfigFromEnv reads the cache TTL from YOUTUBE_TRANSCRIPT_CACHE_TTL (a duration such as "72h")
+func ConfigFromEnv() Config {
+	var cfg Config
+	if value := os.Getenv("YOUTUBE_TRANSCRIPT_CACHE_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			log.Printf("WARNING: Invalid value %q for YOUTUBE_TRANSCRIPT_CACHE_TTL, using default %s", value, DefaultCacheTTL)
+		} else {
+			cfg.CacheTTL = ttl
+		}
+	}
+	return cfg
 }
 
-func (yt *YoutubeTranscript) GetTranscript(url string, lang string) (string, error) {
+type YoutubeTranscript struct {
+	client   *http.Client
+	baseURL  string
+	cache    Cache
+	cacheTTL time.Duration
+}
+
+func New(cfg Config) *YoutubeTranscript {
+	yt := &YoutubeTranscript{
+		client:   cfg.HTTPClient,
+		baseURL:  strings.TrimSuffix(cfg.BaseURL, "/"),
+		cache:    cfg.Cache,
+		cacheTTL: cfg.CacheTTL,
+	}
+	if yt.client == nil {
+		yt.client = &http.Client{Timeout: defaultTimeout}
+	}
+	if yt.baseURL == "" {
+		yt.baseURL = DefaultBaseURL
+	}
+	if yt.cacheTTL == 0 {
+		yt.cacheTTL = DefaultCacheTTL
+	}
+	return yt
+}
+
+// GetTranscript returns the transcript of a video in the first of the preferred languages it has
+// captions in. Language codes match exactly or by their base language ("en" matches "en-GB").
+// Without a match, or without preferred languages, the first language with manual captions is used.
+func (yt *YoutubeTranscript) GetTranscript(ctx context.Context, url string, languages []string) (*Transcript, error) {
 	videoId, err := retrieveVideoId(url)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	if yt.cache != nil {
+		cached, err := yt.cache.Get(ctx, videoId, languages, time.Now().Add(-yt.cacheTTL))
+		if err != nil {
+			log.Printf("WARN: Failed to read cached transcript of video %s: %v", videoId, err)
+		} else if cached != nil {
+			log.Printf("INFO: Using cached %s transcript of video %s", cached.Language, videoId)
+			return cached, nil
+		}
 	}
 
-	transcripts, _, err := yt.fetchTranscript(videoId, lang)
+	transcript, err := yt.fetchTranscript(ctx, videoId, languages)
+	if err != nil {
+		return nil, err
+	}
+
+	if yt.cache != nil {
+		if err := yt.cache.Put(ctx, transcript); err != nil {
+			log.Printf("WARN: Failed to cache transcript of video %s: %v", videoId, err)
+		}
+		// Expired transcripts of other videos are dropped whenever a new one is cached
+		if deleted, err := yt.cache.DeleteExpired(ctx, time.Now().Add(-yt.cacheTTL)); err != nil {
+			log.Printf("WARN: Failed to delete expired transcripts: %v", err)
+		} else if deleted > 0 {
+			log.Printf("INFO: Deleted %d expired transcripts", deleted)
+		}
+	}
+	return transcript, nil
+}
+
+// timeMarker formats an offset into a video as it is marked in transcripts, e.g. [1:02:03] or [12:34]
+func timeMarker(seconds float64) string {
+	total := int(seconds)
+	h, m, s := total/3600, total%3600/60, total%60
+	if h > 0 {
+		return fmt.Sprintf("[%d:%02d:%02d]", h, m, s)
+	}
+	return fmt.Sprintf("[%d:%02d]", m, s)
+}
+
+// TimestampURL returns a link to the video of a YouTube URL that starts playing at the given second
+func TimestampURL(url string, seconds int) (string, error) {
+	videoId, err := retrieveVideoId(url)
 	if err != nil {
 		return "", err
 	}
+	return fmt.Sprintf("https://www.youtube.com/watch?v=%s&t=%ds", videoId, seconds), nil
+}
 
-	// Combine all transcript texts into one string
-	var fullText strings.Builder
-	for _, t := range transcripts {
-		fullText.WriteString(html.UnescapeString(t.Text))
-		fullText.WriteString(" ")
+// captionTrack is a caption track listed on a video page
+type captionTrack struct {
+	BaseURL      string `json:"baseUrl"`
+	LanguageCode string `json:"languageCode"`
+	Kind         string `json:"kind"` // "asr" for automatic captions
+}
+
+// trackLanguages lists the language codes of the tracks once each, manual captions first
+func trackLanguages(tracks []captionTrack) []string {
+	var languages []string
+	seen := make(map[string]bool)
+	for _, asr := range []bool{false, true} {
+		for _, track := range tracks {
+			if (track.Kind == "asr") == asr && !seen[track.LanguageCode] {
+				seen[track.LanguageCode] = true
+				languages = append(languages, track.LanguageCode)
+			}
+		}
 	}
+	return languages
+}
 
-	return fullText.String(), nil
+// chooseLanguage picks the caption language to use from the available ones (manual captions first):
+// the first preferred language available exactly or by its base language, else the first available
+func chooseLanguage(available, preferred []string) string {
+	if len(available) == 0 {
+		return ""
+	}
+	for _, want := range preferred {
+		want = strings.ToLower(strings.TrimSpace(want))
+		if want == "" {
+			continue
+		}
+		for _, code := range available {
+			if strings.ToLower(code) == want {
+				return code
+			}
+		}
+		base, _, _ := strings.Cut(want, "-")
+		for _, code := range available {
+			if codeBase, _, _ := strings.Cut(strings.ToLower(code), "-"); codeBase == base {
+				return code
+			}
+		}
+	}
+	return available[0]
 }
 
-func (yt *YoutubeTranscript) fetchTranscript(videoId string, lang string) ([]TranscriptResponse, string, error) {
-	videoPageURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoId)
-	videoPageResponse, err := http.Get(videoPageURL)
+// get fetches a URL with the client of yt and returns the body of a successful response
+func (yt *YoutubeTranscript) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Without a language YouTube may answer with a consent page
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	resp, err := yt.client.Do(req)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to fetch video page: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
 	}
-	defer videoPageResponse.Body.Close()
+	return io.ReadAll(resp.Body)
+}
 
-	videoPageBody, err := ioutil.ReadAll(videoPageResponse.Body)
+func (yt *YoutubeTranscript) fetchTranscript(ctx context.Context, videoId string, languages []string) (*Transcript, error) {
+	videoPageURL := fmt.Sprintf("%s/watch?v=%s", yt.baseURL, videoId)
+	videoPageBody, err := yt.get(ctx, videoPageURL)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read video page body: %v", err)
+		return nil, fmt.Errorf("failed to fetch video page: %v", err)
 	}
 
-	// Extract video title
-	titleRegex := regexp.MustCompile(`<title>(.+?) - YouTube</title>`)
-	titleMatch := titleRegex.FindSubmatch(videoPageBody)
-	var videoTitle string
-	if len(titleMatch) > 1 {
-		videoTitle = html.UnescapeString(string(titleMatch[1]))
+	// Extract video title, channel and duration
+	details := parseVideoDetails(string(videoPageBody))
+	if details.Title == "" {
+		titleRegex := regexp.MustCompile(`<title>(.+?) - YouTube</title>`)
+		titleMatch := titleRegex.FindSubmatch(videoPageBody)
+		if len(titleMatch) > 1 {
+			details.Title = html.UnescapeString(string(titleMatch[1]))
+		}
 	}
 
 	splittedHTML := strings.Split(string(videoPageBody), `"captions":`)
 	if len(splittedHTML) <= 1 {
 		// Log the HTML around where captions were expected
 		log.Printf("DEBUG: Could not find '\"captions\":' marker in video page HTML for video %s. HTML snippet near expected location: %s", videoId, getHTMLSnippet(string(videoPageBody), `"captions":`))
-		return nil, "", fmt.Errorf("no captions available for video %s", videoId)
+		return nil, fmt.Errorf("no captions available for video %s", videoId)
 	}
 
 	var captions struct {
 		PlayerCaptionsTracklistRenderer struct {
-			CaptionTracks []struct {
-				BaseURL      string `json:"baseUrl"`
-				LanguageCode string `json:"languageCode"`
-			} `json:"captionTracks"`
+			CaptionTracks []captionTrack `json:"captionTracks"`
 		} `json:"playerCaptionsTracklistRenderer"`
 	}
 
-	captionsData := splittedHTML[1][:strings.Index(splittedHTML[1], ",\"videoDetails")]
+	captionsData := splittedHTML[1]
+	if end := strings.Index(captionsData, ",\"videoDetails"); end >= 0 {
+		captionsData = captionsData[:end]
+	}
 	err = json.Unmarshal([]byte(captionsData), &captions)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to parse captions data: %v", err)
+		return nil, fmt.Errorf("failed to parse captions data: %v", err)
 	}
 
-	if len(captions.PlayerCaptionsTracklistRenderer.CaptionTracks) == 0 {
+	tracks := captions.PlayerCaptionsTracklistRenderer.CaptionTracks
+	if len(tracks) == 0 {
 		// Log the parsed captions data if tracks are missing
 		log.Printf("DEBUG: Parsed captions data for video %s, but CaptionTracks array is empty. Captions JSON: %s", videoId, captionsData)
-		return nil, "", fmt.Errorf("no transcripts available for video %s", videoId)
+		return nil, fmt.Errorf("no transcripts available for video %s", videoId)
 	}
 
-	var transcriptURL string
-	if lang != "" {
-		for _, track := range captions.PlayerCaptionsTracklistRenderer.CaptionTracks {
-			if track.LanguageCode == lang {
-				transcriptURL = track.BaseURL
-				break
-			}
-		}
-		if transcriptURL == "" {
-			return nil, "", fmt.Errorf("no transcript available in language %s", lang)
+	// Manual captions of the chosen language are preferred over automatic ones
+	available := trackLanguages(tracks)
+	language := chooseLanguage(available, languages)
+	var track captionTrack
+	for _, t := range tracks {
+		if t.LanguageCode == language && (track.BaseURL == "" || track.Kind == "asr") {
+			track = t
 		}
-	} else {
-		transcriptURL = captions.PlayerCaptionsTracklistRenderer.CaptionTracks[0].BaseURL
-	}
-
-	transcriptResponse, err := http.Get(transcriptURL)
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to fetch transcript: %v", err)
 	}
-	defer transcriptResponse.Body.Close()
+	log.Printf("INFO: Using %s captions of video %s (preferred %v, available %v)", language, videoId, languages, available)
 
-	transcriptBody, err := ioutil.ReadAll(transcriptResponse.Body)
+	transcriptBody, err := yt.get(ctx, track.BaseURL)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to read transcript body: %v", err)
+		return nil, fmt.Errorf("failed to fetch transcript: %v", err)
 	}
 
 	re := regexp.MustCompile(RE_XML_TRANSCRIPT)
 	matches := re.FindAllStringSubmatch(string(transcriptBody), -1)
-	var results []TranscriptResponse
+	transcript := &Transcript{
+		VideoID:         videoId,
+		Title:           details.Title,
+		Channel:         details.Author,
+		DurationSeconds: details.lengthSeconds(),
+		Language:        language,
+		Languages:       available,
+	}
 	for _, match := range matches {
 		duration, _ := strconv.ParseFloat(match[2], 64)
 		offset, _ := strconv.ParseFloat(match[1], 64)
-		results = append(results, TranscriptResponse{
-			Text:     match[3],
+		transcript.Segments = append(transcript.Segments, Segment{
+			Text:     html.UnescapeString(html.UnescapeString(match[3])), // Captions are escaped twice
 			Duration: duration,
 			Offset:   offset,
-			Lang:     lang,
 		})
 	}
+	if len(transcript.Segments) == 0 {
+		return nil, fmt.Errorf("transcript of video %s in %s is empty", videoId, language)
+	}
+
+	return transcript, nil
+}
+
+// videoDetails is the part of the player response on a video page that describes the video
+type videoDetails struct {
+	Title         string `json:"title"`
+	Author        string `json:"author"`        // Channel name
+	LengthSeconds string `json:"lengthSeconds"` // A number in a string
+}
+
+func (d videoDetails) lengthSeconds() int {
+	seconds, _ := strconv.Atoi(d.LengthSeconds)
+	return seconds
+}
 
-	return results, videoTitle, nil
+// parseVideoDetails reads the "videoDetails" object of a video page, zero if it has none
+func parseVideoDetails(page string) videoDetails {
+	var details videoDetails
+	_, after, found := strings.Cut(page, `"videoDetails":`)
+	if !found {
+		return details
+	}
+	// The decoder stops after the object, whatever follows it
+	if err := json.NewDecoder(strings.NewReader(after)).Decode(&details); err != nil {
+		log.Printf("DEBUG: Failed to parse video details: %v", err)
+	}
+	return details
 }
 
 func retrieveVideoId(url string) (string, error) {
@@ -0,0 +1,157 @@
+package youtube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeVideo is a video served by newFakeYouTube
+type fakeVideo struct {
+	captions string            // The "captions" JSON of the video page, none if empty
+	tracks   map[string]string // Transcript XML by the lang parameter of the track URL
+}
+
+// newFakeYouTube serves video pages and caption tracks. It counts the video pages fetched.
+func newFakeYouTube(t *testing.T, videos map[string]fakeVideo) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var pageFetches atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/watch", func(w http.ResponseWriter, r *http.Request) {
+		pageFetches.Add(1)
+		video, ok := videos[r.URL.Query().Get("v")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>Ignored - YouTube</title></head><body><script>var ytInitialPlayerResponse = {`)
+		if video.captions != "" {
+			fmt.Fprintf(w, `"captions":%s,`, video.captions)
+		}
+		fmt.Fprint(w, `"videoDetails":{"title":"How Volcanoes Work","author":"Earth Science","lengthSeconds":"754"}};</script></body></html>`)
+	})
+	mux.HandleFunc("/api/timedtext", func(w http.ResponseWriter, r *http.Request) {
+		for _, video := range videos {
+			if body, ok := video.tracks[r.URL.Query().Get("lang")]; ok {
+				fmt.Fprint(w, body)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &pageFetches
+}
+
+// captionsJSON lists caption tracks served by server; kinds are "" for manual captions or "asr"
+func captionsJSON(server *httptest.Server, tracks ...[2]string) string {
+	var list []string
+	for _, track := range tracks {
+		list = append(list, fmt.Sprintf(`{"baseUrl":"%s/api/timedtext?lang=%s","languageCode":"%s","kind":"%s"}`,
+			server.URL, track[0]+track[1], track[0], track[1]))
+	}
+	return `{"playerCaptionsTracklistRenderer":{"captionTracks":[` + strings.Join(list, ",") + `]}}`
+}
+
+func transcriptXML(captions ...string) string {
+	var xml strings.Builder
+	xml.WriteString(`<?xml version="1.0" encoding="utf-8" ?><transcript>`)
+	for i, caption := range captions {
+		fmt.Fprintf(&xml, `<text start="%d.5" dur="2.5">%s</text>`, i*20, caption)
+	}
+	xml.WriteString(`</transcript>`)
+	return xml.String()
+}
+
+func TestGetTranscriptLanguageFallback(t *testing.T) {
+	videos := map[string]fakeVideo{}
+	server, _ := newFakeYouTube(t, videos)
+	videos["volcanoes01"] = fakeVideo{
+		// Automatic English captions are listed before the manual ones
+		captions: captionsJSON(server, [2]string{"en", "asr"}, [2]string{"de", ""}, [2]string{"pt-BR", ""}),
+		tracks: map[string]string{
+			"enasr": transcriptXML("Magma rises", "It&amp;#39;s hot"),
+			"de":    transcriptXML("Magma steigt auf"),
+			"pt-BR": transcriptXML("O magma sobe"),
+		},
+	}
+	yt := New(Config{HTTPClient: server.Client(), BaseURL: server.URL})
+
+	tests := []struct {
+		preferred []string
+		language  string
+		first     string
+	}{
+		{[]string{"en"}, "en", "Magma rises"},
+		{[]string{"pt"}, "pt-BR", "O magma sobe"},        // By the base language
+		{[]string{"fr", "DE"}, "de", "Magma steigt auf"}, // The next preference, whatever the case
+		{[]string{"fr"}, "de", "Magma steigt auf"},       // The first manual captions
+		{nil, "de", "Magma steigt auf"},
+	}
+	for _, tt := range tests {
+		transcript, err := yt.GetTranscript(context.Background(), "https://www.youtube.com/watch?v=volcanoes01", tt.preferred)
+		if err != nil {
+			t.Fatalf("GetTranscript(%v): %v", tt.preferred, err)
+		}
+		if transcript.Language != tt.language || transcript.Segments[0].Text != tt.first {
+			t.Errorf("GetTranscript(%v) = %s %q, want %s %q", tt.preferred, transcript.Language, transcript.Segments[0].Text, tt.language, tt.first)
+		}
+		if want := []string{"de", "pt-BR", "en"}; !reflect.DeepEqual(transcript.Languages, want) {
+			t.Errorf("languages = %v, want %v", transcript.Languages, want)
+		}
+	}
+
+	transcript, err := yt.GetTranscript(context.Background(), "volcanoes01", []string{"en"})
+	if err != nil {
+		t.Fatalf("GetTranscript: %v", err)
+	}
+	want := &Transcript{
+		VideoID:         "volcanoes01",
+		Title:           "How Volcanoes Work",
+		Channel:         "Earth Science",
+		DurationSeconds: 754,
+		Language:        "en",
+		Languages:       []string{"de", "pt-BR", "en"},
+		Segments: []Segment{
+			{Text: "Magma rises", Offset: 0.5, Duration: 2.5},
+			{Text: "It's hot", Offset: 20.5, Duration: 2.5},
+		},
+	}
+	if !reflect.DeepEqual(transcript, want) {
+		t.Errorf("transcript = %+v, want %+v", transcript, want)
+	}
+}
+
+func TestGetTranscriptMissing(t *testing.T) {
+	videos := map[string]fakeVideo{}
+	server, _ := newFakeYouTube(t, videos)
+	videos["nocaptions1"] = fakeVideo{}
+	videos["notracks123"] = fakeVideo{captions: `{"playerCaptionsTracklistRenderer":{"captionTracks":[]}}`}
+	videos["emptytrack1"] = fakeVideo{
+		captions: captionsJSON(server, [2]string{"es", ""}),
+		tracks:   map[string]string{"es": transcriptXML()},
+	}
+	yt := New(Config{HTTPClient: server.Client(), BaseURL: server.URL})
+
+	tests := []struct {
+		video string
+		err   string
+	}{
+		{"nocaptions1", "no captions available"},
+		{"notracks123", "no transcripts available"},
+		{"emptytrack1", "is empty"},
+		{"unknownvid1", "failed to fetch video page"},
+	}
+	for _, tt := range tests {
+		_, err := yt.GetTranscript(context.Background(), tt.video, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("GetTranscript(%s) error = %v, want %q", tt.video, err, tt.err)
+		}
+	}
+}
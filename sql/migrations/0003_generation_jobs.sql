@@ -0,0 +1,30 @@
+-- +goose Up
+-- Quiz generation runs in background workers; each request becomes a job row.
+CREATE TYPE generation_job_status AS ENUM ('queued', 'running', 'succeeded', 'failed');
+
+-- generation_jobs Table
+CREATE TABLE generation_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status generation_job_status NOT NULL DEFAULT 'queued',
+    input JSONB NOT NULL,
+    quiz_id UUID REFERENCES quizes(id) ON DELETE SET NULL,
+    error TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Trigger for generation_jobs updated_at
+CREATE TRIGGER set_timestamp_generation_jobs
+BEFORE UPDATE ON generation_jobs
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_timestamp();
+-- Indexes
+CREATE INDEX idx_generation_jobs_user_id ON generation_jobs(user_id);
+CREATE INDEX idx_generation_jobs_status ON generation_jobs(status);
+
+-- +goose Down
+DROP TRIGGER IF EXISTS set_timestamp_generation_jobs ON generation_jobs;
+DROP TABLE IF EXISTS generation_jobs;
+DROP TYPE IF EXISTS generation_job_status;
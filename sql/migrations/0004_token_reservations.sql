@@ -0,0 +1,33 @@
+-- +goose NO TRANSACTION
+-- ALTER TYPE ... ADD VALUE can't be used in the same transaction that adds it,
+-- so this migration runs without one.
+
+-- +goose Up
+-- Expected generation cost is held in the ledger before the generator runs.
+ALTER TYPE token_type ADD VALUE IF NOT EXISTS 'reservation';
+
+-- Ledger rows are 'settled' unless they are a reservation that hasn't been settled ('pending')
+-- or was given back ('released'). Released rows don't count towards the balance.
+CREATE TYPE token_status AS ENUM ('pending', 'settled', 'released');
+
+ALTER TABLE tokens
+    ADD COLUMN status token_status NOT NULL DEFAULT 'settled',
+    ADD COLUMN generation_job_id UUID REFERENCES generation_jobs(id) ON DELETE SET NULL;
+CREATE INDEX idx_tokens_generation_job_id ON tokens(generation_job_id);
+
+-- The reserved amounts, so a reservation can be settled or released per balance
+ALTER TABLE generation_jobs
+    ADD COLUMN reserved_input_tokens INT NOT NULL DEFAULT 0,
+    ADD COLUMN reserved_output_tokens INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE generation_jobs
+    DROP COLUMN IF EXISTS reserved_output_tokens,
+    DROP COLUMN IF EXISTS reserved_input_tokens;
+DROP INDEX IF EXISTS idx_tokens_generation_job_id;
+-- Reservations can't exist without the enum value, which Postgres can't drop
+DELETE FROM tokens WHERE type = 'reservation';
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS generation_job_id,
+    DROP COLUMN IF EXISTS status;
+DROP TYPE IF EXISTS token_status;
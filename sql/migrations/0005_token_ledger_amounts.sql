@@ -0,0 +1,45 @@
+-- +goose Up
+-- The ledger records what each row does to the input and output balances separately.
+-- amount stays the total of the row as reported by the generator.
+ALTER TABLE tokens
+    ADD COLUMN input_amount INT NOT NULL DEFAULT 0,
+    ADD COLUMN output_amount INT NOT NULL DEFAULT 0,
+    ADD COLUMN legacy_amount INT; -- Total of rows written before the split, NULL for all others
+
+-- Reservations know their split from the job
+UPDATE tokens t
+SET input_amount = -j.reserved_input_tokens, output_amount = -j.reserved_output_tokens
+FROM generation_jobs j
+WHERE t.generation_job_id = j.id AND t.type = 'reservation';
+
+-- Older rows only have a total; how it was split between the balances was never recorded.
+-- Their total moves to legacy_amount and they count towards neither balance, the opening
+-- gift below absorbs them instead of a made-up split.
+UPDATE tokens SET legacy_amount = amount WHERE type <> 'reservation';
+
+-- Every existing user gets an opening gift covering what the ledger can't explain,
+-- so balances equal the sum of the ledger from here on.
+-- New users get their signup gift when they are created.
+INSERT INTO tokens (user_id, amount, type, status, input_amount, output_amount)
+SELECT
+    u.id,
+    (u.input_tokens_balance - COALESCE(l.input_sum, 0)) + (u.output_tokens_balance - COALESCE(l.output_sum, 0)),
+    'gift',
+    'settled',
+    u.input_tokens_balance - COALESCE(l.input_sum, 0),
+    u.output_tokens_balance - COALESCE(l.output_sum, 0)
+FROM users u
+LEFT JOIN (
+    SELECT user_id, SUM(input_amount) AS input_sum, SUM(output_amount) AS output_sum
+    FROM tokens
+    WHERE status <> 'released'
+    GROUP BY user_id
+) l ON l.user_id = u.id;
+
+-- +goose Down
+-- Nothing wrote gift rows before this migration
+DELETE FROM tokens WHERE type = 'gift';
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS legacy_amount,
+    DROP COLUMN IF EXISTS output_amount,
+    DROP COLUMN IF EXISTS input_amount;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- The options a quiz was generated with (question count, difficulty, Bloom mix,
+-- focus topics, language), so it can be regenerated the same way. NULL for older quizzes.
+ALTER TABLE quizes ADD COLUMN generation_options JSONB;
+
+-- +goose Down
+ALTER TABLE quizes DROP COLUMN IF EXISTS generation_options;
@@ -0,0 +1,34 @@
+-- +goose Up
+-- Questions other than single-answer multiple choice. Existing questions are multiple choice.
+CREATE TYPE question_type AS ENUM (
+    'multiple_choice', -- One correct answer among the options
+    'true_false',      -- Two options, True and False
+    'multi_select',    -- One or more correct answers among the options
+    'short_answer',    -- Free text, every answer row is an accepted answer
+    'numeric',         -- A number, within the tolerance of the answer row's value
+    'ordering',        -- Answer rows put in order by correct_position
+    'matching'         -- Each answer row matched with its match_text
+);
+
+ALTER TABLE questions ADD COLUMN question_type question_type NOT NULL DEFAULT 'multiple_choice';
+
+-- Type-specific answer data, NULL where the type doesn't use it
+ALTER TABLE answers
+    ADD COLUMN correct_position INT,            -- ordering: 1-based place of the item
+    ADD COLUMN match_text TEXT,                 -- matching: the item this answer is matched with
+    ADD COLUMN numeric_value DOUBLE PRECISION,  -- numeric: the correct value
+    ADD COLUMN tolerance DOUBLE PRECISION;      -- numeric: the largest accepted absolute deviation
+
+-- What the user answered for types that aren't a single selected answer
+-- (selected answers, text, number, order or matches)
+ALTER TABLE attempt_answers ADD COLUMN response JSONB;
+
+-- +goose Down
+ALTER TABLE attempt_answers DROP COLUMN IF EXISTS response;
+ALTER TABLE answers
+    DROP COLUMN IF EXISTS tolerance,
+    DROP COLUMN IF EXISTS numeric_value,
+    DROP COLUMN IF EXISTS match_text,
+    DROP COLUMN IF EXISTS correct_position;
+ALTER TABLE questions DROP COLUMN IF EXISTS question_type;
+DROP TYPE IF EXISTS question_type;
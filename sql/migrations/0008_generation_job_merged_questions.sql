@@ -0,0 +1,6 @@
+-- +goose Up
+-- Number of duplicate questions merged away while generating the quiz, reported with the job result
+ALTER TABLE generation_jobs ADD COLUMN merged_questions INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE generation_jobs DROP COLUMN IF EXISTS merged_questions;
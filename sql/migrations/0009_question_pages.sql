@@ -0,0 +1,14 @@
+-- +goose Up
+-- Where a generated question came from: the material and, for paged documents such as PDFs, the pages
+ALTER TABLE questions
+    ADD COLUMN material_id UUID REFERENCES materials(id) ON DELETE SET NULL,
+    ADD COLUMN page_start INT,
+    ADD COLUMN page_end INT,
+    ADD CONSTRAINT questions_page_range_check CHECK (page_start IS NULL OR (page_start >= 1 AND page_end >= page_start));
+
+-- +goose Down
+ALTER TABLE questions
+    DROP CONSTRAINT IF EXISTS questions_page_range_check,
+    DROP COLUMN IF EXISTS page_end,
+    DROP COLUMN IF EXISTS page_start,
+    DROP COLUMN IF EXISTS material_id;
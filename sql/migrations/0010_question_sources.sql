@@ -0,0 +1,40 @@
+-- +goose Up
+-- Where a generated question came from: the material, the pages (documents) or the offset (videos),
+-- and a short quote of the passage the answer is found in. Replaces the source columns of questions.
+CREATE TABLE question_sources (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    question_id UUID NOT NULL UNIQUE REFERENCES questions(id) ON DELETE CASCADE,
+    material_id UUID REFERENCES materials(id) ON DELETE SET NULL,
+    page_start INT,
+    page_end INT,
+    timestamp_seconds INT,
+    quote TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT question_sources_page_range_check CHECK (page_start IS NULL OR (page_start >= 1 AND page_end >= page_start)),
+    CONSTRAINT question_sources_timestamp_check CHECK (timestamp_seconds IS NULL OR timestamp_seconds >= 0)
+);
+CREATE INDEX idx_question_sources_material_id ON question_sources(material_id);
+
+INSERT INTO question_sources (question_id, material_id, page_start, page_end)
+SELECT id, material_id, page_start, page_end FROM questions
+WHERE material_id IS NOT NULL OR page_start IS NOT NULL;
+
+ALTER TABLE questions
+    DROP CONSTRAINT IF EXISTS questions_page_range_check,
+    DROP COLUMN IF EXISTS page_end,
+    DROP COLUMN IF EXISTS page_start,
+    DROP COLUMN IF EXISTS material_id;
+
+-- +goose Down
+ALTER TABLE questions
+    ADD COLUMN material_id UUID REFERENCES materials(id) ON DELETE SET NULL,
+    ADD COLUMN page_start INT,
+    ADD COLUMN page_end INT,
+    ADD CONSTRAINT questions_page_range_check CHECK (page_start IS NULL OR (page_start >= 1 AND page_end >= page_start));
+
+UPDATE questions q
+SET material_id = qs.material_id, page_start = qs.page_start, page_end = qs.page_end
+FROM question_sources qs
+WHERE qs.question_id = q.id;
+
+DROP TABLE IF EXISTS question_sources;
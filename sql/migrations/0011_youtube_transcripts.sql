@@ -0,0 +1,15 @@
+-- +goose Up
+-- Fetched YouTube transcripts, one row per video and caption language, reused until they expire
+CREATE TABLE youtube_transcripts (
+    video_id TEXT NOT NULL,
+    language TEXT NOT NULL,
+    title TEXT,
+    languages TEXT[] NOT NULL,  -- Caption languages the video had when it was fetched
+    segments JSONB NOT NULL,    -- Array of {text, offset, duration}, in seconds
+    fetched_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (video_id, language)
+);
+CREATE INDEX idx_youtube_transcripts_fetched_at ON youtube_transcripts(fetched_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS youtube_transcripts;
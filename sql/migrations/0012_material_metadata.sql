@@ -0,0 +1,14 @@
+-- +goose Up
+-- Details of a material's source, e.g. the title, channel and duration of a YouTube video
+ALTER TABLE materials ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}';
+
+-- The video details are cached along with the transcript
+ALTER TABLE youtube_transcripts
+    ADD COLUMN channel TEXT,
+    ADD COLUMN duration_seconds INT;
+
+-- +goose Down
+ALTER TABLE youtube_transcripts
+    DROP COLUMN IF EXISTS duration_seconds,
+    DROP COLUMN IF EXISTS channel;
+ALTER TABLE materials DROP COLUMN IF EXISTS metadata;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Where the original of an uploaded file is kept in object storage, and its size.
+-- Videos and web pages have no stored original, their url is the source.
+ALTER TABLE materials
+    ADD COLUMN storage_key TEXT,
+    ADD COLUMN size_bytes BIGINT;
+
+-- +goose Down
+ALTER TABLE materials
+    DROP COLUMN IF EXISTS size_bytes,
+    DROP COLUMN IF EXISTS storage_key;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- SHA-256 of the content of an uploaded file, hex encoded, so repeat uploads are recognised
+ALTER TABLE materials ADD COLUMN content_hash TEXT;
+CREATE INDEX idx_materials_user_id_content_hash ON materials(user_id, content_hash);
+
+-- Generated quizzes by the content they were generated from, so identical requests can be
+-- served from the model output of an earlier run instead of generating again
+CREATE TABLE generation_cache (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    content_hash TEXT NOT NULL,    -- SHA-256 over the hashes of all inputs of the job
+    prompt_version TEXT NOT NULL,  -- Outputs of older prompts are not reused
+    options_hash TEXT NOT NULL,    -- SHA-256 of the normalised generation options
+    generator TEXT NOT NULL,       -- Provider and model that generated the output
+    response JSONB NOT NULL,       -- Model output with the input each question came from
+    hits INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_hit_at TIMESTAMPTZ,
+    UNIQUE (content_hash, prompt_version, options_hash, generator)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS generation_cache;
+DROP INDEX IF EXISTS idx_materials_user_id_content_hash;
+ALTER TABLE materials DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,35 @@
+-- +goose Up
+-- Display order of the questions of a quiz and of the options of a question, starting at 1.
+-- Unrelated to answers.correct_position, which is the answer key of ordering questions.
+ALTER TABLE questions ADD COLUMN position INTEGER;
+ALTER TABLE answers ADD COLUMN position INTEGER;
+
+-- Existing rows keep the order they were listed in so far
+UPDATE questions q
+SET position = numbered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY quiz_id ORDER BY created_at, id) AS position
+    FROM questions
+) numbered
+WHERE q.id = numbered.id;
+
+UPDATE answers a
+SET position = numbered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY question_id ORDER BY created_at, id) AS position
+    FROM answers
+) numbered
+WHERE a.id = numbered.id;
+
+ALTER TABLE questions ALTER COLUMN position SET NOT NULL;
+ALTER TABLE answers ALTER COLUMN position SET NOT NULL;
+
+-- Deferrable, so a reorder can swap positions within one statement
+ALTER TABLE questions ADD CONSTRAINT questions_quiz_id_position_key UNIQUE (quiz_id, position) DEFERRABLE INITIALLY IMMEDIATE;
+ALTER TABLE answers ADD CONSTRAINT answers_question_id_position_key UNIQUE (question_id, position) DEFERRABLE INITIALLY IMMEDIATE;
+
+-- +goose Down
+ALTER TABLE answers DROP CONSTRAINT IF EXISTS answers_question_id_position_key;
+ALTER TABLE questions DROP CONSTRAINT IF EXISTS questions_quiz_id_position_key;
+ALTER TABLE answers DROP COLUMN IF EXISTS position;
+ALTER TABLE questions DROP COLUMN IF EXISTS position;
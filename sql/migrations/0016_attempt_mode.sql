@@ -0,0 +1,10 @@
+-- +goose Up
+-- How an attempt is taken: in an exam the answer key is revealed once the attempt is finished,
+-- in practice each question's answer key is revealed as soon as it is answered
+CREATE TYPE attempt_mode AS ENUM ('exam', 'practice');
+
+ALTER TABLE quiz_attempts ADD COLUMN mode attempt_mode NOT NULL DEFAULT 'exam';
+
+-- +goose Down
+ALTER TABLE quiz_attempts DROP COLUMN IF EXISTS mode;
+DROP TYPE IF EXISTS attempt_mode;
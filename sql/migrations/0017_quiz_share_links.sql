@@ -0,0 +1,26 @@
+-- +goose Up
+-- Links that open a quiz by a random token instead of its ID. A link stops working when it is
+-- revoked, expires or has started max_attempts attempts, and while the quiz is private.
+CREATE TABLE quiz_share_links (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    quiz_id UUID NOT NULL REFERENCES quizes(id) ON DELETE CASCADE,
+    creator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ,            -- NULL for links that don't expire
+    max_attempts INTEGER,              -- NULL for links without a limit
+    attempt_count INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_quiz_share_links_quiz_id ON quiz_share_links(quiz_id);
+
+-- Trigger for quiz_share_links updated_at
+CREATE TRIGGER set_timestamp_quiz_share_links
+BEFORE UPDATE ON quiz_share_links
+FOR EACH ROW
+EXECUTE FUNCTION trigger_set_timestamp();
+
+-- +goose Down
+DROP TRIGGER IF EXISTS set_timestamp_quiz_share_links ON quiz_share_links;
+DROP TABLE IF EXISTS quiz_share_links;
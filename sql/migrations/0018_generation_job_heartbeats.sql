@@ -0,0 +1,8 @@
+-- +goose Up
+-- Workers touch heartbeat_at while they run a job. A running job whose heartbeat is older than
+-- the lease was lost with its worker and may be failed by any instance.
+ALTER TABLE generation_jobs ADD COLUMN heartbeat_at TIMESTAMPTZ;
+UPDATE generation_jobs SET heartbeat_at = started_at WHERE status = 'running';
+
+-- +goose Down
+ALTER TABLE generation_jobs DROP COLUMN IF EXISTS heartbeat_at;
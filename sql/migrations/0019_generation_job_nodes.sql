@@ -0,0 +1,7 @@
+-- +goose Up
+-- The inputs of a queued job are kept on the disk of the instance that created it, so only that
+-- instance can run it. Jobs created before have no node and may be picked up by any instance.
+ALTER TABLE generation_jobs ADD COLUMN node_id TEXT;
+
+-- +goose Down
+ALTER TABLE generation_jobs DROP COLUMN IF EXISTS node_id;
@@ -1,8 +1,8 @@
 -- name: CreateAnswer :one
 INSERT INTO answers (
-    question_id, answer, is_correct, explanation
+    question_id, answer, is_correct, explanation, correct_position, match_text, numeric_value, tolerance, position
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
 )
 RETURNING *;
 
@@ -12,12 +12,12 @@ WHERE id = $1 LIMIT 1;
 
 -- name: ListAnswers :many
 SELECT * FROM answers
-ORDER BY created_at ASC;
+ORDER BY question_id, position ASC;
 
 -- name: ListAnswersByQuestionID :many
 SELECT * FROM answers
 WHERE question_id = $1
-ORDER BY created_at ASC; -- Or some other defined order
+ORDER BY position ASC;
 
 -- name: UpdateAnswer :one
 UPDATE answers
@@ -40,4 +40,15 @@ WHERE question_id = $1;
 -- name: GetAnswerCorrectness :one
 SELECT is_correct
 FROM answers
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: UpdateAnswerContent :one
+-- Edits the text, correctness and explanation of an answer; numeric answers keep their value in step with the text
+UPDATE answers
+SET
+    answer = $2,
+    is_correct = $3,
+    explanation = $4,
+    numeric_value = $5
+WHERE id = $1
+RETURNING *;
@@ -1,25 +1,30 @@
 -- name: UpsertAttemptAnswer :one
-INSERT INTO attempt_answers (quiz_attempt_id, question_id, selected_answer_id, is_correct)
-VALUES ($1, $2, $3, $4)
+INSERT INTO attempt_answers (quiz_attempt_id, question_id, selected_answer_id, is_correct, response)
+VALUES ($1, $2, $3, $4, $5)
 ON CONFLICT (quiz_attempt_id, question_id)
 DO UPDATE SET
     selected_answer_id = EXCLUDED.selected_answer_id,
     is_correct = EXCLUDED.is_correct,
+    response = EXCLUDED.response,
     updated_at = NOW()
 RETURNING *;
 
 -- name: ListAttemptAnswersByAttempt :many
-SELECT *
-FROM attempt_answers
-WHERE quiz_attempt_id = $1
-ORDER BY created_at; -- Or order by question order if needed, requires joining questions
+SELECT aa.*
+FROM attempt_answers aa
+JOIN questions q ON q.id = aa.question_id
+WHERE aa.quiz_attempt_id = $1
+ORDER BY q.position;
 
 -- name: CalculateQuizAttemptScore :one
 SELECT COUNT(*)
 FROM attempt_answers
 WHERE quiz_attempt_id = $1 AND is_correct = TRUE;
 
--- name: GetAttemptAnswer :one
-SELECT *
-FROM attempt_answers
-WHERE quiz_attempt_id = $1 AND question_id = $2;
\ No newline at end of file
+-- name: InsertAttemptAnswer :one
+-- Saves the first answer to a question and never replaces it, as practice attempts reveal the
+-- answer key once a question is answered. Returns no row when the question was already answered.
+INSERT INTO attempt_answers (quiz_attempt_id, question_id, selected_answer_id, is_correct, response)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (quiz_attempt_id, question_id) DO NOTHING
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,23 @@
+-- name: GetGenerationCache :one
+SELECT * FROM generation_cache
+WHERE content_hash = $1 AND prompt_version = $2 AND options_hash = $3 AND generator = $4
+LIMIT 1;
+
+-- name: GetGenerationCacheByID :one
+SELECT * FROM generation_cache
+WHERE id = $1 LIMIT 1;
+
+-- name: UpsertGenerationCache :exec
+INSERT INTO generation_cache (
+    content_hash, prompt_version, options_hash, generator, response
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+ON CONFLICT (content_hash, prompt_version, options_hash, generator) DO UPDATE
+SET response = EXCLUDED.response,
+    created_at = NOW();
+
+-- name: RecordGenerationCacheHit :exec
+UPDATE generation_cache
+SET hits = hits + 1, last_hit_at = NOW()
+WHERE id = $1;
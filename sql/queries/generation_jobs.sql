@@ -0,0 +1,53 @@
+-- name: CreateGenerationJob :one
+INSERT INTO generation_jobs (
+    id, user_id, input, reserved_input_tokens, reserved_output_tokens, node_id
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: GetGenerationJob :one
+SELECT * FROM generation_jobs
+WHERE id = $1 LIMIT 1;
+
+-- name: ListQueuedGenerationJobsByNode :many
+-- The queued jobs whose inputs the node has, and those from before jobs had a node
+SELECT * FROM generation_jobs
+WHERE status = 'queued' AND (node_id = $1 OR node_id IS NULL)
+ORDER BY created_at ASC;
+
+-- name: StartGenerationJob :one
+-- Only claims queued jobs, so a job is never run by two workers
+UPDATE generation_jobs
+SET status = 'running', started_at = NOW(), heartbeat_at = NOW()
+WHERE id = $1 AND status = 'queued'
+RETURNING *;
+
+-- name: CompleteGenerationJob :one
+-- Only completes running jobs, a job another instance failed meanwhile stays failed
+UPDATE generation_jobs
+SET status = 'succeeded', quiz_id = $2, merged_questions = $3, error = NULL, finished_at = NOW()
+WHERE id = $1 AND status = 'running'
+RETURNING *;
+
+-- name: FailGenerationJob :one
+-- Jobs that already finished keep their result
+UPDATE generation_jobs
+SET status = 'failed', error = $2, finished_at = NOW()
+WHERE id = $1 AND status IN ('queued', 'running')
+RETURNING *;
+
+-- name: HeartbeatGenerationJob :execrows
+-- Affects no row once the job stopped running, e.g. because another instance failed it
+UPDATE generation_jobs
+SET heartbeat_at = NOW()
+WHERE id = $1 AND status = 'running';
+
+-- name: ClaimStaleGenerationJobs :many
+-- Takes over running jobs without a heartbeat for lease_seconds by renewing it,
+-- so only one instance fails each of them
+UPDATE generation_jobs
+SET heartbeat_at = NOW()
+WHERE status = 'running'
+    AND COALESCE(heartbeat_at, started_at, updated_at) < NOW() - sqlc.arg(lease_seconds)::int * INTERVAL '1 second'
+RETURNING *;
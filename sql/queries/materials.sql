@@ -1,8 +1,8 @@
 -- name: CreateMaterial :one
 INSERT INTO materials (
-    user_id, title, url
+    user_id, title, url, metadata, content_hash
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5
 )
 RETURNING *;
 
@@ -30,4 +30,38 @@ RETURNING *;
 
 -- name: DeleteMaterial :exec
 DELETE FROM materials
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: SetMaterialStorage :exec
+-- Records where the original of an uploaded file was stored
+UPDATE materials
+SET storage_key = $2, size_bytes = $3
+WHERE id = $1;
+
+-- name: ListMaterialsByUserIDPaginated :many
+-- Lists the materials of a user with the number of quizzes each was used for
+SELECT m.*, COUNT(qm.id) AS quiz_count
+FROM materials m
+LEFT JOIN quiz_materials qm ON qm.material_id = m.id
+WHERE m.user_id = $1
+GROUP BY m.id
+ORDER BY m.created_at DESC, m.id
+LIMIT $2 OFFSET $3;
+
+-- name: CountMaterialsByUserID :one
+SELECT COUNT(*) FROM materials
+WHERE user_id = $1;
+
+-- name: ListMaterialsByQuizID :many
+-- Lists the materials a quiz was generated from, in the order they were linked
+SELECT m.* FROM materials m
+JOIN quiz_materials qm ON qm.material_id = m.id
+WHERE qm.quiz_id = $1
+ORDER BY qm.created_at, m.title;
+
+-- name: GetMaterialByUserIDAndContentHash :one
+-- The earliest material of a user with the given content, to reuse for repeat uploads
+SELECT * FROM materials
+WHERE user_id = $1 AND content_hash = $2
+ORDER BY created_at, id
+LIMIT 1;
@@ -0,0 +1,19 @@
+-- name: CreateQuestionSource :one
+INSERT INTO question_sources (
+    question_id, material_id, page_start, page_end, timestamp_seconds, quote
+) VALUES (
+    $1, $2, $3, $4, $5, $6
+)
+RETURNING *;
+
+-- name: ListQuestionSourcesByQuizID :many
+-- Sources of all questions of a quiz with the title and URL of their material
+SELECT
+    qs.id, qs.question_id, qs.material_id, qs.page_start, qs.page_end, qs.timestamp_seconds, qs.quote, qs.created_at,
+    m.title AS material_title,
+    m.url AS material_url
+FROM question_sources qs
+JOIN questions q ON q.id = qs.question_id
+LEFT JOIN materials m ON m.id = qs.material_id
+WHERE q.quiz_id = $1
+ORDER BY q.position;
@@ -1,8 +1,8 @@
 -- name: CreateQuestion :one
 INSERT INTO questions (
-    quiz_id, topic_id, question
+    quiz_id, topic_id, question, question_type, position
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5
 )
 RETURNING *;
 
@@ -12,7 +12,7 @@ WHERE id = $1 LIMIT 1;
 
 -- name: ListQuestions :many
 SELECT * FROM questions
-ORDER BY created_at ASC; -- Or by position/order if added
+ORDER BY quiz_id, position ASC;
 
 -- name: ListQuestionsByQuizID :many
 SELECT
@@ -25,17 +25,17 @@ LEFT JOIN
 WHERE
     q.quiz_id = $1
 ORDER BY
-    q.created_at ASC;
+    q.position ASC;
 
 -- name: ListQuestionsByTopicID :many
 SELECT * FROM questions
 WHERE topic_id = $1
-ORDER BY created_at ASC;
+ORDER BY quiz_id, position ASC;
 
 -- name: ListQuestionsByQuizAndTopicID :many
 SELECT * FROM questions
 WHERE quiz_id = $1 AND topic_id = $2
-ORDER BY created_at ASC;
+ORDER BY position ASC;
 
 -- name: UpdateQuestion :one
 UPDATE questions
@@ -48,4 +48,22 @@ RETURNING *;
 
 -- name: DeleteQuestion :exec
 DELETE FROM questions
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: CountQuestionsByQuizID :one
+SELECT COUNT(*) FROM questions
+WHERE quiz_id = $1;
+
+-- name: NextQuestionPosition :one
+-- Position after the last question of a quiz, for questions added to it
+SELECT (COALESCE(MAX(position), 0) + 1)::INTEGER AS position
+FROM questions
+WHERE quiz_id = $1;
+
+-- name: SetQuestionPositions :execrows
+-- Puts the questions of a quiz in the given order in one statement, numbering them from 1.
+-- The unique positions are checked at the end of the statement, so positions can be swapped.
+UPDATE questions q
+SET position = ordered.position::INTEGER
+FROM unnest(@question_ids::UUID[]) WITH ORDINALITY AS ordered(id, position)
+WHERE q.id = ordered.id AND q.quiz_id = @quiz_id;
@@ -1,6 +1,6 @@
 -- name: CreateQuizAttempt :one
-INSERT INTO quiz_attempts (quiz_id, user_id, start_time)
-VALUES ($1, $2, NOW())
+INSERT INTO quiz_attempts (quiz_id, user_id, start_time, mode)
+VALUES ($1, $2, NOW(), $3)
 RETURNING *;
 
 -- name: GetQuizAttempt :one
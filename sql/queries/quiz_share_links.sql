@@ -0,0 +1,37 @@
+-- name: CreateQuizShareLink :one
+INSERT INTO quiz_share_links (
+    quiz_id, creator_id, token, expires_at, max_attempts
+) VALUES (
+    $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetQuizShareLinkByID :one
+SELECT * FROM quiz_share_links
+WHERE id = $1 LIMIT 1;
+
+-- name: GetQuizShareLinkByToken :one
+SELECT * FROM quiz_share_links
+WHERE token = $1 LIMIT 1;
+
+-- name: ListQuizShareLinksByQuizID :many
+SELECT * FROM quiz_share_links
+WHERE quiz_id = $1
+ORDER BY created_at DESC;
+
+-- name: RevokeQuizShareLink :one
+UPDATE quiz_share_links
+SET revoked_at = COALESCE(revoked_at, NOW())
+WHERE id = $1
+RETURNING *;
+
+-- name: ClaimQuizShareLinkAttempt :one
+-- Counts an attempt started through the link, only while the link is usable, so concurrent
+-- attempts can't go past max_attempts
+UPDATE quiz_share_links
+SET attempt_count = attempt_count + 1
+WHERE id = $1
+    AND revoked_at IS NULL
+    AND (expires_at IS NULL OR expires_at > NOW())
+    AND (max_attempts IS NULL OR attempt_count < max_attempts)
+RETURNING *;
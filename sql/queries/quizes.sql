@@ -1,8 +1,8 @@
 -- name: CreateQuiz :one
 INSERT INTO quizes (
-    creator_id, title, description, visibility
+    creator_id, title, description, visibility, generation_options
 ) VALUES (
-    $1, $2, $3, $4
+    $1, $2, $3, $4, $5
 )
 RETURNING *;
 
@@ -15,6 +15,7 @@ SELECT
     q.visibility,
     q.created_at,
     q.updated_at,
+    q.generation_options,
     u.name AS creator_name,
     u.picture AS creator_picture
 FROM
@@ -61,4 +62,10 @@ WHERE id = $1;
 -- name: ListQuizzesByCreator :many
 SELECT id, title, created_at, updated_at FROM quizes
 WHERE creator_id = $1
-ORDER BY created_at DESC;
\ No newline at end of file
+ORDER BY created_at DESC;
+
+-- name: TouchQuiz :exec
+-- Marks a quiz as updated when its questions or answers change
+UPDATE quizes
+SET updated_at = NOW()
+WHERE id = $1;
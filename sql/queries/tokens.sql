@@ -19,6 +19,16 @@ SELECT * FROM tokens
 WHERE user_id = $1
 ORDER BY created_at DESC;
 
+-- name: ListTokensByUserIDPaginated :many
+SELECT * FROM tokens
+WHERE user_id = $1
+ORDER BY created_at DESC, id
+LIMIT $2 OFFSET $3;
+
+-- name: CountTokensByUserID :one
+SELECT COUNT(*) FROM tokens
+WHERE user_id = $1;
+
 -- name: UpdateToken :one
 UPDATE tokens
 SET
@@ -33,8 +43,73 @@ DELETE FROM tokens
 WHERE id = $1;
 -- name: CreateTokenTransaction :one
 INSERT INTO tokens (
-    user_id, amount, type
+    user_id, amount, input_amount, output_amount, type
+) VALUES (
+    $1, $2, $3, $4, 'usage' -- Amounts should be negative for usage
+)
+RETURNING *;
+
+-- name: CreateTokenReservation :one
+INSERT INTO tokens (
+    user_id, amount, input_amount, output_amount, type, status, generation_job_id
+) VALUES (
+    $1, $2, $3, $4, 'reservation', 'pending', $5 -- Amounts are negative, like usage
+)
+RETURNING *;
+
+-- name: GetPendingTokenReservationByJobID :one
+-- Locks the reservation so it is settled or released only once
+SELECT * FROM tokens
+WHERE generation_job_id = $1 AND type = 'reservation' AND status = 'pending'
+LIMIT 1
+FOR UPDATE;
+
+-- name: CountTokensByGenerationJobID :one
+-- Jobs queued before reservations existed have no ledger rows
+SELECT COUNT(*) FROM tokens
+WHERE generation_job_id = $1;
+
+-- name: SettleTokenReservation :one
+-- The reservation becomes the usage record of the job
+UPDATE tokens
+SET type = 'usage', status = 'settled', amount = $2, input_amount = $3, output_amount = $4
+WHERE id = $1
+RETURNING *;
+
+-- name: ReleaseTokenReservation :one
+UPDATE tokens
+SET status = 'released'
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateTokenRefund :one
+INSERT INTO tokens (
+    user_id, amount, input_amount, output_amount, type, generation_job_id
+) VALUES (
+    $1, $2, $3, $4, 'refund', $5 -- Amounts are positive, they cancel out a usage record
+)
+RETURNING *;
+
+-- name: CreateTokenGrant :one
+INSERT INTO tokens (
+    user_id, amount, input_amount, output_amount, type
 ) VALUES (
-    $1, $2, 'usage' -- Amount should be negative for usage
+    $1, $2, $3, $4, $5 -- Amounts are positive, e.g. the signup gift
 )
 RETURNING *;
+
+-- name: ListTokenBalanceDrift :many
+-- Users whose balances differ from the sum of their ledger; released reservations don't count
+SELECT
+    u.id AS user_id,
+    u.email,
+    u.input_tokens_balance,
+    u.output_tokens_balance,
+    COALESCE(SUM(t.input_amount), 0)::int AS ledger_input_balance,
+    COALESCE(SUM(t.output_amount), 0)::int AS ledger_output_balance
+FROM users u
+LEFT JOIN tokens t ON t.user_id = u.id AND t.status <> 'released'
+GROUP BY u.id
+HAVING u.input_tokens_balance <> COALESCE(SUM(t.input_amount), 0)
+    OR u.output_tokens_balance <> COALESCE(SUM(t.output_amount), 0)
+ORDER BY u.email;
@@ -41,4 +41,31 @@ SET
     input_tokens_balance = input_tokens_balance - $2,
     output_tokens_balance = output_tokens_balance - $3
 WHERE id = $1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: ReserveUserTokens :one
+-- Only succeeds if both balances cover the reservation
+-- A negative balance, left by a job that used more than it reserved, fails every reservation,
+-- even an empty one, so the user can't generate until they get tokens again
+UPDATE users
+SET
+    input_tokens_balance = input_tokens_balance - $2,
+    output_tokens_balance = output_tokens_balance - $3
+WHERE id = $1 AND input_tokens_balance >= $2 AND output_tokens_balance >= $3
+RETURNING *;
+
+-- name: ReconcileUserTokenBalance :one
+-- Sets both balances to the sum of the user's ledger; released reservations don't count
+UPDATE users
+SET
+    input_tokens_balance = ledger.input_balance,
+    output_tokens_balance = ledger.output_balance
+FROM (
+    SELECT
+        COALESCE(SUM(input_amount), 0)::int AS input_balance,
+        COALESCE(SUM(output_amount), 0)::int AS output_balance
+    FROM tokens
+    WHERE user_id = $1 AND status <> 'released'
+) AS ledger
+WHERE users.id = $1
+RETURNING users.*;
@@ -0,0 +1,30 @@
+-- name: GetYoutubeTranscript :one
+-- A transcript fetched after the given time
+SELECT * FROM youtube_transcripts
+WHERE video_id = $1 AND language = $2 AND fetched_at > $3
+LIMIT 1;
+
+-- name: GetYoutubeTranscriptLanguages :one
+-- Caption languages of a video as of its latest transcript fetched after the given time
+SELECT languages FROM youtube_transcripts
+WHERE video_id = $1 AND fetched_at > $2
+ORDER BY fetched_at DESC
+LIMIT 1;
+
+-- name: UpsertYoutubeTranscript :exec
+INSERT INTO youtube_transcripts (
+    video_id, language, title, languages, segments, channel, duration_seconds, fetched_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, NOW()
+)
+ON CONFLICT (video_id, language) DO UPDATE
+SET title = EXCLUDED.title,
+    languages = EXCLUDED.languages,
+    segments = EXCLUDED.segments,
+    channel = EXCLUDED.channel,
+    duration_seconds = EXCLUDED.duration_seconds,
+    fetched_at = EXCLUDED.fetched_at;
+
+-- name: DeleteExpiredYoutubeTranscripts :execrows
+DELETE FROM youtube_transcripts
+WHERE fetched_at <= $1;